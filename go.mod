@@ -2,7 +2,11 @@ module github.com/ItsIgnacioPortal/hacker-scoper/src/hacker-scoper
 
 go 1.25.0
 
-require golang.org/x/net v0.40.0
+require (
+	golang.org/x/crypto v0.38.0
+	golang.org/x/net v0.40.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// githubAnnotation is a GitHub Actions workflow command that shows a message inline on the pull requests, like "::error file=targets.txt,line=3::...", for --format github.
+type githubAnnotation struct {
+	// "error" or "warning"
+	level string
+	// The targets file, relative to the root of the repository. Empty for the targets read from stdin.
+	file string
+	// The line of the target in the file. 0 if it's unknown.
+	line    int
+	title   string
+	message string
+}
+
+// String returns the annotation as a workflow command.
+func (annotation githubAnnotation) String() string {
+	var properties []string
+	if annotation.file != "" {
+		properties = append(properties, "file="+escapeAnnotationProperty(filepath.ToSlash(annotation.file)))
+		if annotation.line > 0 {
+			properties = append(properties, "line="+strconv.Itoa(annotation.line))
+		}
+	}
+	if annotation.title != "" {
+		properties = append(properties, "title="+escapeAnnotationProperty(annotation.title))
+	}
+
+	command := "::" + annotation.level
+	if len(properties) > 0 {
+		command += " " + strings.Join(properties, ",")
+	}
+	return command + "::" + escapeAnnotationData(annotation.message)
+}
+
+// escapeAnnotationData escapes the message of a workflow command, so that it can't end the command or start a new one.
+func escapeAnnotationData(data string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(data)
+}
+
+// escapeAnnotationProperty escapes the value of a property of a workflow command, which also can't contain the separators of the properties.
+func escapeAnnotationProperty(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(value)
+}
+
+// targetLineNumbers returns the line number of the first occurrence of every target of a targets file, so that the annotations can point at them.
+func targetLineNumbers(path string) (map[string]int, error) {
+	input, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	lineNumbers := map[string]int{}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), maxTargetLineLength)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if _, isSeen := lineNumbers[line]; isTargetLine(line) && !isSeen {
+			lineNumbers[line] = lineNumber
+		}
+	}
+	return lineNumbers, scanner.Err()
+}
+
+// targetAnnotation returns the annotation of a target that isn't in scope: an error for the out-of-scope targets, and a warning for the unsure and invalid ones.
+func targetAnnotation(res targetResult, file string, lineNumbers map[string]int) githubAnnotation {
+	annotation := githubAnnotation{file: file, line: lineNumbers[res.inputLine]}
+	switch {
+	case res.err != nil:
+		annotation.level, annotation.title = "warning", "Invalid target"
+		annotation.message = "Unable to parse \"" + res.targetStr + "\" as a target."
+	case res.isRelated:
+		annotation.level, annotation.title = "warning", "Related target"
+		annotation.message = "\"" + res.targetStr + "\" isn't matched by any in-scope or out-of-scope rule, but it shares its domain with the in-scope rule \"" + scopeToString(res.matchedScope) + "\"."
+	case res.isUnsure || res.isUnmatched:
+		annotation.level, annotation.title = "warning", "Unsure target"
+		annotation.message = "\"" + res.targetStr + "\" isn't matched by any in-scope or out-of-scope rule, so it might not be in scope."
+	default:
+		annotation.level, annotation.title = "error", "Out-of-scope target"
+		annotation.message = "\"" + res.targetStr + "\" is out of scope."
+	}
+	return annotation
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Matches an ASN target like "AS64500"
+var asnTargetRegex = regexp.MustCompile(`^(?i)AS(\d+)$`)
+
+// asnRange is a range of IP addresses announced by an ASN.
+type asnRange struct {
+	start netip.Addr
+	end   netip.Addr
+}
+
+// asnDataset holds the IP ranges of every ASN, for --asn-dataset.
+type asnDataset map[uint32][]asnRange
+
+// loadASNDataset reads an ASN dataset. Like the targets, it can be a local file, an http(s) URL, and gzip-compressed.
+// Two formats are supported, with whitespace-separated fields:
+// - "range_start range_end ASN ..." like the ip2asn datasets of iptoasn.com. ASN 0 means that the range isn't routed.
+// - "prefix ASN ..." like "192.0.2.0/24 64500".
+func loadASNDataset(path string) (asnDataset, error) {
+	input, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	dataset := asnDataset{}
+	scanner := bufio.NewScanner(input)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		var ipRange asnRange
+		var asnField string
+		if prefix, err := netip.ParsePrefix(fields[0]); err == nil && len(fields) >= 2 {
+			prefix = prefix.Masked()
+			ipRange = asnRange{start: prefix.Addr(), end: lastAddress(prefix)}
+			asnField = fields[1]
+		} else if len(fields) >= 3 {
+			start, startErr := netip.ParseAddr(fields[0])
+			end, endErr := netip.ParseAddr(fields[1])
+			if startErr != nil || endErr != nil || start.BitLen() != end.BitLen() || end.Less(start) {
+				return nil, errors.New("invalid IP range in line " + strconv.Itoa(lineNumber) + " of the ASN dataset")
+			}
+			ipRange = asnRange{start: start, end: end}
+			asnField = fields[2]
+		} else {
+			return nil, errors.New("invalid line " + strconv.Itoa(lineNumber) + " in the ASN dataset")
+		}
+
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(asnField), "AS"), 10, 32)
+		if err != nil {
+			return nil, errors.New("invalid ASN in line " + strconv.Itoa(lineNumber) + " of the ASN dataset")
+		}
+		if asn != 0 {
+			dataset[uint32(asn)] = append(dataset[uint32(asn)], ipRange)
+		}
+	}
+	return dataset, scanner.Err()
+}
+
+// prefixes returns the CIDR prefixes announced by an ASN, or nil if the ASN isn't in the dataset.
+func (dataset asnDataset) prefixes(asn uint32) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, ipRange := range dataset[asn] {
+		prefixes = append(prefixes, rangeToPrefixes(ipRange.start, ipRange.end)...)
+	}
+	return prefixes
+}
+
+// expandASNTargets replaces the ASN targets (like "AS64500") of a stream of lines with the CIDR prefixes of the ASN, so that every prefix gets its own verdict.
+func expandASNTargets(lines <-chan string, dataset asnDataset) <-chan string {
+	out := make(chan string, 128)
+
+	go func() {
+		defer close(out)
+		for line := range lines {
+			match := asnTargetRegex.FindStringSubmatch(strings.TrimSpace(line))
+			if match == nil {
+				out <- line
+				continue
+			}
+			asn, err := strconv.ParseUint(match[1], 10, 32)
+			prefixes := dataset.prefixes(uint32(asn))
+			if err != nil || len(prefixes) == 0 {
+				repeatedWarning(warnUnknownASN, "The ASN \""+line+"\" isn't in the ASN dataset. It has been ignored.")
+				continue
+			}
+			for _, prefix := range prefixes {
+				out <- prefix.String()
+			}
+		}
+	}()
+
+	return out
+}
+
+// rangeToPrefixes splits a range of IP addresses into the smallest list of CIDR prefixes that covers it exactly.
+func rangeToPrefixes(start netip.Addr, end netip.Addr) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for {
+		// The biggest prefix that starts at the start address and doesn't go past the end address
+		bits := start.BitLen()
+		for bits > 0 {
+			candidate := netip.PrefixFrom(start, bits-1)
+			if candidate.Masked().Addr() != start || end.Less(lastAddress(candidate)) {
+				break
+			}
+			bits--
+		}
+		prefix := netip.PrefixFrom(start, bits)
+		prefixes = append(prefixes, prefix)
+
+		last := lastAddress(prefix)
+		if !last.Less(end) {
+			return prefixes
+		}
+		start = last.Next()
+	}
+}
+
+// lastAddress returns the last IP address of a prefix.
+func lastAddress(prefix netip.Prefix) netip.Addr {
+	address := prefix.Masked().Addr().AsSlice()
+	for i := range address {
+		// The amount of bits of this byte that are part of the network
+		networkBits := min(max(prefix.Bits()-i*8, 0), 8)
+		address[i] |= byte(0xff >> networkBits)
+	}
+	last, _ := netip.AddrFromSlice(address)
+	return last
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"time"
+)
+
+// asyncWriter writes to an io.Writer from a dedicated goroutine, so that slow disks don't stall the matching pipeline.
+// Write errors are reported by the next call to Flush or Close.
+type asyncWriter struct {
+	requests chan asyncWriteRequest
+	done     chan struct{}
+}
+
+// asyncWriteRequest is either some data to write, or a request to flush (when flushed isn't nil).
+type asyncWriteRequest struct {
+	data    string
+	flushed chan error
+}
+
+// newAsyncWriter returns an asyncWriter that buffers its writes. On top of the explicit calls to Flush, the buffer is flushed every flushEvery writes and every flushInterval, if they aren't 0.
+// Otherwise, the writes only reach w when the buffer fills.
+func newAsyncWriter(w io.Writer, flushEvery int, flushInterval time.Duration) *asyncWriter {
+	aw := &asyncWriter{
+		requests: make(chan asyncWriteRequest, 1024),
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(aw.done)
+		buffered := bufio.NewWriter(w)
+		// Once an error happens, everything else is discarded. The error is kept to be returned by Flush.
+		var err error
+		pendingWrites := 0
+
+		// A nil channel never receives, so the ticker is only used with a flushInterval
+		var ticks <-chan time.Time
+		if flushInterval > 0 {
+			ticker := time.NewTicker(flushInterval)
+			defer ticker.Stop()
+			ticks = ticker.C
+		}
+
+		for {
+			select {
+			case req, ok := <-aw.requests:
+				if !ok {
+					return
+				}
+				if req.flushed != nil {
+					if err == nil {
+						err = buffered.Flush()
+					}
+					pendingWrites = 0
+					req.flushed <- err
+					continue
+				}
+				if err == nil {
+					_, err = buffered.WriteString(req.data)
+				}
+				pendingWrites++
+				if flushEvery > 0 && pendingWrites >= flushEvery && err == nil {
+					err = buffered.Flush()
+					pendingWrites = 0
+				}
+			case <-ticks:
+				if pendingWrites > 0 && err == nil {
+					err = buffered.Flush()
+					pendingWrites = 0
+				}
+			}
+		}
+	}()
+
+	return aw
+}
+
+// WriteString queues s to be written. It never blocks on disk I/O, unless the queue is full.
+func (aw *asyncWriter) WriteString(s string) (int, error) {
+	aw.requests <- asyncWriteRequest{data: s}
+	return len(s), nil
+}
+
+// Flush waits until everything queued so far has been written, and returns the first error found while writing, if any.
+func (aw *asyncWriter) Flush() error {
+	flushed := make(chan error)
+	aw.requests <- asyncWriteRequest{flushed: flushed}
+	return <-flushed
+}
+
+// Close flushes the writer and stops its goroutine. The asyncWriter can't be used after calling Close.
+func (aw *asyncWriter) Close() error {
+	err := aw.Flush()
+	close(aw.requests)
+	<-aw.done
+	return err
+}
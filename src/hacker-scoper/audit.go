@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// programIssue is a suspicious scope entry of a firebounty program, found by the audit-program subcommand.
+type programIssue struct {
+	// "package-name", "binary", "invalid-tld", "path", "duplicate", "in-and-out-of-scope" or "invalid"
+	Kind string `json:"kind"`
+	// "in_scope" or "out_of_scope"
+	List        string `json:"list"`
+	Scope       string `json:"scope"`
+	Description string `json:"description"`
+}
+
+// programAudit is the report of the audit-program subcommand for a single program.
+type programAudit struct {
+	Program       string         `json:"program"`
+	Slug          string         `json:"slug"`
+	FirebountyURL string         `json:"firebounty_url"`
+	Issues        []programIssue `json:"issues"`
+}
+
+// auditProgramCommand reports every suspicious scope entry of a company, in a report that can be forwarded to the program.
+func auditProgramCommand(ctx context.Context, args []string) {
+	var company string
+	var format string
+	var privateTLDsAreEnabled bool
+	var databaseIsUpdating bool
+	var tmpFile *os.File
+
+	flags := newSubcommandFlagSet("audit-program")
+	flags.StringVar(&company, "c", "", "Specify the company name to lookup.")
+	flags.StringVar(&company, "company", "", "Specify the company name to lookup.")
+	flags.StringVar(&format, "format", "text", "Output format. Either \"text\" or \"json\".")
+	flags.BoolVar(&privateTLDsAreEnabled, "enable-private-tlds", false, "Don't report the scope domains with private TLDs.")
+	flags.Parse(args) // #nosec G104 -- The FlagSet exits on errors.
+	setupClientTLS()
+
+	if company == "" {
+		crash(errInvalidArguments, "The audit-program subcommand requires a company. Use -c company", errors.New("missing company"))
+	}
+	if format != "text" && format != "json" {
+		crash(errInvalidArguments, "Invalid --format selected. Valid formats are \"text\" and \"json\"", errors.New("invalid format "+format))
+	}
+	if format == "json" {
+		chainMode = true
+	}
+
+	handleInterrupts(&databaseIsUpdating, &tmpFile)
+	setupFirebountyJSONPath()
+	updateFirebountyJSONIfNeeded(ctx, &databaseIsUpdating, &tmpFile)
+
+	for i, companyIndex := range selectCompanies(company) {
+		prog, err := loadProgramByIndex(firebountyJSONPath, companyIndex)
+		if err != nil {
+			crash(errDatabase, "Couldn't load full program data", err)
+		}
+		audit := auditProgram(prog, privateTLDsAreEnabled)
+
+		if format == "json" {
+			// Every program is printed in a single line, so that combined companies are printed as JSON lines
+			encoded, err := json.Marshal(audit)
+			if err != nil {
+				crash(errWriteOutput, "Couldn't encode the audit report", err)
+			}
+			fmt.Println(string(encoded))
+		} else {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Print(formatProgramAudit(audit))
+		}
+	}
+}
+
+// auditProgram finds the suspicious "web_application" scope entries of a program.
+func auditProgram(prog *Program, privateTLDsAreEnabled bool) programAudit {
+	audit := programAudit{Program: prog.Name, Slug: prog.Slug, FirebountyURL: prog.Firebounty_url, Issues: []programIssue{}}
+
+	inscopes := map[string]bool{}
+	for _, scope := range prog.Scopes.In_scopes {
+		if scope.Scope_type == "web_application" {
+			inscopes[normalizeAuditedScope(scope.Scope)] = true
+		}
+	}
+
+	for _, list := range []struct {
+		name   string
+		scopes []Scope
+	}{{"in_scope", prog.Scopes.In_scopes}, {"out_of_scope", prog.Scopes.Out_of_scopes}} {
+		seen := map[string]bool{}
+		for _, scope := range list.scopes {
+			if scope.Scope_type != "web_application" || strings.TrimSpace(scope.Scope) == "" {
+				continue
+			}
+
+			normalized := normalizeAuditedScope(scope.Scope)
+			if seen[normalized] {
+				audit.Issues = append(audit.Issues, programIssue{Kind: "duplicate", List: list.name, Scope: scope.Scope, Description: "This entry is listed more than once."})
+				continue
+			}
+			seen[normalized] = true
+			if list.name == "out_of_scope" && inscopes[normalized] {
+				audit.Issues = append(audit.Issues, programIssue{Kind: "in-and-out-of-scope", List: list.name, Scope: scope.Scope, Description: "This entry is listed both as in scope and as out of scope."})
+			}
+
+			if kind, description := auditScopeEntry(strings.TrimSpace(scope.Scope), privateTLDsAreEnabled); kind != "" {
+				audit.Issues = append(audit.Issues, programIssue{Kind: kind, List: list.name, Scope: scope.Scope, Description: description})
+			}
+		}
+	}
+	return audit
+}
+
+// normalizeAuditedScope returns the form of a scope entry used to find duplicates.
+func normalizeAuditedScope(scope string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(scope)), "/")
+}
+
+// auditScopeEntry runs the same heuristics as parseLine on a single "web_application" scope entry, and returns the kind and description of its problem, if any.
+func auditScopeEntry(scope string, privateTLDsAreEnabled bool) (kind string, description string) {
+	if binary := parseBinaryScope(scope); binary != nil {
+		if binary.kind == "hash" {
+			return "binary", "This looks like a file hash, but it's listed as a web application. It should probably be an executable or other scope."
+		}
+		return "binary", "This looks like a desktop binary, but it's listed as a web application. It should probably be an executable scope."
+	}
+
+	// Regexes and IP ranges don't have hostnames to check
+	_, _, cidrErr := net.ParseCIDR(scope)
+	isRegex := strings.HasPrefix(scope, "^") && strings.HasSuffix(scope, "$")
+
+	// The "?" wildcards would be parsed as the start of the query string
+	if !isRegex && cidrErr != nil && !hasSingleCharWildcard(scope) {
+		parsedURL, err := url.Parse(scope)
+		if err != nil || parsedURL.Host == "" {
+			parsedURL, err = url.Parse("https://" + scope)
+		}
+		if err == nil && parsedURL.Host != "" {
+			hostname := strings.ToLower(strings.TrimPrefix(parsedURL.Hostname(), "*."))
+			hasPublicTLD := true
+			if !strings.Contains(hostname, "*") && net.ParseIP(hostname) == nil {
+				eTLD, icann := publicsuffix.PublicSuffix(hostname)
+				hasPublicTLD = icann || strings.IndexByte(eTLD, '.') >= 0
+			}
+
+			if isAndroidPackageName(scope) {
+				return "package-name", "This looks like an Android package name, but it's listed as a web application. It should probably be an android_application scope."
+			}
+			if parsedURL.Path != "" && parsedURL.Path != "/" && !strings.Contains(scope, "*") {
+				return "path", "This entry contains the path \"" + parsedURL.Path + "\". Scopes are matched by hostname, so the path is ignored by most tools."
+			}
+			if !hasPublicTLD && !privateTLDsAreEnabled {
+				return "invalid-tld", "The domain \"" + hostname + "\" doesn't have a public Top Level Domain (TLD)."
+			}
+		}
+	}
+
+	// Anything else that hacker-scoper can't use
+	previousHideWarnings := hideWarnings
+	hideWarnings = true
+	_, err := parseScope(scope, true)
+	hideWarnings = previousHideWarnings
+	if err != nil {
+		return "invalid", "This entry isn't a valid hostname, wildcard, URL, IP address, CIDR range or regex."
+	}
+	return "", ""
+}
+
+// isAndroidPackageName reports whether a "web_application" scope looks like an Android package name, like "com.example.app".
+// Package names start with a TLD. Like in parseLine, "com." and "org." are always suspicious, and any other TLD is suspicious if the scope doesn't end with a public TLD.
+func isAndroidPackageName(scope string) bool {
+	scope = strings.ToLower(strings.TrimSpace(scope))
+	if strings.ContainsAny(scope, "/:*^$ ") {
+		return false
+	}
+	if strings.HasPrefix(scope, "com.") || strings.HasPrefix(scope, "org.") {
+		return true
+	}
+	firstLabel, _, hasDot := strings.Cut(scope, ".")
+	if !hasDot {
+		return false
+	}
+	_, firstLabelIsTLD := publicsuffix.PublicSuffix(firstLabel)
+	eTLD, icann := publicsuffix.PublicSuffix(scope)
+	return firstLabelIsTLD && !(icann || strings.IndexByte(eTLD, '.') >= 0)
+}
+
+// reclassifyMobileScopes separates the Android package names from the rest of the scopes, for --reclassify-mobile.
+func reclassifyMobileScopes(lines []string) (webLines []string, mobileLines []string) {
+	for _, line := range lines {
+		if isAndroidPackageName(line) {
+			mobileLines = append(mobileLines, line)
+		} else {
+			webLines = append(webLines, line)
+		}
+	}
+	return webLines, mobileLines
+}
+
+// formatProgramAudit describes the issues of a program in plain text, so that the report can be forwarded to the program.
+func formatProgramAudit(audit programAudit) string {
+	var builder strings.Builder
+	builder.WriteString("Scope audit of " + audit.Program)
+	if audit.FirebountyURL != "" {
+		builder.WriteString(" (" + audit.FirebountyURL + ")")
+	}
+	builder.WriteString("\n")
+
+	if len(audit.Issues) == 0 {
+		builder.WriteString("No suspicious scope entries were found.\n")
+		return builder.String()
+	}
+	builder.WriteString(strconv.Itoa(len(audit.Issues)) + " suspicious scope entries were found:\n")
+	for _, issue := range audit.Issues {
+		list := "In scope"
+		if issue.List == "out_of_scope" {
+			list = "Out of scope"
+		}
+		builder.WriteString("\n- " + list + ": " + strconv.Quote(issue.Scope) + " (" + issue.Kind + ")\n")
+		builder.WriteString("  " + issue.Description + "\n")
+	}
+	return builder.String()
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The version of the synthetic workload of the bench subcommand. It's increased whenever the workload changes, since the results of different workloads can't be compared.
+const benchWorkloadVersion = 1
+
+// benchResult is the outcome of a bench run, and the format of the baseline files.
+type benchResult struct {
+	Workload         int     `json:"workload"`
+	Version          string  `json:"version"`
+	GoVersion        string  `json:"go_version"`
+	Platform         string  `json:"platform"`
+	Scopes           int     `json:"scopes"`
+	Targets          int     `json:"targets"`
+	Rounds           int     `json:"rounds"`
+	TargetsPerSecond float64 `json:"targets_per_second"`
+	AllocsPerTarget  float64 `json:"allocs_per_target"`
+	BytesPerTarget   float64 `json:"bytes_per_target"`
+}
+
+// benchMetric is a number of a bench run compared with the same number of the baseline.
+type benchMetric struct {
+	name     string
+	unit     string
+	current  float64
+	baseline float64
+	// Whether a higher number is better, like for the throughput
+	higherIsBetter bool
+}
+
+// change returns how much the metric changed since the baseline, in percent. Positive changes are increases.
+func (metric benchMetric) change() float64 {
+	if metric.baseline == 0 {
+		if metric.current == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (metric.current - metric.baseline) / metric.baseline * 100
+}
+
+// regressed reports whether the metric got worse than the baseline by more than the threshold, in percent.
+func (metric benchMetric) regressed(threshold float64) bool {
+	if metric.higherIsBetter {
+		return metric.change() < -threshold
+	}
+	return metric.change() > threshold
+}
+
+// benchCommand measures the throughput and the allocations of the matching on a synthetic workload, and compares them with a baseline,
+// so that maintainers can catch performance regressions, and users can validate their builds on their own hardware.
+func benchCommand(args []string) {
+	var targetsAmount int
+	var rounds int
+	var baselinePath string
+	var saveBaselinePath string
+	var rawThreshold string
+	var format string
+
+	flags := newSubcommandFlagSet("bench")
+	flags.IntVar(&targetsAmount, "targets", 20000, "How many targets are matched in every round.")
+	flags.IntVar(&rounds, "rounds", 5, "How many times the targets are matched. The best round is reported.")
+	flags.StringVar(&baselinePath, "baseline", "", "Path to a baseline saved by --save-baseline, to compare the results with.")
+	flags.StringVar(&saveBaselinePath, "save-baseline", "", "Save the results as a baseline.")
+	flags.StringVar(&rawThreshold, "fail-threshold", "10%", "How much worse than the baseline the results can be before the bench fails, like \"10%\".")
+	flags.StringVar(&format, "format", "text", "Output format. Either \"text\" or \"json\".")
+	flags.Parse(args) // #nosec G104 -- The FlagSet exits on errors.
+
+	if flags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: hacker-scoper bench [--baseline /path/to/baseline.json] [--fail-threshold 10%] [--save-baseline /path/to/baseline.json] [--targets INT] [--rounds INT] [--format text|json]")
+		// Exit code 2 = command line syntax error
+		os.Exit(2)
+	}
+	if format != "text" && format != "json" {
+		crash(errInvalidArguments, "Invalid --format selected. Valid formats are \"text\" and \"json\"", errors.New("invalid format "+format))
+	}
+	if targetsAmount < 1 || rounds < 1 {
+		crash(errInvalidArguments, "Invalid --targets or --rounds selected", errors.New("both must be at least 1"))
+	}
+	threshold, err := parseBenchThreshold(rawThreshold)
+	if err != nil {
+		crash(errInvalidArguments, "Invalid --fail-threshold selected", err)
+	}
+
+	var baseline *benchResult
+	if baselinePath != "" {
+		baseline, err = readBenchBaseline(baselinePath)
+		if err != nil {
+			crash(errReadInput, "Unable to read the baseline \""+baselinePath+"\"", err)
+		}
+		if baseline.Workload != benchWorkloadVersion {
+			crash(errInvalidArguments, "The baseline \""+baselinePath+"\" was saved by a version of hacker-scoper with a different bench workload. Save a new baseline with --save-baseline", errors.New("workload "+strconv.Itoa(baseline.Workload)+" instead of "+strconv.Itoa(benchWorkloadVersion)))
+		}
+		// The results are only comparable with the same amount of targets, so the amount of the baseline is used unless another one is given
+		targetsAreSet := false
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "targets" {
+				targetsAreSet = true
+			}
+		})
+		if !targetsAreSet {
+			targetsAmount = baseline.Targets
+		} else if targetsAmount != baseline.Targets {
+			crash(errInvalidArguments, "The baseline \""+baselinePath+"\" was measured with "+strconv.Itoa(baseline.Targets)+" targets", errors.New("--targets doesn't match the baseline"))
+		}
+	}
+
+	if format == "text" && !chainMode {
+		fmt.Println("[+] Matching " + strconv.Itoa(targetsAmount) + " targets, " + strconv.Itoa(rounds) + " times...")
+	}
+	result, err := runBench(targetsAmount, rounds)
+	if err != nil {
+		crash(errInvalidArguments, "Unable to prepare the bench workload", err)
+	}
+
+	if saveBaselinePath != "" {
+		encoded, err := json.MarshalIndent(result, "", "  ")
+		if err == nil {
+			err = writeFileAtomically(saveBaselinePath, append(encoded, '\n'))
+		}
+		if err != nil {
+			crash(errWriteOutput, "Unable to save the baseline to \""+saveBaselinePath+"\"", err)
+		}
+	}
+
+	metrics := []benchMetric{
+		{name: "Throughput", unit: "targets/s", current: result.TargetsPerSecond, higherIsBetter: true},
+		{name: "Allocations", unit: "allocs/target", current: result.AllocsPerTarget},
+		{name: "Memory", unit: "B/target", current: result.BytesPerTarget},
+	}
+	if baseline != nil {
+		metrics[0].baseline = baseline.TargetsPerSecond
+		metrics[1].baseline = baseline.AllocsPerTarget
+		metrics[2].baseline = baseline.BytesPerTarget
+	}
+
+	if format == "json" {
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			crash(errWriteOutput, "Unable to encode the results as JSON", err)
+		}
+		fmt.Println(string(encoded))
+	} else {
+		for _, metric := range metrics {
+			line := fmt.Sprintf("%-12s %.1f %s", metric.name+":", metric.current, metric.unit)
+			if baseline != nil {
+				line += fmt.Sprintf(" (baseline %.1f, %+.1f%%)", metric.baseline, metric.change())
+			}
+			fmt.Println(line)
+		}
+		if saveBaselinePath != "" && !chainMode {
+			fmt.Println("[+] Saved the baseline to \"" + saveBaselinePath + "\".")
+		}
+	}
+
+	if baseline == nil {
+		return
+	}
+	var regressions []string
+	for _, metric := range metrics {
+		if metric.regressed(threshold) {
+			regressions = append(regressions, fmt.Sprintf("%s %+.1f%%", strings.ToLower(metric.name), metric.change()))
+		}
+	}
+	if len(regressions) > 0 {
+		fmt.Fprintln(os.Stderr, "[-] Regression against the baseline \""+baselinePath+"\" (more than "+strconv.FormatFloat(threshold, 'f', -1, 64)+"% worse): "+strings.Join(regressions, ", ")+".")
+		os.Exit(1)
+	}
+	if format == "text" && !chainMode {
+		fmt.Println("[+] No regression against the baseline.")
+	}
+}
+
+// parseBenchThreshold parses a --fail-threshold, like "10%" or "10", into a percentage.
+func parseBenchThreshold(rawThreshold string) (float64, error) {
+	threshold, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(rawThreshold), "%"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if threshold < 0 || math.IsNaN(threshold) || math.IsInf(threshold, 0) {
+		return 0, errors.New("the threshold must be a positive percentage, like \"10%\"")
+	}
+	return threshold, nil
+}
+
+// readBenchBaseline reads a baseline saved by --save-baseline.
+func readBenchBaseline(path string) (*benchResult, error) {
+	input, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	var baseline benchResult
+	err = json.NewDecoder(input).Decode(&baseline)
+	if err != nil {
+		return nil, err
+	}
+	return &baseline, nil
+}
+
+// runBench parses and matches the targets of the workload against its scopes, once per round. The throughput of the fastest round is reported, together with the allocations of the leanest one, since the slower rounds are mostly noise from the rest of the machine.
+func runBench(targetsAmount int, rounds int) (*benchResult, error) {
+	inscopeLines, noscopeLines, targetLines := benchWorkload(targetsAmount)
+	var inscopes, noscopes []ParsedScope
+	for _, lines := range []struct {
+		lines  []string
+		parsed *[]ParsedScope
+	}{{inscopeLines, &inscopes}, {noscopeLines, &noscopes}} {
+		for _, line := range lines.lines {
+			scope, err := ParseScope(line)
+			if err != nil {
+				return nil, errors.New("unable to parse the scope \"" + line + "\": " + err.Error())
+			}
+			*lines.parsed = append(*lines.parsed, scope)
+		}
+	}
+	matcher := NewMatcher(inscopes, noscopes, ExplicitLevelSubdomains)
+
+	result := &benchResult{
+		Workload:        benchWorkloadVersion,
+		Version:         currentVersion,
+		GoVersion:       runtime.Version(),
+		Platform:        runtime.GOOS + "/" + runtime.GOARCH,
+		Scopes:          len(inscopes) + len(noscopes),
+		Targets:         targetsAmount,
+		Rounds:          rounds,
+		AllocsPerTarget: math.Inf(1),
+		BytesPerTarget:  math.Inf(1),
+	}
+	var before, after runtime.MemStats
+	for round := 0; round < rounds; round++ {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		for _, line := range targetLines {
+			target, err := ParseTarget(line)
+			if err != nil {
+				return nil, errors.New("unable to parse the target \"" + line + "\": " + err.Error())
+			}
+			matcher.Match(target)
+		}
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+
+		result.TargetsPerSecond = math.Max(result.TargetsPerSecond, float64(targetsAmount)/elapsed.Seconds())
+		result.AllocsPerTarget = math.Min(result.AllocsPerTarget, float64(after.Mallocs-before.Mallocs)/float64(targetsAmount))
+		result.BytesPerTarget = math.Min(result.BytesPerTarget, float64(after.TotalAlloc-before.TotalAlloc)/float64(targetsAmount))
+	}
+	return result, nil
+}
+
+// benchWorkload returns the scopes and targets of the bench. They're always the same for the same amount of targets, so that the runs can be compared.
+// The scopes mix every common kind of scope, and the targets mix in-scope, out-of-scope and unrelated URLs, hostnames, IP addresses and email addresses.
+func benchWorkload(targetsAmount int) (inscopeLines []string, noscopeLines []string, targetLines []string) {
+	const companies = 100
+	for i := 0; i < companies; i++ {
+		company := "company" + strconv.Itoa(i)
+		inscopeLines = append(inscopeLines, company+".com", "*."+company+".net", "https://app."+company+".io/")
+		noscopeLines = append(noscopeLines, "admin."+company+".com", "legacy."+company+".net")
+	}
+	for i := 0; i < companies/10; i++ {
+		inscopeLines = append(inscopeLines, "10."+strconv.Itoa(i)+".0.0/16", `^https://api\.regex`+strconv.Itoa(i)+`\.com/v[0-9]+/.*$`)
+		noscopeLines = append(noscopeLines, "10."+strconv.Itoa(i)+".1.0/24")
+	}
+
+	for i := 0; i < targetsAmount; i++ {
+		company := "company" + strconv.Itoa(i%companies)
+		number := strconv.Itoa(i)
+		var target string
+		switch i % 10 {
+		case 0:
+			target = "https://www." + company + ".com/login?id=" + number
+		case 1:
+			target = "host" + number + "." + company + ".net"
+		case 2:
+			target = "https://admin." + company + ".com/"
+		case 3:
+			target = "http://legacy." + company + ".net:8080/index.php"
+		case 4:
+			target = "https://app." + company + ".io/dashboard"
+		case 5:
+			target = "10." + strconv.Itoa(i%(companies/10)) + "." + strconv.Itoa(i%4) + "." + strconv.Itoa(i%250+1)
+		case 6:
+			target = "https://api.regex" + strconv.Itoa(i%(companies/10)) + ".com/v2/users/" + number
+		case 7:
+			target = "user" + number + "@" + company + ".com"
+		case 8:
+			target = "https://unrelated" + number + ".org/"
+		default:
+			target = "192.0.2." + strconv.Itoa(i%250+1)
+		}
+		targetLines = append(targetLines, target)
+	}
+	return inscopeLines, noscopeLines, targetLines
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The prefix of the scopes that are free-form names of desktop binaries, like "binary:Example Desktop Client for Windows"
+const binaryPrefix = "binary:"
+
+// File hashes, in hex, optionally with the name of the algorithm, like "sha256:9f86d08..."
+var fileHashRegex = regexp.MustCompile(`^(?i:(md5|sha1|sha256|sha512):)?([0-9a-fA-F]{32}|[0-9a-fA-F]{40}|[0-9a-fA-F]{64}|[0-9a-fA-F]{128})$`)
+
+// Executable file names, like "ExampleSetup-1.2.3.exe". None of these extensions are TLDs, so they can't be hostnames.
+var executableFilenameRegex = regexp.MustCompile(`(?i)^[^/\\:*?"<>|]+\.(exe|msi|msix|dmg|pkg|deb|rpm|appimage|snap|jar|dll|dylib|apk|aab|ipa)$`)
+
+// BinaryScope is a scope entry that isn't a network identifier, like a desktop binary or a file hash.
+// Binary scopes are passed through: they never match any target, but they're kept with the rest of the scopes, so that they aren't reported as parse errors and the exports can mention them.
+type BinaryScope struct {
+	// "hash" or "executable"
+	kind string
+	// The scope line, with lowercased hashes
+	raw string
+}
+
+// String returns the scope line of the binary, like "ExampleSetup.exe" or "sha256:9f86d08...".
+func (binary *BinaryScope) String() string {
+	return binary.raw
+}
+
+// parseBinaryScope parses the scopes that are file hashes, executable file names, or "binary:" names. It returns nil for every other scope.
+func parseBinaryScope(line string) *BinaryScope {
+	if name, isBinary := strings.CutPrefix(line, binaryPrefix); isBinary {
+		if strings.TrimSpace(name) == "" {
+			return nil
+		}
+		return &BinaryScope{kind: "executable", raw: line}
+	}
+	if fileHashRegex.MatchString(line) {
+		return &BinaryScope{kind: "hash", raw: strings.ToLower(line)}
+	}
+	if executableFilenameRegex.MatchString(line) {
+		return &BinaryScope{kind: "executable", raw: line}
+	}
+	return nil
+}
+
+// binaryScopeLines returns the scope lines of the binary scopes, for the exports that can only mention them.
+func binaryScopeLines(scopes []interface{}) []string {
+	var lines []string
+	for _, scope := range scopes {
+		if binary, isBinary := scope.(*BinaryScope); isBinary {
+			lines = append(lines, binary.String())
+		}
+	}
+	return lines
+}
@@ -0,0 +1,10 @@
+//go:build darwin
+
+package main
+
+import "os/exec"
+
+// browserCommand returns the command that opens a URL in the default browser.
+func browserCommand(pageURL string) *exec.Cmd {
+	return exec.Command("open", pageURL) // #nosec G204 -- Only http(s) URLs are opened.
+}
@@ -0,0 +1,10 @@
+//go:build !windows && !darwin
+
+package main
+
+import "os/exec"
+
+// browserCommand returns the command that opens a URL in the default browser. Linux and the BSDs use xdg-open, from xdg-utils.
+func browserCommand(pageURL string) *exec.Cmd {
+	return exec.Command("xdg-open", pageURL) // #nosec G204 -- Only http(s) URLs are opened.
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import "os/exec"
+
+// browserCommand returns the command that opens a URL in the default browser. "start" isn't used, since it's a builtin of cmd.exe that interprets the "&" of the URLs.
+func browserCommand(pageURL string) *exec.Cmd {
+	return exec.Command("rundll32", "url.dll,FileProtocolHandler", pageURL) // #nosec G204 -- Only http(s) URLs are opened.
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// bulkExportCommand exports the union of the in-scope domains and wildcards of every program with a tag, like every HackerOne program, into a single deduplicated list.
+func bulkExportCommand(ctx context.Context, args []string) {
+	var tag string
+	var outputPath string
+	var privateTLDsAreEnabled bool
+	var databaseIsUpdating bool
+	var tmpFile *os.File
+
+	flags := newSubcommandFlagSet("bulk-export")
+	flags.StringVar(&tag, "tag", "", "Export the scopes of the programs with this tag/platform, like \"hackerone\".")
+	flags.StringVar(&outputPath, "o", "", "Save the scopes to a file instead of printing them.")
+	flags.StringVar(&outputPath, "output", "", "Save the scopes to a file instead of printing them.")
+	flags.BoolVar(&privateTLDsAreEnabled, "enable-private-tlds", false, "Enable the use of company scope domains with private TLDs.")
+	flags.Parse(args) // #nosec G104 -- The FlagSet exits on errors.
+	setupClientTLS()
+
+	if tag == "" {
+		fmt.Fprintln(os.Stderr, "Usage: hacker-scoper bulk-export --tag TAG [-o /path/to/scopes.txt] [--enable-private-tlds]")
+		// Exit code 2 = command line syntax error
+		os.Exit(2)
+	}
+
+	handleInterrupts(&databaseIsUpdating, &tmpFile)
+	setupFirebountyJSONPath()
+	updateFirebountyJSONIfNeeded(ctx, &databaseIsUpdating, &tmpFile)
+
+	scopes, programCount, err := collectTagScopes(firebountyJSONPath, tag, privateTLDsAreEnabled)
+	if err != nil {
+		crash(errDatabase, "Couldn't read the firebounty database", err)
+	}
+	if programCount == 0 {
+		crash(errNoScopes, "None of the programs of the database have the tag \""+tag+"\"", errors.New("unknown tag "+tag))
+	}
+
+	if outputPath == "" {
+		for _, scope := range scopes {
+			fmt.Println(scope)
+		}
+		return
+	}
+	var data []byte
+	if len(scopes) > 0 {
+		data = []byte(strings.Join(scopes, "\n") + "\n")
+	}
+	err = writeFileAtomically(outputPath, data)
+	if err != nil {
+		crash(errWriteOutput, "Unable to write the scopes to \""+outputPath+"\"", err)
+	}
+	if !chainMode {
+		fmt.Println("[+] Exported " + strconv.Itoa(len(scopes)) + " scopes of " + strconv.Itoa(programCount) + " \"" + tag + "\" programs to \"" + outputPath + "\".")
+	}
+}
+
+// collectTagScopes returns the sorted and deduplicated in-scope domains and wildcards of every program with the tag (case-insensitive), and how many programs have it.
+// The other kinds of scopes, like IP ranges and regexes, aren't exported. The scopes that don't parse are skipped.
+func collectTagScopes(jsonPath string, tag string, privateTLDsAreEnabled bool) ([]string, int, error) {
+	// Thousands of scopes are parsed, and the warnings about them would drown the output
+	previousHideWarnings, previousHideMisconfigWarnings := hideWarnings, hideMisconfigWarnings
+	hideWarnings, hideMisconfigWarnings = true, true
+	defer func() { hideWarnings, hideMisconfigWarnings = previousHideWarnings, previousHideMisconfigWarnings }()
+
+	var scopes []string
+	programCount := 0
+	var decodeErr error
+	err := iterateRawPrograms(jsonPath, func(index int, rawProgram json.RawMessage) bool {
+		var prog Program
+		decodeErr = json.Unmarshal(rawProgram, &prog)
+		if decodeErr != nil {
+			return false
+		}
+		if !strings.EqualFold(prog.Tag, tag) {
+			return true
+		}
+		programCount++
+
+		inscopeScopes, _ := parseAllLines(webApplicationScopeLines(prog.Scopes.In_scopes), true, privateTLDsAreEnabled, nil)
+		for _, scope := range inscopeScopes {
+			switch scope.(type) {
+			case string, *WildcardScope:
+				scopes = append(scopes, scopeToString(scope))
+			}
+		}
+		return true
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	return sortedUnique(scopes), programCount, err
+}
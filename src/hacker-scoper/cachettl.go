@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The sources whose cache TTL can be configured with "--cache-ttl source=TTL"
+var cacheTTLSources = []string{"firebounty", "plugins"}
+
+// How long the firebounty database is used before it's downloaded again, unless --cache-ttl says otherwise
+const defaultDatabaseTTL = 24 * time.Hour
+
+// A cache TTL of "never" keeps the cached copy forever, for reproducible runs
+const neverExpires = time.Duration(math.MaxInt64)
+
+// Set with "--cache-ttl". The TTL of every source, or of all of them under the "" key.
+var cacheTTLs = cacheTTLFlag{}
+
+// cacheTTLFlag is the --cache-ttl flag. It can be given once for all the sources, like "--cache-ttl 6h", and once per source, like "--cache-ttl plugins=1h".
+type cacheTTLFlag map[string]time.Duration
+
+func (ttls cacheTTLFlag) String() string {
+	var values []string
+	for source, ttl := range ttls {
+		value := ttl.String()
+		if ttl == neverExpires {
+			value = "never"
+		}
+		if source != "" {
+			value = source + "=" + value
+		}
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+func (ttls cacheTTLFlag) Set(value string) error {
+	source, rawTTL, hasSource := strings.Cut(strings.TrimSpace(value), "=")
+	if !hasSource {
+		source, rawTTL = "", source
+	} else if !slices.Contains(cacheTTLSources, source) {
+		return errors.New("unknown source \"" + source + "\". Valid sources are \"" + strings.Join(cacheTTLSources, "\", \"") + "\"")
+	}
+
+	if rawTTL == "never" {
+		ttls[source] = neverExpires
+		return nil
+	}
+	ttl, err := parseAge(rawTTL)
+	if err != nil {
+		return err
+	}
+	if ttl < 0 {
+		return errors.New("negative cache TTL")
+	}
+	ttls[source] = ttl
+	return nil
+}
+
+// cacheTTL returns the TTL of the cache of a source: the one given for the source, or else the one given for all of them, or else the default.
+func cacheTTL(source string, defaultTTL time.Duration) time.Duration {
+	if ttl, isSet := cacheTTLs[source]; isSet {
+		return ttl
+	}
+	if ttl, isSet := cacheTTLs[""]; isSet {
+		return ttl
+	}
+	return defaultTTL
+}
+
+// isCacheFresh reports whether a file that was last modified at modTime is still within the TTL.
+func isCacheFresh(modTime time.Time, ttl time.Duration) bool {
+	return ttl == neverExpires || time.Since(modTime) < ttl
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The list of bug bounty programs that ProjectDiscovery's Chaos dataset is built from
+const defaultChaosListURL = "https://raw.githubusercontent.com/projectdiscovery/public-bugbounty-programs/main/chaos-bugbounty-list.json"
+
+// chaosList is the chaos-bugbounty-list.json file, which maps every program to its root domains.
+type chaosList struct {
+	Programs []chaosProgram `json:"programs"`
+}
+
+type chaosProgram struct {
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Bounty  bool     `json:"bounty"`
+	Swag    bool     `json:"swag"`
+	Domains []string `json:"domains"`
+}
+
+// importChaosCommand converts the root domains of a program of the Chaos bug bounty list into a scope bundle, since they complement the scopes of the firebounty database.
+func importChaosCommand(args []string) {
+	var company string
+	var listPath string
+	var outputPath string
+
+	flags := newSubcommandFlagSet("import-chaos")
+	flags.StringVar(&company, "c", "", "Specify the company name to lookup.")
+	flags.StringVar(&company, "company", "", "Specify the company name to lookup.")
+	flags.StringVar(&listPath, "chaos-list", defaultChaosListURL, "Path or URL of the Chaos bug bounty list.")
+	flags.StringVar(&outputPath, "o", "", "Save the scope bundle to a file instead of printing it.")
+	flags.StringVar(&outputPath, "output", "", "Save the scope bundle to a file instead of printing it.")
+	flags.Parse(args) // #nosec G104 -- The FlagSet exits on errors.
+	setupClientTLS()
+
+	if company == "" {
+		fmt.Fprintln(os.Stderr, "Usage: hacker-scoper import-chaos -c company [--chaos-list /path/to/chaos-bugbounty-list.json] [-o /path/to/program.yaml]")
+		// Exit code 2 = command line syntax error
+		os.Exit(2)
+	}
+
+	list, err := readChaosList(listPath)
+	if err != nil {
+		crash(errReadInput, "Unable to read the Chaos bug bounty list \""+listPath+"\"", err)
+	}
+	prog, err := list.find(company)
+	if err != nil {
+		crash(errNoScopes, "Unable to import the scopes of \""+company+"\" from the Chaos bug bounty list", err)
+	}
+	bundle := prog.toScopeBundle(listPath)
+
+	if outputPath == "" {
+		err = writeScopeBundle(os.Stdout, bundle)
+		if err != nil {
+			crash(errWriteOutput, "Unable to write the scope bundle", err)
+		}
+		return
+	}
+	var buffer bytes.Buffer
+	err = writeScopeBundle(&buffer, bundle)
+	if err == nil {
+		err = writeFileAtomically(outputPath, buffer.Bytes())
+	}
+	if err != nil {
+		crash(errWriteOutput, "Unable to write the scope bundle to \""+outputPath+"\"", err)
+	}
+	if !chainMode {
+		fmt.Println("[+] Imported " + strconv.Itoa(len(bundle.InScope)/2) + " root domains of \"" + prog.Name + "\" to \"" + outputPath + "\". Use it with --scope-bundle.")
+	}
+}
+
+// readChaosList reads the Chaos bug bounty list from a file or a URL.
+func readChaosList(path string) (*chaosList, error) {
+	input, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	var list chaosList
+	err = json.NewDecoder(input).Decode(&list)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// find returns the program named like the company (case-insensitive). If no program has that exact name, the only program whose name contains it is returned instead.
+// It returns an error if there's no such program, or if the company name is ambiguous.
+func (list *chaosList) find(company string) (*chaosProgram, error) {
+	var partialMatches []*chaosProgram
+	for i := range list.Programs {
+		prog := &list.Programs[i]
+		if strings.EqualFold(prog.Name, company) {
+			return prog, nil
+		}
+		if strings.Contains(strings.ToLower(prog.Name), strings.ToLower(company)) {
+			partialMatches = append(partialMatches, prog)
+		}
+	}
+
+	switch len(partialMatches) {
+	case 0:
+		return nil, errors.New("no program is named like \"" + company + "\"")
+	case 1:
+		return partialMatches[0], nil
+	}
+	var names []string
+	for _, prog := range partialMatches {
+		names = append(names, "\""+prog.Name+"\"")
+	}
+	return nil, errors.New("\"" + company + "\" matches several programs: " + strings.Join(names, ", ") + ". Use the full name of the program")
+}
+
+// toScopeBundle converts the program into a scope bundle, where every root domain is in scope together with its subdomains.
+// The Chaos list doesn't have out-of-scope entries, so the bundle doesn't either.
+func (prog *chaosProgram) toScopeBundle(listPath string) *scopeBundle {
+	bundle := &scopeBundle{
+		Program: scopeBundleProgram{Name: prog.Name, Platform: chaosPlatform(prog.URL), URL: prog.URL},
+		Notes:   "Imported from the Chaos bug bounty list (" + listPath + ").\nThe root domains aren't the official scope of the program: check its policy before testing.\n",
+	}
+	seen := map[string]bool{}
+	for _, domain := range prog.Domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		bundle.InScope = append(bundle.InScope, scopeBundleEntry{Scope: domain}, scopeBundleEntry{Scope: "*." + domain})
+	}
+	return bundle
+}
+
+// chaosPlatform returns the platform of a program from the URL of its policy, like "hackerone" for "https://hackerone.com/example". Self-hosted programs don't have a platform.
+func chaosPlatform(programURL string) string {
+	parsed, err := url.Parse(programURL)
+	if err != nil {
+		return ""
+	}
+	labels := strings.Split(strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www."), ".")
+	if len(labels) < 2 {
+		return ""
+	}
+	switch platform := labels[len(labels)-2]; platform {
+	case "hackerone", "bugcrowd", "intigriti", "yeswehack", "hackenproof", "federacy":
+		return platform
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The exit code of chain mode runs where the company matched several companies. The candidates are printed to stderr as JSON.
+const exitAmbiguousCompany = 3
+
+// Set with "--select-slug". The companies are selected by the slugs of their programs, instead of by searching for the --company name.
+var selectedSlugs stringListFlag
+
+// companyCandidates is the JSON line printed to stderr when the company matched several companies in chain mode,
+// so that wrappers can present their own chooser, and run hacker-scoper again with the --select-slug of the chosen candidate.
+type companyCandidates struct {
+	Query      string             `json:"query"`
+	Candidates []companyCandidate `json:"candidates"`
+}
+
+// companyCandidate is one of the choices of the interactive chooser. With --merge-duplicates, a single candidate can have several programs.
+type companyCandidate struct {
+	Name     string             `json:"name"`
+	Programs []candidateProgram `json:"programs"`
+}
+
+type candidateProgram struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	URL  string `json:"url,omitempty"`
+}
+
+// newCompanyCandidates describes the choices of the chooser. The names are the ones of the database, instead of the lowercase'd ones used for matching.
+func newCompanyCandidates(query string, choices [][]firebountySearchMatch, companyNames []string, identities []programIdentity) companyCandidates {
+	candidates := companyCandidates{Query: query, Candidates: []companyCandidate{}}
+	for _, choice := range choices {
+		var candidate companyCandidate
+		var names []string
+		for _, match := range choice {
+			program := candidateProgram{Name: strings.TrimSpace(companyNames[match.companyIndex])}
+			if match.companyIndex < len(identities) {
+				program.Slug = identities[match.companyIndex].Slug
+				program.URL = identities[match.companyIndex].URL
+			}
+			candidate.Programs = append(candidate.Programs, program)
+			names = append(names, program.Name)
+		}
+		candidate.Name = names[0]
+		if len(names) > 1 {
+			candidate.Name += " (merged: " + strings.Join(names, ", ") + ")"
+		}
+		candidates.Candidates = append(candidates.Candidates, candidate)
+	}
+	return candidates
+}
+
+// exitWithCompanyCandidates prints the candidates to stderr as a JSON line, and exits with exitAmbiguousCompany.
+func exitWithCompanyCandidates(candidates companyCandidates) {
+	encoded, err := json.Marshal(candidates)
+	if err != nil {
+		crash(errWriteOutput, "Unable to encode the matching companies as JSON", err)
+	}
+	fmt.Fprintln(os.Stderr, string(encoded))
+	os.Exit(exitAmbiguousCompany)
+}
+
+// selectCompaniesBySlug returns the indexes of the programs with the --select-slug slugs, and remembers them as the selection of the company query, like the interactive chooser does.
+func selectCompaniesBySlug(company string, slugs []string) []int {
+	companyNames, err := extractCompanyNames(firebountyJSONPath)
+	if err != nil {
+		crash(errDatabase, "Couldn't parse company names from firebounty JSON.", err)
+	}
+
+	var selected []firebountySearchMatch
+	for _, slug := range slugs {
+		companyIndex, err := findCompanyBySlug(firebountyJSONPath, strings.TrimSpace(slug))
+		if err != nil {
+			crash(errNoScopes, "Unable to select the program \""+slug+"\"", err)
+		}
+		selected = append(selected, firebountySearchMatch{companyIndex, strings.ToLower(strings.TrimSpace(companyNames[companyIndex]))})
+	}
+	if !chainMode {
+		fmt.Println("[+] Selected the company " + colorGood + groupName(selected) + colorReset + " by its slug.")
+	}
+	return rememberCompanySelection(strings.ToLower(strings.TrimSpace(company)), selected)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net"
+	"slices"
+)
+
+// parseTargetLine parses a target like parseTarget does. With --allow-cidr-targets, CIDR ranges are parsed as *net.IPNet targets instead of as URLs with a path.
+func parseTargetLine(line string, allowCIDRTargets bool) (interface{}, error) {
+	if allowCIDRTargets {
+		if _, network, err := net.ParseCIDR(line); err == nil {
+			return network, nil
+		}
+	}
+	return parseTarget(line)
+}
+
+// matchingScopeForCIDR returns the first scope that fully contains a CIDR target, or nil if none of them do.
+func matchingScopeForCIDR(target *net.IPNet, scopes *[]interface{}, explicitLevel *int) interface{} {
+	for _, scope := range *scopes {
+		if cidrIsContainedIn(target, scope, scopeExplicitLevel(scope, *explicitLevel)) {
+			return scope
+		}
+	}
+	return nil
+}
+
+// cidrIntersectsAny reports whether a CIDR target has any address in common with any of the scopes.
+// A CIDR target is out of scope as soon as a single one of its addresses is.
+func cidrIntersectsAny(target *net.IPNet, scopes *[]interface{}, explicitLevel *int) bool {
+	for _, scope := range *scopes {
+		switch assertedScope := scope.(type) {
+		case *net.IP:
+			if target.Contains(*assertedScope) {
+				return true
+			}
+		case *net.IPNet:
+			// CIDR scopes are disabled in --explicit-level=3
+			if ExplicitLevel(*explicitLevel) != ExplicitLevelStrict && (assertedScope.Contains(target.IP) || target.Contains(assertedScope.IP)) {
+				return true
+			}
+		case *NmapIPRange:
+			if ExplicitLevel(*explicitLevel) == ExplicitLevelStrict {
+				continue
+			}
+			targetOctets, err := ipRangeOctets(target)
+			if err != nil {
+				continue
+			}
+			intersects := true
+			for i := range 4 {
+				if !slices.ContainsFunc(targetOctets[i], func(value uint8) bool { return slices.Contains(assertedScope.Octets[i], value) }) {
+					intersects = false
+					break
+				}
+			}
+			if intersects {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cidrIsContainedIn reports whether every address of a CIDR target is matched by the scope.
+func cidrIsContainedIn(target *net.IPNet, scope interface{}, explicitLevel int) bool {
+	switch assertedScope := scope.(type) {
+	case *net.IP:
+		// Only a single-address range can be contained in an IP address
+		ones, bits := target.Mask.Size()
+		return ones == bits && assertedScope.Equal(target.IP)
+	case *net.IPNet:
+		if ExplicitLevel(explicitLevel) == ExplicitLevelStrict {
+			return false
+		}
+		scopeOnes, scopeBits := assertedScope.Mask.Size()
+		targetOnes, targetBits := target.Mask.Size()
+		return scopeBits == targetBits && scopeOnes <= targetOnes && assertedScope.Contains(target.IP)
+	case *NmapIPRange:
+		if ExplicitLevel(explicitLevel) == ExplicitLevelStrict {
+			return false
+		}
+		targetOctets, err := ipRangeOctets(target)
+		if err != nil {
+			return false
+		}
+		for i := range 4 {
+			for _, value := range targetOctets[i] {
+				if !slices.Contains(assertedScope.Octets[i], value) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"os"
+)
+
+// Set with "--client-cert". Path to the PEM client certificate presented to servers that ask for one, like scope mirrors behind mTLS.
+var clientCertPath string
+
+// Set with "--client-key". Path to the PEM private key of the client certificate. Not needed if the key is in the certificate file.
+var clientKeyPath string
+
+// Set with "--ca-bundle". Path to a PEM bundle of extra certificate authorities to trust, like the CA of a self-hosted scope mirror.
+var caBundlePath string
+
+// clientTLSConfig is the TLS configuration of the HTTP clients that download files, or nil to use the defaults.
+var clientTLSConfig *tls.Config
+
+// loadClientTLSConfig builds the TLS configuration for the client certificate and CA bundle, or returns nil if neither was given.
+// The CA bundle is trusted together with the system's certificate authorities, so that public servers can still be reached.
+func loadClientTLSConfig(certPath string, keyPath string, caPath string) (*tls.Config, error) {
+	if certPath == "" && keyPath == "" && caPath == "" {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if keyPath != "" && certPath == "" {
+		return nil, errors.New("--client-key requires --client-cert")
+	}
+	if certPath != "" {
+		if keyPath == "" {
+			keyPath = certPath
+		}
+		certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	if caPath != "" {
+		bundle, err := os.ReadFile(caPath) // #nosec G304 -- The path is a CLI argument specified by the user running the program.
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, errors.New("the CA bundle " + caPath + " doesn't have any PEM certificates")
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// setupClientTLS loads the client certificate and CA bundle given in the command line, and applies them to the HTTP client.
+func setupClientTLS() {
+	config, err := loadClientTLSConfig(clientCertPath, clientKeyPath, caBundlePath)
+	if err != nil {
+		crash(errNetwork, "Unable to load the client certificate or the CA bundle", err)
+	}
+	clientTLSConfig = config
+	if transport, isTransport := httpClient.Transport.(*http.Transport); isTransport && config != nil {
+		transport.TLSClientConfig = config.Clone()
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// The names that can be given to --delimiter instead of the character, since tabs are hard to type in a shell
+var namedDelimiters = map[string]string{"tab": "\t", "space": " ", "comma": ",", "semicolon": ";", "pipe": "|"}
+
+// columnLayout is where the target is in the input lines of columnar inventories, set with --delimiter and --target-column.
+type columnLayout struct {
+	// Empty for any run of spaces and tabs
+	delimiter string
+	// The column of the target, starting at 1
+	column int
+}
+
+// splitLine is an input line split into its target and the rest of its columns.
+type splitLine struct {
+	target string
+	// The text of the line before and after the target, with their separators, so that the line can be printed back with the target
+	before string
+	after  string
+	// The rest of the columns, in order
+	others []string
+}
+
+// parseColumnDelimiter parses the value of --delimiter, which can be a name like "tab", or the delimiter itself, like ",".
+func parseColumnDelimiter(value string) (string, error) {
+	if delimiter, isNamed := namedDelimiters[strings.ToLower(value)]; isNamed {
+		return delimiter, nil
+	}
+	if value == "" {
+		return "", errors.New("the delimiter can't be empty")
+	}
+	return value, nil
+}
+
+// split splits the target of an input line from the rest of its columns, like "https://a.example.com 200 Example title" from an annotated recon list.
+// Without a delimiter, the columns up to the target are separated by spaces and tabs, since targets can't contain whitespace, and the rest of the line after the target is a single column,
+// so that the titles of recon lists, like "Example title", aren't split into words. The target can be quoted, like in CSV files.
+// It returns an error if the line doesn't have the target column.
+func (layout columnLayout) split(line string) (splitLine, error) {
+	// The start and end of every column in the line
+	var bounds [][2]int
+	if layout.delimiter == "" {
+		start := -1
+		for i, char := range line {
+			isSeparator := char == ' ' || char == '\t'
+			if !isSeparator && start == -1 && len(bounds) == layout.column {
+				// The rest of the line after the target
+				bounds = append(bounds, [2]int{i, len(strings.TrimRight(line, " \t"))})
+				break
+			} else if !isSeparator && start == -1 {
+				start = i
+			} else if isSeparator && start != -1 {
+				bounds = append(bounds, [2]int{start, i})
+				start = -1
+			}
+		}
+		if start != -1 {
+			bounds = append(bounds, [2]int{start, len(line)})
+		}
+	} else {
+		start := 0
+		for {
+			end := strings.Index(line[start:], layout.delimiter)
+			if end == -1 {
+				bounds = append(bounds, [2]int{start, len(line)})
+				break
+			}
+			bounds = append(bounds, [2]int{start, start + end})
+			start += end + len(layout.delimiter)
+		}
+	}
+
+	if layout.column > len(bounds) {
+		return splitLine{}, errors.New("the line doesn't have a column number " + strconv.Itoa(layout.column))
+	}
+	var split splitLine
+	for i, bound := range bounds {
+		if i != layout.column-1 {
+			split.others = append(split.others, strings.TrimSpace(line[bound[0]:bound[1]]))
+		}
+	}
+	targetBounds := bounds[layout.column-1]
+	split.before, split.after = line[:targetBounds[0]], line[targetBounds[1]:]
+	split.target = strings.TrimSpace(line[targetBounds[0]:targetBounds[1]])
+	if len(split.target) >= 2 && strings.HasPrefix(split.target, "\"") && strings.HasSuffix(split.target, "\"") {
+		split.target = strings.ReplaceAll(split.target[1:len(split.target)-1], "\"\"", "\"")
+	}
+	return split, nil
+}
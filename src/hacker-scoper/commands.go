@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runSubcommand runs the subcommand named by the first argument.
+// Returns false if the first argument isn't a subcommand, in which case the arguments should be parsed as regular flags.
+func runSubcommand(ctx context.Context, args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	switch args[0] {
+	case "show":
+		showCommand(ctx, args[1:])
+	case "list":
+		listCommand(ctx, args[1:])
+	case "db":
+		dbCommand(args[1:])
+	case "monitor":
+		monitorCommand(ctx, args[1:])
+	case "audit-program":
+		auditProgramCommand(ctx, args[1:])
+	case "multi":
+		multiCommand(ctx, args[1:])
+	case "who-owns":
+		whoOwnsCommand(ctx, args[1:])
+	case "bulk-export":
+		bulkExportCommand(ctx, args[1:])
+	case "import-chaos":
+		importChaosCommand(args[1:])
+	case "bench":
+		benchCommand(args[1:])
+	default:
+		return false
+	}
+	return true
+}
+
+// newSubcommandFlagSet returns a FlagSet with the arguments shared by all subcommands that read the firebounty database.
+func newSubcommandFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.StringVar(&firebountyJSONPath, "database", "", "Custom path to the cached firebounty database")
+	flags.StringVar(&databaseSnapshotPath, "database-snapshot", "", "Path to a pinned copy of the firebounty database, which is never updated.")
+	flags.StringVar(&databaseChecksumURL, "database-checksum", "", "URL of the published SHA-256 checksum of the database.")
+	flags.StringVar(&databaseSignatureURL, "database-signature", "", "URL of the detached Ed25519 signature of the database.")
+	flags.StringVar(&databasePublicKeyPath, "database-public-key", "", "Path to the Ed25519 public key that the database signature is verified with.")
+	flags.Var(&cacheTTLs, "cache-ttl", "How long the cached database is used before refreshing it, like \"6h\" or \"never\".")
+	flags.StringVar(&clientCertPath, "client-cert", "", "Path to the PEM client certificate presented to servers that ask for one.")
+	flags.StringVar(&clientKeyPath, "client-key", "", "Path to the PEM private key of the client certificate.")
+	flags.StringVar(&caBundlePath, "ca-bundle", "", "Path to a PEM bundle of extra certificate authorities to trust.")
+	flags.BoolVar(&chainMode, "ch", false, "Output only the important information. No decorations.")
+	flags.BoolVar(&chainMode, "chain-mode", false, "Output only the important information. No decorations.")
+	flags.BoolVar(&hyperlinksDisabled, "no-hyperlinks", false, "Don't print the URLs as terminal hyperlinks.")
+	flags.Var(&logFormat, "log-format", "Format of the warnings and errors written to stderr. Either \"text\" or \"json\".")
+	return flags
+}
+
+// showCommand prints the firebounty record of a company, without matching any targets.
+func showCommand(ctx context.Context, args []string) {
+	var company string
+	var format string
+	var databaseIsUpdating bool
+	var tmpFile *os.File
+
+	flags := newSubcommandFlagSet("show")
+	flags.StringVar(&company, "c", "", "Specify the company name to lookup.")
+	flags.StringVar(&company, "company", "", "Specify the company name to lookup.")
+	flags.StringVar(&format, "format", "text", "Output format. Either \"text\", \"json\" or \"yaml\".")
+	flags.Parse(args) // #nosec G104 -- The FlagSet exits on errors.
+	setupClientTLS()
+
+	if company == "" {
+		crash(errInvalidArguments, "The show subcommand requires a company. Use -c company", errors.New("missing company"))
+	}
+	if format != "text" && format != "json" && format != "yaml" {
+		crash(errInvalidArguments, "Invalid --format selected. Valid formats are \"text\", \"json\" and \"yaml\"", errors.New("invalid format "+format))
+	}
+
+	// The JSON and YAML outputs must not be mixed with any other messages
+	if format != "text" {
+		chainMode = true
+	}
+	hyperlinksEnabled = !chainMode && terminalSupportsHyperlinks()
+
+	handleInterrupts(&databaseIsUpdating, &tmpFile)
+	setupFirebountyJSONPath()
+	updateFirebountyJSONIfNeeded(ctx, &databaseIsUpdating, &tmpFile)
+
+	for i, companyIndex := range selectCompanies(company) {
+		if format == "yaml" {
+			prog, err := loadProgramByIndex(firebountyJSONPath, companyIndex)
+			if err != nil {
+				crash(errDatabase, "Couldn't load full program data", err)
+			}
+
+			// Combined companies are printed as separate YAML documents
+			if i > 0 {
+				fmt.Println("---")
+			}
+			err = writeScopeBundle(os.Stdout, programToScopeBundle(prog))
+			if err != nil {
+				crash(errWriteOutput, "Couldn't write the scope bundle", err)
+			}
+		} else if format == "json" {
+			rawProgram, err := loadRawProgramByIndex(firebountyJSONPath, companyIndex)
+			if err != nil {
+				crash(errDatabase, "Couldn't load full program data", err)
+			}
+
+			// Every program is printed in a single line, so that combined companies are printed as JSON lines
+			var compacted bytes.Buffer
+			err = json.Compact(&compacted, rawProgram)
+			if err != nil {
+				crash(errDatabase, "Couldn't load full program data", err)
+			}
+			fmt.Println(compacted.String())
+		} else {
+			prog, err := loadProgramByIndex(firebountyJSONPath, companyIndex)
+			if err != nil {
+				crash(errDatabase, "Couldn't load full program data", err)
+			}
+			fmt.Println("[+] Name: " + hyperlink(prog.Name, prog.Url))
+			fmt.Println("[+] Slug: " + prog.Slug)
+			fmt.Println("[+] Tag: " + prog.Tag)
+			printProgramDetails(prog)
+			fmt.Println()
+		}
+	}
+}
+
+// listedProgram is the summary of a program printed by the list subcommand
+type listedProgram struct {
+	Name          string `json:"name"`
+	Slug          string `json:"slug"`
+	Tag           string `json:"tag"`
+	InScopes      int    `json:"in_scopes"`
+	OutOfScopes   int    `json:"out_of_scopes"`
+	LastUpdated   string `json:"last_updated,omitempty"`
+	lastUpdatedAt time.Time
+}
+
+// programUpdateDates holds the fields that firebounty may use for the last update date of a program.
+// Not every program has one.
+type programUpdateDates struct {
+	Updated_at   string
+	Last_update  string
+	Last_updated string
+}
+
+// The layouts accepted for the update dates of firebounty programs
+var programUpdateDateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// summarizeProgram builds the list subcommand summary of a raw firebounty program.
+func summarizeProgram(rawProgram json.RawMessage) (listedProgram, error) {
+	var prog Program
+	var dates programUpdateDates
+	if err := json.Unmarshal(rawProgram, &prog); err != nil {
+		return listedProgram{}, err
+	}
+	if err := json.Unmarshal(rawProgram, &dates); err != nil {
+		return listedProgram{}, err
+	}
+
+	summary := listedProgram{
+		Name:        strings.TrimSpace(prog.Name),
+		Slug:        prog.Slug,
+		Tag:         prog.Tag,
+		InScopes:    len(prog.Scopes.In_scopes),
+		OutOfScopes: len(prog.Scopes.Out_of_scopes),
+	}
+	for _, rawDate := range []string{dates.Updated_at, dates.Last_updated, dates.Last_update} {
+		for _, layout := range programUpdateDateLayouts {
+			if parsed, err := time.Parse(layout, rawDate); err == nil {
+				summary.lastUpdatedAt = parsed
+				summary.LastUpdated = parsed.Format("2006-01-02 15:04:05")
+				return summary, nil
+			}
+		}
+	}
+	return summary, nil
+}
+
+// listCommand prints every program in the firebounty database, optionally filtered by tag and update date.
+func listCommand(ctx context.Context, args []string) {
+	var tag string
+	var updatedSinceStr string
+	var format string
+	var limit int
+	var offset int
+	var databaseIsUpdating bool
+	var tmpFile *os.File
+
+	flags := newSubcommandFlagSet("list")
+	flags.StringVar(&tag, "tag", "", "Only list the programs with this tag/platform, like \"hackerone\".")
+	flags.StringVar(&updatedSinceStr, "updated-since", "", "Only list the programs updated within this amount of time, like \"30d\" or \"12h\".")
+	flags.StringVar(&format, "format", "text", "Output format. Either \"text\" or \"json\".")
+	flags.IntVar(&limit, "limit", 0, "Maximum amount of programs to list.")
+	flags.IntVar(&offset, "offset", 0, "Amount of matching programs to skip before listing, for paging.")
+	flags.Parse(args) // #nosec G104 -- The FlagSet exits on errors.
+	setupClientTLS()
+
+	if format != "text" && format != "json" {
+		crash(errInvalidArguments, "Invalid --format selected. Valid formats are \"text\" and \"json\"", errors.New("invalid format "+format))
+	}
+	if limit < 0 || offset < 0 {
+		crash(errInvalidArguments, "--limit and --offset can't be negative", errors.New("invalid paging"))
+	}
+	var updatedSince time.Time
+	if updatedSinceStr != "" {
+		age, err := parseAge(updatedSinceStr)
+		if err != nil {
+			crash(errInvalidArguments, "Invalid --updated-since selected", err)
+		}
+		updatedSince = time.Now().Add(-age)
+	}
+	if format == "json" {
+		chainMode = true
+	}
+
+	handleInterrupts(&databaseIsUpdating, &tmpFile)
+	setupFirebountyJSONPath()
+	updateFirebountyJSONIfNeeded(ctx, &databaseIsUpdating, &tmpFile)
+
+	matched := 0
+	listed := 0
+	programsWithoutDate := 0
+	err := iterateRawPrograms(firebountyJSONPath, func(index int, rawProgram json.RawMessage) bool {
+		summary, err := summarizeProgram(rawProgram)
+		if err != nil {
+			warning(warnDatabase, "Couldn't parse the program number "+strconv.Itoa(index)+" of the firebounty database.")
+			return true
+		}
+		if tag != "" && !strings.EqualFold(summary.Tag, tag) {
+			return true
+		}
+		if !updatedSince.IsZero() {
+			if summary.lastUpdatedAt.IsZero() {
+				programsWithoutDate++
+				return true
+			} else if summary.lastUpdatedAt.Before(updatedSince) {
+				return true
+			}
+		}
+
+		// Keep counting the matching programs after the page is full, so that the total can be shown
+		matched++
+		if matched <= offset || (limit != 0 && listed >= limit) {
+			return true
+		}
+
+		if format == "json" {
+			line, err := json.Marshal(summary)
+			if err != nil {
+				crash(errWriteOutput, "Couldn't encode the program "+summary.Name, err)
+			}
+			fmt.Println(string(line))
+		} else if chainMode {
+			fmt.Println(strings.Join([]string{summary.Name, summary.Tag, strconv.Itoa(summary.InScopes), strconv.Itoa(summary.OutOfScopes), summary.LastUpdated}, "\t"))
+		} else {
+			line := "[+] " + summary.Name + " (" + summary.Tag + ") - " + strconv.Itoa(summary.InScopes) + " in-scope, " + strconv.Itoa(summary.OutOfScopes) + " out-of-scope"
+			if summary.LastUpdated != "" {
+				line += " - updated " + summary.LastUpdated
+			}
+			fmt.Println(line)
+		}
+
+		listed++
+		return true
+	})
+	if err != nil {
+		crash(errDatabase, "Couldn't read the firebounty database", err)
+	}
+
+	if !chainMode {
+		fmt.Println("\n[+] Listed " + strconv.Itoa(listed) + " of " + strconv.Itoa(matched) + " matching programs.")
+		if programsWithoutDate > 0 {
+			warning(warnProgramSkipped, strconv.Itoa(programsWithoutDate)+" programs were skipped because the database doesn't have an update date for them.")
+		}
+	}
+}
+
+// databaseInfo holds the statistics printed by "db info"
+type databaseInfo struct {
+	Path        string    `json:"path"`
+	SourceURL   string    `json:"source_url"`
+	Size        int64     `json:"size"`
+	LastUpdated time.Time `json:"last_updated"`
+	Programs    int       `json:"programs"`
+	InScopes    int       `json:"in_scopes"`
+	OutOfScopes int       `json:"out_of_scopes"`
+	SHA256      string    `json:"sha256"`
+}
+
+// getDatabaseInfo gathers the statistics of the firebounty database at the given path.
+func getDatabaseInfo(jsonPath string) (*databaseInfo, error) {
+	stats, err := os.Stat(jsonPath)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &databaseInfo{Path: jsonPath, SourceURL: firebountyAPIURL, Size: stats.Size(), LastUpdated: stats.ModTime()}
+	info.SHA256, err = fileSHA256(jsonPath)
+	if err != nil {
+		return nil, err
+	}
+	err = iterateRawPrograms(jsonPath, func(index int, rawProgram json.RawMessage) bool {
+		var prog Program
+		if json.Unmarshal(rawProgram, &prog) == nil {
+			info.InScopes += len(prog.Scopes.In_scopes)
+			info.OutOfScopes += len(prog.Scopes.Out_of_scopes)
+		}
+		info.Programs++
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// dbCommand manages the cached firebounty database.
+// "db info" prints information about the database, and "db clear" deletes it.
+func dbCommand(args []string) {
+	if len(args) == 0 || (args[0] != "info" && args[0] != "clear") {
+		fmt.Fprintln(os.Stderr, "Usage: hacker-scoper db info|clear [--database /path/to/firebounty.json] [--format text|json]")
+		// Exit code 2 = command line syntax error
+		os.Exit(2)
+	}
+
+	var format string
+	flags := newSubcommandFlagSet("db " + args[0])
+	flags.StringVar(&format, "format", "text", "Output format. Either \"text\" or \"json\".")
+	flags.Parse(args[1:]) // #nosec G104 -- The FlagSet exits on errors.
+
+	if format != "text" && format != "json" {
+		crash(errInvalidArguments, "Invalid --format selected. Valid formats are \"text\" and \"json\"", errors.New("invalid format "+format))
+	}
+	if format == "json" {
+		chainMode = true
+	}
+	setupFirebountyJSONPath()
+
+	if args[0] == "clear" {
+		if databaseSnapshotPath != "" {
+			crash(errDatabase, "Database snapshots are read-only, so they can't be cleared", errors.New("read-only database"))
+		}
+		err := os.Remove(firebountyJSONPath)
+		if errors.Is(err, os.ErrNotExist) {
+			if !chainMode {
+				fmt.Println("[+] There is no cached database at \"" + firebountyJSONPath + "\". Nothing to clear.")
+			}
+			return
+		} else if err != nil {
+			crash(errDatabase, "Unable to delete the database at \""+firebountyJSONPath+"\"", err)
+		}
+		// The ETag, checksum and signature belong to the deleted database
+		saveDatabaseETag(firebountyJSONPath, "")             // #nosec G104 -- A leftover ETag isn't used without a database.
+		os.Remove(databaseChecksumPath(firebountyJSONPath))  // #nosec G104 -- A leftover checksum is replaced by the next verified download.
+		os.Remove(databaseSignaturePath(firebountyJSONPath)) // #nosec G104 -- A leftover signature is replaced by the next verified download.
+		if !chainMode {
+			fmt.Println("[+] Deleted the cached database at \"" + firebountyJSONPath + "\". It will be downloaded again the next time it's needed.")
+		}
+		return
+	}
+
+	info, err := getDatabaseInfo(firebountyJSONPath)
+	if errors.Is(err, os.ErrNotExist) {
+		crash(errDatabase, "There is no cached database at \""+firebountyJSONPath+"\". It will be downloaded the next time you use --company.", err)
+	} else if err != nil {
+		crash(errDatabase, "Unable to read the database at \""+firebountyJSONPath+"\"", err)
+	}
+
+	if format == "json" {
+		line, err := json.Marshal(info)
+		if err != nil {
+			crash(errWriteOutput, "Couldn't encode the database information", err)
+		}
+		fmt.Println(string(line))
+		return
+	}
+
+	age := time.Since(info.LastUpdated).Round(time.Minute)
+	fmt.Println("[+] Path: " + info.Path)
+	fmt.Println("[+] Source URL: " + info.SourceURL)
+	fmt.Println("[+] Size: " + strconv.FormatFloat(float64(info.Size)/1024/1024, 'f', 2, 64) + " MiB")
+	fmt.Println("[+] Last updated: " + info.LastUpdated.Format("2006-01-02 15:04:05") + " (" + age.String() + " ago)")
+	fmt.Println("[+] Programs: " + strconv.Itoa(info.Programs))
+	fmt.Println("[+] In-scope entries: " + strconv.Itoa(info.InScopes))
+	fmt.Println("[+] Out-of-scope entries: " + strconv.Itoa(info.OutOfScopes))
+	fmt.Println("[+] SHA-256: " + info.SHA256)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Set with "--contract-scopes". The smart contract addresses listed in the scopes of the programs are matched against the targets that are contract addresses, for Web3 programs.
+var contractScopesEnabled bool
+
+// EVM addresses are 20 bytes, written as 40 hex digits after "0x"
+var evmAddressRegex = regexp.MustCompile(`^0[xX][0-9a-fA-F]{40}$`)
+
+// The chain IDs of the chain names that programs usually use, like "polygon:0x..."
+var evmChainIDs = map[string]string{
+	"ethereum":  "1",
+	"eth":       "1",
+	"mainnet":   "1",
+	"optimism":  "10",
+	"bsc":       "56",
+	"bnb":       "56",
+	"gnosis":    "100",
+	"polygon":   "137",
+	"matic":     "137",
+	"fantom":    "250",
+	"zksync":    "324",
+	"base":      "8453",
+	"arbitrum":  "42161",
+	"avalanche": "43114",
+	"avax":      "43114",
+	"linea":     "59144",
+	"scroll":    "534352",
+	"sepolia":   "11155111",
+}
+
+// The chain IDs of the block explorers, whose address pages are how programs usually list their contracts, like "https://etherscan.io/address/0x..."
+var blockExplorerChainIDs = map[string]string{
+	"etherscan.io":            "1",
+	"optimistic.etherscan.io": "10",
+	"bscscan.com":             "56",
+	"gnosisscan.io":           "100",
+	"polygonscan.com":         "137",
+	"ftmscan.com":             "250",
+	"basescan.org":            "8453",
+	"arbiscan.io":             "42161",
+	"snowtrace.io":            "43114",
+	"lineascan.build":         "59144",
+	"scrollscan.com":          "534352",
+	"sepolia.etherscan.io":    "11155111",
+}
+
+// ContractAddress is the address of a smart contract on an EVM chain, like "0x5FbDB2315678afecb367f032d93F642f64180aa3".
+// The chain is optional, like in "polygon:0x..." or "eip155:137:0x...". Addresses without a chain match the address on every chain.
+type ContractAddress struct {
+	// The chain ID, like "137", or the lowercased chain name if it isn't a known one. Empty for every chain.
+	chain string
+	// Lowercased, without "0x"
+	address string
+}
+
+// String returns the contract as a scope line, with the address in its EIP-55 checksum form, like "eip155:137:0x5FbDB2315678afecb367f032d93F642f64180aa3".
+func (contract *ContractAddress) String() string {
+	address := checksumAddress(contract.address)
+	if contract.chain == "" {
+		return address
+	}
+	if _, err := strconv.Atoi(contract.chain); err == nil {
+		return "eip155:" + contract.chain + ":" + address
+	}
+	return contract.chain + ":" + address
+}
+
+// matches reports whether the contract of a target is matched by a contract scope. Addresses are case-insensitive, and scopes or targets without a chain match every chain.
+func (scope *ContractAddress) matches(target *ContractAddress) bool {
+	if scope.address != target.address {
+		return false
+	}
+	return scope.chain == "" || target.chain == "" || scope.chain == target.chain
+}
+
+// checksumAddress returns the EIP-55 checksum form of a lowercased address without "0x", like "0x5FbDB2315678afecb367f032d93F642f64180aa3".
+func checksumAddress(address string) string {
+	// Ethereum uses the original Keccak-256, which has a different padding than SHA3-256
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write([]byte(address)) // #nosec G104 -- Writing to a hash never fails.
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	checksummed := []byte(address)
+	for i, char := range checksummed {
+		if char >= 'a' && char <= 'f' && hash[i] >= '8' {
+			checksummed[i] = char - 'a' + 'A'
+		}
+	}
+	return "0x" + string(checksummed)
+}
+
+// hasValidChecksum reports whether the address of a line like "0x..." has a valid EIP-55 checksum. Addresses in a single case don't have a checksum, so they're always valid.
+func hasValidChecksum(address string) bool {
+	digits := address[2:]
+	if digits == strings.ToLower(digits) || digits == strings.ToUpper(digits) {
+		return true
+	}
+	return checksumAddress(strings.ToLower(digits))[2:] == digits
+}
+
+// parseContractAddress parses a contract address, either on its own ("0x..."), with a chain name or ID ("polygon:0x...", "137:0x..."), as a CAIP-10 account ID ("eip155:137:0x..."), or as a block explorer URL ("https://polygonscan.com/address/0x..."). It returns nil for every other line.
+// Mixed-case addresses with an invalid EIP-55 checksum are probably typos, so they're parsed with a warning.
+func parseContractAddress(line string) *ContractAddress {
+	chain := ""
+	address := line
+	if explorerURL, err := parseURLWithDefaultScheme(line); err == nil && strings.Contains(line, "/") {
+		chainID, isExplorer := blockExplorerChainIDs[strings.TrimPrefix(strings.ToLower(explorerURL.Hostname()), "www.")]
+		segments := strings.Split(strings.Trim(explorerURL.Path, "/"), "/")
+		if !isExplorer || len(segments) != 2 || (segments[0] != "address" && segments[0] != "token") {
+			return nil
+		}
+		chain, address = chainID, segments[1]
+	} else if separator := strings.LastIndex(line, ":"); separator != -1 {
+		chain, address = strings.ToLower(line[:separator]), line[separator+1:]
+		chain = strings.TrimPrefix(chain, "eip155:")
+		if chainID, isKnown := evmChainIDs[chain]; isKnown {
+			chain = chainID
+		}
+		if chain == "" || strings.Contains(chain, ":") {
+			return nil
+		}
+	}
+
+	if !evmAddressRegex.MatchString(address) {
+		return nil
+	}
+	if !hasValidChecksum(address) {
+		repeatedWarning(warnContractChecksum, "The contract address \""+line+"\" has an invalid EIP-55 checksum. Make sure that it doesn't have a typo.")
+	}
+	return &ContractAddress{chain: chain, address: strings.ToLower(address[2:])}
+}
+
+// matchingScopeForContract returns the first contract scope that matches the contract target.
+func matchingScopeForContract(target *ContractAddress, inscopeScopes *[]interface{}) interface{} {
+	for i := range *inscopeScopes {
+		if scope, isContract := (*inscopeScopes)[i].(*ContractAddress); isContract && scope.matches(target) {
+			return scope
+		}
+	}
+	return nil
+}
+
+// contractScopeLines returns the "smart_contract" scopes of a firebounty scope list, for --contract-scopes.
+func contractScopeLines(scopes []Scope) []string {
+	var lines []string
+	for _, scope := range scopes {
+		rawScope := strings.TrimSpace(scope.Scope)
+		if scope.Scope_type == "smart_contract" && rawScope != "" {
+			lines = append(lines, rawScope)
+		}
+	}
+	return lines
+}
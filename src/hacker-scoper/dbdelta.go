@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// databaseETagPath returns the path of the file with the ETag of the cached database, next to the database.
+func databaseETagPath(jsonPath string) string {
+	return jsonPath + ".etag"
+}
+
+// setConditionalHeaders makes the database download conditional on the cached database, so that servers that support it can answer "304 Not Modified" instead of sending the whole database again.
+func setConditionalHeaders(req *http.Request, jsonPath string) {
+	info, err := os.Stat(jsonPath)
+	if err != nil {
+		return
+	}
+	req.Header.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+	etag, err := os.ReadFile(databaseETagPath(jsonPath)) // #nosec G304 -- The path is derived from the database path.
+	if err == nil && len(etag) > 0 {
+		req.Header.Set("If-None-Match", string(etag))
+	}
+}
+
+// saveDatabaseETag remembers the ETag of the downloaded database for the next update. The ETag of an older database is deleted if the server didn't send one.
+func saveDatabaseETag(jsonPath string, etag string) error {
+	if etag == "" {
+		err := os.Remove(databaseETagPath(jsonPath))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return os.WriteFile(databaseETagPath(jsonPath), []byte(etag), 0600)
+}
+
+// markDatabaseFresh resets the age of the cached database after the server confirmed that it's still up to date.
+func markDatabaseFresh(jsonPath string) error {
+	now := time.Now()
+	return os.Chtimes(jsonPath, now, now)
+}
+
+// programDigest is the SHA-256 of the JSON of a program, to find the programs that changed between two versions of the database.
+type programDigest [sha256.Size]byte
+
+// programDigests returns the SHA-256 of every program of a firebounty database, keyed by slug (or by name, for programs without a slug).
+// Programs with the same key are told apart by the order in which they appear, like "example#2".
+func programDigests(jsonPath string) (map[string]programDigest, error) {
+	digests := map[string]programDigest{}
+	occurrences := map[string]int{}
+	var decodeErr error
+	err := iterateRawPrograms(jsonPath, func(index int, rawProgram json.RawMessage) bool {
+		var identity struct {
+			Name string
+			Slug string
+		}
+		decodeErr = json.Unmarshal(rawProgram, &identity)
+		if decodeErr != nil {
+			return false
+		}
+		key := identity.Slug
+		if key == "" {
+			key = strings.TrimSpace(identity.Name)
+		}
+		occurrences[key]++
+		if occurrences[key] > 1 {
+			key += "#" + strconv.Itoa(occurrences[key])
+		}
+		digests[key] = programDigest(sha256.Sum256(rawProgram))
+		return true
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	return digests, err
+}
+
+// databaseDelta holds the programs that changed between two versions of the firebounty database.
+type databaseDelta struct {
+	Added   int
+	Changed int
+	Removed int
+}
+
+// diffProgramDigests compares the programs of two versions of the firebounty database.
+func diffProgramDigests(previous map[string]programDigest, current map[string]programDigest) databaseDelta {
+	var delta databaseDelta
+	for key, digest := range current {
+		previousDigest, existed := previous[key]
+		if !existed {
+			delta.Added++
+		} else if previousDigest != digest {
+			delta.Changed++
+		}
+	}
+	for key := range previous {
+		if _, exists := current[key]; !exists {
+			delta.Removed++
+		}
+	}
+	return delta
+}
+
+// String describes the delta, like "3 programs added, 10 changed, 1 removed".
+func (delta databaseDelta) String() string {
+	return strconv.Itoa(delta.Added) + " programs added, " + strconv.Itoa(delta.Changed) + " changed, " + strconv.Itoa(delta.Removed) + " removed"
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Lock files older than this are assumed to belong to a hacker-scoper process that crashed, and are deleted.
+const databaseLockStaleAfter = 15 * time.Minute
+
+// How long we wait for another hacker-scoper process to finish updating the database.
+const databaseLockTimeout = 10 * time.Minute
+
+// heldDatabaseLock is the path of the lock file while this process holds it, so that it can be released on Ctrl+C.
+var heldDatabaseLock string
+var heldDatabaseLockMutex sync.Mutex
+
+// lockDatabase creates a lock file next to the database, so that hacker-scoper processes running in parallel don't update the database at the same time.
+// If another process holds the lock, lockDatabase waits until it's released, or until the context is cancelled.
+func lockDatabase(ctx context.Context, jsonPath string) error {
+	lockPath := jsonPath + ".lock"
+	deadline := time.Now().Add(databaseLockTimeout)
+
+	for {
+		lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600) // #nosec G304 -- The path is derived from the database path.
+		if err == nil {
+			// The PID is only written for the user's information, in case the lock file has to be deleted manually
+			lockFile.WriteString(strconv.Itoa(os.Getpid())) // #nosec G104 -- The content of the lock file doesn't matter.
+			lockFile.Close()                                // #nosec G104 -- The content of the lock file doesn't matter.
+
+			heldDatabaseLockMutex.Lock()
+			heldDatabaseLock = lockPath
+			heldDatabaseLockMutex.Unlock()
+			return nil
+		} else if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+
+		// Someone else holds the lock
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > databaseLockStaleAfter {
+			warning(warnDatabase, "Deleting the stale database lock file \""+lockPath+"\"")
+			os.Remove(lockPath) // #nosec G104 -- If the removal fails we'll just try again.
+			continue
+		}
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for another hacker-scoper process to release the lock file \"" + lockPath + "\". If no other hacker-scoper process is running, delete the lock file manually")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// unlockDatabase releases the lock created by lockDatabase, if this process holds it.
+func unlockDatabase() {
+	heldDatabaseLockMutex.Lock()
+	defer heldDatabaseLockMutex.Unlock()
+	if heldDatabaseLock != "" {
+		err := os.Remove(heldDatabaseLock)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			warning(warnDatabase, "Unable to delete the database lock file \""+heldDatabaseLock+"\". Please delete it manually.")
+		}
+		heldDatabaseLock = ""
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Set with "--database-checksum". URL of the published SHA-256 checksum of the database, like the output of sha256sum.
+var databaseChecksumURL string
+
+// Set with "--database-signature". URL of the detached Ed25519 signature of the database.
+var databaseSignatureURL string
+
+// Set with "--database-public-key". Path to the Ed25519 public key that the database signature is verified with.
+var databasePublicKeyPath string
+
+// Published checksums and signatures bigger than this are rejected
+const maxVerificationFileSize = 65535
+
+// databaseVerificationEnabled reports whether the database has to be verified, and crashes if only half of the signature settings were given.
+func databaseVerificationEnabled() bool {
+	if (databaseSignatureURL == "") != (databasePublicKeyPath == "") {
+		crash(errInvalidArguments, "--database-signature and --database-public-key have to be used together", errors.New("incomplete signature settings"))
+	}
+	return databaseChecksumURL != "" || databaseSignatureURL != ""
+}
+
+// databaseChecksumPath returns the path of the verified checksum of the cached database, next to the database.
+func databaseChecksumPath(jsonPath string) string {
+	return jsonPath + ".sha256"
+}
+
+// databaseSignaturePath returns the path of the verified signature of the cached database, next to the database.
+func databaseSignaturePath(jsonPath string) string {
+	return jsonPath + ".sig"
+}
+
+// fetchVerificationFile downloads a published checksum or signature.
+func fetchVerificationFile(ctx context.Context, fileURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("the server replied with \"" + resp.Status + "\"")
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxVerificationFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxVerificationFileSize {
+		return nil, errors.New("the file is too big")
+	}
+	return data, nil
+}
+
+// fetchDatabaseVerification downloads the published checksum and signature of the database, whichever are configured.
+func fetchDatabaseVerification(ctx context.Context) (checksum []byte, signature []byte, err error) {
+	if databaseChecksumURL != "" {
+		checksum, err = fetchVerificationFile(ctx, databaseChecksumURL)
+		if err != nil {
+			return nil, nil, errors.New("unable to download the checksum from \"" + databaseChecksumURL + "\": " + err.Error())
+		}
+	}
+	if databaseSignatureURL != "" {
+		signature, err = fetchVerificationFile(ctx, databaseSignatureURL)
+		if err != nil {
+			return nil, nil, errors.New("unable to download the signature from \"" + databaseSignatureURL + "\": " + err.Error())
+		}
+	}
+	return checksum, signature, nil
+}
+
+// parseChecksum extracts the SHA-256 checksum of a file from a published checksum. Both a bare hex checksum and the output of sha256sum are accepted.
+// If the checksum file lists several files, the one with the same name as the database is used.
+func parseChecksum(data []byte, filename string) ([]byte, error) {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		// sha256sum marks the files that were read in binary mode with a "*"
+		if len(lines) > 1 && (len(fields) < 2 || filepath.Base(strings.TrimPrefix(fields[1], "*")) != filename) {
+			continue
+		}
+		checksum, err := hex.DecodeString(fields[0])
+		if err != nil || len(checksum) != sha256.Size {
+			return nil, errors.New("\"" + fields[0] + "\" isn't a SHA-256 checksum")
+		}
+		return checksum, nil
+	}
+	return nil, errors.New("the checksum file doesn't have a checksum for " + filename)
+}
+
+// parsePublicKey decodes an Ed25519 public key, either in PEM format (like the keys of "openssl genpkey -algorithm ed25519") or as the base64 or hex of the raw key.
+func parsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		ed25519Key, isEd25519 := key.(ed25519.PublicKey)
+		if !isEd25519 {
+			return nil, errors.New("the public key isn't an Ed25519 key")
+		}
+		return ed25519Key, nil
+	}
+
+	rawKey := decodeBinaryText(data, ed25519.PublicKeySize)
+	if len(rawKey) != ed25519.PublicKeySize {
+		return nil, errors.New("the public key isn't an Ed25519 key")
+	}
+	return ed25519.PublicKey(rawKey), nil
+}
+
+// decodeBinaryText decodes keys and signatures of the given size that may be published raw, or as hex or base64 text.
+func decodeBinaryText(data []byte, size int) []byte {
+	text := string(bytes.TrimSpace(data))
+	if decoded, err := hex.DecodeString(text); err == nil && len(decoded) == size {
+		return decoded
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(text); err == nil && len(decoded) == size {
+		return decoded
+	}
+	return data
+}
+
+// verifyDatabaseFile checks the database file at the path against a published checksum and signature. Nil checksums and signatures aren't checked.
+func verifyDatabaseFile(path string, checksum []byte, signature []byte) error {
+	data, err := os.ReadFile(path) // #nosec G304 -- The path is the database path, or a temp file next to it.
+	if err != nil {
+		return err
+	}
+
+	if checksum != nil {
+		expected, err := parseChecksum(checksum, filepath.Base(firebountyJSONPath))
+		if err != nil {
+			return err
+		}
+		actual := sha256.Sum256(data)
+		if !bytes.Equal(expected, actual[:]) {
+			return errors.New("the SHA-256 checksum of the database is " + hex.EncodeToString(actual[:]) + ", but " + hex.EncodeToString(expected) + " was expected")
+		}
+	}
+
+	if signature != nil {
+		keyData, err := os.ReadFile(databasePublicKeyPath) // #nosec G304 -- The path is a CLI argument specified by the user running the program.
+		if err != nil {
+			return err
+		}
+		key, err := parsePublicKey(keyData)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(key, data, decodeBinaryText(signature, ed25519.SignatureSize)) {
+			return errors.New("the signature of the database isn't valid for the public key " + databasePublicKeyPath)
+		}
+	}
+	return nil
+}
+
+// saveDatabaseVerification stores the checksum and signature that the database was verified with next to it, so that the cached database can be verified again on every run.
+func saveDatabaseVerification(jsonPath string, checksum []byte, signature []byte) error {
+	for _, file := range []struct {
+		path string
+		data []byte
+	}{{databaseChecksumPath(jsonPath), checksum}, {databaseSignaturePath(jsonPath), signature}} {
+		if file.data == nil {
+			continue
+		}
+		err := writeFileAtomically(file.path, file.data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyCachedDatabase checks that the cached database wasn't modified since it was downloaded and verified.
+// The signature detects any tampering, since the key is never stored with the database. The checksum is stored next to the database, so it only detects accidental corruption.
+func verifyCachedDatabase(jsonPath string) error {
+	var checksum, signature []byte
+	var err error
+	if databaseChecksumURL != "" {
+		checksum, err = os.ReadFile(databaseChecksumPath(jsonPath)) // #nosec G304 -- The path is derived from the database path.
+		if err != nil {
+			return errors.New("the cached database hasn't been verified with a checksum. Delete it with \"hacker-scoper db clear\" to download it again")
+		}
+	}
+	if databaseSignatureURL != "" {
+		signature, err = os.ReadFile(databaseSignaturePath(jsonPath)) // #nosec G304 -- The path is derived from the database path.
+		if err != nil {
+			return errors.New("the cached database hasn't been verified with a signature. Delete it with \"hacker-scoper db clear\" to download it again")
+		}
+	}
+	return verifyDatabaseFile(jsonPath, checksum, signature)
+}
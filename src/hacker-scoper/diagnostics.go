@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// The stable codes of the warnings and errors, so that automation can filter or alert on specific conditions.
+// Codes are never reused: when a condition is removed, its code is retired with it.
+const (
+	// A scope or target line that couldn't be parsed
+	warnUnparsableLine = "HS-W001"
+	// A scope without a public TLD, which is usually a misconfigured program
+	warnPrivateTLD = "HS-W002"
+	// A package name (like "com.example.app") listed as a web scope
+	warnPackageNameScope = "HS-W003"
+	// A scope with a path, which can't be matched against hosts
+	warnScopeWithPath = "HS-W004"
+	// A regex scope that couldn't be compiled
+	warnInvalidRegex = "HS-W005"
+	// A scope that can't be represented by the selected export format
+	warnUnsupportedExport = "HS-W006"
+	// A problem with the firebounty database that doesn't stop the run, like a failed update
+	warnDatabase = "HS-W007"
+	// A program that was skipped, like a program without scopes
+	warnProgramSkipped = "HS-W008"
+	// A scope plugin that failed
+	warnScopePlugin = "HS-W009"
+	// Arguments that can't be used together, or an invalid value
+	warnInvalidArguments = "HS-W010"
+	// A file that couldn't be read or written, without stopping the run
+	warnFile = "HS-W011"
+	// A failed App Store lookup of an iOS app
+	warnAppStoreLookup = "HS-W012"
+	// A problem while monitoring the scopes of the programs
+	warnMonitor = "HS-W013"
+	// An ASN that isn't in the ASN database
+	warnUnknownASN = "HS-W014"
+	// A raw HTTP request without a "Host" header
+	warnRequestWithoutHost = "HS-W015"
+	// A contract address with an invalid EIP-55 checksum
+	warnContractChecksum = "HS-W016"
+	// A server that was started without an authentication token
+	warnServerWithoutToken = "HS-W017"
+	// An invalid setting of the config file, like an unknown color theme
+	warnInvalidConfig = "HS-W018"
+	// Cached scopes that diverge from the live program page, or a program page that couldn't be checked
+	warnLiveScope = "HS-W019"
+	// The --max-memory limit was reached, and a feature stopped using more memory
+	warnMemoryLimit = "HS-W020"
+	// A page that couldn't be opened in the browser by --open
+	warnOpenBrowser = "HS-W021"
+
+	// Invalid arguments
+	errInvalidArguments = "HS-E001"
+	// An input file, like the targets or a profile, that couldn't be read
+	errReadInput = "HS-E002"
+	// An output file that couldn't be written
+	errWriteOutput = "HS-E003"
+	// The firebounty database couldn't be loaded or updated
+	errDatabase = "HS-E004"
+	// No scopes were found for the selected programs
+	errNoScopes = "HS-E005"
+	// A network request failed
+	errNetwork = "HS-E006"
+	// The benchmark or the profiler couldn't be started
+	errProfiling = "HS-E007"
+)
+
+// Set with "--log-format json". The warnings and errors are written to stderr as JSON lines, instead of as text.
+var jsonDiagnostics bool
+
+// Set with "--log-format".
+var logFormat logFormatFlag
+
+// diagnostic is a warning or an error, as written to stderr with "--log-format json".
+type diagnostic struct {
+	// "warning" or "error"
+	Level   string `json:"level"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// The underlying error of the errors
+	Error string `json:"error,omitempty"`
+}
+
+// logFormatFlag is the --log-format flag. Either "text" or "json".
+type logFormatFlag struct{}
+
+func (logFormatFlag) String() string {
+	if jsonDiagnostics {
+		return "json"
+	}
+	return "text"
+}
+
+func (logFormatFlag) Set(value string) error {
+	switch value {
+	case "text":
+		jsonDiagnostics = false
+	case "json":
+		jsonDiagnostics = true
+	default:
+		return errors.New("valid values are \"text\" and \"json\"")
+	}
+	return nil
+}
+
+// printJSONDiagnostic writes a diagnostic to stderr as a JSON line.
+func printJSONDiagnostic(entry diagnostic) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		// Diagnostics are made of strings, so they can always be marshalled
+		return
+	}
+	fmt.Fprintln(os.Stderr, string(line))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+)
+
+// readPreviousAssets reads the assets of a previous output of hacker-scoper, for --diff-against.
+// Every output format is supported. A previous output that doesn't exist yet has no assets.
+func readPreviousAssets(path string) (map[string]bool, error) {
+	input, err := openInput(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]bool{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	assets := map[string]bool{}
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		if asset := previousOutputAsset(scanner.Text()); asset != "" {
+			assets[asset] = true
+		}
+	}
+	return assets, scanner.Err()
+}
+
+// previousOutputAsset returns the asset of a single line of a previous output, or an empty string if the line doesn't have one.
+// The line can be a plain asset, a text result with its annotations (like "a.example.com [*.example.com]"), a --json result or a --csv row.
+func previousOutputAsset(line string) string {
+	line = strings.TrimSpace(line)
+	// Empty lines, and the metadata of --with-header
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ""
+	}
+
+	if strings.HasPrefix(line, "{") {
+		var result jsonResult
+		if json.Unmarshal([]byte(line), &result) == nil {
+			return result.Asset
+		}
+		return ""
+	}
+
+	if resultType, _, isCSV := strings.Cut(line, ","); isCSV {
+		switch resultType {
+		case "type":
+			// The CSV header
+			return ""
+		case "inscope", "unsure", "related", "inscope-email", "unsure-email", "related-email":
+			record, err := csv.NewReader(strings.NewReader(line)).Read()
+			if err == nil && len(record) >= 2 {
+				return record[1]
+			}
+			return ""
+		}
+	}
+
+	// The annotations of the text output are separated from the asset with a space
+	return strings.Fields(line)[0]
+}
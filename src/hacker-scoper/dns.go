@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// How many seconds a DNS query can take when --dns-timeout isn't specified
+const defaultDNSTimeout = 5
+
+// Responses of DNS over HTTPS servers bigger than this are ignored
+const maxDoHResponseSize = 65535
+
+// dnsResolver is a DNS server that queries are sent to.
+type dnsResolver struct {
+	// "udp" (retried over TCP if the response is truncated), "tcp" or "https" (DNS over HTTPS)
+	network string
+	// Addresses like "8.8.8.8:53", or the URL of the DNS over HTTPS endpoint
+	address string
+}
+
+// dnsClient sends DNS queries directly to DNS servers, instead of using the system resolver.
+// This is needed to follow CNAME chains hop by hop, since the system resolver only returns the last hostname of the chain.
+// The answers are cached for the whole run, so every hostname is only queried once no matter how many targets share it.
+type dnsClient struct {
+	// If there are none, the system resolver is used instead.
+	resolvers []dnsResolver
+	timeout   time.Duration
+	// Used for the DNS over HTTPS resolvers
+	httpClient *http.Client
+	// The queries are spread between the resolvers in a round-robin fashion
+	nextResolver atomic.Uint32
+
+	cacheMutex sync.Mutex
+	cache      map[string]*dnsCacheEntry
+}
+
+type dnsCacheEntry struct {
+	// Concurrent lookups of the same hostname wait for the first one, instead of sending their own queries
+	once    sync.Once
+	answers []string
+	err     error
+}
+
+// newDNSClient creates a dnsClient that uses the resolvers listed in the given file, or the DNS servers of /etc/resolv.conf if the path is empty.
+func newDNSClient(resolversFilepath string, timeout time.Duration) (*dnsClient, error) {
+	var resolvers []dnsResolver
+	if resolversFilepath == "" {
+		for _, server := range readResolvConf("/etc/resolv.conf") {
+			resolvers = append(resolvers, dnsResolver{network: "udp", address: server})
+		}
+	} else {
+		var err error
+		resolvers, err = readResolversFile(resolversFilepath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &dnsClient{
+		resolvers:  resolvers,
+		timeout:    timeout,
+		httpClient: newHTTPClient(timeout),
+		cache:      map[string]*dnsCacheEntry{},
+	}, nil
+}
+
+// readResolvConf returns the addresses of the nameservers listed in a resolv.conf file.
+func readResolvConf(path string) []string {
+	file, err := os.Open(path) // #nosec G304 -- The path is a constant.
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			// Remove the zone of link-local IPv6 addresses, like "fe80::1%eth0"
+			ip := net.ParseIP(strings.SplitN(fields[1], "%", 2)[0])
+			if ip != nil {
+				servers = append(servers, net.JoinHostPort(ip.String(), "53"))
+			}
+		}
+	}
+	return servers
+}
+
+// readResolversFile reads a --resolvers file, with one resolver per line. Empty lines and lines starting with "#" are ignored.
+func readResolversFile(path string) ([]dnsResolver, error) {
+	file, err := os.Open(path) // #nosec G304 -- Intended functionality.
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var resolvers []dnsResolver
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		resolver, err := parseResolver(line)
+		if err != nil {
+			return nil, err
+		}
+		resolvers = append(resolvers, resolver)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(resolvers) == 0 {
+		return nil, errors.New("the resolvers file " + path + " doesn't have any resolvers")
+	}
+	return resolvers, nil
+}
+
+// parseResolver parses a line of a --resolvers file. Valid formats are:
+//
+//	8.8.8.8
+//	8.8.8.8:53
+//	udp://8.8.8.8:53
+//	tcp://[2001:4860:4860::8888]:53
+//	https://dns.google/dns-query
+func parseResolver(line string) (dnsResolver, error) {
+	if strings.HasPrefix(line, "https://") {
+		return dnsResolver{network: "https", address: line}, nil
+	}
+
+	resolver := dnsResolver{network: "udp", address: line}
+	if network, address, found := strings.Cut(line, "://"); found {
+		if network != "udp" && network != "tcp" {
+			return dnsResolver{}, errors.New("invalid resolver \"" + line + "\". Valid protocols are \"udp://\", \"tcp://\" and \"https://\"")
+		}
+		resolver.network, resolver.address = network, address
+	}
+
+	if ip := net.ParseIP(strings.Trim(resolver.address, "[]")); ip != nil {
+		resolver.address = net.JoinHostPort(ip.String(), "53")
+	} else if _, _, err := net.SplitHostPort(resolver.address); err != nil {
+		if strings.Contains(resolver.address, ":") || resolver.address == "" {
+			return dnsResolver{}, errors.New("invalid resolver \"" + line + "\"")
+		}
+		resolver.address = net.JoinHostPort(resolver.address, "53")
+	}
+	return resolver, nil
+}
+
+// lookupCNAME returns the hostname that the CNAME record of the given hostname points to, or an empty string if it doesn't have a CNAME record.
+// The hostname is only resolved a single hop.
+func (client *dnsClient) lookupCNAME(ctx context.Context, hostname string) (string, error) {
+	answers, err := client.cachedLookup(ctx, "CNAME", hostname, client.queryCNAME)
+	if err != nil || len(answers) == 0 {
+		return "", err
+	}
+	return answers[0], nil
+}
+
+// lookupHost returns the IPv4 and IPv6 addresses of the hostname. A hostname that doesn't exist has no addresses, but isn't an error.
+func (client *dnsClient) lookupHost(ctx context.Context, hostname string) ([]string, error) {
+	return client.cachedLookup(ctx, "A", hostname, client.queryHost)
+}
+
+// cachedLookup runs the lookup, unless the same type of lookup was already done for the hostname during this run.
+// Lookups that fail because the context was cancelled aren't cached, so that they're retried by the next caller.
+func (client *dnsClient) cachedLookup(ctx context.Context, lookupType string, hostname string, lookup func(ctx context.Context, hostname string) ([]string, error)) ([]string, error) {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	key := lookupType + " " + hostname
+	client.cacheMutex.Lock()
+	if client.cache == nil {
+		client.cache = map[string]*dnsCacheEntry{}
+	}
+	entry, found := client.cache[key]
+	if !found {
+		entry = &dnsCacheEntry{}
+		client.cache[key] = entry
+	}
+	client.cacheMutex.Unlock()
+
+	entry.once.Do(func() {
+		entry.answers, entry.err = lookup(ctx, hostname)
+	})
+	if entry.err != nil && ctx.Err() != nil {
+		client.cacheMutex.Lock()
+		if client.cache[key] == entry {
+			delete(client.cache, key)
+		}
+		client.cacheMutex.Unlock()
+	}
+	return entry.answers, entry.err
+}
+
+// queryCNAME does the actual lookup of lookupCNAME, without the cache.
+func (client *dnsClient) queryCNAME(ctx context.Context, hostname string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, client.timeout)
+	defer cancel()
+
+	if len(client.resolvers) == 0 {
+		// The system resolver follows the whole chain, so the last hostname of the chain is returned as a single hop
+		canonicalName, err := net.DefaultResolver.LookupCNAME(ctx, hostname)
+		if err != nil {
+			return nil, err
+		}
+		canonicalName = strings.TrimSuffix(canonicalName, ".")
+		if strings.EqualFold(canonicalName, hostname) {
+			return nil, nil
+		}
+		return []string{canonicalName}, nil
+	}
+
+	response, err := client.query(ctx, hostname, dnsmessage.TypeCNAME)
+	if err != nil {
+		return nil, err
+	}
+	for _, answer := range response.Answers {
+		if cname, isCNAME := answer.Body.(*dnsmessage.CNAMEResource); isCNAME && strings.EqualFold(strings.TrimSuffix(answer.Header.Name.String(), "."), hostname) {
+			return []string{strings.TrimSuffix(cname.CNAME.String(), ".")}, nil
+		}
+	}
+	return nil, nil
+}
+
+// queryHost does the actual lookup of lookupHost, without the cache.
+func (client *dnsClient) queryHost(ctx context.Context, hostname string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, client.timeout)
+	defer cancel()
+
+	if len(client.resolvers) == 0 {
+		addresses, err := net.DefaultResolver.LookupHost(ctx, hostname)
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, nil
+		}
+		return addresses, err
+	}
+
+	// The answers also include the CNAME records that lead to the addresses, which are skipped
+	var addresses []string
+	for _, queryType := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		response, err := client.query(ctx, hostname, queryType)
+		if err != nil {
+			return nil, err
+		}
+		for _, answer := range response.Answers {
+			switch body := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				addresses = append(addresses, net.IP(body.A[:]).String())
+			case *dnsmessage.AAAAResource:
+				addresses = append(addresses, net.IP(body.AAAA[:]).String())
+			}
+		}
+	}
+	return addresses, nil
+}
+
+// query sends the query to the resolvers. If a resolver fails, the next one is tried.
+func (client *dnsClient) query(ctx context.Context, hostname string, queryType dnsmessage.Type) (*dnsmessage.Message, error) {
+	var lastErr error
+	first := int(client.nextResolver.Add(1))
+	for i := range client.resolvers {
+		resolver := client.resolvers[(first+i)%len(client.resolvers)]
+		response, err := client.exchange(ctx, resolver, hostname, queryType)
+		if err == nil {
+			return response, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// cnameChain follows the CNAME records of the hostname, and returns every hostname of the chain after it.
+// The chain stops after maxDepth hops, or when a hostname repeats itself.
+func (client *dnsClient) cnameChain(ctx context.Context, hostname string, maxDepth int) []string {
+	seen := map[string]bool{strings.ToLower(hostname): true}
+	var chain []string
+	current := hostname
+	for len(chain) < maxDepth {
+		next, err := client.lookupCNAME(ctx, current)
+		if err != nil || next == "" {
+			break
+		}
+		next = strings.ToLower(next)
+		if seen[next] {
+			// CNAME loop
+			break
+		}
+		seen[next] = true
+		chain = append(chain, next)
+		current = next
+	}
+	return chain
+}
+
+// exchange sends a single DNS query to the resolver.
+func (client *dnsClient) exchange(ctx context.Context, resolver dnsResolver, hostname string, queryType dnsmessage.Type) (*dnsmessage.Message, error) {
+	query, id, err := buildDNSQuery(hostname, queryType)
+	if err != nil {
+		return nil, err
+	}
+
+	var packed []byte
+	switch resolver.network {
+	case "https":
+		packed, err = exchangeDNSOverHTTPS(ctx, client.httpClient, resolver.address, query)
+	case "tcp":
+		packed, err = exchangeDNSOverConn(ctx, "tcp", resolver.address, query)
+	default:
+		packed, err = exchangeDNSOverConn(ctx, "udp", resolver.address, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := unpackDNSResponse(packed, id)
+	if err == nil && response.Truncated && resolver.network == "udp" {
+		// The response didn't fit in a UDP packet
+		packed, err = exchangeDNSOverConn(ctx, "tcp", resolver.address, query)
+		if err != nil {
+			return nil, err
+		}
+		return unpackDNSResponse(packed, id)
+	}
+	return response, err
+}
+
+// buildDNSQuery builds a recursive DNS query for the hostname, and returns it together with its ID.
+func buildDNSQuery(hostname string, queryType dnsmessage.Type) ([]byte, uint16, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(hostname, ".") + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+	id := uint16(rand.IntN(1 << 16)) // #nosec G404 -- DNS query IDs don't need a cryptographically secure random number generator.
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: queryType, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	return packed, id, err
+}
+
+// unpackDNSResponse parses a DNS response, and makes sure that it answers the query with the given ID.
+func unpackDNSResponse(packed []byte, id uint16) (*dnsmessage.Message, error) {
+	var response dnsmessage.Message
+	if err := response.Unpack(packed); err != nil {
+		return nil, err
+	}
+	if response.ID != id {
+		return nil, errors.New("the DNS server replied with a different query ID")
+	}
+	if response.RCode != dnsmessage.RCodeSuccess && response.RCode != dnsmessage.RCodeNameError {
+		return nil, errors.New("the DNS server replied with " + response.RCode.String())
+	}
+	return &response, nil
+}
+
+// exchangeDNSOverConn sends the query over UDP or TCP, and returns the raw response. Over TCP, messages are prefixed with their length.
+func exchangeDNSOverConn(ctx context.Context, network string, server string, query []byte) ([]byte, error) {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		conn.SetDeadline(deadline) // #nosec G104 -- If the deadline can't be set, the context still stops the query.
+	}
+
+	if network == "tcp" {
+		packed := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+		packed = append(packed, query...)
+		if _, err = conn.Write(packed); err != nil {
+			return nil, err
+		}
+		var length uint16
+		if err = binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		packed = make([]byte, length)
+		if _, err = io.ReadFull(conn, packed); err != nil {
+			return nil, err
+		}
+		return packed, nil
+	}
+
+	if _, err = conn.Write(query); err != nil {
+		return nil, err
+	}
+	packed := make([]byte, 65535)
+	n, err := conn.Read(packed)
+	if err != nil {
+		return nil, err
+	}
+	return packed[:n], nil
+}
+
+// exchangeDNSOverHTTPS sends the query to a DNS over HTTPS endpoint (RFC 8484), and returns the raw response.
+func exchangeDNSOverHTTPS(ctx context.Context, httpClient *http.Client, endpoint string, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("the DNS over HTTPS server replied with \"" + resp.Status + "\"")
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxDoHResponseSize))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// scopeInterpretation is how a scope line was interpreted, for --dry-run.
+type scopeInterpretation struct {
+	line string
+	// Like "hostname" or "wildcard". Empty if the line couldn't be parsed.
+	kind string
+	// The scope as it's matched, like "*.example.com"
+	normalized string
+	// The regex that the targets are matched against, for the wildcards and regexes
+	regex string
+	err   error
+}
+
+// interpretScopeLines parses every scope line on its own, like parseAllLines, but keeps how each line was interpreted, including the lines that couldn't be parsed.
+func interpretScopeLines(lines []string, privateTLDsAreEnabled bool) []scopeInterpretation {
+	// The parse errors are already part of the interpretations
+	previousHideWarnings := hideWarnings
+	hideWarnings = true
+	defer func() { hideWarnings = previousHideWarnings }()
+
+	var interpretations []scopeInterpretation
+	for _, line := range lines {
+		scopeLine, _ := splitScopeComment(line)
+		if scopeLine == "" {
+			continue
+		}
+		interpretation := scopeInterpretation{line: line}
+		scope, err := parseLine(scopeLine, true, privateTLDsAreEnabled)
+		if err != nil || scope == nil {
+			interpretation.err = err
+			if err == nil {
+				interpretation.err = ErrInvalidFormat
+			}
+		} else {
+			interpretation.kind = scopeKindName(scope)
+			interpretation.normalized = scopeToString(scope)
+			switch assertedScope := scope.(type) {
+			case *WildcardScope:
+				interpretation.regex = assertedScope.scope.String()
+			case *regexp.Regexp:
+				interpretation.regex = assertedScope.String()
+			}
+		}
+		interpretations = append(interpretations, interpretation)
+	}
+	return interpretations
+}
+
+// scopeKindName returns the name of the type of a scope returned by parseLine, like "wildcard".
+func scopeKindName(scope interface{}) string {
+	switch scope.(type) {
+	case string:
+		return "hostname"
+	case *net.IP:
+		return "ip"
+	case *net.IPNet:
+		return "cidr"
+	case *NmapIPRange:
+		return "nmap-range"
+	case *regexp.Regexp:
+		return "regex"
+	case *WildcardScope:
+		return "wildcard"
+	case *MobileApp:
+		return "mobile-app"
+	case *Repository:
+		return "repository"
+	case *ContractAddress:
+		return "contract"
+	case *BinaryScope:
+		return "binary"
+	}
+	return "unknown"
+}
+
+// printDryRun prints how every scope line was interpreted, and how many targets would be read, for --dry-run. It returns how many scope lines couldn't be parsed.
+// targets is nil when no targets were given.
+func printDryRun(w io.Writer, inscopeLines []string, noscopeLines []string, privateTLDsAreEnabled bool, targets <-chan string) int {
+	invalidLines := 0
+	for _, list := range []struct {
+		name  string
+		lines []string
+	}{{"In-scope", inscopeLines}, {"Out-of-scope", noscopeLines}} {
+		interpretations := interpretScopeLines(list.lines, privateTLDsAreEnabled)
+		fmt.Fprintln(w, "[+] "+list.name+" rules ("+strconv.Itoa(len(interpretations))+"):")
+		for _, interpretation := range interpretations {
+			if interpretation.err != nil {
+				invalidLines++
+				fmt.Fprintln(w, "\t[-] "+interpretation.line+" -> invalid: "+interpretation.err.Error())
+				continue
+			}
+			description := interpretation.kind + " " + interpretation.normalized
+			if interpretation.regex != "" && interpretation.regex != interpretation.normalized {
+				description += " (regex: " + interpretation.regex + ")"
+			}
+			fmt.Fprintln(w, "\t[+] "+interpretation.line+" -> "+description)
+		}
+	}
+
+	if targets == nil {
+		fmt.Fprintln(w, "[+] No targets were given.")
+		return invalidLines
+	}
+	targetCount := 0
+	for line := range targets {
+		if isTargetLine(strings.TrimSpace(line)) {
+			targetCount++
+		}
+	}
+	fmt.Fprintln(w, "[+] "+strconv.Itoa(targetCount)+" targets would be read.")
+	return invalidLines
+}
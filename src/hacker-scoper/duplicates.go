@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Set with "--merge-duplicates". The firebounty entries of the same program are selected together, as a single company.
+var mergeDuplicatePrograms bool
+
+// programIdentity is the part of a firebounty entry used to find the other entries of the same program.
+type programIdentity struct {
+	Slug string `json:"slug"`
+	URL  string `json:"url"`
+}
+
+// extractProgramIdentities reads the slug and program URL of every company of the firebounty database, in the same order as extractCompanyNames.
+func extractProgramIdentities(jsonPath string) ([]programIdentity, error) {
+	file, err := os.Open(jsonPath) // #nosec G304 -- Intended behavior
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var partial struct {
+		Pgms []programIdentity `json:"pgms"`
+	}
+	err = json.NewDecoder(file).Decode(&partial)
+	if err != nil {
+		return nil, err
+	}
+	return partial.Pgms, nil
+}
+
+// normalizeProgramURL returns the form of a program URL used to compare programs across platforms, like "example.com/security" for "https://www.Example.com/security/".
+func normalizeProgramURL(rawURL string) string {
+	normalized := strings.ToLower(strings.TrimSpace(rawURL))
+	normalized = strings.TrimPrefix(normalized, "https://")
+	normalized = strings.TrimPrefix(normalized, "http://")
+	normalized = strings.TrimPrefix(normalized, "www.")
+	return strings.TrimSuffix(normalized, "/")
+}
+
+// duplicateProgramGroups splits the matched companies into groups of entries of the same program. Entries are the same program when they have the same program URL,
+// or when the slug of one of them is the slug of the other followed by a suffix, like "example" and "example-bugcrowd".
+// The other entries of the same programs are added to the groups, even if their names didn't match the search. Every group is sorted by company index.
+func duplicateProgramGroups(matches []firebountySearchMatch, companyNames []string, identities []programIdentity) [][]firebountySearchMatch {
+	indexesBySlug := map[string][]int{}
+	indexesByURL := map[string][]int{}
+	// The entries whose slug starts with the key, followed by "-"
+	indexesBySlugPrefix := map[string][]int{}
+	for i, identity := range identities {
+		slug := strings.ToLower(identity.Slug)
+		if slug != "" {
+			indexesBySlug[slug] = append(indexesBySlug[slug], i)
+			for dash := strings.IndexByte(slug, '-'); dash > 0; dash = nextDash(slug, dash) {
+				indexesBySlugPrefix[slug[:dash]] = append(indexesBySlugPrefix[slug[:dash]], i)
+			}
+		}
+		if programURL := normalizeProgramURL(identity.URL); programURL != "" {
+			indexesByURL[programURL] = append(indexesByURL[programURL], i)
+		}
+	}
+
+	// The entries that are the same program as the given entry
+	duplicatesOf := func(index int) []int {
+		var duplicates []int
+		slug := strings.ToLower(identities[index].Slug)
+		if slug != "" {
+			duplicates = append(duplicates, indexesBySlug[slug]...)
+			duplicates = append(duplicates, indexesBySlugPrefix[slug]...)
+			for dash := strings.IndexByte(slug, '-'); dash > 0; dash = nextDash(slug, dash) {
+				duplicates = append(duplicates, indexesBySlug[slug[:dash]]...)
+			}
+		}
+		if programURL := normalizeProgramURL(identities[index].URL); programURL != "" {
+			duplicates = append(duplicates, indexesByURL[programURL]...)
+		}
+		return duplicates
+	}
+
+	grouped := map[int]bool{}
+	var groups [][]firebountySearchMatch
+	for _, match := range matches {
+		if grouped[match.companyIndex] || match.companyIndex >= len(identities) {
+			continue
+		}
+
+		// Every entry that is reachable through duplicates is the same program
+		var group []firebountySearchMatch
+		pending := []int{match.companyIndex}
+		grouped[match.companyIndex] = true
+		for len(pending) > 0 {
+			index := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			group = append(group, firebountySearchMatch{index, strings.ToLower(strings.TrimSpace(companyNames[index]))})
+			for _, duplicate := range duplicatesOf(index) {
+				if !grouped[duplicate] {
+					grouped[duplicate] = true
+					pending = append(pending, duplicate)
+				}
+			}
+		}
+
+		slices.SortFunc(group, func(a, b firebountySearchMatch) int { return a.companyIndex - b.companyIndex })
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// nextDash returns the index of the next "-" of the slug after the given index, or -1 if there are no more.
+func nextDash(slug string, previous int) int {
+	next := strings.IndexByte(slug[previous+1:], '-')
+	if next == -1 {
+		return -1
+	}
+	return previous + 1 + next
+}
+
+// groupName describes a group of entries of the same program, like "example (merged: example, example bugcrowd)".
+func groupName(group []firebountySearchMatch) string {
+	if len(group) == 1 {
+		return group[0].companyName
+	}
+	var names []string
+	for _, match := range group {
+		names = append(names, match.companyName)
+	}
+	return group[0].companyName + " (merged: " + strings.Join(names, ", ") + ")"
+}
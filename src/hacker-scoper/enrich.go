@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The checks run by --enrich when --enrich-checks isn't specified
+const defaultEnrichChecks = "cname,tls,favicon"
+
+// How long every network request made by the enrichment checks can take
+const enrichTimeout = 5 * time.Second
+
+// Favicons bigger than this are ignored
+const maxFaviconSize = 1 << 20
+
+// Amount of in-scope hostnames whose favicons are downloaded for the favicon check
+const maxFaviconReferences = 20
+
+// enricher runs the --enrich checks on unsure targets, looking for signals that they might belong to the program anyway.
+type enricher struct {
+	checks        []string
+	inscopeScopes *[]interface{}
+	explicitLevel *int
+	resolver      *dnsClient
+	cnameDepth    int
+	httpClient    *http.Client
+
+	// The favicons of the in-scope hostnames are only downloaded once, the first time they're needed
+	faviconReferenceURLs []string
+	faviconHashesOnce    sync.Once
+	faviconHashes        map[string]string
+}
+
+// newEnricher validates the comma-separated list of checks, and prepares them. The resolver is used by the cname check.
+func newEnricher(checks string, inscopeScopes *[]interface{}, explicitLevel *int, resolver *dnsClient, cnameDepth int) (*enricher, error) {
+	e := &enricher{
+		inscopeScopes: inscopeScopes,
+		explicitLevel: explicitLevel,
+		resolver:      resolver,
+		cnameDepth:    cnameDepth,
+		httpClient: &http.Client{
+			Timeout: enrichTimeout,
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				// Unsure assets often have self-signed or mismatched certificates. We only download their favicons.
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // #nosec G402 -- Intended functionality.
+			},
+		},
+	}
+
+	for _, check := range strings.Split(checks, ",") {
+		check = strings.ToLower(strings.TrimSpace(check))
+		switch check {
+		case "cname", "tls", "favicon":
+			e.checks = append(e.checks, check)
+		case "":
+		default:
+			return nil, errors.New("unknown check \"" + check + "\". Valid checks are \"cname\", \"tls\" and \"favicon\"")
+		}
+	}
+	if len(e.checks) == 0 {
+		return nil, errors.New("no checks selected")
+	}
+
+	// The favicons of the in-scope hostnames are the reference for the favicon check
+	for _, scope := range *inscopeScopes {
+		if hostname, isHostname := scope.(string); isHostname && len(e.faviconReferenceURLs) < maxFaviconReferences {
+			e.faviconReferenceURLs = append(e.faviconReferenceURLs, "https://"+hostname+"/favicon.ico")
+		}
+	}
+	return e, nil
+}
+
+// enrich runs every check on the target, and returns the signals that fired, like "cname:cdn.example.com".
+// The checks stop early if the context is cancelled.
+func (e *enricher) enrich(ctx context.Context, parsedTarget interface{}) []string {
+	components := getTargetComponents(parsedTarget)
+	if components.Host == "" {
+		return nil
+	}
+
+	var signals []string
+	for _, check := range e.checks {
+		if ctx.Err() != nil {
+			break
+		}
+		var signal string
+		switch check {
+		case "cname":
+			// Emails and IP addresses don't have CNAME records
+			if components.IP == "" && components.Scheme != "mailto" {
+				signal = e.checkCNAME(ctx, components.Host)
+			}
+		case "tls":
+			if components.Scheme != "mailto" {
+				signal = e.checkTLS(ctx, components)
+			}
+		case "favicon":
+			if components.Scheme != "mailto" {
+				signal = e.checkFavicon(ctx, components)
+			}
+		}
+		if signal != "" {
+			signals = append(signals, signal)
+		}
+	}
+	return signals
+}
+
+// isInscopeHostname reports whether the hostname matches any of the in-scope scopes.
+func (e *enricher) isInscopeHostname(hostname string) bool {
+	target := prepareTarget(&url.URL{Host: strings.TrimSuffix(hostname, ".")})
+	return findMatchingScope(e.inscopeScopes, target, e.explicitLevel) != nil
+}
+
+// checkCNAME fires if the CNAME chain of the host reaches an in-scope hostname.
+func (e *enricher) checkCNAME(ctx context.Context, host string) string {
+	for _, cname := range e.resolver.cnameChain(ctx, host, e.cnameDepth) {
+		if e.isInscopeHostname(cname) {
+			return "cname:" + cname
+		}
+	}
+	return ""
+}
+
+// checkTLS fires if the TLS certificate of the target is also valid for an in-scope hostname.
+func (e *enricher) checkTLS(ctx context.Context, components targetComponents) string {
+	port := components.Port
+	if port == "" || components.Scheme == "http" {
+		port = "443"
+	}
+	config := &tls.Config{InsecureSkipVerify: true} // #nosec G402 -- We only read the certificate, we don't trust it.
+	if components.IP == "" {
+		config.ServerName = components.Host
+	}
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: enrichTimeout}, Config: config}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(components.Host, port))
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+
+	certificates := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		return ""
+	}
+	for _, name := range certificates[0].DNSNames {
+		name = strings.TrimPrefix(name, "*.")
+		if e.isInscopeHostname(name) {
+			return "tls-san:" + name
+		}
+	}
+	return ""
+}
+
+// checkFavicon fires if the favicon of the target is identical to the favicon of an in-scope hostname.
+func (e *enricher) checkFavicon(ctx context.Context, components targetComponents) string {
+	e.faviconHashesOnce.Do(func() { e.loadFaviconHashes(ctx) })
+	if len(e.faviconHashes) == 0 {
+		return ""
+	}
+
+	scheme := components.Scheme
+	if scheme != "http" {
+		scheme = "https"
+	}
+	host := components.Host
+	if components.Port != "" {
+		host = net.JoinHostPort(host, components.Port)
+	}
+	hash, err := e.faviconHash(ctx, scheme+"://"+host+"/favicon.ico")
+	if err != nil {
+		return ""
+	}
+	if reference, found := e.faviconHashes[hash]; found {
+		return "favicon:" + reference
+	}
+	return ""
+}
+
+// loadFaviconHashes downloads the favicons of the in-scope hostnames in parallel.
+func (e *enricher) loadFaviconHashes(ctx context.Context) {
+	e.faviconHashes = map[string]string{}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, referenceURL := range e.faviconReferenceURLs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hash, err := e.faviconHash(ctx, referenceURL)
+			if err != nil {
+				return
+			}
+			parsedURL, _ := url.Parse(referenceURL) // #nosec G104 -- The reference URLs are built by newEnricher.
+			mutex.Lock()
+			e.faviconHashes[hash] = parsedURL.Host
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+}
+
+// faviconHash downloads the favicon at the given URL and returns its SHA-256 hash.
+func (e *enricher) faviconHash(ctx context.Context, faviconURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, faviconURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("no favicon")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFaviconSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) == 0 || len(data) > maxFaviconSize {
+		return "", errors.New("invalid favicon")
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// rankLeads sorts the enriched unsure results so that the ones with the most signals come first.
+func rankLeads(leads []targetResult) {
+	sort.SliceStable(leads, func(i, j int) bool {
+		return len(leads[i].signals) > len(leads[j].signals)
+	})
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The formats supported by --export-scope
+var scopeExportFormats = []string{"caido", "mitmproxy"}
+
+// The formats supported by --export-exclusions
+var exclusionExportFormats = []string{"nuclei", "katana"}
+
+// The maximum amount of globs that a single IP range can be expanded into for Caido
+const maxCaidoGlobsPerRange = 256
+
+// caidoScope is a Caido scope preset, with the same fields as the "Create scope" form and API of Caido.
+type caidoScope struct {
+	Name      string   `json:"name"`
+	Allowlist []string `json:"allowlist"`
+	Denylist  []string `json:"denylist"`
+}
+
+// exportScope writes the effective in-scope and out-of-scope rules in the scope format of a proxy.
+// Rules that can't be represented in the format are skipped with a warning.
+func exportScope(w io.Writer, format string, name string, inscopeScopes []interface{}, noscopeScopes []interface{}, inscopeExplicitLevel int, noscopeExplicitLevel int) error {
+	switch format {
+	case "caido":
+		scope := caidoScope{
+			Name:      name,
+			Allowlist: caidoGlobs(inscopeScopes, inscopeExplicitLevel),
+			Denylist:  caidoGlobs(noscopeScopes, noscopeExplicitLevel),
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(scope)
+
+	case "mitmproxy":
+		allow := mitmproxyFilter(inscopeScopes, inscopeExplicitLevel)
+		if allow == "" {
+			return errors.New("none of the in-scope rules can be represented as mitmproxy filter expressions")
+		}
+		if deny := mitmproxyFilter(noscopeScopes, noscopeExplicitLevel); deny != "" {
+			allow += " & !" + deny
+		}
+		block := "!(" + allow + ")"
+		separator := blockListSeparator(block)
+
+		// The binaries can't be filtered by a proxy, but they're still part of the scope
+		binaries := ""
+		if lines := binaryScopeLines(inscopeScopes); len(lines) > 0 {
+			binaries = "# In-scope binaries and file hashes, which can't be filtered by mitmproxy: " + strings.Join(lines, ", ") + "\n"
+		}
+
+		_, err := fmt.Fprint(w, "# mitmproxy options generated by hacker-scoper. Save them in ~/.mitmproxy/config.yaml, or pass them with --set.\n"+
+			binaries+
+			"# Only show the in-scope flows\n"+
+			"view_filter: "+yamlSingleQuote(allow)+"\n"+
+			"# Block every flow that isn't in scope with a 403\n"+
+			"block_list:\n"+
+			"  - "+yamlSingleQuote(separator+block+separator+"403")+"\n")
+		return err
+	}
+	return errors.New("unknown export format " + format)
+}
+
+// exportExclusions writes the out-of-scope rules as a list of exclusions for a scanner, with one exclusion per line, so that the list can be given to the scanner as a file:
+// - nuclei: hostnames, IP addresses and CIDR ranges for -exclude-hosts.
+// - katana: URL regexes for -crawl-out-scope.
+// Rules that can't be represented in the format are skipped with a warning.
+func exportExclusions(w io.Writer, format string, noscopeScopes []interface{}, noscopeExplicitLevel int) error {
+	var exclusions []string
+	switch format {
+	case "nuclei":
+		exclusions = nucleiExcludedHosts(noscopeScopes)
+	case "katana":
+		exclusions = katanaOutOfScopeRegexes(noscopeScopes, noscopeExplicitLevel)
+	default:
+		return errors.New("unknown export format " + format)
+	}
+	if len(exclusions) == 0 {
+		return errors.New("none of the out-of-scope rules can be exported to " + format)
+	}
+	_, err := io.WriteString(w, strings.Join(exclusions, "\n")+"\n")
+	return err
+}
+
+// nucleiExcludedHosts converts the scopes into the hosts accepted by the -exclude-hosts argument of nuclei, which doesn't support wildcards.
+func nucleiExcludedHosts(scopes []interface{}) []string {
+	var hosts []string
+	for _, scope := range scopes {
+		switch assertedScope := scope.(type) {
+		case string, *net.IP, *net.IPNet:
+			hosts = append(hosts, scopeToString(assertedScope))
+		case *NmapIPRange:
+			// Only the ranges without any fully wildcarded octet can be expanded into IP addresses
+			ips, err := ipRangeGlobs(assertedScope)
+			if err != nil || slices.ContainsFunc(ips, func(ip string) bool { return strings.Contains(ip, "*") }) {
+				warning(warnUnsupportedExport, "The scope \""+assertedScope.Raw+"\" can't be exported to nuclei, since it's too big to be expanded into IP addresses.")
+				continue
+			}
+			hosts = append(hosts, ips...)
+		case *MobileApp, *Repository, *ContractAddress, *BinaryScope:
+			// App, repository, contract and binary scopes don't apply to web targets
+		default:
+			warning(warnUnsupportedExport, "The scope \""+scopeToString(assertedScope)+"\" can't be exported to nuclei, since -exclude-hosts doesn't support wildcards or regexes.")
+		}
+	}
+	return hosts
+}
+
+// katanaOutOfScopeRegexes converts the scopes into URL regexes for the -crawl-out-scope argument of katana.
+func katanaOutOfScopeRegexes(scopes []interface{}, explicitLevel int) []string {
+	// The regexes of the hosts are wrapped with the scheme and the optional port of the URLs
+	urlRegex := func(hostRegex string) string {
+		return `^[a-zA-Z][a-zA-Z0-9+.-]*://` + hostRegex + `(:\d+)?(/|\?|#|$)`
+	}
+
+	var regexes []string
+	for _, scope := range scopes {
+		// The scopes of some sources can have their own level
+		level := ExplicitLevel(scopeExplicitLevel(scope, explicitLevel))
+		switch assertedScope := scope.(type) {
+		case string:
+			hostRegex := regexp.QuoteMeta(assertedScope)
+			// Hostname scopes also match their subdomains in --explicit-level=0 and 1
+			if level <= ExplicitLevelSubdomains {
+				hostRegex = `([^/?#]*\.)?` + hostRegex
+			}
+			regexes = append(regexes, urlRegex(hostRegex))
+		case *WildcardScope:
+			if level != ExplicitLevelStrict {
+				// The wildcards can't match past the host
+				regexes = append(regexes, urlRegex(hostWildcardRegex.Replace(assertedScope.hostPattern())))
+			}
+		case *regexp.Regexp:
+			// Regex scopes are already matched against the whole target
+			regexes = append(regexes, assertedScope.String())
+		case *net.IP:
+			hostRegex := regexp.QuoteMeta(assertedScope.String())
+			// IPv6 addresses are enclosed in brackets in URLs
+			if assertedScope.To4() == nil {
+				hostRegex = `\[` + hostRegex + `\]`
+			}
+			regexes = append(regexes, urlRegex(hostRegex))
+		case *net.IPNet, *NmapIPRange:
+			octets, err := ipRangeOctets(assertedScope)
+			if err != nil {
+				warning(warnUnsupportedExport, "The scope \""+scopeToString(assertedScope)+"\" can't be exported to katana: "+err.Error())
+				continue
+			}
+			regexes = append(regexes, urlRegex(octetsRegex(octets)))
+		}
+	}
+	return regexes
+}
+
+// Restricts the wildcards of a wildcard scope regex to the host, so that "*" and "?" can't match past it.
+var hostWildcardRegex = strings.NewReplacer("\\.", "\\.", ".*", "[^/?#]*", ".", "[^/?#]")
+
+// caidoGlobs converts the scopes into the hostname globs used by Caido.
+func caidoGlobs(scopes []interface{}, explicitLevel int) []string {
+	globs := []string{}
+	for _, scope := range scopes {
+		level := ExplicitLevel(scopeExplicitLevel(scope, explicitLevel))
+		switch assertedScope := scope.(type) {
+		case string:
+			globs = append(globs, assertedScope)
+			// Hostname scopes also match their subdomains in --explicit-level=0 and 1
+			if level <= ExplicitLevelSubdomains {
+				globs = append(globs, "*."+assertedScope)
+			}
+		case *WildcardScope:
+			if level != ExplicitLevelStrict {
+				globs = append(globs, scopeToString(assertedScope))
+			}
+		case *net.IP:
+			globs = append(globs, assertedScope.String())
+		case *net.IPNet, *NmapIPRange:
+			rangeGlobs, err := ipRangeGlobs(assertedScope)
+			if err != nil {
+				warning(warnUnsupportedExport, "The scope \""+scopeToString(assertedScope)+"\" can't be exported to Caido: "+err.Error())
+				continue
+			}
+			globs = append(globs, rangeGlobs...)
+		case *MobileApp, *Repository, *ContractAddress, *BinaryScope:
+			// App, repository, contract and binary scopes don't apply to web targets
+		default:
+			warning(warnUnsupportedExport, "The scope \""+scopeToString(assertedScope)+"\" can't be exported to Caido, since Caido only supports hostname globs.")
+		}
+	}
+	return globs
+}
+
+// ipRangeGlobs expands a CIDR or nmap IP range into Caido globs. Octets that accept every value become a "*".
+func ipRangeGlobs(scope interface{}) ([]string, error) {
+	octets, err := ipRangeOctets(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	globs := []string{""}
+	for i, values := range octets {
+		var parts []string
+		if len(values) == 256 {
+			parts = []string{"*"}
+		} else {
+			for _, value := range values {
+				parts = append(parts, strconv.Itoa(int(value)))
+			}
+		}
+		if len(globs)*len(parts) > maxCaidoGlobsPerRange {
+			return nil, errors.New("it would need more than " + strconv.Itoa(maxCaidoGlobsPerRange) + " globs")
+		}
+
+		var expanded []string
+		for _, glob := range globs {
+			for _, part := range parts {
+				if i > 0 {
+					expanded = append(expanded, glob+"."+part)
+				} else {
+					expanded = append(expanded, part)
+				}
+			}
+		}
+		globs = expanded
+	}
+	return globs, nil
+}
+
+// ipRangeOctets returns the values accepted by every octet of an IPv4 CIDR or nmap IP range.
+func ipRangeOctets(scope interface{}) ([4][]uint8, error) {
+	var octets [4][]uint8
+	switch assertedScope := scope.(type) {
+	case *NmapIPRange:
+		return assertedScope.Octets, nil
+	case *net.IPNet:
+		ip := assertedScope.IP.To4()
+		ones, bits := assertedScope.Mask.Size()
+		if ip == nil || bits != 32 {
+			return octets, errors.New("only IPv4 ranges are supported")
+		}
+		for i := range 4 {
+			// The amount of bits of this octet that are part of the network
+			networkBits := min(max(ones-i*8, 0), 8)
+			first := int(ip[i])
+			last := first | (0xff >> networkBits)
+			for value := first; value <= last; value++ {
+				octets[i] = append(octets[i], uint8(value))
+			}
+		}
+		return octets, nil
+	}
+	return octets, errors.New("not an IP range")
+}
+
+// mitmproxyFilter converts the scopes into a mitmproxy filter expression that matches any of them, or returns an empty string if none of them can be converted.
+func mitmproxyFilter(scopes []interface{}, explicitLevel int) string {
+	var expressions []string
+	for _, scope := range scopes {
+		level := ExplicitLevel(scopeExplicitLevel(scope, explicitLevel))
+		switch assertedScope := scope.(type) {
+		case string:
+			// Hostname scopes are suffixes in --explicit-level=0 and 1
+			hostRegex := regexp.QuoteMeta(assertedScope) + "$"
+			if level > ExplicitLevelSubdomains {
+				hostRegex = "^" + hostRegex
+			}
+			expressions = append(expressions, "~d "+mitmproxyQuote(hostRegex))
+		case *WildcardScope:
+			if level != ExplicitLevelStrict {
+				expressions = append(expressions, "~d "+mitmproxyQuote(assertedScope.scope.String()))
+			}
+		case *regexp.Regexp:
+			// Regex scopes are matched against the whole target
+			expressions = append(expressions, "~u "+mitmproxyQuote(assertedScope.String()))
+		case *net.IP:
+			expressions = append(expressions, "~d "+mitmproxyQuote("^"+regexp.QuoteMeta(assertedScope.String())+"$"))
+		case *net.IPNet, *NmapIPRange:
+			octets, err := ipRangeOctets(assertedScope)
+			if err != nil {
+				warning(warnUnsupportedExport, "The scope \""+scopeToString(assertedScope)+"\" can't be exported to mitmproxy: "+err.Error())
+				continue
+			}
+			expressions = append(expressions, "~d "+mitmproxyQuote("^"+octetsRegex(octets)+"$"))
+		}
+	}
+
+	if len(expressions) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(expressions, " | ") + ")"
+}
+
+// octetsRegex returns an unanchored regex that matches the IPv4 addresses whose octets have the given values.
+func octetsRegex(octets [4][]uint8) string {
+	parts := make([]string, 4)
+	for i, values := range octets {
+		if len(values) == 256 {
+			parts[i] = `\d+`
+			continue
+		}
+		alternatives := make([]string, len(values))
+		for j, value := range values {
+			alternatives[j] = strconv.Itoa(int(value))
+		}
+		parts[i] = strings.Join(alternatives, "|")
+		if len(alternatives) > 1 {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, `\.`)
+}
+
+// mitmproxyQuote returns the argument of a mitmproxy filter, quoting it if it has any characters that would end an unquoted argument.
+func mitmproxyQuote(argument string) string {
+	if !strings.ContainsAny(argument, "()~'\" \t\r\n") {
+		return argument
+	}
+	// Quoted arguments use backslash escapes
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(argument) + `"`
+}
+
+// blockListSeparator returns a character that doesn't appear in the filter, to separate the fields of a mitmproxy block_list entry.
+func blockListSeparator(filter string) string {
+	for _, separator := range []string{"|", "/", ":", "#", "%", ";", ",", "@"} {
+		if !strings.Contains(filter, separator) {
+			return separator
+		}
+	}
+	return "\x00"
+}
+
+// yamlSingleQuote returns the string as a single-quoted YAML scalar, which doesn't have any escape sequences besides doubling the single quotes.
+func yamlSingleQuote(str string) string {
+	return "'" + strings.ReplaceAll(str, "'", "''") + "'"
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// These regexes are used by --extract to find targets inside arbitrary text
+var (
+	extractURLRegex      = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>()\[\]{}\x60\\]+`)
+	extractHostnameRegex = regexp.MustCompile(`(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]{2,63}(?::\d{1,5})?`)
+	extractIPv4Regex     = regexp.MustCompile(`(?:\d{1,3}\.){3}\d{1,3}`)
+	extractIPv6Regex     = regexp.MustCompile(`[0-9a-fA-F]*:[0-9a-fA-F:]*:[0-9a-fA-F:.]*`)
+)
+
+// extractTargets replaces every line received from the given channel with all the URLs, hostnames and IPs that can be found in it.
+func extractTargets(lines <-chan string) <-chan string {
+	out := make(chan string, 128)
+
+	go func() {
+		defer close(out)
+		for line := range lines {
+			for _, target := range extractTargetsFromLine(line) {
+				out <- target
+			}
+		}
+	}()
+
+	return out
+}
+
+// extractTargetsFromLine returns every URL, hostname and IP address found in the given text, without duplicates.
+// Hostnames are only accepted if they end with a public TLD, to avoid matching things like "document.location" in JS files.
+func extractTargetsFromLine(line string) []string {
+	var targets []string
+	seen := make(map[string]bool)
+	add := func(target string) {
+		if !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+
+	// URLs are removed from the line after being extracted, so that their hosts aren't extracted a second time
+	line = extractURLRegex.ReplaceAllStringFunc(line, func(rawURL string) string {
+		add(strings.TrimRight(rawURL, ".,;:!?"))
+		return " "
+	})
+
+	line = extractIPv4Regex.ReplaceAllStringFunc(line, func(rawIP string) string {
+		if ip := net.ParseIP(rawIP); ip != nil {
+			add(rawIP)
+			return " "
+		}
+		return rawIP
+	})
+
+	for _, hostname := range extractHostnameRegex.FindAllString(line, -1) {
+		portless := hostname
+		if host, _, err := net.SplitHostPort(hostname); err == nil {
+			portless = host
+		}
+		if eTLD, icann := publicsuffix.PublicSuffix(strings.ToLower(portless)); icann && eTLD != portless {
+			add(hostname)
+		}
+	}
+
+	for _, rawIP := range extractIPv6Regex.FindAllString(line, -1) {
+		if ip := net.ParseIP(rawIP); ip != nil && ip.To4() == nil {
+			add(rawIP)
+		}
+	}
+
+	return targets
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// This file implements the small expression language used by --filter.
+// Expressions are type-checked when they're compiled, so evaluating them can never fail.
+
+type filterValueType int
+
+const (
+	filterString filterValueType = iota
+	filterNumber
+	filterBool
+)
+
+func (t filterValueType) String() string {
+	switch t {
+	case filterString:
+		return "string"
+	case filterNumber:
+		return "number"
+	}
+	return "boolean"
+}
+
+// filterEnvironment holds the variables that can be used in a --filter expression
+type filterEnvironment struct {
+	target  string
+	host    string
+	ip      string
+	port    float64
+	scheme  string
+	path    string
+	verdict string
+	rule    string
+	unsure  bool
+	related bool
+}
+
+// filterNode is a compiled piece of an expression. Only the function that matches valueType is set.
+type filterNode struct {
+	valueType  filterValueType
+	evalString func(env *filterEnvironment) string
+	evalNumber func(env *filterEnvironment) float64
+	evalBool   func(env *filterEnvironment) bool
+}
+
+// filterExpr is a compiled --filter expression
+type filterExpr struct {
+	root filterNode
+}
+
+// evaluate reports whether the target described by env should be kept.
+func (expr *filterExpr) evaluate(env *filterEnvironment) bool {
+	return expr.root.evalBool(env)
+}
+
+// newFilterEnvironment builds the variables of a --filter expression for the given result.
+func newFilterEnvironment(res *targetResult) *filterEnvironment {
+	components := getTargetComponents(res.parsedTarget)
+	env := &filterEnvironment{
+		target:  res.targetStr,
+		host:    components.Host,
+		ip:      components.IP,
+		scheme:  components.Scheme,
+		path:    components.Path,
+		verdict: "inscope",
+		rule:    scopeToString(res.matchedScope),
+		unsure:  res.isUnsure,
+		related: res.isRelated,
+	}
+	if res.isRelated {
+		env.verdict = "related"
+	} else if res.isUnsure {
+		env.verdict = "unsure"
+	}
+	if port, err := strconv.Atoi(components.Port); err == nil {
+		env.port = float64(port)
+	}
+	return env
+}
+
+var filterVariables = map[string]filterNode{
+	"target":  {valueType: filterString, evalString: func(env *filterEnvironment) string { return env.target }},
+	"host":    {valueType: filterString, evalString: func(env *filterEnvironment) string { return env.host }},
+	"ip":      {valueType: filterString, evalString: func(env *filterEnvironment) string { return env.ip }},
+	"port":    {valueType: filterNumber, evalNumber: func(env *filterEnvironment) float64 { return env.port }},
+	"scheme":  {valueType: filterString, evalString: func(env *filterEnvironment) string { return env.scheme }},
+	"path":    {valueType: filterString, evalString: func(env *filterEnvironment) string { return env.path }},
+	"verdict": {valueType: filterString, evalString: func(env *filterEnvironment) string { return env.verdict }},
+	"rule":    {valueType: filterString, evalString: func(env *filterEnvironment) string { return env.rule }},
+	"unsure":  {valueType: filterBool, evalBool: func(env *filterEnvironment) bool { return env.unsure }},
+	"related": {valueType: filterBool, evalBool: func(env *filterEnvironment) bool { return env.related }},
+}
+
+type filterToken struct {
+	text     string
+	isString bool // The token is a quoted string literal
+	isNumber bool
+	position int
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+// compileFilterExpr parses and type-checks a --filter expression. The expression must evaluate to a boolean.
+func compileFilterExpr(source string) (*filterExpr, error) {
+	tokens, err := tokenizeFilterExpr(source)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &filterParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(parser.tokens) {
+		return nil, errors.New("unexpected \"" + parser.tokens[parser.pos].text + "\" at position " + strconv.Itoa(parser.tokens[parser.pos].position))
+	}
+	if root.valueType != filterBool {
+		return nil, errors.New("the expression must be a boolean, but it's a " + root.valueType.String())
+	}
+	return &filterExpr{root: root}, nil
+}
+
+func tokenizeFilterExpr(source string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '"' || c == '\'':
+			var literal strings.Builder
+			start := i
+			i++
+			for i < len(source) && source[i] != c {
+				if source[i] == '\\' && i+1 < len(source) {
+					i++
+				}
+				literal.WriteByte(source[i])
+				i++
+			}
+			if i >= len(source) {
+				return nil, errors.New("unterminated string starting at position " + strconv.Itoa(start))
+			}
+			i++
+			tokens = append(tokens, filterToken{text: literal.String(), isString: true, position: start})
+
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(source) && (source[i] >= '0' && source[i] <= '9' || source[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, filterToken{text: source[start:i], isNumber: true, position: start})
+
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(source) && (source[i] == '_' || source[i] >= 'a' && source[i] <= 'z' || source[i] >= 'A' && source[i] <= 'Z' || source[i] >= '0' && source[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, filterToken{text: source[start:i], position: start})
+
+		default:
+			operator := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")"} {
+				if strings.HasPrefix(source[i:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, errors.New("unexpected character '" + string(c) + "' at position " + strconv.Itoa(i))
+			}
+			tokens = append(tokens, filterToken{text: operator, position: i})
+			i += len(operator)
+		}
+	}
+	return tokens, nil
+}
+
+// peek returns the text of the next operator or identifier, or an empty string if the next token is a literal or there are no tokens left.
+func (p *filterParser) peek() string {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].isString || p.tokens[p.pos].isNumber {
+		return ""
+	}
+	return p.tokens[p.pos].text
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return left, err
+	}
+	for p.peek() == "||" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return right, err
+		}
+		if left.valueType != filterBool || right.valueType != filterBool {
+			return left, errors.New("\"||\" can only be used with booleans")
+		}
+		l, r := left.evalBool, right.evalBool
+		left = filterNode{valueType: filterBool, evalBool: func(env *filterEnvironment) bool { return l(env) || r(env) }}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return left, err
+	}
+	for p.peek() == "&&" {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return right, err
+		}
+		if left.valueType != filterBool || right.valueType != filterBool {
+			return left, errors.New("\"&&\" can only be used with booleans")
+		}
+		l, r := left.evalBool, right.evalBool
+		left = filterNode{valueType: filterBool, evalBool: func(env *filterEnvironment) bool { return l(env) && r(env) }}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (filterNode, error) {
+	if p.peek() == "!" {
+		p.pos++
+		operand, err := p.parseNot()
+		if err != nil {
+			return operand, err
+		}
+		if operand.valueType != filterBool {
+			return operand, errors.New("\"!\" can only be used with booleans")
+		}
+		o := operand.evalBool
+		return filterNode{valueType: filterBool, evalBool: func(env *filterEnvironment) bool { return !o(env) }}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return left, err
+	}
+
+	operator := p.peek()
+	switch operator {
+	case "==", "!=", "<", ">", "<=", ">=", "contains", "startsWith", "endsWith", "matches":
+		p.pos++
+	default:
+		return left, nil
+	}
+
+	// Regexes are compiled only once, so the right side of "matches" must be a literal
+	if operator == "matches" {
+		if p.pos >= len(p.tokens) || !p.tokens[p.pos].isString {
+			return left, errors.New("the right side of \"matches\" must be a string literal")
+		}
+		if left.valueType != filterString {
+			return left, errors.New("\"matches\" can only be used with strings")
+		}
+		regex, err := regexp.Compile(p.tokens[p.pos].text)
+		if err != nil {
+			return left, err
+		}
+		p.pos++
+		l := left.evalString
+		return filterNode{valueType: filterBool, evalBool: func(env *filterEnvironment) bool { return regex.MatchString(l(env)) }}, nil
+	}
+
+	right, err := p.parsePrimary()
+	if err != nil {
+		return right, err
+	}
+	if left.valueType != right.valueType {
+		return left, errors.New("\"" + operator + "\" can't compare a " + left.valueType.String() + " with a " + right.valueType.String())
+	}
+
+	var compare func(env *filterEnvironment) bool
+	switch left.valueType {
+	case filterString:
+		l, r := left.evalString, right.evalString
+		switch operator {
+		case "==":
+			compare = func(env *filterEnvironment) bool { return l(env) == r(env) }
+		case "!=":
+			compare = func(env *filterEnvironment) bool { return l(env) != r(env) }
+		case "contains":
+			compare = func(env *filterEnvironment) bool { return strings.Contains(l(env), r(env)) }
+		case "startsWith":
+			compare = func(env *filterEnvironment) bool { return strings.HasPrefix(l(env), r(env)) }
+		case "endsWith":
+			compare = func(env *filterEnvironment) bool { return strings.HasSuffix(l(env), r(env)) }
+		}
+	case filterNumber:
+		l, r := left.evalNumber, right.evalNumber
+		switch operator {
+		case "==":
+			compare = func(env *filterEnvironment) bool { return l(env) == r(env) }
+		case "!=":
+			compare = func(env *filterEnvironment) bool { return l(env) != r(env) }
+		case "<":
+			compare = func(env *filterEnvironment) bool { return l(env) < r(env) }
+		case ">":
+			compare = func(env *filterEnvironment) bool { return l(env) > r(env) }
+		case "<=":
+			compare = func(env *filterEnvironment) bool { return l(env) <= r(env) }
+		case ">=":
+			compare = func(env *filterEnvironment) bool { return l(env) >= r(env) }
+		}
+	case filterBool:
+		l, r := left.evalBool, right.evalBool
+		switch operator {
+		case "==":
+			compare = func(env *filterEnvironment) bool { return l(env) == r(env) }
+		case "!=":
+			compare = func(env *filterEnvironment) bool { return l(env) != r(env) }
+		}
+	}
+	if compare == nil {
+		return left, errors.New("\"" + operator + "\" can't be used with a " + left.valueType.String())
+	}
+	return filterNode{valueType: filterBool, evalBool: compare}, nil
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	if p.pos >= len(p.tokens) {
+		return filterNode{}, errors.New("unexpected end of the expression")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+
+	switch {
+	case token.isString:
+		value := token.text
+		return filterNode{valueType: filterString, evalString: func(env *filterEnvironment) string { return value }}, nil
+
+	case token.isNumber:
+		value, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return filterNode{}, errors.New("invalid number \"" + token.text + "\" at position " + strconv.Itoa(token.position))
+		}
+		return filterNode{valueType: filterNumber, evalNumber: func(env *filterEnvironment) float64 { return value }}, nil
+
+	case token.text == "true" || token.text == "false":
+		value := token.text == "true"
+		return filterNode{valueType: filterBool, evalBool: func(env *filterEnvironment) bool { return value }}, nil
+
+	case token.text == "(":
+		node, err := p.parseOr()
+		if err != nil {
+			return node, err
+		}
+		if p.peek() != ")" {
+			return node, errors.New("missing \")\"")
+		}
+		p.pos++
+		return node, nil
+	}
+
+	if variable, ok := filterVariables[token.text]; ok {
+		return variable, nil
+	}
+	return filterNode{}, errors.New("unknown variable \"" + token.text + "\" at position " + strconv.Itoa(token.position))
+}
@@ -0,0 +1,17 @@
+//go:build darwin
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// The database is stored in ~/Library/Application Support/hacker-scoper/
+func getFirebountyJSONPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "hacker-scoper") + string(filepath.Separator)
+}
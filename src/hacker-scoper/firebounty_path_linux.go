@@ -1,6 +1,18 @@
 //go:build linux
+
 package main
 
+import (
+	"os"
+	"path/filepath"
+)
+
+// The database is stored in $XDG_CACHE_HOME/hacker-scoper/ (~/.cache/hacker-scoper/ by default), so that it can be written without root permissions.
+// /etc/hacker-scoper/ is only used if the home directory of the user can't be determined.
 func getFirebountyJSONPath() string {
-    return "/etc/hacker-scoper/"
-}
\ No newline at end of file
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "/etc/hacker-scoper/"
+	}
+	return filepath.Join(cacheDir, "hacker-scoper") + string(filepath.Separator)
+}
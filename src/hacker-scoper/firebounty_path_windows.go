@@ -1,8 +1,9 @@
 //go:build windows
+
 package main
 
 import "os"
 
 func getFirebountyJSONPath() string {
-    return os.Getenv("APPDATA") + "\\hacker-scoper\\"
-}
\ No newline at end of file
+	return os.Getenv("APPDATA") + "\\hacker-scoper\\"
+}
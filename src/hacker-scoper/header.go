@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The arguments whose values are never written to the --with-header metadata, since the output files are usually shared
+var secretArguments = []string{"serve-token"}
+
+// outputHeader is the metadata written at the top of the output file by --with-header, so that the results are self-describing when they resurface weeks later.
+type outputHeader struct {
+	// Always "header", so that it can be told apart from the --json results
+	Type      string `json:"type"`
+	Version   string `json:"version"`
+	Generated string `json:"generated"`
+	// The companies, files and plugins that the scopes came from
+	ScopeSources []string `json:"scope_sources,omitempty"`
+	// The hash of the parsed scopes and of the settings that change the verdicts, like "sha256:..."
+	ScopeHash string `json:"scope_hash"`
+	// The digest of the --database-snapshot, like "sha256:..."
+	Database  string   `json:"database,omitempty"`
+	Arguments []string `json:"arguments"`
+}
+
+// newOutputHeader returns the metadata of the current run.
+func newOutputHeader(flags *flag.FlagSet, lineDetails map[string]ruleDetails, scopeHash string) outputHeader {
+	sources := scopeSources(lineDetails)
+	slices.Sort(sources)
+	return outputHeader{
+		Type:         "header",
+		Version:      currentVersion,
+		Generated:    time.Now().UTC().Format(time.RFC3339),
+		ScopeSources: sources,
+		ScopeHash:    "sha256:" + scopeHash,
+		Database:     databaseSnapshotDigest,
+		Arguments:    usedArguments(flags),
+	}
+}
+
+// usedArguments returns the arguments that were set on the command line or by a profile, like "--company=Example" or "-ch". The values of the secret arguments are redacted.
+func usedArguments(flags *flag.FlagSet) []string {
+	arguments := []string{}
+	flags.Visit(func(f *flag.Flag) {
+		// The short aliases, like -c and -ins, are written with a single dash
+		name := "--" + f.Name
+		if len(f.Name) <= 3 {
+			name = "-" + f.Name
+		}
+		if boolFlag, isBool := f.Value.(interface{ IsBoolFlag() bool }); isBool && boolFlag.IsBoolFlag() && f.Value.String() == "true" {
+			arguments = append(arguments, name)
+			return
+		}
+		value := f.Value.String()
+		if slices.Contains(secretArguments, f.Name) {
+			value = "REDACTED"
+		}
+		arguments = append(arguments, name+"="+value)
+	})
+	return arguments
+}
+
+// format returns the header in the output format: a single JSON object for --json, and comment lines like "# Scope hash: sha256:..." for the text and CSV outputs.
+func (header outputHeader) format(asJSON bool) string {
+	if asJSON {
+		line, err := json.Marshal(header)
+		if err != nil {
+			// Marshaling a struct of strings can't fail
+			crash(errWriteOutput, "Unable to encode the header as JSON", err)
+		}
+		return string(line) + "\n"
+	}
+
+	lines := []string{
+		"# hacker-scoper v" + header.Version,
+		"# Generated: " + header.Generated,
+		"# Scope sources: " + strings.Join(header.ScopeSources, ", "),
+		"# Scope hash: " + header.ScopeHash,
+	}
+	if header.Database != "" {
+		lines = append(lines, "# Database: "+header.Database)
+	}
+	quotedArguments := make([]string, len(header.Arguments))
+	for i, argument := range header.Arguments {
+		if strings.ContainsAny(argument, " \t\"'") {
+			argument = strconv.Quote(argument)
+		}
+		quotedArguments[i] = argument
+	}
+	lines = append(lines, "# Arguments: "+strings.Join(quotedArguments, " "))
+	return strings.Join(lines, "\n") + "\n"
+}
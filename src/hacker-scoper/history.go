@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Amount of company selections remembered for --last
+const companyHistorySize = 10
+
+// companySelection is a company lookup, together with the companies that the user chose for it.
+type companySelection struct {
+	Query string `json:"query"`
+	// The lowercase'd names of the chosen companies. Names are used instead of indexes, since indexes change when the database is updated.
+	Companies []string  `json:"companies"`
+	Time      time.Time `json:"time"`
+}
+
+// companyHistoryPath returns the path of the file where the company selections are remembered. It's saved next to the database.
+func companyHistoryPath() string {
+	return filepath.Join(filepath.Dir(firebountyJSONPath), "history.json")
+}
+
+// loadCompanyHistory reads the remembered company selections, most recent first. A missing history file isn't an error.
+func loadCompanyHistory(path string) ([]companySelection, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- The path is derived from the database path.
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var history []companySelection
+	err = json.Unmarshal(data, &history)
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// recordCompanySelection adds a selection to the top of the history. Older selections of the same query are forgotten.
+func recordCompanySelection(path string, selection companySelection) error {
+	history, err := loadCompanyHistory(path)
+	if err != nil {
+		// A corrupted history isn't worth keeping
+		history = nil
+	}
+
+	newHistory := []companySelection{selection}
+	for _, previous := range history {
+		if previous.Query != selection.Query && len(newHistory) < companyHistorySize {
+			newHistory = append(newHistory, previous)
+		}
+	}
+
+	data, err := json.MarshalIndent(newHistory, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Written atomically, like the resume state, so that parallel runs can't corrupt it
+	return writeFileAtomically(path, data)
+}
+
+// lastCompanySelection returns the most recent selection for the query, or the most recent selection of all if the query is empty.
+func lastCompanySelection(query string) (companySelection, error) {
+	history, err := loadCompanyHistory(companyHistoryPath())
+	if err != nil {
+		return companySelection{}, err
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	for _, selection := range history {
+		if query == "" || selection.Query == query {
+			return selection, nil
+		}
+	}
+	if query == "" {
+		return companySelection{}, errors.New("no company has been selected yet")
+	}
+	return companySelection{}, errors.New("the company \"" + query + "\" hasn't been selected before")
+}
+
+// rememberCompanySelection saves the companies chosen for the query into the history, and returns their indexes.
+func rememberCompanySelection(query string, selected []firebountySearchMatch) []int {
+	selection := companySelection{Query: query, Time: time.Now()}
+	var indexes []int
+	for _, match := range selected {
+		selection.Companies = append(selection.Companies, match.companyName)
+		indexes = append(indexes, match.companyIndex)
+	}
+
+	err := recordCompanySelection(companyHistoryPath(), selection)
+	if err != nil {
+		warning(warnFile, "Unable to save the company selection into the history: "+err.Error())
+	}
+	return indexes
+}
+
+// selectLastCompanies returns the indexes of the companies of the last selection for the query, without asking the user to choose again.
+func selectLastCompanies(query string) []int {
+	selection, err := lastCompanySelection(query)
+	if err != nil {
+		crash(errReadInput, "Unable to reuse the last company selection: "+err.Error(), err)
+	}
+
+	indexes, missing, err := companyIndexesByName(selection.Companies)
+	if err != nil {
+		crash(errDatabase, "Couldn't parse company names from firebounty JSON.", err)
+	}
+	for _, name := range missing {
+		warning(warnProgramSkipped, "The company \""+name+"\" of the last selection isn't in the database anymore.")
+	}
+	if len(indexes) == 0 {
+		crash(errNoScopes, "None of the companies of the last selection are in the database anymore.", errors.New("no companies found"))
+	}
+	if !chainMode {
+		fmt.Println("[+] Reusing the last selection for \"" + selection.Query + "\": " + colorGood + strings.Join(selection.Companies, ", ") + colorReset)
+	}
+	return indexes
+}
+
+// companyIndexesByName returns the current indexes of the companies with the given lowercase'd names, together with the names that aren't in the database anymore.
+func companyIndexesByName(names []string) (indexes []int, missing []string, err error) {
+	companyNames, err := extractCompanyNames(firebountyJSONPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	remaining := map[string]bool{}
+	for _, name := range names {
+		remaining[name] = true
+	}
+	for i, name := range companyNames {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if remaining[name] {
+			indexes = append(indexes, i)
+			delete(remaining, name)
+		}
+	}
+	for _, name := range names {
+		if remaining[name] {
+			missing = append(missing, name)
+		}
+	}
+	return indexes, missing, nil
+}
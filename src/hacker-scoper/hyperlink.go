@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Set with "--no-hyperlinks".
+var hyperlinksDisabled bool
+
+// Set when the decorated output is shown in a terminal that supports hyperlinks. The URLs are then printed as OSC 8 hyperlinks.
+var hyperlinksEnabled bool
+
+// Set with "--link-hosts". The in-scope hosts of the decorated output are linked to "https://<host>".
+var linkInscopeHosts bool
+
+// stdoutIsTerminal reports whether stdout is shown to the user, instead of being redirected to a file or another program.
+func stdoutIsTerminal() bool {
+	stat, err := os.Stdout.Stat()
+	return err == nil && (stat.Mode()&os.ModeCharDevice) != 0
+}
+
+// terminalSupportsHyperlinks reports whether the hyperlinks would be shown by a terminal, unless they're disabled with --no-hyperlinks.
+// Terminals that don't support them are expected to ignore them, but the escape sequences would end up in files and pipes.
+func terminalSupportsHyperlinks() bool {
+	return !hyperlinksDisabled && stdoutIsTerminal() && os.Getenv("TERM") != "dumb"
+}
+
+// hyperlink returns the text as an OSC 8 terminal hyperlink to the target URL, or the text as-is when hyperlinks are disabled.
+// The URLs come from the firebounty database and the targets, so the ones with control characters are never linked: they could end the escape sequence early and inject their own.
+func hyperlink(text string, target string) string {
+	if !hyperlinksEnabled || target == "" || strings.ContainsFunc(target, func(char rune) bool { return char < 0x20 || char == 0x7f }) {
+		return text
+	}
+	return "\033]8;;" + target + "\033\\" + text + "\033]8;;\033\\"
+}
+
+// hostURL returns the "https://<host>" URL of a target for --link-hosts, or "" for the targets that aren't hosts, like mobile apps.
+func hostURL(target interface{}) string {
+	var host string
+	switch assertedTarget := target.(type) {
+	case *url.URL:
+		host = assertedTarget.Host
+	case *URLWithIPAddressHost:
+		host = formatIPHost(assertedTarget.IPhost)
+	case *net.IP:
+		host = formatIPHost(*assertedTarget)
+	}
+	if host == "" {
+		return ""
+	}
+	return (&url.URL{Scheme: "https", Host: host}).String()
+}
+
+// formatIPHost returns an IP address as the host of a URL, with brackets around IPv6 addresses.
+func formatIPHost(ip net.IP) string {
+	if ip.To4() == nil {
+		return "[" + ip.String() + "]"
+	}
+	return ip.String()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// How long the interrupt handler waits for the stats summary, in case the results aren't being handled anymore
+const interruptSummaryTimeout = time.Second
+
+// interruptedRun is what has to be finished when a run is interrupted by SIGINT or SIGTERM, so that the results that were already found aren't lost.
+type interruptedRun struct {
+	progress   *progressbar.ProgressBar
+	writer     *asyncWriter
+	seenAssets *seenSet
+	// Set with --stats. The stats are only used by the goroutine that handles the results, so the summary is asked to it through summaryRequests.
+	showStats       bool
+	summaryRequests chan chan string
+	// Read instead of the stats when --stats isn't set
+	processedTargets *atomic.Int64
+	inscopeTargets   *atomic.Int64
+}
+
+// cleanup writes the buffered results to the output file, deletes the temporary file of --unique, and summarizes what was done before the interruption on stderr.
+// With --stats, the summary is the one of --stats, even in chain mode, like when the run finishes.
+func (run *interruptedRun) cleanup(stderr io.Writer) {
+	if run.progress != nil {
+		run.progress.Clear() // #nosec G104 -- The program is exiting.
+	}
+	if run.writer != nil {
+		err := run.writer.Flush()
+		if err != nil {
+			warning(warnFile, "Unable to write the buffered results to the output file: "+err.Error())
+		}
+	}
+	if run.seenAssets != nil {
+		run.seenAssets.close() // #nosec G104 -- The program is exiting.
+	}
+
+	if run.showStats {
+		if summary, isAnswered := run.requestSummary(); isAnswered {
+			fmt.Fprintln(stderr, summary)
+			return
+		}
+	}
+	if !chainMode {
+		fmt.Fprintln(stderr, "[INFO]: Interrupted after processing "+strconv.FormatInt(run.processedTargets.Load(), 10)+" targets, "+strconv.FormatInt(run.inscopeTargets.Load(), 10)+" of which were in scope.")
+	}
+}
+
+// requestSummary asks the goroutine that handles the results for the stats summary. It gives up after interruptSummaryTimeout, if the results aren't being handled anymore.
+func (run *interruptedRun) requestSummary() (string, bool) {
+	timeout := time.After(interruptSummaryTimeout)
+	reply := make(chan string, 1)
+	select {
+	case run.summaryRequests <- reply:
+	case <-timeout:
+		return "", false
+	}
+	select {
+	case summary := <-reply:
+		return summary, true
+	case <-timeout:
+		return "", false
+	}
+}
+
+// receiveResults passes every result to handle until the channel is closed. In between, it answers the requests of the interrupt handler for the stats summary.
+func receiveResults(results <-chan targetResult, summaryRequests chan chan string, summary func() string, handle func(targetResult)) {
+	for {
+		select {
+		case res, isOpen := <-results:
+			if !isOpen {
+				return
+			}
+			handle(res)
+		case reply := <-summaryRequests:
+			reply <- summary()
+		}
+	}
+}
@@ -14,17 +14,17 @@ var ramfile *os.File
 func StartBenchmark(profileFilenamePrefix string) bool {
 	cpufile, err := os.Create(`.\benchmarking\profiling-output\cpu` + profileFilenamePrefix + `.prof`)
 	if err != nil {
-		crash("could not create CPU profile: ", err)
+		crash(errProfiling, "could not create CPU profile: ", err)
 	}
 
 	ramfile, err = os.Create(`.\benchmarking\profiling-output\ram` + profileFilenamePrefix + `.prof`)
 	if err != nil {
-		crash("could not create CPU profile: ", err)
+		crash(errProfiling, "could not create CPU profile: ", err)
 	}
 
 	err = pprof.StartCPUProfile(cpufile)
 	if err != nil {
-		crash("could not start CPU profile: ", err)
+		crash(errProfiling, "could not start CPU profile: ", err)
 	}
 
 	return true
@@ -41,7 +41,7 @@ func StopBenchmark() bool {
 	// that has inuse_space as the default index.
 	err := pprof.Lookup("allocs").WriteTo(ramfile, 0)
 	if err != nil {
-		crash("could not write memory profile: ", err)
+		crash(errProfiling, "could not write memory profile: ", err)
 	}
 
 	ramfile.Close()
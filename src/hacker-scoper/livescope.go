@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Set with "--verify-scope-live". The cached scopes of the selected programs are compared with their live program pages.
+var verifyScopeLive bool
+
+// The biggest program page that is downloaded by --verify-scope-live
+const maxLivePageSize = 5 * 1024 * 1024
+
+// How many scopes are listed in the --verify-scope-live warnings
+const maxListedLiveScopes = 5
+
+// The scripts, styles and tags of the program pages, which are removed so that only the text of the page is compared
+var htmlMarkupRegex = regexp.MustCompile(`(?is)<script\b.*?</script\s*>|<style\b.*?</style\s*>|<[^>]*>`)
+
+// The hosts of the scopes that can be looked for in the program pages, like "example.com" and "*.example.com"
+var liveScopeHostRegex = regexp.MustCompile(`^(?:\*\.)?(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// liveScopeComparison is how the cached scopes of a program differ from the identifiers of its live program page.
+type liveScopeComparison struct {
+	// How many cached scopes were compared
+	cached int
+	// The cached scopes that the page doesn't mention
+	missing []string
+	// The hosts that the page mentions under the domains of the cached scopes, but that no cached scope covers
+	unknown []string
+}
+
+// diverges reports whether the cached scopes differ significantly from the page: when most of them aren't on the page anymore, or when the page has hosts that aren't cached.
+func (comparison liveScopeComparison) diverges() bool {
+	return len(comparison.missing)*2 > comparison.cached || len(comparison.unknown) > 0
+}
+
+// verifyLiveScopes downloads the program page of a firebounty program, and warns when its cached scopes diverge from the page, since the firebounty data may be stale.
+// The failures are warnings too: the cached scopes are used either way.
+func verifyLiveScopes(ctx context.Context, prog *Program) {
+	if offlineMode {
+		warning(warnLiveScope, "Not verifying the scopes of "+prog.Name+" against its program page, because --offline is set.")
+		return
+	}
+	if prog.Url == "" {
+		warning(warnLiveScope, "Unable to verify the scopes of "+prog.Name+", because the database doesn't have the URL of its program page.")
+		return
+	}
+	page, err := fetchProgramPage(ctx, prog.Url)
+	if err != nil {
+		warning(warnLiveScope, "Unable to download the program page of "+prog.Name+" to verify its scopes: "+err.Error())
+		return
+	}
+
+	comparison := compareLiveScopes(append(webApplicationScopeLines(prog.Scopes.In_scopes), webApplicationScopeLines(prog.Scopes.Out_of_scopes)...), page)
+	if !comparison.diverges() {
+		if !chainMode {
+			fmt.Println("[+] The cached scopes match the live program page.")
+		}
+		return
+	}
+
+	var problems []string
+	if len(comparison.missing) > 0 {
+		problems = append(problems, strconv.Itoa(len(comparison.missing))+" of the "+strconv.Itoa(comparison.cached)+" cached scopes aren't on the page ("+listLiveScopes(comparison.missing)+")")
+	}
+	if len(comparison.unknown) > 0 {
+		problems = append(problems, "the page mentions "+strconv.Itoa(len(comparison.unknown))+" hosts that aren't cached ("+listLiveScopes(comparison.unknown)+")")
+	}
+	message := "The cached scopes of " + prog.Name + " diverge from its live program page (" + prog.Url + "): " + strings.Join(problems, ", and ") + ". The firebounty data might be stale."
+	if len(comparison.missing) == comparison.cached {
+		message += " If the page is rendered with JavaScript, its scopes can't be read."
+	}
+	warning(warnLiveScope, message)
+}
+
+// fetchProgramPage downloads a program page, and returns its text without the HTML markup.
+func fetchProgramPage(ctx context.Context, pageURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("got status code " + strconv.Itoa(resp.StatusCode) + " while downloading " + pageURL)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxLivePageSize))
+	if err != nil {
+		return "", err
+	}
+	return html.UnescapeString(htmlMarkupRegex.ReplaceAllString(string(body), " ")), nil
+}
+
+// compareLiveScopes compares the cached scopes of a program with the text of its program page.
+// A scope is on the page if its host is, like "example.com" for "https://example.com/app". The hosts of the page are only reported as unknown if they belong to the same domains as the cached scopes, so that the links to the platform and to other websites are ignored.
+func compareLiveScopes(scopeLines []string, page string) liveScopeComparison {
+	page = strings.ToLower(page)
+	var comparison liveScopeComparison
+	// The hosts of the cached scopes, and the base domains of their wildcards
+	cachedHosts := map[string]bool{}
+	var wildcardDomains []string
+	// The registrable domains of the cached scopes, like "example.co.uk"
+	cachedDomains := map[string]bool{}
+
+	for _, line := range scopeLines {
+		host := liveScopeHost(line)
+		if host == "" || cachedHosts[host] {
+			continue
+		}
+		cachedHosts[host] = true
+		comparison.cached++
+		if !strings.Contains(page, host) {
+			comparison.missing = append(comparison.missing, line)
+		}
+
+		baseDomain := strings.TrimPrefix(host, "*.")
+		if baseDomain != host {
+			cachedHosts[baseDomain] = true
+			wildcardDomains = append(wildcardDomains, baseDomain)
+		}
+		if domain, err := publicsuffix.EffectiveTLDPlusOne(baseDomain); err == nil {
+			cachedDomains[domain] = true
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, hostname := range extractHostnameRegex.FindAllString(page, -1) {
+		if host, _, err := net.SplitHostPort(hostname); err == nil {
+			hostname = host
+		}
+		if seen[hostname] || cachedHosts[hostname] {
+			continue
+		}
+		seen[hostname] = true
+		domain, err := publicsuffix.EffectiveTLDPlusOne(hostname)
+		if err != nil || !cachedDomains[domain] {
+			continue
+		}
+		isCovered := false
+		for _, wildcardDomain := range wildcardDomains {
+			if strings.HasSuffix(hostname, "."+wildcardDomain) {
+				isCovered = true
+				break
+			}
+		}
+		if !isCovered {
+			comparison.unknown = append(comparison.unknown, hostname)
+		}
+	}
+	return comparison
+}
+
+// liveScopeHost returns the host of a scope as it would be written on a program page, like "*.example.com" for "https://*.example.com:443/". It returns "" for the scopes without a host, like IP ranges and regexes.
+func liveScopeHost(scope string) string {
+	host := strings.ToLower(strings.TrimSpace(scope))
+	if _, afterScheme, hasScheme := strings.Cut(host, "://"); hasScheme {
+		host = afterScheme
+	}
+	host, _, _ = strings.Cut(host, "/")
+	if withoutPort, _, err := net.SplitHostPort(host); err == nil {
+		host = withoutPort
+	}
+	if !liveScopeHostRegex.MatchString(host) {
+		return ""
+	}
+	return host
+}
+
+// listLiveScopes returns the first scopes of a list, like "a.example.com, b.example.com and 3 more".
+func listLiveScopes(scopes []string) string {
+	if len(scopes) <= maxListedLiveScopes {
+		return strings.Join(scopes, ", ")
+	}
+	return strings.Join(scopes[:maxListedLiveScopes], ", ") + " and " + strconv.Itoa(len(scopes)-maxListedLiveScopes) + " more"
+}
@@ -2,11 +2,15 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net"
 	"net/http"
 	"net/url"
@@ -15,9 +19,12 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 	"unicode"
 
@@ -30,17 +37,56 @@ const firebountyJSONFilename = "firebounty-scope-url_only.json"
 
 var firebountyJSONPath string
 
+// httpClient is used for every outgoing request, including remote target and scope lists.
+var httpClient = newHTTPClient(30 * time.Second)
+
 var ErrInvalidFormat = errors.New("invalid format: not IP, CIDR, or URL")
 
+// ErrMisconfiguredScope is returned for the scopes of misconfigured bug bounty programs, like domains without a public TLD.
+var ErrMisconfiguredScope = fmt.Errorf("%w: the scope doesn't have a public TLD", ErrInvalidFormat)
+
 type URLWithIPAddressHost struct {
 	rawURL string
 	IPhost net.IP
 }
 
+// EmailAddress is a target such as "user@example.com". Only the domain part is matched against the scopes.
+type EmailAddress struct {
+	rawAddress string
+	domain     string
+}
+
+// preparedTarget is a parsed target together with the normalized forms that the scopes are compared with.
+// They're computed once per target by prepareTarget, instead of once for every scope that the target is compared with.
+type preparedTarget struct {
+	// The target, as returned by parseTarget
+	value interface{}
+	// The host of URLs and the domain of email addresses, without the port, in lowercase
+	host string
+	// What the regex scopes are matched against: the whole URL or email address
+	raw string
+	// Set for IP addresses, and for the URLs with an IP address host
+	ip *net.IP
+}
+
 type WildcardScope struct {
 	scope regexp.Regexp
 }
 
+// apexDomain returns the domain that the wildcard is rooted at, like "example.com" for "*.example.com". It returns "" if the wildcard doesn't start with "*.", or has more wildcards.
+func (wildcard *WildcardScope) apexDomain() string {
+	apex, isRooted := strings.CutPrefix(regexToWildcard.Replace(wildcard.hostPattern()), "*.")
+	if !isRooted || strings.ContainsAny(apex, "*?") {
+		return ""
+	}
+	return apex
+}
+
+// hostPattern returns the regex of the wildcard without its anchors, like `.*\.example\.com` for "*.example.com".
+func (wildcard *WildcardScope) hostPattern() string {
+	return strings.TrimSuffix(strings.TrimPrefix(wildcard.scope.String(), "^"), "$")
+}
+
 type NmapIPRange struct {
 	Octets [4][]uint8 // Each octet can be a list of allowed values
 	Raw    string     // Original string for reference
@@ -78,10 +124,22 @@ type PartialFirebounty struct {
 	Pgms []PartialProgram `json:"pgms"`
 }
 
+// decompressedReader wraps a decompressing reader so that closing it also closes the underlying input.
+type decompressedReader struct {
+	io.Reader
+	underlying io.Closer
+}
+
+func (d *decompressedReader) Close() error {
+	return d.underlying.Close()
+}
+
 type parseResult struct {
-	value interface{}
-	line  string
-	err   error
+	index   int
+	value   interface{}
+	line    string
+	comment string
+	err     error
 }
 
 type targetResult struct {
@@ -90,18 +148,101 @@ type targetResult struct {
 	err           error
 	isInsideScope bool
 	isUnsure      bool
-	targetStr     string
+	// Set with --mark-related, for the unsure targets that share the registrable domain of an in-scope rule, which is then their matchedScope
+	isRelated bool
+	// Set for the targets that matched neither the in-scope nor the out-of-scope rules. Without --include-unsure, they aren't in scope, but --stats, --fail-on-out-of-scope and --format github still treat them as unsure instead of out of scope
+	isUnmatched bool
+	targetStr   string
+	// The whole input line, including the columns of annotated and columnar inputs
+	inputLine string
+	// The columns of the input line around the target, like "200" and "Example title"
+	columns      splitLine
+	matchedScope interface{}
+	// The signals that fired when the --enrich checks were run on an unsure target
+	signals []string
+	// The CNAME chain that led --follow-cnames to an in-scope hostname
+	cnameChain []string
+	// Whether the in-scope subdomain only resolves because of a wildcard DNS record of its apex domain
+	wildcardDNS bool
+}
+
+// targetComponents holds the pieces of a parsed target. Pieces that don't apply to the target are left empty.
+// They're included in the JSON output as "parsed", so that other tools don't have to parse the targets again.
+type targetComponents struct {
+	Scheme string `json:"scheme,omitempty"`
+	Host   string `json:"host,omitempty"`
+	Port   string `json:"port,omitempty"`
+	Path   string `json:"path,omitempty"`
+	IP     string `json:"ip,omitempty"`
+	// Set for mobile app targets, like "android:com.example.app"
+	App        string `json:"app,omitempty"`
+	AppVersion string `json:"app_version,omitempty"`
+	// Set for repository targets, like "example/app"
+	Repo string `json:"repo,omitempty"`
+	// Set for contract targets, like "0x5FbDB2315678afecb367f032d93F642f64180aa3" on the chain "137"
+	Chain    string `json:"chain,omitempty"`
+	Contract string `json:"contract,omitempty"`
 }
 
 var chainMode bool
 
-const colorReset = "\033[0m"
-const colorYellow = "\033[33m"
-const colorRed = "\033[38;2;255;0;0m"
-const colorGreen = "\033[38;2;37;255;36m"
-const colorBlue = "\033[38;2;0;204;255m"
+// Set with "--diagnostics none". Errors are still shown.
+var hideWarnings bool
+
+// Set with "--suppress-misconfig-warnings". Only hides the warnings about misconfigured bug bounty programs.
+var hideMisconfigWarnings bool
+
+// Called by the interrupt handler before exiting, so that the results that were already found aren't lost. Set once the targets start being processed.
+var interruptCleanup atomic.Pointer[func()]
+
+// Set with "--offline". Disables the update check and the automatic updates of the database.
+var offlineMode bool
+
+// Set with "--unanchored-wildcards". Wildcard scopes match any part of the host, like in older versions, so "*.example.com" also matches "www.example.com.evil.net".
+var unanchoredWildcards bool
+
+// Set with "--case-insensitive". Regex scopes are compiled case-insensitively. Hostnames and wildcards are always case-insensitive.
+var caseInsensitiveRegexes bool
+
+// Every gzip stream starts with these magic bytes
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ruleDetails holds the information about a scope rule that isn't needed for matching it, like its comment in the scopes file.
+type ruleDetails struct {
+	Description string
+	Ports       []int
+	Tags        []string
+	MaxSeverity string
+	// The programs or files that contributed the rule, like "Example" or "./.inscope"
+	Sources []string
+}
+
+// scopeDetails holds the details of every scope that has any, keyed by the parsed scope.
+// It's filled by parseAllLines before any target is processed, and only read afterwards.
+var scopeDetails = map[interface{}]ruleDetails{}
+
+// Using this path as a scopes file reads the scopes from stdin, like "--inscope -"
+const stdinPath = "-"
+
+// The longest target line that can be read. Longer lines, like huge data URIs, stop the reading of the targets with a warning.
+const maxTargetLineLength = 1024 * 1024
+
+// Matches targets like "user@example.com" and "mailto:user@example.com"
+var emailAddressRegex = regexp.MustCompile(`^(?:mailto:)?[^@\s/:]+@([^@\s/:\[\]]+\.[^@\s/:\[\]]+)$`)
 
 func main() {
+	defer exitOnJSONCrash()
+
+	// The interrupt handler exits the program directly, so the root context is never cancelled. Library users and tests pass their own contexts.
+	ctx := context.Background()
+
+	// The colors must be set before anything is printed
+	applyColorTheme(readConfig())
+
+	// Subcommands such as "show" have their own arguments
+	if runSubcommand(ctx, os.Args[1:]) {
+		return
+	}
 
 	StartBenchmark("1")
 
@@ -112,6 +253,9 @@ func main() {
 	var outputCSVFormat bool
 
 	var quietMode bool
+	var showStats bool
+	var statsTopRules int
+	var failOnOutOfScope bool
 	var showVersion bool
 	var company string
 	var inscopeExplicitLevel int //should only be [0], 1, or 2
@@ -119,85 +263,444 @@ func main() {
 	var scopesListFilepath string
 	var outofScopesListFilepath string
 	var privateTLDsAreEnabled bool
+	var httpTimeout int
+	var resumeStatePath string
+	var maxTargets int
+	var noProgress bool
+	var diagnosticsMode string
+	var verdictCachePath string
+	var uniqueAssets bool
+	var maxMemoryStr string
+	var showRuleTimings bool
+	var orderedOutput bool
+	var diffAgainstFilepath string
+	var serveAddress string
+	var serveToken string
+	var exportScopeFormat string
+	var dryRun bool
+	var exportExclusionsFormat string
+	var reclassifyMobile bool
+	var dropOutOfScopePorts bool
+	var allowCIDRTargets bool
+	var asnDatasetPath string
+	var anyMode bool
+	var stripOutOfScopePorts bool
+	var sampleRateStr string
+	var inputIsHTTPRequests bool
+	var extractMode bool
+	var pastedScopeFilepath string
+	var scopePluginCommands stringListFlag
+	var filterExpressionStr string
+	var overwriteOutputFile bool
+	var appendOutputFile bool
+	var teeOutput bool
+	var flushIntervalStr string
+	var flushEvery int
+	var commandLineScopes stringListFlag
+	var assumedScopes stringListFlag
+	var commandLineExclusions stringListFlag
+	var showRule bool
+	var scopeBundleFilepath string
+	var profileName string
+	var useLastSelection bool
+	var enrichUnsure bool
+	var enrichChecks string
+	var followCNAMEs bool
+	var cnameDepth int
+	var resolversFilepath string
+	var dnsTimeout int
+	var outputJSONFormat bool
+	var outputFormat string
+	var outputGitHubFormat bool
+	var withHeader bool
+	var rawColumnDelimiter string
+	var targetColumn int
 
 	databaseIsUpdating := false
 	var tmpFile *os.File
 
-	const usage = `Hacker-scoper is a GoLang tool designed to assist cybersecurity professionals in bug bounty programs. It identifies and excludes URLs and IP addresses that fall outside a program's scope by comparing input targets (URLs/IPs) against a locally cached [FireBounty](https://firebounty.com) database of scraped scope data. Users may also supply a custom scope list for validation.
+	usage := `Hacker-scoper is a GoLang tool designed to assist cybersecurity professionals in bug bounty programs. It identifies and excludes URLs and IP addresses that fall outside a program's scope by comparing input targets (URLs/IPs) against a locally cached [FireBounty](https://firebounty.com) database of scraped scope data. Users may also supply a custom scope list for validation.
+
+` + colorInfo + `Usage:` + colorReset + ` hacker-scoper --file /path/to/targets [--company company | --inscopes-file /path/to/inscopes [--outofscopes-file /path/to/outofscopes] [--enable-private-tlds]] [--inscope-explicit-level INT] [--noscope-explicit-level INT] [--chain-mode] [--database /path/to/firebounty.json] [--include-unsure] [--output /path/to/outputfile] [--hostnames-only]
+
+` + colorInfo + `Subcommands:` + colorReset + `
+  hacker-scoper show -c company [--format text|json|yaml] [--database /path/to/firebounty.json]
+      Print the firebounty record of a company (scopes, tag, URLs, etc) without matching any targets. The yaml format exports the scopes as a scope bundle for --scope-bundle.
+
+  hacker-scoper list [--tag hackerone] [--updated-since 30d] [--limit INT] [--offset INT] [--format text|json] [--database /path/to/firebounty.json]
+      List the cached programs and how many scopes they have. Programs can be filtered by tag (platform) and by how recently they were updated.
+
+  hacker-scoper db info|clear [--format text|json] [--database /path/to/firebounty.json]
+      "info" shows the path, size, age, source URL, SHA-256, and amount of programs and scopes of the cached firebounty database. "clear" deletes it.
 
-` + colorBlue + `Usage:` + colorReset + ` hacker-scoper --file /path/to/targets [--company company | --inscopes-file /path/to/inscopes [--outofscopes-file /path/to/outofscopes] [--enable-private-tlds]] [--inscope-explicit-level INT] [--noscope-explicit-level INT] [--chain-mode] [--database /path/to/firebounty.json] [--include-unsure] [--output /path/to/outputfile] [--hostnames-only]
+  hacker-scoper monitor -c company --targets-dir /path/to/targets [--interval 6h] [--state /path/to/state.json] [--once] [--notify-command COMMAND] [--notify-webhook URL] [--pprof-port INT] [--database /path/to/firebounty.json]
+      Every interval, refresh the scopes of the company, re-filter every file in the targets directory, and report the new in-scope assets and the scope changes since the previous cycle. The first cycle is only recorded as the baseline. Reports are printed to stdout, unless a notifier is configured: the notify command receives them on stdin, and the notify webhook receives them as a JSON POST request like {"text": "..."} (compatible with Slack and Mattermost). Use --pprof-port to profile a long-running monitor.
 
-` + colorBlue + `Usage examples:` + colorReset + `
+  hacker-scoper audit-program -c company [--format text|json] [--enable-private-tlds] [--database /path/to/firebounty.json]
+      Report every suspicious scope entry of the company (Android package names, desktop binaries and file hashes listed as web applications, domains without a public TLD, scopes with paths, duplicate entries, entries that are both in and out of scope, and invalid entries), in a report that can be forwarded to the program.
+
+  hacker-scoper multi --companies-file /path/to/companies.txt [-f /path/to/targets] [--format text|jsonl] [--out-dir /path/to/buckets] [--inscope-explicit-level INT] [--enable-private-tlds] [--database /path/to/firebounty.json]
+      Check every target against every program of the companies file (one company name or slug per line), and print the in-scope targets together with the programs they belong to, like "a.example.com [Example, Example (Bugcrowd)]". Useful for sorting a mixed recon dump into per-program buckets. The targets are read from stdin unless -f is given. With --out-dir, the in-scope targets of every program are also written into their own file in that directory, named after the slug of the program (like "buckets/example-bugcrowd.txt").
+
+  hacker-scoper who-owns ASSET [--format text|json] [--inscope-explicit-level INT] [--enable-private-tlds] [--database /path/to/firebounty.json]
+      Search every program of the firebounty database for the ones whose scope covers the asset, and print them together with the rule that matched, like "Example (example) [*.example.com]". The exit code is 1 if no program covers the asset.
+
+  hacker-scoper bulk-export --tag TAG [-o /path/to/scopes.txt] [--enable-private-tlds] [--database /path/to/firebounty.json]
+      Export the union of the in-scope domains and wildcards of every program with the tag (platform), like "hackerone", as a single sorted and deduplicated list.
+
+  hacker-scoper import-chaos -c company [--chaos-list /path/to/chaos-bugbounty-list.json] [-o /path/to/program.yaml]
+      Convert the root domains of a program of ProjectDiscovery's Chaos bug bounty list into a scope bundle for --scope-bundle, with every root domain and its subdomains in scope. The list is downloaded from GitHub unless --chaos-list is given.
+
+  hacker-scoper bench [--baseline /path/to/baseline.json] [--fail-threshold 10%] [--save-baseline /path/to/baseline.json] [--targets INT] [--rounds INT] [--format text|json]
+      Measure the throughput (targets/s) and the allocations per target of the matching on a built-in synthetic workload. With --baseline, compare them with a baseline saved by --save-baseline, and exit with code 1 if any of them is worse by more than --fail-threshold (10% by default).
+
+` + colorInfo + `Usage examples:` + colorReset + `
   Example: Cat a file, and lookup scopes on firebounty
-  ` + colorGreen + `cat recon-targets.txt | hacker-scoper -c google` + colorReset + `
+  ` + colorGood + `cat recon-targets.txt | hacker-scoper -c google` + colorReset + `
 
   Example: Cat a file, and use the .inscope & .noscope files
-  ` + colorGreen + `cat recon-targets.txt | hacker-scoper` + colorReset + `
+  ` + colorGood + `cat recon-targets.txt | hacker-scoper` + colorReset + `
 
   Example: Manually pick a file, lookup scopes on firebounty, and set inscope explicit-level
-  ` + colorGreen + `hacker-scoper -f recon-targets.txt -c google -ie 2` + colorReset + `
+  ` + colorGood + `hacker-scoper -f recon-targets.txt -c google -ie 2` + colorReset + `
 
   Example: Manually pick a file, use custom scopes and out-of-scope files, and set inscope explicit-level
-  ` + colorGreen + `hacker-scoper -f recon-targets.txt -ins inscope -oos noscope.txt -ie 2 ` + colorReset + `
+  ` + colorGood + `hacker-scoper -f recon-targets.txt -ins inscope -oos noscope.txt -ie 2 ` + colorReset + `
 
-` + colorBlue + `Usage notes:` + colorReset + `
+  Example: Download the scopes of a program and pipe them into hacker-scoper
+  ` + colorGood + `curl https://example.com/scope.txt | hacker-scoper --inscope - -f recon-targets.txt` + colorReset + `
+
+` + colorInfo + `Usage notes:` + colorReset + `
   If no company and no inscope file is specified, hacker-scoper will look for ".inscope" and ".noscope" files in the current or in parent directories.
+  A ".hacker-scoper" file containing "slug: program-slug" or "scope-bundle: /path/to/program.yaml" pins its directory (and every directory under it) to a firebounty program or a scope bundle. If both a ".hacker-scoper" and a ".inscope" file are found, the closest one is used.
+  Targets can't contain whitespace, so when an input line has extra space or tab separated columns after the target (like "https://a.example.com 200 Example title" from an annotated recon list), only the first column is checked against the scopes, and the rest of the columns are printed back with the in-scope results. In the --json output, they're in the "columns" field. Use --delimiter and --target-column for other layouts.
+  The colors can be changed with "color-theme: default|colorblind|16-color|none" in the config file (~/.config/hacker-scoper/config.yaml on Linux), and each color with "colors:" entries like "warning: bright-yellow" or "good: '#0072b2'" (hex codes must be quoted). See the README for details.
 
-` + colorBlue + `List of all possible arguments:` + colorReset + `
+` + colorInfo + `List of all possible arguments:` + colorReset + `
   -c, --company string
       Specify the company name to lookup.
 
+  --last
+      Reuse the last company selection, including the choice made when several companies matched, instead of asking again. Without --company, the most recent selection is used.
+
+  --select-slug SLUG
+      Select the firebounty program with this slug, instead of the companies whose names match --company. Can be used multiple times to select several programs together, like COMBINE ALL. In chain mode, when --company matches several companies, the run exits with code 3 and prints the candidates to stderr as a JSON line, like {"query":"example","candidates":[{"name":"Example","programs":[{"name":"Example","slug":"example","url":"https://example.com/security"}]}]}, so that wrappers can show their own chooser and run hacker-scoper again with the --select-slug of the chosen programs. Requires --company.
+
+  --merge-duplicates
+      When the firebounty database has several entries for the same program, select them together as a single company, instead of asking to choose one of them or to COMBINE ALL. Entries are the same program when they have the same program URL, or when the slug of one of them is the slug of the other followed by a suffix, like "example" and "example-bugcrowd". The entries of the same program are merged even if their names don't match the search.
+
   -f, --file /path/to/targets
-      Path to your file containing URLs
+      Path to your file containing URLs. Can also be an http(s) URL pointing to a remote list of targets. gzip-compressed files are decompressed automatically.
 
   -ins, --inscope, --in-scope, --in-scope-file, --inscope-file /path/to/inscopes
-      Path to a custom plaintext file containing scopes
+      Path to a custom plaintext file containing scopes. Can also be an http(s) URL, or "-" to read the scopes from stdin (the targets must then be specified with --file).
 
   -oos, --outofscope, --out-of-scope, --out-of-scope-file, --outofscope-file /path/to/outofscopes
-      Path to a custom plaintext file containing scopes exclusions
+      Path to a custom plaintext file containing scopes exclusions. Can also be an http(s) URL, or "-" to read them from stdin.
+      Without any in-scope entries (no --inscope file, company or --scope), every target that isn't out of scope is considered in scope, for "everything except this list" engagements. The same happens with a .noscope file that doesn't have an .inscope file.
+
+  --scope SCOPE
+      Add an in-scope entry directly from the command line, without creating a file. Can be used multiple times, and together with the other sources of scopes.
+        Example: --scope '*.example.com' --scope 10.0.0.0/8
+
+  --assume-inscope SCOPE
+      Shortcut for filtering a list down to a single scope, like "--assume-inscope '*.example.com'". The scope is built only from the command line: the .inscope and .noscope files are ignored, and it can't be combined with a company or another scopes file. Can be used multiple times, and together with --exclude and --oos.
+        Example: subfinder -d example.com | hacker-scoper --assume-inscope '*.example.com' -ch
+
+  --exclude SCOPE
+      Add an out-of-scope entry directly from the command line. Can be used multiple times.
+        Example: --exclude internal.example.com
+
+  --profile NAME
+      Load the arguments stored in a named profile, so switching between engagements is a single argument. Profiles are YAML files in the "hacker-scoper/profiles" folder of your config directory (~/.config/hacker-scoper/profiles/NAME.yaml on Linux). Arguments given on the command line take precedence over the profile.
+        Example: --profile acme-q3
+
+  --scope-bundle /path/to/program.yaml
+      Load the scopes from a YAML scope bundle, which holds the program's metadata, notes, and per-entry attributes (description, ports, tags and severity caps) together with the scopes. Bundles can be exported from firebounty with "hacker-scoper show -c company --format yaml".
+
+  --scope-plugin "/path/to/plugin [args]"
+      Get the scopes from an external executable instead of firebounty. The value of --company is sent to the plugin, which must reply with the scopes in JSON. See the README for details about the protocol. Can be used multiple times, like once per platform: the plugins run at the same time, and their scopes are combined. A plugin that fails is skipped with a warning, or replaced by the scopes it returned on its last successful run.
+
+  --paste-scope /path/to/pasted-scope
+      Path to a file containing the scope tables copied from a program's policy page (Bugcrowd, HackerOne, etc). Markdown tables, HTML tables and text copied from a web browser are supported. In-scope and out-of-scope identifiers are detected automatically.
 
   -ie, --inscope-explicit-level INT
   -oe, --noscope-explicit-level INT
       How explicit we expect the scopes to be:
+                  0: Treat every scope as a wildcard: hostnames include their subdomains, and wildcards also include their apex domain (*.example.com includes example.com). Only meant for recon triage, when you'd rather see too much than miss something.
         (default) 1: Include subdomains in the scope even if there's not a wildcard in the scope.
                   2: Include subdomains in the scope only if there's a wildcard in the scope.
                   3: Include subdomains/IPs in the scope only if they are explicitly within the scope. CIDR ranges and wildcards are disabled.
 
+  --firebounty-explicit-level INT
+  --file-explicit-level INT
+      Match the in-scope entries of each kind of source with their own explicit-level, instead of the --inscope-explicit-level: the firebounty programs, and every other source (scopes files, .inscope files, --scope, scope bundles, pasted scopes and plugins). For example, "--file-explicit-level 0 --firebounty-explicit-level 3" trusts your curated .inscope file loosely, while treating the firebounty data strictly. Entries that come from both kinds of sources, and hostnames that are also out of scope, keep the --inscope-explicit-level. Can also be set in the "explicit-levels" setting of the config file, with its "firebounty" and "files" levels.
+
+  --any
+      Print nothing, and exit with code 0 as soon as an in-scope target is found, or with code 1 if there are none. Useful for cheaply asking "does this list contain anything in scope?" in shell scripts. Unsure targets don't count.
+
+  --asn-dataset /path/to/ip2asn-v4.tsv.gz
+      Accept ASN targets (like AS64500), and replace them with the CIDR prefixes announced by the ASN, which are checked like --allow-cidr-targets. Useful for checking the ASN of a program against its published CIDR scopes. The dataset can be a local file or an http(s) URL, optionally gzip-compressed, in the format of the ip2asn datasets of iptoasn.com ("range_start range_end ASN ...") or with one "prefix ASN" per line.
+
+  --allow-cidr-targets
+      Treat the targets that are CIDR ranges (like 10.0.0.0/24) as ranges, instead of as URLs with a path. A range is in scope only if it's fully contained in an in-scope range or IP address, and none of its addresses are out of scope.
+
+  --drop-out-of-scope-ports
+      When a target has an explicit port (like example.com:8080) and its matching rule only allows some ports (see the scope bundles), treat the targets with any other port as out-of-scope. Targets without a port are always kept.
+
+  --strip-port-and-keep
+      Like --drop-out-of-scope-ports, but the targets with a port that isn't allowed are kept, without their port. For example, "https://example.com:8080/login" turns into "https://example.com/login".
+
+  --verify-scope-live
+      Download the program page of the selected firebounty programs, and warn (HS-W019) when their cached scopes diverge significantly from the hosts found on it: when most of the cached scopes aren't on the page, or when the page mentions hosts under the program's domains that no cached scope covers. Catches stale firebounty data before you rely on it. The cached scopes are used either way. Pages that are rendered with JavaScript can't be verified.
+
+  --open
+      Open the program URL (the policy) and the firebounty page of the selected firebounty programs in the default browser, with xdg-open, open or rundll32 depending on the OS. Only http(s) URLs are opened. A page that can't be opened is a warning (HS-W021), and the scopes are still used.
+
+  --mobile-scopes
+      Also load the android_application and ios_application scopes of the program, and match the targets that are mobile apps against them, for APK and IPA triage pipelines. App targets can be package names or bundle IDs (like com.example.app, only when they don't look like a hostname, matched against the apps of both platforms), IDs with a version (like com.example.app:1.2.3), "android:" package names (like android:com.example.app), "ios:" bundle IDs (like ios:com.example.app), Google Play URLs, or App Store URLs. The bundle IDs of App Store URLs are looked up in the App Store (unless --offline is set), so that App Store URLs and bundle IDs of the same app match each other. App targets are only matched against app scopes, and hostnames are never matched against app scopes. In scopes files, app scopes are written like android:com.example.app or ios:com.example.app, or android:com.example.* for every app whose ID starts with com.example.
+
+  --repo-scopes
+      Recognize the GitHub and GitLab repository URLs in the scopes (like https://github.com/example/app, or https://github.com/example for every repository of an owner), also load the source_code scopes of the program, and match the targets that are repositories against them, for code review. Repository targets can be repository URLs, including the pages inside of them and git@ URLs, or org/repo shorthands (like example/app), which are matched against the repositories of every host. Repository targets are only matched against repository scopes.
+
+  --contract-scopes
+      Recognize the EVM smart contract addresses in the scopes, also load the smart_contract scopes of the program, and match the targets that are contract addresses against them, for Web3 programs. Addresses can be written on their own (like 0x5FbDB2315678afecb367f032d93F642f64180aa3, for every chain), with a chain name or ID (like polygon:0x... or 137:0x...), as CAIP-10 IDs (like eip155:137:0x...), or as block explorer URLs (like https://polygonscan.com/address/0x...). Addresses are case-insensitive, and shown with their EIP-55 checksum. Contract targets are only matched against contract scopes.
+
+  --reclassify-mobile
+      Bug bounty programs sometimes list the package names of their Android apps (like com.example.app) as web_application scopes. Instead of warning about them, move them into the mobile scopes and continue. The reclassified scopes are listed with the rest of the program details.
+
+  --verbose
+      Print every repeated warning. By default, the warnings that can repeat for thousands of input lines (like the targets that can't be parsed) are only printed once, and the rest of them are counted and summarized at the end of the run.
+
+  --suppress-misconfig-warnings
+      Hide the warnings about misconfigured bug bounty programs (scopes without a public TLD, or starting with "com." or "org."), for programs where the noise is known. The faulty scopes are still ignored.
+
   --enable-private-tlds
       Set this flag to enable the use of company scope domains with private TLDs. This essentially disables the bug-bounty-program misconfiguration detection.
 
+  --unanchored-wildcards
+      Match the wildcard scopes against any part of the host, like older versions did. By default, a wildcard must match the whole host, so "*.example.com" doesn't match "www.example.com.evil.net".
+
+  --case-insensitive
+      Match the regex scopes case-insensitively. Hostname and wildcard scopes are always matched case-insensitively, since hostnames aren't case-sensitive.
+
   -ch, --chain-mode, --plain, --raw, --no-ansi
       In "chain-mode" we only output the important information. No decorations.
 	    Default: false
 
+  --diagnostics stderr|none
+      Warnings and errors are always written to stderr, so that only the results are written to stdout, even in chain-mode. Use "none" to hide the warnings. Errors are still shown.
+        Default: stderr
+
+  --log-format text|json
+      Format of the warnings and errors written to stderr. Every warning and error has a stable code, like HS-W001 for an unparsable line, so that automation can filter or alert on specific conditions. With "json", each one is written as a JSON line, like {"level":"warning","code":"HS-W001","message":"..."}.
+        Default: text
+
   --database /path/to/database
       Custom path to the cached firebounty database.
 	  	Default:
 		- Windows: %APPDATA%\hacker-scoper\
-		- Linux: /etc/hacker-scoper/
+		- Linux: $XDG_CACHE_HOME/hacker-scoper/ (~/.cache/hacker-scoper/ if XDG_CACHE_HOME isn't set)
+		- MacOS: ~/Library/Application Support/hacker-scoper/
 
   -iu, --include-unsure
       Include "unsure" assets in the output. An unsure asset is an asset that's not in scope, but is also not out of scope. Very probably unrelated to the bug bounty program.
 
+  --mark-related
+      Give the "related" verdict to the unsure assets that share the registrable domain (eTLD+1) of an in-scope domain or wildcard, like dev.example.com when example.com is in scope with an explicit-level of 2 or 3, so that the near misses can be told apart from the entirely unrelated hosts. Related assets are printed as "RELATED", with the in-scope rule that they share their domain with, and have the "related" type in the CSV and JSON outputs. Implies --include-unsure.
+
+  --database-snapshot /path/to/firebounty.json
+      Use a pinned copy of the firebounty database instead of the cached one. The snapshot is read-only: it's never updated nor modified. Its SHA-256 is shown when the run starts, and recorded in the "database" field of the --json output, so that the scope decisions of an engagement can be reproduced exactly later. Can't be used together with --database.
+
+  --database-checksum URL
+      Verify the downloaded database against a published SHA-256 checksum, either a bare hex checksum or the output of sha256sum. A database that fails verification is never used.
+
+  --database-signature URL --database-public-key /path/to/key.pem
+      Verify the downloaded database against a detached Ed25519 signature (raw, hex or base64), with a public key in PEM format or as the hex or base64 of the raw key. The verified signature is saved next to the database, and the cached database is verified again on every run, so it can't be tampered with on disk either.
+
+  --client-cert /path/to/cert.pem [--client-key /path/to/key.pem]
+      Present a client certificate to the servers that ask for one, like a self-hosted scope mirror behind mTLS. The key can be in the certificate file, or in its own file.
+
+  --ca-bundle /path/to/ca.pem
+      Trust the certificate authorities of a PEM bundle, together with the system's ones, like the internal CA of a corporate network.
+
+  --cache-ttl [SOURCE=]TTL
+      How long the cached copy of a source is used before refreshing it, like "6h" or "2d". Use "never" to keep a fully static cache, for reproducible runs. Without a source, the TTL applies to every source. Can be used multiple times to set the TTL of each source, like "--cache-ttl 6h --cache-ttl plugins=1h". The sources are:
+        firebounty: The firebounty database. Default: 24h
+        plugins: The scopes returned by the scope plugins. Default: 0 (the plugins run every time)
+
+  --http-timeout INT
+      Amount of seconds to wait for a server to respond when downloading remote files. Proxies are configured with the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+        Default: 30
+
+  --filter EXPRESSION
+      Custom logic to decide which of the matched targets are kept. Targets are dropped if the expression is false. See the README for the list of variables and operators.
+        Example: --filter '!(host endsWith ".gov") && port != 8080'
+
   -o, --output /path/to/outputfile
-      Save the inscope assets to a file
+      Save the inscope assets to a file. The {date} and {company} tokens in the filename are replaced with the current date (YYYY-MM-DD) and the company name.
+        Example: --output 'results/{company}-{date}.txt'
+
+  --overwrite
+      Replace the contents of the output file if it already exists. This is the default.
+
+  --append
+      Add the results to the end of the output file if it already exists, instead of replacing it.
+
+  --flush-interval DURATION
+      Write the buffered results to the output file at least this often, like "5s" or "1m", so that other tools can follow the output file while it's being written. By default, the results are buffered until the buffer fills, or until the end of the run. The buffered results are also written when the run is interrupted with Ctrl-C.
+
+  --flush-every N
+      Write the buffered results to the output file every N results. Can be combined with --flush-interval.
+
+  --tee
+      Print the results to stdout (like chain-mode) and also save them to the output file, even when --quiet is set. Useful for chaining hacker-scoper with other tools while keeping a copy of the results. Requires --output.
+
+  --delimiter DELIMITER
+      Delimiter of the columns of the input lines, for comma or tab separated inventories. Either the delimiter itself (like ",") or one of the names "tab", "space", "comma", "semicolon" and "pipe". Quoted targets (like "https://a.example.com") are unquoted. By default, the columns are separated by any amount of spaces and tabs, and the rest of the line after the target is a single column, so that titles like "Example title" are kept whole.
+
+  --target-column INT
+      Column of the input lines where the target is, starting at 1. The rest of the columns are printed back with the in-scope results. Lines without that column are reported as invalid targets.
+        Default: 1
+
+  --with-header
+      Write a metadata block at the top of the output file, so that the result files are self-describing when they resurface weeks later: the version of hacker-scoper, when the file was generated, the sources of the scopes, the hash of the scopes, the database snapshot (if any) and the arguments used. The block is made of "#" comment lines, or of a {"type":"header",...} object with --json. Appended and resumed output files that already have content don't get a second header. Requires --output.
+
+  --http-requests
+      The input contains raw HTTP requests (like the ones saved with Burp's "copy to file") instead of one target per line. The Host header and path of every request are used as the target URL. Several requests can be concatenated in the same file.
+
+  --extract
+      The input is arbitrary text (JS files, pastebins, email bodies...) instead of one target per line. Every URL, hostname and IP address found in the text is checked against the scopes.
+
+  --max-targets INT
+      Stop after processing this many targets. Useful for quickly validating your scopes on a subset of a big input.
+
+  --sample PERCENTAGE
+      Only process a random sample of the targets, for example "1%" or "0.01". Useful for quickly validating your scopes on a subset of a big input.
+
+  --resume /path/to/state.json
+      Periodically save the progress of the run into a checkpoint file. If the run gets interrupted, running the same command again will continue from the last checkpoint instead of starting over. Results are printed in the same order as the input when this flag is set.
+
+  --ordered
+      Print the results in the same order as the input, like for diff-based workflows. The targets are still matched in parallel: the results that are ready early are held back until the results before them are printed.
+
+  --dry-run
+      Preflight check for long jobs: load and parse every scope, print how each scope line was interpreted (its type, its normalized form, and the regex generated for wildcards), count the targets that would be read, and exit without matching them. The targets are optional. Exits with code 1 if any scope line can't be parsed.
+
+  --export-scope caido|mitmproxy
+      Instead of reading targets, print the effective scopes (after merging every scope source and exclusion) in the scope format of a proxy:
+      - caido: a JSON scope preset with an allowlist and a denylist of hostname globs.
+      - mitmproxy: a config.yaml with a view_filter that only shows the in-scope flows, and a block_list entry that blocks everything else.
+      Rules that can't be represented in the format are skipped with a warning.
+
+  --export-exclusions nuclei|katana
+      Instead of reading targets, print the out-of-scope rules as exclusions for a scanner, one per line, so that the exclusions defined once in .noscope apply everywhere:
+      - nuclei: hostnames, IP addresses and CIDR ranges. Use the file with "nuclei -exclude-hosts exclusions.txt".
+      - katana: URL regexes. Use the file with "katana -crawl-out-scope exclusions.txt".
+      Rules that can't be represented in the format are skipped with a warning.
+
+  --serve 127.0.0.1:8765
+      Instead of reading targets, answer scope checks over HTTP with the loaded scopes. Made for proxy extensions (Burp, Caido, etc) that color requests by their verdict in real time. See the README for the API.
+
+  --serve-token TOKEN
+      Require the "Authorization: Bearer TOKEN" header in the --serve requests. By default, no authentication is required.
+
+  --pprof-port INT
+      While --serve runs, serve the Go profiling endpoints (net/http/pprof) at http://127.0.0.1:PORT/debug/pprof/, so that a live instance can be profiled, like with "go tool pprof http://127.0.0.1:6060/debug/pprof/heap". They're only reachable from this machine. Requires --serve.
+
+  --diff-against /path/to/previous-output.txt
+      Only output the assets that aren't in the output of a previous run, in any output format. Useful for detecting new assets in cron jobs. If the file doesn't exist yet, every asset is new.
+
+  --cache-verdicts /path/to/verdicts.json
+      Remember the verdict of every target in this file, and reuse them in the next runs with the same scopes, so that only the new targets are evaluated. The cached verdicts are discarded when the scopes or the explicit levels change.
+
+  --unique
+      Print every asset only once, even if it's repeated in the targets (or, with --hostnames-only, when several URLs have the same hostname).
+
+  --max-memory SIZE
+      The most memory that --unique and --cache-verdicts can use together, like "512MB" or "2G". When it runs out, the assets seen by --unique are moved to a temporary file on disk (only their hashes are written), which is slower but keeps huge deduplicated runs possible on small machines, and the verdicts of the rest of the targets aren't cached. Requires --unique or --cache-verdicts.
+
+  --rule-timings
+      Measure how long every scope rule takes to be matched, and print the 10 slowest rules to stderr at the end of the run. Useful for finding the slow rules (usually pathological regexes) of huge scopes.
+
+  --follow-cnames
+      Follow the CNAME chains of the hostname targets that aren't in scope, and mark them as in scope if any hostname of the chain is in scope (for example, vanity domains that are CNAMEs of the program's infrastructure). The chain stops at the first out-of-scope hostname.
+      In-scope subdomains that only resolve because of a wildcard DNS record of their apex domain are marked with "[wildcard DNS]", since they're usually noise.
+
+  --cname-depth INT
+      Maximum amount of CNAME records followed by --follow-cnames and the cname check of --enrich.
+        Default: 10
+
+  --enrich
+      Run extra checks on the unsure assets, looking for signals that they belong to the program anyway, and rank them by the amount of signals that fired. The unsure assets are printed at the end of the run, after the in-scope ones. Implies --include-unsure.
+      Like with --follow-cnames, in-scope subdomains that only resolve because of a wildcard DNS record are marked with "[wildcard DNS]".
+
+  --enrich-checks cname,tls,favicon
+      Comma-separated list of the checks run by --enrich:
+        cname: the CNAME chain of the asset reaches an in-scope hostname.
+        tls: the TLS certificate of the asset is also valid for an in-scope hostname.
+        favicon: the favicon of the asset is identical to the favicon of an in-scope hostname.
+        Default: cname,tls,favicon
+
+  --resolvers /path/to/resolvers.txt
+      Send the DNS queries of --follow-cnames and --enrich to these resolvers instead of the ones of the system. One resolver per line, like "8.8.8.8", "tcp://9.9.9.9:53" or "https://dns.google/dns-query" (DNS over HTTPS). The queries are spread between all the resolvers, and every hostname is only queried once per run.
+
+  --dns-timeout INT
+      Amount of seconds to wait for a DNS server to respond.
+        Default: 5
 
   --csv
-      Output in CSV format.
+      Output in CSV format. Email address targets are reported with the "inscope-email" and "unsure-email" types.
+
+  --format text|csv|json|github
+      Output format. "csv" and "json" are the same as --csv and --json. "github" prints GitHub Actions workflow annotations instead of the results: an ::error:: for every out-of-scope target, and a ::warning:: for every unsure or invalid target (even without --include-unsure, the targets that match neither the in-scope nor the out-of-scope rules are unsure), pointing at their line in the targets file, so that scope violations in a committed target list show up inline on pull requests. Use --fail-on-out-of-scope to also fail the job.
+        Default: text
+
+  --json
+      Output one JSON object per line, like {"type":"inscope","asset":"a.example.com","rule":"*.example.com","description":"Main website"}. The description is the comment of the rule in the scopes file, if any. The "sources" are the programs and files that contributed the rule, like ["Example", "--scope"]. The "parsed" object has the pieces of the target that hacker-scoper already parsed, like {"scheme":"https","host":"a.example.com","port":"8443","path":"/login"}.
+
+  --show-rule
+      Show the scope rule that matched each in-scope target, together with its comment in the scopes file. When the scopes are combined from several sources (several companies, or a company and --scope entries), the programs and files that contributed the rule are shown too, like "[*.example.com # from Example, Example (Bugcrowd)]". With --csv, the "rule", "description" and "sources" columns are added.
 
   --quiet
-      Disable command-line output.
+      Disable command-line output. Requires an output file, unless --stats, --any or --fail-on-out-of-scope is set, for the runs that only care about the summary or the exit code.
+
+  --stats
+      When the run finishes, print a summary on stderr, like "[STATS]: 1000 targets in 1.5s: 800 in scope, 10 unsure, 150 out of scope, 40 invalid". It's printed even with --quiet or chain-mode, and when the run is interrupted.
+      The rules with the most in-scope results are listed too, like "800 (80.0%): *.example.com", so that it's easy to see when most of the results came from a single wildcard.
+
+  --stats-top INT
+      Amount of rules listed by --stats. Use 0 to only print the summary.
+        Default: 10
+
+  --fail-on-out-of-scope
+      Exit with code 1 if any target is out of scope or can't be parsed, for CI checks that a list of targets only has in-scope assets. Unsure targets don't count, even without --include-unsure: the targets that match neither the in-scope nor the out-of-scope rules are counted as unsure.
+
+  --no-progress
+      Don't show the progress bar. The progress bar is shown on stderr with the amount of processed targets, their rate and the ETA, unless stderr isn't a terminal or chain-mode is enabled.
+
+  --no-hyperlinks
+      Don't print the firebounty URL, the program URL and the company name as terminal hyperlinks. They're only printed as hyperlinks (OSC 8) in the decorated output, when stdout is a terminal.
+
+  --link-hosts
+      In the decorated output, link every in-scope host to https://<host>, so that it can be opened from the terminal with a click. Disabled by --no-hyperlinks.
 
   -ho, --hostnames-only
-      When handling URLs, output only their hostnames instead of the full URLs
+      When handling URLs, output only their hostnames instead of the full URLs. IP addresses are printed in their canonical form, without brackets, like 2001:db8::1.
+
+  --offline
+      Don't connect to the internet unless asked to: disable the update check, and use the local firebounty database even if it's older than 24hs. Remote target and scope files are still downloaded.
 
   --version
-      Show the installed version
+      Show the installed version. With "update-check: true" in the config file (~/.config/hacker-scoper/config.yaml on Linux), hacker-scoper also checks GitHub for a newer release once a day, and prints a one-line notice when there is one (never in chain mode, nor with --offline). The check is disabled by default.
 
 `
 
 	flag.StringVar(&company, "c", "", "Specify the company name to lookup.")
 	flag.StringVar(&company, "company", "", "Specify the company name to lookup.")
+	flag.BoolVar(&useLastSelection, "last", false, "Reuse the last company selection.")
+	flag.Var(&selectedSlugs, "select-slug", "Select the program with this slug among the companies matched by --company. Can be used multiple times.")
+	flag.BoolVar(&mergeDuplicatePrograms, "merge-duplicates", false, "Select the firebounty entries of the same program together.")
 	flag.StringVar(&targetsListFilepath, "f", "", "Path to your file containing URLs")
 	flag.StringVar(&targetsListFilepath, "file", "", "Path to your file containing URLs")
 	flag.StringVar(&scopesListFilepath, "ins", "", "Path to a custom plaintext file containing scopes")
@@ -210,31 +713,120 @@ func main() {
 	flag.StringVar(&outofScopesListFilepath, "out-of-scope", "", "Path to a custom plaintext file containing scopes exclusions")
 	flag.StringVar(&outofScopesListFilepath, "outofscope-file", "", "Path to a custom plaintext file containing scopes exclusions")
 	flag.StringVar(&outofScopesListFilepath, "out-of-scope-file", "", "Path to a custom plaintext file containing scopes exclusions")
-	flag.IntVar(&inscopeExplicitLevel, "ie", 1, "Level of explicitness expected. ([1]/2/3)")
-	flag.IntVar(&inscopeExplicitLevel, "inscope-explicit-level", 1, "Level of explicitness expected. ([1]/2/3)")
-	flag.IntVar(&inscopeExplicitLevel, "in-scope-explicit-level", 1, "Level of explicitness expected. ([1]/2/3)")
-	flag.IntVar(&noscopeExplicitLevel, "oe", 1, "Level of explicitness expected. ([1]/2/3)")
-	flag.IntVar(&noscopeExplicitLevel, "noscope-explicit-level", 1, "Level of explicitness expected. ([1]/2/3)")
-	flag.IntVar(&noscopeExplicitLevel, "no-scope-explicit-level", 1, "Level of explicitness expected. ([1]/2/3)")
+	flag.Var(&scopePluginCommands, "scope-plugin", "Get the scopes from an external executable instead of firebounty. Can be used multiple times.")
+	flag.StringVar(&pastedScopeFilepath, "paste-scope", "", "Path to a file containing the scope tables copied from a program's policy page")
+	flag.IntVar(&inscopeExplicitLevel, "ie", int(ExplicitLevelSubdomains), "Level of explicitness expected. (0/[1]/2/3)")
+	flag.IntVar(&inscopeExplicitLevel, "inscope-explicit-level", int(ExplicitLevelSubdomains), "Level of explicitness expected. (0/[1]/2/3)")
+	flag.IntVar(&inscopeExplicitLevel, "in-scope-explicit-level", int(ExplicitLevelSubdomains), "Level of explicitness expected. (0/[1]/2/3)")
+	flag.IntVar(&firebountyExplicitLevel, "firebounty-explicit-level", noSourceExplicitLevel, "Level of explicitness expected from the in-scope entries of the firebounty programs, instead of the --inscope-explicit-level. (0/1/2/3)")
+	flag.IntVar(&fileExplicitLevel, "file-explicit-level", noSourceExplicitLevel, "Level of explicitness expected from the in-scope entries of every other source (scopes files, --scope, scope bundles, etc), instead of the --inscope-explicit-level. (0/1/2/3)")
+	flag.IntVar(&noscopeExplicitLevel, "oe", int(ExplicitLevelSubdomains), "Level of explicitness expected. (0/[1]/2/3)")
+	flag.IntVar(&noscopeExplicitLevel, "noscope-explicit-level", int(ExplicitLevelSubdomains), "Level of explicitness expected. (0/[1]/2/3)")
+	flag.IntVar(&noscopeExplicitLevel, "no-scope-explicit-level", int(ExplicitLevelSubdomains), "Level of explicitness expected. (0/[1]/2/3)")
+	flag.BoolVar(&anyMode, "any", false, "Print nothing, and exit with code 0 as soon as an in-scope target is found, or with code 1 if there are none.")
+	flag.StringVar(&asnDatasetPath, "asn-dataset", "", "Path or URL of an ASN dataset, to expand the ASN targets (like AS64500) into their prefixes.")
+	flag.BoolVar(&allowCIDRTargets, "allow-cidr-targets", false, "Treat the CIDR targets as ranges, which are in scope only if they're fully contained in the in-scope ranges.")
+	flag.BoolVar(&dropOutOfScopePorts, "drop-out-of-scope-ports", false, "Treat the targets with a port that isn't allowed by their matching rule as out-of-scope.")
+	flag.BoolVar(&stripOutOfScopePorts, "strip-port-and-keep", false, "Remove the ports that aren't allowed by their matching rule from the targets, and keep them.")
+	flag.BoolVar(&verifyScopeLive, "verify-scope-live", false, "Download the program page of the selected firebounty programs, and warn when their cached scopes diverge from it.")
+	flag.BoolVar(&openProgramPages, "open", false, "Open the program URL and the firebounty page of the selected programs in the default browser.")
+	flag.BoolVar(&mobileScopesEnabled, "mobile-scopes", false, "Match the targets that are Android package names or iOS bundle IDs against the android_application and ios_application scopes of the program.")
+	flag.BoolVar(&repoScopesEnabled, "repo-scopes", false, "Match the targets that are GitHub or GitLab repositories against the repository scopes of the program.")
+	flag.BoolVar(&contractScopesEnabled, "contract-scopes", false, "Match the targets that are smart contract addresses against the contract scopes of the program.")
+	flag.BoolVar(&reclassifyMobile, "reclassify-mobile", false, "Move the Android package names listed as web_application scopes into the mobile scopes, instead of warning about them.")
+	flag.BoolVar(&hideMisconfigWarnings, "suppress-misconfig-warnings", false, "Hide the warnings about misconfigured bug bounty programs.")
 	flag.BoolVar(&privateTLDsAreEnabled, "enable-private-tlds", false, "Set this flag to enable the use of company scope domains with private TLDs. This essentially disables the bug-bounty-program misconfiguration detection.")
+	flag.BoolVar(&unanchoredWildcards, "unanchored-wildcards", false, "Match the wildcard scopes against any part of the host, like older versions did.")
+	flag.BoolVar(&caseInsensitiveRegexes, "case-insensitive", false, "Match the regex scopes case-insensitively.")
 	flag.BoolVar(&chainMode, "ch", false, "Output only the important information. No decorations.")
 	flag.BoolVar(&chainMode, "chain-mode", false, "Output only the important information. No decorations.")
 	flag.BoolVar(&chainMode, "plain", false, "Output only the important information. No decorations.")
 	flag.BoolVar(&chainMode, "raw", false, "Output only the important information. No decorations.")
 	flag.BoolVar(&chainMode, "no-ansi", false, "Output only the important information. No decorations.")
+	flag.StringVar(&diagnosticsMode, "diagnostics", "stderr", "Where the warnings are written to. (stderr/none)")
+	flag.Var(&logFormat, "log-format", "Format of the warnings and errors written to stderr. Either \"text\" or \"json\".")
 	flag.StringVar(&firebountyJSONPath, "database", "", "Custom path to the cached firebounty database")
+	flag.StringVar(&databaseSnapshotPath, "database-snapshot", "", "Path to a pinned copy of the firebounty database, which is never updated.")
+	flag.StringVar(&databaseChecksumURL, "database-checksum", "", "URL of the published SHA-256 checksum of the database.")
+	flag.StringVar(&databaseSignatureURL, "database-signature", "", "URL of the detached Ed25519 signature of the database.")
+	flag.StringVar(&databasePublicKeyPath, "database-public-key", "", "Path to the Ed25519 public key that the database signature is verified with.")
+	flag.StringVar(&clientCertPath, "client-cert", "", "Path to the PEM client certificate presented to servers that ask for one.")
+	flag.StringVar(&clientKeyPath, "client-key", "", "Path to the PEM private key of the client certificate.")
+	flag.StringVar(&caBundlePath, "ca-bundle", "", "Path to a PEM bundle of extra certificate authorities to trust.")
+	flag.Var(&cacheTTLs, "cache-ttl", "How long the cached database and scope plugin results are used before refreshing them, like \"6h\", \"plugins=1h\" or \"never\". Can be used multiple times.")
+	flag.IntVar(&httpTimeout, "http-timeout", 30, "Amount of seconds to wait for a server to respond when downloading remote files.")
+	flag.StringVar(&profileName, "profile", "", "Load the arguments stored in a named profile.")
+	flag.StringVar(&scopeBundleFilepath, "scope-bundle", "", "Load the scopes from a YAML scope bundle.")
+	flag.Var(&commandLineScopes, "scope", "Add an in-scope entry. Can be used multiple times.")
+	flag.Var(&assumedScopes, "assume-inscope", "Use only this in-scope entry, ignoring the .inscope and .noscope files. Can be used multiple times.")
+	flag.Var(&commandLineExclusions, "exclude", "Add an out-of-scope entry. Can be used multiple times.")
+	flag.StringVar(&filterExpressionStr, "filter", "", "Custom logic to decide which of the matched targets are kept.")
 	flag.StringVar(&inscopeOutputFile, "o", "", "Save the inscope urls to a file")
 	flag.StringVar(&inscopeOutputFile, "output", "", "Save the inscope urls to a file")
+	flag.BoolVar(&overwriteOutputFile, "overwrite", false, "Replace the contents of the output file if it already exists.")
+	flag.BoolVar(&appendOutputFile, "append", false, "Add the results to the end of the output file instead of replacing it.")
+	flag.StringVar(&flushIntervalStr, "flush-interval", "", "Write the buffered results to the output file at least this often, like \"5s\".")
+	flag.IntVar(&flushEvery, "flush-every", 0, "Write the buffered results to the output file every N results.")
+	flag.BoolVar(&teeOutput, "tee", false, "Print the results to stdout and also save them to the output file.")
+	flag.StringVar(&rawColumnDelimiter, "delimiter", "", "Delimiter of the columns of the input lines, like \",\" or \"tab\". By default, the columns are separated by spaces and tabs.")
+	flag.IntVar(&targetColumn, "target-column", 1, "Column of the input lines where the target is, starting at 1.")
+	flag.BoolVar(&withHeader, "with-header", false, "Write a commented metadata block at the top of the output file.")
+	flag.BoolVar(&inputIsHTTPRequests, "http-requests", false, "The input contains raw HTTP requests instead of one target per line.")
+	flag.BoolVar(&extractMode, "extract", false, "Check every URL, hostname and IP address found in arbitrary text.")
+	flag.IntVar(&maxTargets, "max-targets", 0, "Stop after processing this many targets.")
+	flag.BoolVar(&noProgress, "no-progress", false, "Don't show the progress bar.")
+	flag.BoolVar(&hyperlinksDisabled, "no-hyperlinks", false, "Don't print the URLs as terminal hyperlinks.")
+	flag.BoolVar(&linkInscopeHosts, "link-hosts", false, "Link the in-scope hosts to https://<host> in the decorated output.")
+	flag.StringVar(&sampleRateStr, "sample", "", "Only process a random sample of the targets, for example \"1%\".")
+	flag.BoolVar(&verboseWarnings, "verbose", false, "Print every repeated warning, like the warnings about malformed targets, instead of summarizing them at the end.")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print how every scope line is interpreted and how many targets would be read, then exit without matching them.")
+	flag.StringVar(&exportScopeFormat, "export-scope", "", "Print the effective scopes in the scope format of a proxy (caido or mitmproxy) instead of reading targets.")
+	flag.StringVar(&exportExclusionsFormat, "export-exclusions", "", "Print the out-of-scope rules as exclusions for a scanner (nuclei or katana) instead of reading targets.")
+	flag.StringVar(&serveAddress, "serve", "", "Answer scope checks over HTTP at GET /check?target=... instead of reading targets.")
+	flag.StringVar(&serveToken, "serve-token", "", "Require this token in the Authorization header of the --serve requests.")
+	flag.IntVar(&pprofPort, "pprof-port", 0, "Serve the net/http/pprof endpoints on this port of 127.0.0.1 while --serve runs.")
+	flag.StringVar(&diffAgainstFilepath, "diff-against", "", "Only output the assets that aren't in the output of a previous run.")
+	flag.StringVar(&verdictCachePath, "cache-verdicts", "", "Remember the verdict of every target in this file, and reuse them in the next runs with the same scopes.")
+	flag.BoolVar(&uniqueAssets, "unique", false, "Print every asset only once, even if it's repeated in the targets.")
+	flag.StringVar(&maxMemoryStr, "max-memory", "", "Most memory used by --unique and --cache-verdicts, like \"512MB\". --unique moves to a temporary file when it runs out.")
+	flag.BoolVar(&showRuleTimings, "rule-timings", false, "Print the 10 slowest scope rules at the end of the run.")
+	flag.StringVar(&resumeStatePath, "resume", "", "Save the progress of the run into a checkpoint file, and continue from it if it already exists.")
+	flag.BoolVar(&orderedOutput, "ordered", false, "Print the results in the same order as the input.")
 	flag.BoolVar(&outputCSVFormat, "csv", false, "Output in CSV format")
+	flag.BoolVar(&followCNAMEs, "follow-cnames", false, "Mark targets as in scope if their CNAME chain goes through an in-scope hostname.")
+	flag.IntVar(&cnameDepth, "cname-depth", 10, "Maximum amount of CNAME records followed by --follow-cnames and the cname check of --enrich.")
+	flag.StringVar(&resolversFilepath, "resolvers", "", "Path to a file with the DNS resolvers used by --follow-cnames and --enrich.")
+	flag.IntVar(&dnsTimeout, "dns-timeout", defaultDNSTimeout, "Amount of seconds to wait for a DNS server to respond.")
+	flag.BoolVar(&enrichUnsure, "enrich", false, "Run extra checks on the unsure assets, and rank them by the amount of signals that fired.")
+	flag.StringVar(&enrichChecks, "enrich-checks", defaultEnrichChecks, "Comma-separated list of the checks run by --enrich.")
+	flag.BoolVar(&outputJSONFormat, "json", false, "Output one JSON object per line")
+	flag.StringVar(&outputFormat, "format", "", "Output format. Either \"text\", \"csv\", \"json\" or \"github\".")
+	flag.BoolVar(&showRule, "show-rule", false, "Show the scope rule that matched each target")
 	flag.BoolVar(&quietMode, "quiet", false, "Disable command-line output.")
+	flag.BoolVar(&showStats, "stats", false, "Print a summary of the run on stderr when it finishes.")
+	flag.IntVar(&statsTopRules, "stats-top", defaultStatsTopRules, "Amount of rules listed by --stats, ranked by their amount of in-scope results.")
+	flag.BoolVar(&failOnOutOfScope, "fail-on-out-of-scope", false, "Exit with code 1 if any target is out of scope or can't be parsed.")
 	flag.BoolVar(&showVersion, "version", false, "Show installed version")
+	flag.BoolVar(&offlineMode, "offline", false, "Don't connect to the internet unless asked to: disable the update check, and use the local database even if it's older than 24hs.")
 	flag.BoolVar(&includeUnsure, "iu", false, "Include \"unsure\" URLs in the output. An unsure URL is a URL that's not in scope, but is also not out of scope. Very probably unrelated to the bug bounty program.")
+	flag.BoolVar(&markRelated, "mark-related", false, "Give the \"related\" verdict to the unsure assets that share the registrable domain of an in-scope domain, like dev.example.com with an explicit-level of 2. Implies --include-unsure.")
 	flag.BoolVar(&includeUnsure, "include-unsure", false, "Include \"unsure\" URLs in the output. An unsure URL is a URL that's not in scope, but is also not out of scope. Very probably unrelated to the bug bounty program.")
 	flag.BoolVar(&outputDomainsOnly, "ho", false, "Output only domains instead of the full URLs")
 	flag.BoolVar(&outputDomainsOnly, "hostnames-only", false, "Output only domains instead of the full URLs")
 	//https://www.antoniojgutierrez.com/posts/2021-05-14-short-and-long-options-in-go-flags-pkg/
 	flag.Usage = func() { fmt.Print(usage) }
 	flag.Parse()
+	appStoreLookupContext = ctx
+
+	if profileName != "" {
+		profileSettings, err := loadProfile(profileName)
+		if err == nil {
+			err = applyProfile(flag.CommandLine, profileSettings)
+		}
+		if err != nil {
+			crash(errReadInput, "Unable to load the profile \""+profileName+"\": "+err.Error(), err)
+		}
+	}
 
 	banner := `
 '||                      '||                      '
@@ -247,579 +839,1829 @@ func main() {
 `
 
 	if showVersion {
-		fmt.Print("hacker-scoper: v6.2.0\n")
+		fmt.Print("hacker-scoper: v" + currentVersion + "\n")
 		os.Exit(0)
 	}
 
-	if quietMode && inscopeOutputFile == "" {
-		warning("--quiet was set, but no output file was specified. Program will do nothing.")
+	switch outputFormat {
+	case "", "text":
+	case "csv":
+		outputCSVFormat = true
+	case "json":
+		outputJSONFormat = true
+	case "github":
+		outputGitHubFormat = true
+	default:
+		warning(warnInvalidArguments, "Invalid --format selected. Valid formats are \"text\", \"csv\", \"json\" and \"github\".")
 		os.Exit(2)
 	}
 
-	// This avoids having to check both chainMode and quietMode in the future. Instead we can just check chainMode.
-	if quietMode && !chainMode {
-		chainMode = quietMode
+	if outputCSVFormat && outputJSONFormat {
+		warning(warnInvalidArguments, "--csv and --json can't be used at the same time.")
+		os.Exit(2)
+	}
+	if outputGitHubFormat && (outputCSVFormat || outputJSONFormat) {
+		warning(warnInvalidArguments, "--format github can't be used with --csv or --json.")
+		os.Exit(2)
 	}
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		for range c {
-			if databaseIsUpdating {
-				fmt.Println()
-				path := tmpFile.Name()
-				tmpFile.Close() // #nosec G104 -- There is no harm in potentially double-closing a temp file.
-				err := os.Remove(path)
-				if err != nil {
-					warning("Error deleting temp file at \"" + path + "\". Please ensure the file is deleted.")
-				}
-				infoGood("INFO: ", "Database update has been cancelled. Previous state restored.")
-			}
-			os.Exit(0)
-		}
-	}()
+	if teeOutput && inscopeOutputFile == "" {
+		warning(warnInvalidArguments, "--tee requires an output file. Use --output to specify it.")
+		os.Exit(2)
+	}
+	if withHeader && inscopeOutputFile == "" {
+		warning(warnInvalidArguments, "--with-header requires an output file. Use --output to specify it.")
+		os.Exit(2)
+	}
 
-	if firebountyJSONPath == "" {
-		firebountyJSONPath = getFirebountyJSONPath()
-		if firebountyJSONPath == "" && !chainMode {
-			warning("This OS isn't officially supported. The firebounty JSON will be downloaded in the current working directory. To override this behavior, use the \"--database\" flag.")
-		}
-	} else {
-		//If the folder exists...
-		_, err := os.Stat(firebountyJSONPath)
-		if errors.Is(err, os.ErrNotExist) {
-			//Create the folder
-			err := os.Mkdir(firebountyJSONPath, 0700)
-			if err != nil {
-				crash("Unable to create the folder \""+firebountyJSONPath+"\"", err)
-			}
-		} else if err != nil {
-			// Schrodinger: file may or may not exist. See err for details.
-			crash("Could not verify existence of the folder \""+firebountyJSONPath+"\"!", err)
+	if anyMode {
+		if inscopeOutputFile != "" || resumeStatePath != "" {
+			warning(warnInvalidArguments, "--any doesn't print or save any results, so it can't be used with --output or --resume.")
+			os.Exit(2)
 		}
+		// Scripts only care about the exit code
+		chainMode = true
+		hideWarnings = true
 	}
 
-	firebountyJSONPath = firebountyJSONPath + firebountyJSONFilename
-
-	if !chainMode {
-		fmt.Println(banner)
+	// Without an output file, --quiet is still useful for the summary and the exit code of the run
+	if quietMode && inscopeOutputFile == "" && !showStats && !failOnOutOfScope && !anyMode {
+		warning(warnInvalidArguments, "--quiet was set, but no output file, --stats, --any or --fail-on-out-of-scope was specified. Program will do nothing.")
+		os.Exit(2)
 	}
 
-	//validate arguments
-	if inscopeExplicitLevel != 1 && inscopeExplicitLevel != 2 && inscopeExplicitLevel != 3 {
-		var err error
-		crash("Invalid in-scope explicit-level selected", err)
+	layout := columnLayout{column: targetColumn}
+	if rawColumnDelimiter != "" {
+		delimiter, err := parseColumnDelimiter(rawColumnDelimiter)
+		if err != nil {
+			crash(errInvalidArguments, "Invalid --delimiter selected", err)
+		}
+		layout.delimiter = delimiter
 	}
-	if noscopeExplicitLevel != 1 && noscopeExplicitLevel != 2 && noscopeExplicitLevel != 3 {
-		var err error
-		crash("Invalid no-scope explicit-level selected", err)
+	if targetColumn < 1 {
+		warning(warnInvalidArguments, "Invalid --target-column selected. The columns are numbered from 1.")
+		os.Exit(2)
 	}
 
-	// Validate the targets input
-	var streamedLinesChan <-chan string
-
-	// If we're getting input from stdin...
-	//https://stackoverflow.com/a/26567513/11490425
-	stat, _ := os.Stdin.Stat()
-	if (stat.Mode()&os.ModeCharDevice) == 0 && !isVSCodeDebug() {
-
-		// Stream stdin into the same async pipeline we use for files so
-		// workers can start processing immediately and we avoid buffering
-		// the whole input in memory.
-		ch := make(chan string, 1024)
-		go func() {
-			scanner := bufio.NewScanner(os.Stdin)
-			for scanner.Scan() {
-				line := strings.TrimSpace(scanner.Text())
-				if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "//") {
-					ch <- line
-				}
-			}
-			close(ch)
-		}()
-		streamedLinesChan = ch
-
-	} else if targetsListFilepath != "" {
-		// We didn't get anything from stdin, so we will use the file specified by the user
-		// Immediately open the file specified by the user and stream lines so workers
-		// can begin processing while the reader continues to read the file.
+	if statsTopRules < 0 {
+		warning(warnInvalidArguments, "Invalid --stats-top selected. It can't be negative.")
+		os.Exit(2)
+	}
 
-		// Use streaming reader instead of loading whole file into memory
-		linesChan, err := streamFileLines(targetsListFilepath)
-		if err != nil {
-			crash("Could not read the file "+targetsListFilepath, err)
+	if len(assumedScopes) > 0 {
+		if company != "" || scopesListFilepath != "" || scopeBundleFilepath != "" || pastedScopeFilepath != "" || len(scopePluginCommands) > 0 || useLastSelection {
+			warning(warnInvalidArguments, "--assume-inscope builds the whole scope from the command line, so it can't be used with a company or another scopes file. Use --scope to add entries to them instead.")
+			os.Exit(2)
 		}
-		streamedLinesChan = linesChan
+		// The scope is built on the fly, just like with --scope
+		commandLineScopes = append(commandLineScopes, assumedScopes...)
+	}
 
-	} else {
-		// We didn't get anything from stdin, and the user didn't specify a file
-		// Print a usage warning, then quit gracefully
+	if overwriteOutputFile && appendOutputFile {
+		warning(warnInvalidArguments, "--overwrite and --append can't be used at the same time.")
+		os.Exit(2)
+	}
+	inscopeOutputFile = expandOutputFilename(inscopeOutputFile, company, time.Now())
 
-		if !chainMode {
-			fmt.Println(colorRed + "[-] No input file specified. Please specify a file with the -f or --file argument." + colorReset)
-			fmt.Println(colorRed + "[-] Run with \"--help\" for more information." + colorReset)
+	var flushInterval time.Duration
+	if flushIntervalStr != "" {
+		var err error
+		flushInterval, err = parseAge(flushIntervalStr)
+		if err != nil || flushInterval <= 0 {
+			warning(warnInvalidArguments, "Invalid --flush-interval selected. Use an amount of time like \"5s\" or \"1m\".")
+			os.Exit(2)
 		}
-
-		// Exit code 2 = command line syntax error
+	}
+	if flushEvery < 0 {
+		warning(warnInvalidArguments, "Invalid --flush-every selected. It must be a positive amount of results.")
+		os.Exit(2)
+	}
+	if (flushInterval > 0 || flushEvery > 0) && inscopeOutputFile == "" {
+		warning(warnInvalidArguments, "--flush-interval and --flush-every require an output file. Use --output to specify it.")
 		os.Exit(2)
 	}
 
-	var inscopeLines []string
-	var noscopeLines []string
-
-	// Validate the inscope input
-	if company == "" && scopesListFilepath == "" {
-		// If the user didn't specify a company name, and also didn't specify a filepath for the inscope and outofscope files, we'll search for .inscope and .noscope files.
+	if httpTimeout <= 0 {
+		var err error
+		crash(errInvalidArguments, "Invalid --http-timeout selected", err)
+	}
+	httpClient = newHTTPClient(time.Duration(httpTimeout) * time.Second)
+	setupClientTLS()
+
+	switch diagnosticsMode {
+	case "stderr":
+	case "none":
+		hideWarnings = true
+	default:
+		warning(warnInvalidArguments, "Invalid --diagnostics selected. Valid values are \"stderr\" and \"none\".")
+		os.Exit(2)
+	}
 
-		if !chainMode {
-			fmt.Println("No company or scopes file specified. Looking for \".inscope\" and \".noscope\" files...")
+	// This avoids having to check both chainMode and quietMode in the future. Instead we can just check chainMode.
+	if quietMode && !chainMode {
+		chainMode = quietMode
+	}
+	// The results printed to stdout by --tee, --json and --format github are meant to be piped to other tools, so they can't have decorations.
+	if teeOutput || outputJSONFormat || outputGitHubFormat {
+		chainMode = true
+	}
+	hyperlinksEnabled = !chainMode && terminalSupportsHyperlinks()
+	// The exported scopes are printed to stdout, so they can't be mixed with any other messages
+	if exportScopeFormat != "" {
+		if !slices.Contains(scopeExportFormats, exportScopeFormat) {
+			warning(warnInvalidArguments, "Invalid --export-scope selected. Valid formats are \""+strings.Join(scopeExportFormats, "\", \"")+"\".")
+			os.Exit(2)
 		}
-
-		//look for .inscope file
-		inscopePath, err := searchForFileBackwards(".inscope")
-		if err != nil {
-			crash("Couldn't locate a .inscope file.", err)
+		chainMode = true
+	}
+	if exportExclusionsFormat != "" {
+		if !slices.Contains(exclusionExportFormats, exportExclusionsFormat) {
+			warning(warnInvalidArguments, "Invalid --export-exclusions selected. Valid formats are \""+strings.Join(exclusionExportFormats, "\", \"")+"\".")
+			os.Exit(2)
 		}
-
-		if !chainMode {
-			fmt.Println(".inscope found. Using " + inscopePath)
+		if exportScopeFormat != "" {
+			warning(warnInvalidArguments, "--export-scope and --export-exclusions can't be used at the same time.")
+			os.Exit(2)
 		}
+		chainMode = true
+	}
 
-		//look for .noscope file
-		noscopePath, err := searchForFileBackwards(".noscope")
-		if err != nil {
-			noscopePath = ""
-		} else if !chainMode {
-			fmt.Println(".noscope found. Using " + noscopePath)
-		}
+	handleInterrupts(&databaseIsUpdating, &tmpFile)
 
-		// Load the inscope file into memory
-		inscopeLines, err = readFileLines(inscopePath)
-		if err != nil {
-			crash(".inscope file found at "+inscopePath+" but couldn't be read.", err)
-		}
+	setupFirebountyJSONPath()
+
+	if len(selectedSlugs) > 0 && (company == "" || useLastSelection) {
+		warning(warnInvalidArguments, "--select-slug selects among the companies of --company, so it requires --company, and it can't be used with --last.")
+		os.Exit(2)
+	}
 
-		// Load the noscope file into memory
-		noscopeLines, err = readFileLines(noscopePath)
+	// --last without a company reuses the most recent company selection
+	if useLastSelection && company == "" {
+		selection, err := lastCompanySelection("")
 		if err != nil {
-			crash(".noscope file found at "+noscopePath+" but couldn't be read.", err)
+			crash(errReadInput, "Unable to reuse the last company selection: "+err.Error(), err)
 		}
+		company = selection.Query
+	}
 
-	} else if company != "" {
-		// If the user inputted a company name, we'll lookup said company in the firebounty db
+	if !chainMode {
+		fmt.Println(banner)
+		if !offlineMode && updateCheckIsEnabled(readConfig()) {
+			notifyIfOutdated(ctx)
+		}
+	}
 
-		// If the db exists...
-		if firebountyJSONFileStats, err := os.Stat(firebountyJSONPath); err == nil {
-			//check age. if age > 24hs
-			yesterday := time.Now().Add(-24 * time.Hour)
-			if firebountyJSONFileStats.ModTime().Before(yesterday) {
-				if !chainMode {
-					fmt.Println("[INFO]: +24hs have passed since the last update to the local firebounty database. Updating...")
-				}
-				updateFireBountyJSON(&databaseIsUpdating, tmpFile, true)
-			}
-		} else if errors.Is(err, os.ErrNotExist) {
-			// The database does not exist.
-			// We'll create it.
+	//validate arguments
+	if !ExplicitLevel(inscopeExplicitLevel).isValid() {
+		var err error
+		crash(errInvalidArguments, "Invalid in-scope explicit-level selected", err)
+	}
+	if !ExplicitLevel(noscopeExplicitLevel).isValid() {
+		var err error
+		crash(errInvalidArguments, "Invalid no-scope explicit-level selected", err)
+	}
+	// The per-source levels of the config file are only used when they aren't given as arguments
+	configFirebountyLevel, configFileLevel := configSourceExplicitLevels(readConfig())
+	if firebountyExplicitLevel == noSourceExplicitLevel {
+		firebountyExplicitLevel = configFirebountyLevel
+	}
+	if fileExplicitLevel == noSourceExplicitLevel {
+		fileExplicitLevel = configFileLevel
+	}
+	if err := validateSourceExplicitLevel(firebountyExplicitLevel); err != nil {
+		crash(errInvalidArguments, "Invalid --firebounty-explicit-level selected", err)
+	}
+	if err := validateSourceExplicitLevel(fileExplicitLevel); err != nil {
+		crash(errInvalidArguments, "Invalid --file-explicit-level selected", err)
+	}
+	if err := validatePprofPort(pprofPort); err != nil {
+		crash(errInvalidArguments, "Invalid --pprof-port selected", err)
+	}
+	if pprofPort != 0 && serveAddress == "" {
+		warning(warnInvalidArguments, "--pprof-port requires --serve. Use it with the monitor subcommand to profile the monitor.")
+		os.Exit(2)
+	}
+	var maxMemory int64
+	if maxMemoryStr != "" {
+		var err error
+		maxMemory, err = parseMemorySize(maxMemoryStr)
+		if err != nil {
+			warning(warnInvalidArguments, "Invalid --max-memory selected. Use an amount of memory like \"512MB\" or \"2G\".")
+			os.Exit(2)
+		}
+		if !uniqueAssets && verdictCachePath == "" {
+			warning(warnInvalidArguments, "--max-memory only limits the memory of --unique and --cache-verdicts, and neither was set.")
+			os.Exit(2)
+		}
+	}
+	var filterExpression *filterExpr
+	if filterExpressionStr != "" {
+		var err error
+		filterExpression, err = compileFilterExpr(filterExpressionStr)
+		if err != nil {
+			crash(errInvalidArguments, "Invalid --filter expression: "+err.Error(), err)
+		}
+	}
+	if dropOutOfScopePorts && stripOutOfScopePorts {
+		warning(warnInvalidArguments, "--drop-out-of-scope-ports and --strip-port-and-keep can't be used at the same time.")
+		os.Exit(2)
+	}
+	if maxTargets < 0 {
+		var err error
+		crash(errInvalidArguments, "Invalid --max-targets selected", err)
+	}
+	sampleRate := 1.0
+	if sampleRateStr != "" {
+		var err error
+		sampleRate, err = parseSampleRate(sampleRateStr)
+		if err != nil {
+			crash(errInvalidArguments, "Invalid --sample selected", err)
+		}
+		if resumeStatePath != "" {
+			crash(errInvalidArguments, "--sample can't be used together with --resume, since a random sample can't be resumed", err)
+		}
+	}
+	if cnameDepth < 1 {
+		var err error
+		crash(errInvalidArguments, "Invalid --cname-depth selected", err)
+	}
+	if dnsTimeout <= 0 {
+		var err error
+		crash(errInvalidArguments, "Invalid --dns-timeout selected", err)
+	}
+	if markRelated {
+		includeUnsure = true
+	}
+	if enrichUnsure {
+		includeUnsure = true
+		if resumeStatePath != "" {
+			var err error
+			crash(errInvalidArguments, "--enrich can't be used together with --resume, since the unsure assets are only printed at the end of the run", err)
+		}
+	}
+
+	// "--inscope -" reads the scopes from stdin, so the targets must come from a file
+	scopesFromStdin := scopesListFilepath == stdinPath || outofScopesListFilepath == stdinPath
+	if scopesFromStdin {
+		if scopesListFilepath == outofScopesListFilepath {
+			warning(warnInvalidArguments, "The in-scope and out-of-scope files can't both be read from stdin.")
+			os.Exit(2)
+		}
+		if (targetsListFilepath == "" || targetsListFilepath == stdinPath) && serveAddress == "" && exportScopeFormat == "" && exportExclusionsFormat == "" && !dryRun {
+			warning(warnInvalidArguments, "The scopes are being read from stdin, so the targets must be specified with the -f or --file argument.")
+			os.Exit(2)
+		}
+	}
+
+	// Validate the targets input
+	var streamedLinesChan <-chan string
+	// The local file that the targets are read from, if any. Its targets can be counted for the progress bar.
+	countableTargetsFile := ""
+
+	// If we're getting input from stdin...
+	//https://stackoverflow.com/a/26567513/11490425
+	stat, _ := os.Stdin.Stat()
+	if serveAddress != "" || exportScopeFormat != "" || exportExclusionsFormat != "" {
+		// With --serve, the targets come from the HTTP requests instead. The exports don't need any targets.
+	} else if (stat.Mode()&os.ModeCharDevice) == 0 && !isVSCodeDebug() && !scopesFromStdin {
+
+		// Stream stdin into the same async pipeline we use for files so
+		// workers can start processing immediately and we avoid buffering
+		// the whole input in memory. Nothing is ever written to disk.
+		linesChan, err := streamFileLines(stdinPath)
+		if err != nil {
+			crash(errReadInput, "Could not decompress the data received from stdin", err)
+		}
+		streamedLinesChan = linesChan
+
+	} else if targetsListFilepath != "" {
+		// We didn't get anything from stdin, so we will use the file specified by the user
+		// Immediately open the file specified by the user and stream lines so workers
+		// can begin processing while the reader continues to read the file.
+
+		// Use streaming reader instead of loading whole file into memory
+		linesChan, err := streamFileLines(targetsListFilepath)
+		if err != nil {
+			crash(errReadInput, "Could not read the file "+targetsListFilepath, err)
+		}
+		streamedLinesChan = linesChan
+		if !isRemotePath(targetsListFilepath) {
+			countableTargetsFile = targetsListFilepath
+		}
+
+	} else if !dryRun {
+		// We didn't get anything from stdin, and the user didn't specify a file
+		// Print a usage warning, then quit gracefully
+
+		fmt.Fprintln(os.Stderr, colorError+"[-] No input file specified. Please specify a file with the -f or --file argument."+colorReset)
+		fmt.Fprintln(os.Stderr, colorError+"[-] Run with \"--help\" for more information."+colorReset)
+
+		// Exit code 2 = command line syntax error
+		os.Exit(2)
+	}
+
+	var inscopeLines []string
+	var noscopeLines []string
+	// The details of the scope lines that have them, like the attributes of the entries of a scope bundle
+	lineDetails := map[string]ruleDetails{}
+	// The names of the firebounty programs whose scopes were loaded, for --firebounty-explicit-level
+	firebountySources := map[string]bool{}
+	// Set when only out-of-scope entries were given. Every target that isn't out of scope is in scope.
+	outOfScopeOnly := false
+
+	// Validate the inscope input
+	if len(scopePluginCommands) > 0 {
+		// The scopes are provided by external plugins, usually one per platform
+		pluginsSucceeded := false
+		for _, result := range runScopePlugins(ctx, scopePluginCommands, company, filepath.Join(filepath.Dir(firebountyJSONPath), "plugin-cache"), cacheTTL("plugins", 0)) {
+			if result.err != nil && !result.cached {
+				warning(warnScopePlugin, "Error running the scope plugin \""+result.command+"\": "+result.err.Error()+". Its scopes have been skipped.")
+				continue
+			} else if result.err != nil {
+				warning(warnScopePlugin, "Error running the scope plugin \""+result.command+"\": "+result.err.Error()+". Using the scopes it returned on its last successful run instead.")
+			}
+			pluginsSucceeded = true
+			inscopeLines = append(inscopeLines, result.inscopeLines...)
+			noscopeLines = append(noscopeLines, result.noscopeLines...)
+			recordScopeSource(lineDetails, result.command, result.inscopeLines, result.noscopeLines)
 			if !chainMode {
-				fmt.Println("[INFO]: Downloading scopes file and saving in \"" + firebountyJSONPath + "\"")
+				fmt.Println("[+] The scope plugin \"" + result.command + "\" returned " + strconv.Itoa(len(result.inscopeLines)) + " in-scope and " + strconv.Itoa(len(result.noscopeLines)) + " out-of-scope entries")
 			}
-			updateFireBountyJSON(&databaseIsUpdating, tmpFile, false)
-		} else {
-			crash("Unable to get information about the database file at \""+firebountyJSONPath+"\". Probably a permissions error with the directory the database is saved at. Try using the database argument like '--database /custom/path/to/store/the/firebounty.json'", err)
 		}
+		if !pluginsSucceeded {
+			crash(errNoScopes, "None of the scope plugins returned any scopes", errors.New("every scope plugin failed"))
+		}
+
+	} else if scopeBundleFilepath != "" {
+		// The scopes come from a YAML scope bundle
+		inscopeLines, noscopeLines, lineDetails = loadScopeBundle(scopeBundleFilepath)
+		recordScopeSource(lineDetails, scopeBundleFilepath, inscopeLines, noscopeLines)
 
-		// Get the company names from the JSON file
-		companyNames, err := extractCompanyNames(firebountyJSONPath)
+	} else if pastedScopeFilepath != "" {
+		// The user pasted the scope tables of a program into a file
+		var err error
+		inscopeLines, noscopeLines, err = readPastedScopeFile(pastedScopeFilepath)
 		if err != nil {
-			crash("Couldn't parse company names from firebounty JSON.", err)
-		}
-
-		var matchingCompanyList []firebountySearchMatch
-		var userChoice string
-		var userPickedInvalidChoice bool = true
-		var userChoiceAsInt int
-
-		//for every company...
-		for i, fcompany := range companyNames {
-			fcompany := strings.ToLower(fcompany)
-			fcompany = strings.TrimSpace(fcompany)
-			if fcompany == company {
-				matchingCompanyList = []firebountySearchMatch{{i, fcompany}}
-				break
-			} else if strings.Contains(fcompany, company) {
-				matchingCompanyList = append(matchingCompanyList, firebountySearchMatch{i, fcompany})
-			}
-		}
-		if len(matchingCompanyList) == 0 && !chainMode {
-			fmt.Println(colorRed + "[-] 0 (lowercase'd) company names contained the string \"" + company + "\"" + colorReset)
-			fmt.Println(colorRed + "[-] If the company's bug bounty program is private, consider using rescope to download the scopes: https://github.com/root4loot/rescope")
-			fmt.Println(colorRed + "[-] If the company's bug bounty program is public, consider either of these options:")
-			fmt.Println(colorRed + "\t - Doing a manual search at https://firebounty.com")
-			fmt.Println(colorRed + "\t - Loading the scopes manually into '.inscope' and '.noscope' files.")
-			fmt.Println(colorRed + "\t - Loading the scopes manually into custom files, specified with the --inscope-file and --outofscope-file arguments.")
-			// Exit code 2 = command line syntax error
-			os.Exit(2)
-		} else if len(matchingCompanyList) > 1 {
+			crash(errReadInput, "Error reading the file "+pastedScopeFilepath, err)
+		}
+		recordScopeSource(lineDetails, pastedScopeFilepath, inscopeLines, noscopeLines)
+		if !chainMode {
+			fmt.Println("[+] Found " + strconv.Itoa(len(inscopeLines)) + " in-scope and " + strconv.Itoa(len(noscopeLines)) + " out-of-scope entries in " + pastedScopeFilepath)
+		}
+
+	} else if company == "" && scopesListFilepath == "" && len(commandLineScopes) > 0 {
+		// The only scopes are the ones given with --scope. They're added below, together with the --exclude entries.
+		if !chainMode {
+			fmt.Println("[+] Using " + strconv.Itoa(len(commandLineScopes)) + " in-scope entries from the command line")
+		}
+		if outofScopesListFilepath != "" {
+			var err error
+			noscopeLines, err = readFileLines(outofScopesListFilepath)
+			if err != nil {
+				crash(errReadInput, "Error reading the file "+outofScopesListFilepath, err)
+			}
+			recordScopeSource(lineDetails, outofScopesListFilepath, noscopeLines)
+		}
+
+	} else if company == "" && scopesListFilepath == "" && outofScopesListFilepath != "" {
+		// "Everything except this list" engagements only have out-of-scope entries
+		var err error
+		noscopeLines, err = readFileLines(outofScopesListFilepath)
+		if err != nil {
+			crash(errReadInput, "Error reading the file "+outofScopesListFilepath, err)
+		}
+		recordScopeSource(lineDetails, outofScopesListFilepath, noscopeLines)
+		outOfScopeOnly = true
+
+	} else if company == "" && scopesListFilepath == "" {
+		// If the user didn't specify a company name, and also didn't specify a filepath for the inscope and outofscope files, we'll search for .inscope and .noscope files.
 
-			if chainMode {
-				warning("Unable to match the company to a single company. Please use a more exact company string.")
-				os.Exit(2)
+		if !chainMode {
+			fmt.Println("No company or scopes file specified. Looking for \"" + projectMarkerFilename + "\", \".inscope\" and \".noscope\" files...")
+		}
+
+		// Whichever of the .hacker-scoper and .inscope files is closest to the current directory is used
+		markerPath, _ := searchForFileBackwards(projectMarkerFilename)
+		inscopePath, _ := searchForFileBackwards(".inscope")
+		closestPath := closestFile(markerPath, inscopePath)
+		if closestPath == "" {
+			// A lone .noscope file means that everything else is in scope
+			noscopePath, err := searchForFileBackwards(".noscope")
+			if err != nil {
+				crash(errNoScopes, "Couldn't locate a "+projectMarkerFilename+", .inscope or .noscope file.", errors.New("unable to locate a \""+projectMarkerFilename+"\", \".inscope\" or \".noscope\" file"))
 			}
+			if !chainMode {
+				fmt.Println(".noscope found without an .inscope file. Using " + noscopePath)
+			}
+			noscopeLines, err = readFileLines(noscopePath)
+			if err != nil {
+				crash(errReadInput, ".noscope file found at "+noscopePath+" but couldn't be read.", err)
+			}
+			recordScopeSource(lineDetails, noscopePath, noscopeLines)
+			outOfScopeOnly = true
 
-			//apparently "while" doesn't exist in Go. It has been replaced by "for"
-			for userPickedInvalidChoice {
-				//For every matchingCompanyList item...
-				for i := range matchingCompanyList {
-					//Print it
-					fmt.Println("    " + strconv.Itoa(i) + " - " + matchingCompanyList[i].companyName)
+		} else if closestPath == markerPath {
+			if !chainMode {
+				fmt.Println(projectMarkerFilename + " found. Using " + markerPath)
+			}
+			marker, err := readProjectMarker(markerPath)
+			if err != nil {
+				crash(errReadInput, "Error reading "+markerPath, err)
+			}
+
+			if marker.ScopeBundle != "" {
+				inscopeLines, noscopeLines, lineDetails = loadScopeBundle(marker.ScopeBundle)
+				recordScopeSource(lineDetails, marker.ScopeBundle, inscopeLines, noscopeLines)
+			} else {
+				updateFirebountyJSONIfNeeded(ctx, &databaseIsUpdating, &tmpFile)
+				companyIndex, err := findCompanyBySlug(firebountyJSONPath, marker.Slug)
+				if err != nil {
+					crash(errNoScopes, "Unable to find the program pinned by "+markerPath, err)
 				}
+				programName, programInscopeLines, programNoscopeLines, err := getCompanyScopes(ctx, firebountyJSONPath, &companyIndex)
+				if err != nil {
+					crash(errNoScopes, "Error parsing the program "+marker.Slug, err)
+				}
+				inscopeLines, noscopeLines = programInscopeLines, programNoscopeLines
+				recordScopeSource(lineDetails, programName, inscopeLines, noscopeLines)
+				firebountySources[programName] = true
+			}
 
-				//Show user the option to combine all of the previous companies as if they were a single company
-				fmt.Println("    " + strconv.Itoa(len(matchingCompanyList)) + " - COMBINE ALL")
+		} else {
+			if !chainMode {
+				fmt.Println(".inscope found. Using " + inscopePath)
+			}
 
-				//Get userchoice
-				fmt.Print("\n[+] Multiple companies matched \"" + company + "\". Please choose one: ")
-				_, err = fmt.Scanln(&userChoice)
+			//look for .noscope file
+			noscopePath, err := searchForFileBackwards(".noscope")
+			if err != nil {
+				noscopePath = ""
+			} else if !chainMode {
+				fmt.Println(".noscope found. Using " + noscopePath)
+			}
+
+			// Load the inscope file into memory
+			inscopeLines, err = readFileLines(inscopePath)
+			if err != nil {
+				crash(errReadInput, ".inscope file found at "+inscopePath+" but couldn't be read.", err)
+			}
+			recordScopeSource(lineDetails, inscopePath, inscopeLines)
+
+			// Load the noscope file into memory
+			if noscopePath != "" {
+				noscopeLines, err = readFileLines(noscopePath)
 				if err != nil {
-					crash("An error occurred while reading user input.", err)
+					crash(errReadInput, ".noscope file found at "+noscopePath+" but couldn't be read.", err)
 				}
+				recordScopeSource(lineDetails, noscopePath, noscopeLines)
+			}
+		}
+
+	} else if company != "" {
+		// If the user inputted a company name, we'll lookup said company in the firebounty db
+		updateFirebountyJSONIfNeeded(ctx, &databaseIsUpdating, &tmpFile)
+
+		var companyIndexes []int
+		if len(selectedSlugs) > 0 {
+			companyIndexes = selectCompaniesBySlug(company, selectedSlugs)
+		} else if useLastSelection {
+			companyIndexes = selectLastCompanies(company)
+		} else {
+			companyIndexes = selectCompanies(company)
+		}
+
+		//for every company that the user selected...
+		for _, companyIndex := range companyIndexes {
+			programName, tempinscopeLines, tempnoscopeLines, err := getCompanyScopes(ctx, firebountyJSONPath, &companyIndex)
+			if err != nil {
+				crash(errNoScopes, "Error parsing the company "+company, err)
+			}
+			recordScopeSource(lineDetails, programName, tempinscopeLines, tempnoscopeLines)
+			firebountySources[programName] = true
+
+			inscopeLines = append(inscopeLines, tempinscopeLines...)
+			noscopeLines = append(noscopeLines, tempnoscopeLines...)
+		}
 
-				//Convert userchoice str -> int
-				userChoiceAsInt, err = strconv.Atoi(userChoice)
-				//If the user picked something invalid...
+	} else {
+		//user chose to use their own scope list
+		var err error
+		// Remote scope lists are validated when they're downloaded
+		if !isRemotePath(scopesListFilepath) && scopesListFilepath != stdinPath {
+			_, err = os.Stat(scopesListFilepath)
+		}
+		if err == nil {
+			// path/to/whatever exists
+
+			// Load the user-supplied inscopes file into memory
+			inscopeLines, err = readFileLines(scopesListFilepath)
+			if err != nil {
+				crash(errReadInput, "Error reading the file "+scopesListFilepath, err)
+			}
+			recordScopeSource(lineDetails, scopesListFilepath, inscopeLines)
+
+			// The outofScopesListFilepath might, or might not have been specified.
+			// If a custom outofScopesListFilepath was specified...
+			if outofScopesListFilepath != "" {
+				// Load the user-supplied noscopes file into memory
+				noscopeLines, err = readFileLines(outofScopesListFilepath)
 				if err != nil {
-					warning("Invalid option selected!")
-				} else {
-					userPickedInvalidChoice = false
+					crash(errReadInput, "Error reading the file "+outofScopesListFilepath, err)
 				}
+				recordScopeSource(lineDetails, outofScopesListFilepath, noscopeLines)
+			}
+
+		} else if errors.Is(err, os.ErrNotExist) {
+			//path/to/whatever does not exist
+			err = nil
+			crash(errReadInput, scopesListFilepath+" does not exist.", err)
+
+		} else {
+			// Schrodinger: file may or may not exist. See err for details.
+			panic(err)
+		}
+	}
+
+	// Scopes given with --scope and --exclude are added to the ones from any other source
+	inscopeLines = append(inscopeLines, commandLineScopes...)
+	noscopeLines = append(noscopeLines, commandLineExclusions...)
+	recordScopeSource(lineDetails, "--scope", commandLineScopes)
+	recordScopeSource(lineDetails, "--exclude", commandLineExclusions)
+	// The sources are only shown next to the rules when the scopes were combined from several of them
+	showRuleSources := len(scopeSources(lineDetails)) > 1
+
+	if reclassifyMobile {
+		var mobileLines, noscopeMobileLines []string
+		inscopeLines, mobileLines = reclassifyMobileScopes(inscopeLines)
+		// Out-of-scope apps can't exclude any web targets, only app targets
+		noscopeLines, noscopeMobileLines = reclassifyMobileScopes(noscopeLines)
+		if len(mobileLines) > 0 && !chainMode {
+			fmt.Println("\n[+] Mobile scopes (reclassified from web_application): ")
+			for _, line := range mobileLines {
+				fmt.Println("\t[+] android_application: " + line)
+			}
+		}
+		// With --mobile-scopes, the reclassified package names are matched against the app targets
+		if mobileScopesEnabled {
+			for _, line := range mobileLines {
+				inscopeLines = append(inscopeLines, androidPrefix+line)
+			}
+			for _, line := range noscopeMobileLines {
+				noscopeLines = append(noscopeLines, androidPrefix+line)
+			}
+		}
+	}
+
+	StopBenchmark()
+	StartBenchmark("2")
+
+	// --scope entries turn an out-of-scope-only run into a normal one
+	outOfScopeOnly = outOfScopeOnly && len(inscopeLines) == 0
+
+	if dryRun {
+		if printDryRun(os.Stdout, inscopeLines, noscopeLines, privateTLDsAreEnabled, streamedLinesChan) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Parse all inscopeLines lines
+	inscopeScopes := []interface{}{}
+	var err error
+	if !outOfScopeOnly {
+		inscopeScopes, err = parseAllLines(inscopeLines, true, privateTLDsAreEnabled, lineDetails)
+		if err != nil {
+			crash(errNoScopes, "Unable to parse any inscope entries as scopes", err)
+		}
+	}
+
+	// Parse all noscopeLines lines
+	noscopeScopes, err := parseAllLines(noscopeLines, true, privateTLDsAreEnabled, lineDetails)
+	if err != nil && outOfScopeOnly {
+		crash(errNoScopes, "Unable to parse any out-of-scope entries as scopes. Without them, every target would be in scope", err)
+	} else if err != nil && len(noscopeLines) > 0 {
+		warning(warnUnparsableLine, "Unable to parse any noscope entries as scopes")
+	}
+	explicitLevelOverrides = newExplicitLevelOverrides(inscopeScopes, noscopeScopes, firebountySources, firebountyExplicitLevel, fileExplicitLevel)
+	if outOfScopeOnly && !chainMode {
+		fmt.Println("[+] No in-scope entries were given. Every target that isn't out of scope is considered in scope.")
+	}
+
+	if exportScopeFormat != "" {
+		exportName := company
+		if exportName == "" {
+			exportName = "hacker-scoper"
+		}
+		err = exportScope(os.Stdout, exportScopeFormat, exportName, inscopeScopes, noscopeScopes, inscopeExplicitLevel, noscopeExplicitLevel)
+		if err != nil {
+			crash(errWriteOutput, "Unable to export the scopes", err)
+		}
+		return
+	}
+	if exportExclusionsFormat != "" {
+		err = exportExclusions(os.Stdout, exportExclusionsFormat, noscopeScopes, noscopeExplicitLevel)
+		if err != nil {
+			crash(errWriteOutput, "Unable to export the exclusions", err)
+		}
+		return
+	}
+
+	// --mark-related tells the near misses apart from the rest of the unsure targets
+	var related relatedDomains
+	if markRelated {
+		related = newRelatedDomains(inscopeScopes)
+	}
+
+	if serveAddress != "" {
+		if serveToken == "" && !isLoopbackAddress(serveAddress) {
+			warning(warnServerWithoutToken, "The check server is reachable from other machines, and --serve-token wasn't set. Anyone who can reach it can read your scopes.")
+		}
+		if !chainMode {
+			fmt.Println("[+] Listening on http://" + serveAddress + "/check?target=...")
+		}
+		if pprofPort != 0 {
+			pprofAddress, err := startPprofServer(ctx, pprofPort)
+			if err != nil {
+				crash(errProfiling, "Unable to start the profiling endpoints", err)
+			}
+			if !chainMode {
+				fmt.Println("[+] Profiling endpoints at http://" + pprofAddress + "/debug/pprof/")
+			}
+		}
+		err = serveChecks(ctx, serveAddress, &checkServer{
+			inscopeScopes:        inscopeScopes,
+			noscopeScopes:        noscopeScopes,
+			inscopeExplicitLevel: inscopeExplicitLevel,
+			noscopeExplicitLevel: noscopeExplicitLevel,
+			related:              related,
+			token:                serveToken,
+		})
+		crash(errNetwork, "The check server stopped", err)
+	}
+
+	// Load the checkpoint of a previous interrupted run, if any
+	var resume *resumeState
+	if resumeStatePath != "" {
+		resume, err = loadResumeState(resumeStatePath)
+		if err != nil {
+			crash(errReadInput, "Unable to read the resume state file \""+resumeStatePath+"\"", err)
+		}
+		if resume.LinesProcessed > 0 {
+			if resume.TargetsFile != targetsListFilepath || resume.OutputFile != inscopeOutputFile {
+				warning(warnFile, "The resume state file \""+resumeStatePath+"\" was created with different --file or --output arguments. Resuming anyway.")
+			}
+			if !chainMode {
+				fmt.Println("[INFO]: Resuming from target number " + strconv.Itoa(resume.LinesProcessed+1))
+			}
+		}
+		resume.TargetsFile = targetsListFilepath
+		resume.OutputFile = inscopeOutputFile
+	}
+
+	// The previous output is read before the output file is opened, since they can be the same file
+	var previousAssets map[string]bool
+	if diffAgainstFilepath != "" {
+		previousAssets, err = readPreviousAssets(diffAgainstFilepath)
+		if err != nil {
+			crash(errReadInput, "Unable to read the previous output "+diffAgainstFilepath, err)
+		}
+	}
+
+	// Variables for writing the output to a file if necessary.
+	var writer *asyncWriter
+	var f *os.File
+
+	// Whether the output file already had content before this run. Used to avoid repeating the CSV header.
+	outputFileHasContent := false
+
+	if inscopeOutputFile != "" {
+		openFlags := os.O_APPEND | os.O_WRONLY | os.O_CREATE
+		if resume != nil && resume.LinesProcessed > 0 {
+			// Discard anything that was written to the output file after the last checkpoint, since those targets will be processed again.
+			err = os.Truncate(inscopeOutputFile, resume.OutputSize)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				crash(errWriteOutput, "Unable to restore the output file to its last checkpoint", err)
 			}
+			outputFileHasContent = resume.OutputSize > 0
+		} else if appendOutputFile {
+			if info, err := os.Stat(inscopeOutputFile); err == nil {
+				outputFileHasContent = info.Size() > 0
+			}
+		} else {
+			openFlags |= os.O_TRUNC
+		}
+
+		f, err = os.OpenFile(inscopeOutputFile, openFlags, 0600) // #nosec G304 -- inscopeOutputFile is a CLI argument specified by the user running the program. It is not unsafe to allow them to open any file in their own system.
+		if err != nil {
+			crash(errWriteOutput, "Unable to read output file", err)
+		}
+
+		// The output file is written from its own goroutine, so that slow disks don't stall the workers
+		writer = newAsyncWriter(f, flushEvery, flushInterval)
+	}
+
+	skipLines := 0
+	if resume != nil {
+		skipLines = resume.LinesProcessed
+	}
+	if inputIsHTTPRequests {
+		streamedLinesChan = extractRawHTTPRequests(streamedLinesChan)
+	}
+	if extractMode {
+		streamedLinesChan = extractTargets(streamedLinesChan)
+	}
+	if asnDatasetPath != "" {
+		dataset, err := loadASNDataset(asnDatasetPath)
+		if err != nil {
+			crash(errReadInput, "Unable to read the ASN dataset "+asnDatasetPath, err)
+		}
+		// The prefixes of the ASNs are CIDR targets
+		allowCIDRTargets = true
+		streamedLinesChan = expandASNTargets(streamedLinesChan, dataset)
+	}
+	if maxTargets > 0 || sampleRate < 1 {
+		streamedLinesChan = sampleLines(streamedLinesChan, maxTargets, sampleRate)
+	}
+	numberedLinesChan := numberLines(streamedLinesChan, skipLines)
+	// The ordered results are limited to a window of targets, see orderResults
+	var orderedSlots chan struct{}
+	if resume != nil || orderedOutput {
+		orderedSlots = make(chan struct{}, orderedWindowSize)
+		numberedLinesChan = throttleLines(numberedLinesChan, orderedSlots)
+	}
+
+	// The progress bar is only shown to humans. The total is only known when every line of the targets file is a target.
+	var progress *progressbar.ProgressBar
+	if !chainMode && !noProgress && stderrIsTerminal() {
+		progress = newTargetsProgressBar(-1)
+		if countableTargetsFile != "" && !inputIsHTTPRequests && !extractMode && asnDatasetPath == "" && sampleRate == 1 {
+			// Counting the targets takes a while for big files, so the workers don't wait for it
+			go func() {
+				total, err := countTargetLines(countableTargetsFile)
+				if err != nil {
+					return
+				}
+				if maxTargets > 0 && int64(maxTargets) < total {
+					total = int64(maxTargets)
+				}
+				progress.ChangeMax64(total - int64(skipLines))
+			}()
+		}
+	}
 
-			//tip
-			fmt.Println("[-] If you want to remove one of these options, feel free to modify your firebounty database: " + firebountyJSONPath + "\n")
+	// The DNS answers are shared by --follow-cnames and --enrich
+	var resolver *dnsClient
+	if followCNAMEs || enrichUnsure {
+		resolver, err = newDNSClient(resolversFilepath, time.Duration(dnsTimeout)*time.Second)
+		if err != nil {
+			crash(errReadInput, "Unable to read the resolvers file", err)
+		}
+	}
+	var cnameClient *dnsClient
+	if followCNAMEs {
+		cnameClient = resolver
+	}
+	var wildcards *wildcardDetector
+	if resolver != nil {
+		wildcards = newWildcardDetector(resolver)
+	}
 
-			//If the user chose to "COMBINE ALL"...
-			if userChoiceAsInt == len(matchingCompanyList) {
-				//for every company that matched the company query...
-				for i := range matchingCompanyList {
+	if showRuleTimings {
+		ruleTimer = &ruleTimings{}
+	}
 
-					//Load the matchingCompanyList 2D slice, and convert the first member from string to integer, and save the company index
-					companyIndex := matchingCompanyList[i].companyIndex
-					tempinscopeLines, tempnoscopeLines, err := getCompanyScopes(firebountyJSONPath, &companyIndex)
-					if err != nil {
-						crash("Error parsing the company "+company, err)
+	// --unique and --cache-verdicts share the --max-memory budget
+	memory := newMemoryBudget(maxMemory)
+	matchingOptions := scopeMatchingOptions{
+		inscopeExplicitLevel:   inscopeExplicitLevel,
+		noscopeExplicitLevel:   noscopeExplicitLevel,
+		includeUnsure:          includeUnsure,
+		allowCIDRTargets:       allowCIDRTargets,
+		caseInsensitiveRegexes: caseInsensitiveRegexes,
+		unanchoredWildcards:    unanchoredWildcards,
+	}
+	var verdicts *verdictCache
+	if verdictCachePath != "" {
+		scopeHash := hashScopes(inscopeScopes, noscopeScopes, matchingOptions)
+		verdicts, err = loadVerdictCache(verdictCachePath, scopeHash, inscopeScopes)
+		if err != nil {
+			crash(errReadInput, "Unable to read the verdict cache", err)
+		}
+		verdicts.limitMemory(memory)
+	}
+	var seenAssets *seenSet
+	if uniqueAssets {
+		seenAssets = newSeenSet(memory)
+	}
+
+	var leadEnricher *enricher
+	if enrichUnsure {
+		leadEnricher, err = newEnricher(enrichChecks, &inscopeScopes, &inscopeExplicitLevel, resolver, cnameDepth)
+		if err != nil {
+			crash(errInvalidArguments, "Invalid --enrich-checks selected", err)
+		}
+	}
+
+	// Parse all targetsInput lines concurrently.
+	numWorkers := runtime.NumCPU()
+	outputChan := make(chan targetResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for numberedLine := range numberedLinesChan {
+				// Annotated recon lists and inventories have more columns than the target, which are printed back with the in-scope results
+				columns, err := layout.split(numberedLine.line)
+				line := columns.target
+				var parsedTarget interface{}
+				if err == nil {
+					parsedTarget, err = parseTargetLine(line, allowCIDRTargets)
+				} else {
+					line = numberedLine.line
+				}
+				res := targetResult{
+					index:        numberedLine.index,
+					parsedTarget: parsedTarget,
+					err:          err,
+					targetStr:    line,
+					inputLine:    numberedLine.line,
+					columns:      columns,
+				}
+				if err == nil {
+					var isInsideScope, isUnsure, isUnmatched bool
+					var matchedScope interface{}
+					isCached := false
+					if verdicts != nil {
+						isCached, isInsideScope, isUnsure, isUnmatched, matchedScope = verdicts.get(line)
+					}
+					if !isCached {
+						isInsideScope, isUnsure, isUnmatched, matchedScope = parseScopes(&inscopeScopes, &noscopeScopes, &parsedTarget, &inscopeExplicitLevel, &noscopeExplicitLevel, includeUnsure)
+						if verdicts != nil {
+							verdicts.set(line, isInsideScope, isUnsure, isUnmatched, matchedScope)
+						}
+					}
+					res.isInsideScope = isInsideScope
+					res.isUnsure = isUnsure
+					res.isUnmatched = isUnmatched
+					res.matchedScope = matchedScope
+
+					// Hostnames that aren't in scope might still be CNAMEs of in-scope hostnames
+					if cnameClient != nil && (!isInsideScope || isUnsure) {
+						chain, cnameScope := parseScopesThroughCNAMEs(ctx, cnameClient, cnameDepth, &inscopeScopes, &noscopeScopes, &parsedTarget, &inscopeExplicitLevel, &noscopeExplicitLevel)
+						if cnameScope != nil {
+							res.isInsideScope, res.isUnsure, res.matchedScope, res.cnameChain = true, false, cnameScope, chain
+						}
 					}
 
-					inscopeLines = append(inscopeLines, tempinscopeLines...)
-					noscopeLines = append(noscopeLines, tempnoscopeLines...)
+					if res.isUnsure && related != nil {
+						if relatedScope := related.find(parsedTarget); relatedScope != nil {
+							res.isRelated, res.matchedScope = true, relatedScope
+						}
+					}
 
+					// The ports of the targets must be allowed by the ports of their matching rule, if it has any
+					if res.isInsideScope && !res.isUnsure && (dropOutOfScopePorts || stripOutOfScopePorts) {
+						if port := getTargetComponents(parsedTarget).Port; !isPortAllowed(scopeDetails[res.matchedScope].Ports, port) {
+							if stripOutOfScopePorts {
+								res.targetStr = stripTargetPort(line)
+							} else {
+								res.isInsideScope = false
+							}
+						}
+					}
+
+					// The --filter expression has the last word on the targets that would be printed
+					if res.isInsideScope && filterExpression != nil && !filterExpression.evaluate(newFilterEnvironment(&res)) {
+						res.isInsideScope = false
+					}
+
+					// The enrichment checks are slow, so they're run by the workers in parallel
+					if res.isInsideScope && res.isUnsure && leadEnricher != nil {
+						res.signals = leadEnricher.enrich(ctx, parsedTarget)
+					}
+
+					if res.isInsideScope && !res.isUnsure && wildcards != nil {
+						if targetURL, isURL := parsedTarget.(*url.URL); isURL {
+							res.wildcardDNS = wildcards.isWildcardResolved(ctx, removePortFromHost(targetURL))
+						}
+					}
 				}
+				outputChan <- res
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(outputChan)
+	}()
+
+	// Consume results as they arrive
+	var target string
+
+	// --tee prints the results even when --quiet is set
+	printResults := (!quietMode || teeOutput) && !anyMode
+
+	// The annotations of --format github point at the lines of the targets file. The targets read from stdin don't have a file.
+	var annotatedFile string
+	var targetLines map[string]int
+	if outputGitHubFormat && countableTargetsFile != "" {
+		annotatedFile = countableTargetsFile
+		targetLines, err = targetLineNumbers(countableTargetsFile)
+		if err != nil {
+			crash(errReadInput, "Could not read the file "+countableTargetsFile, err)
+		}
+	}
+
+	// Resumed and appended runs already have a header in the output file
+	if withHeader && !outputFileHasContent {
+		header := newOutputHeader(flag.CommandLine, lineDetails, hashScopes(inscopeScopes, noscopeScopes, matchingOptions))
+		writer.WriteString(header.format(outputJSONFormat)) // #nosec G104 -- Write errors are reported when the writer is flushed.
+	}
+
+	if outputCSVFormat {
+		csvHeader := "type,asset"
+		if showRule {
+			csvHeader += ",rule,description,sources"
+		}
+		if enrichUnsure {
+			csvHeader += ",signals"
+		}
+		if wildcards != nil {
+			csvHeader += ",wildcard_dns"
+		}
+		if printResults {
+			fmt.Println(csvHeader)
+		}
+		// Resumed and appended runs already have a header in the output file
+		if inscopeOutputFile != "" && !outputFileHasContent {
+			writer.WriteString(csvHeader + "\n") // #nosec G104 -- Write errors are reported when the writer is flushed.
+		}
+	}
+
+	// printResult prints an in-scope or unsure result, and saves it to the output file
+	printResult := func(res targetResult) {
+		if outputDomainsOnly {
+			switch assertedTarget := res.parsedTarget.(type) {
+			case *url.URL:
+				target = removePortFromHost(assertedTarget)
+			// IP addresses are printed in their canonical form, like "2001:db8::1"
+			case *URLWithIPAddressHost:
+				target = assertedTarget.IPhost.String()
+			case *net.IP:
+				target = assertedTarget.String()
+			case *EmailAddress:
+				target = assertedTarget.domain
+			default:
+				target = res.targetStr
+			}
+		} else {
+			target = res.targetStr
+		}
+
+		// --diff-against only prints the assets that weren't found by the previous run
+		if previousAssets[target] {
+			return
+		}
+
+		if seenAssets != nil {
+			wasSpilled := seenAssets.spilled()
+			isNew, err := seenAssets.add(target)
+			if err != nil {
+				seenAssets.close() // #nosec G104 -- The program is exiting.
+				crash(errWriteOutput, "Unable to write the assets seen by --unique to a temporary file", err)
+			}
+			if seenAssets.spilled() && !wasSpilled && !chainMode {
+				if progress != nil {
+					progress.Clear() // #nosec G104 -- The progress bar is redrawn with the next result anyway.
+				}
+				fmt.Fprintln(os.Stderr, "[INFO]: The assets seen by --unique reached the --max-memory limit, so they were moved to a temporary file.")
+			}
+			if !isNew {
+				return
+			}
+		}
+
+		// Email addresses get their own reason code, so that they can be told apart from the rest of the assets
+		resultType, label := "inscope", "IN-SCOPE"
+		if res.isRelated {
+			resultType, label = "related", "RELATED"
+		} else if res.isUnsure {
+			resultType, label = "unsure", "UNSURE"
+		}
+		if _, isEmail := res.parsedTarget.(*EmailAddress); isEmail {
+			resultType, label = resultType+"-email", label+" EMAIL"
+		}
+
+		// Unsure targets didn't match any rule. Related targets have the rule that they share their domain with.
+		var rule string
+		var details ruleDetails
+		if res.matchedScope != nil {
+			rule = scopeToString(res.matchedScope)
+			details = scopeDetails[res.matchedScope]
+		}
+
+		var line string
+		if outputJSONFormat {
+			components := getTargetComponents(res.parsedTarget)
+			// --strip-port-and-keep removed the port from the printed target
+			if stripOutOfScopePorts && !isPortAllowed(details.Ports, components.Port) {
+				components.Port = ""
+			}
+			line = formatJSONResult(jsonResult{
+				Type:        resultType,
+				Asset:       target,
+				Rule:        rule,
+				Description: details.Description,
+				Ports:       details.Ports,
+				Tags:        details.Tags,
+				MaxSeverity: details.MaxSeverity,
+				Sources:     details.Sources,
+				Signals:     res.signals,
+				CNAMEChain:  res.cnameChain,
+				WildcardDNS: res.wildcardDNS,
+				Parsed:      &components,
+				Database:    databaseSnapshotDigest,
+				Columns:     res.columns.others,
+			})
+		} else if outputCSVFormat {
+			fields := []string{resultType, target}
+			if showRule {
+				fields = append(fields, rule, details.Description, strings.Join(details.Sources, ";"))
+			}
+			if enrichUnsure {
+				fields = append(fields, strings.Join(res.signals, ";"))
+			}
+			if wildcards != nil {
+				fields = append(fields, strconv.FormatBool(res.wildcardDNS))
+			}
+			line = formatCSVLine(fields...)
+		} else {
+			line = res.columns.before + target + res.columns.after
+			if showRule && rule != "" {
+				var sources []string
+				if showRuleSources {
+					sources = details.Sources
+				}
+				line += " " + formatRule(rule, details.Description, sources)
+			}
+			if len(res.cnameChain) > 0 {
+				line += " [CNAME: " + strings.Join(res.cnameChain, " -> ") + "]"
+			}
+			if len(res.signals) > 0 {
+				line += " [signals: " + strings.Join(res.signals, ", ") + "]"
+			}
+			if res.wildcardDNS {
+				line += " [wildcard DNS]"
+			}
+		}
+
+		if printResults {
+			if progress != nil {
+				progress.Clear() // #nosec G104 -- The progress bar is redrawn with the next result anyway.
+			}
+			if outputGitHubFormat {
+				// Only the targets that might not be in scope are annotated
+				if res.isUnsure {
+					fmt.Println(targetAnnotation(res, annotatedFile, targetLines))
+				}
+			} else if chainMode || outputCSVFormat {
+				fmt.Println(line)
+			} else if res.isUnsure {
+				infoWarning(label+": ", line)
+			} else if linkInscopeHosts && strings.HasPrefix(line, target) {
+				// Only the host is linked, not the rule or the rest of the decorations
+				infoGood(label+": ", hyperlink(target, hostURL(res.parsedTarget))+strings.TrimPrefix(line, target))
 			} else {
-				// The user chose a specific company
-				// Use userChoiceAsInt as an index for the matchingCompanyList 2D slice, and save the company index
-				companyCounter := matchingCompanyList[userChoiceAsInt].companyIndex
-				inscopeLines, noscopeLines, err = getCompanyScopes(firebountyJSONPath, &companyCounter)
+				infoGood(label+": ", line)
+			}
+		}
+		if inscopeOutputFile != "" {
+			writer.WriteString(line + "\n") // #nosec G104 -- Write errors are reported when the writer is flushed.
+		}
+	}
+
+	// With --enrich, the unsure results are held back until the end of the run, so that they can be ranked
+	var leads []targetResult
+
+	// Read by the interrupt handler, from another goroutine
+	var processedTargets, inscopeTargets atomic.Int64
+	stats := runStats{started: time.Now()}
+
+	handleResult := func(res targetResult) {
+		stats.add(res)
+		processedTargets.Add(1)
+		if res.isInsideScope && res.err == nil {
+			inscopeTargets.Add(1)
+		}
+		if progress != nil {
+			progress.Add(1) // #nosec G104 -- Drawing the progress bar can't fail in a way that matters.
+		}
+		if res.err != nil {
+			if progress != nil {
+				progress.Clear() // #nosec G104 -- The progress bar is redrawn with the next result anyway.
+			}
+			repeatedWarning(warnUnparsableLine, "Unable to parse the string '"+res.targetStr+"' as a target.")
+			if outputGitHubFormat && printResults {
+				fmt.Println(targetAnnotation(res, annotatedFile, targetLines))
+			}
+			return
+		}
+		// --any stops at the first in-scope target. Unsure targets don't count.
+		if anyMode {
+			if res.isInsideScope && !res.isUnsure {
+				os.Exit(0)
+			}
+			return
+		}
+		if !res.isInsideScope {
+			if outputGitHubFormat && printResults {
+				fmt.Println(targetAnnotation(res, annotatedFile, targetLines))
+			}
+			return
+		}
+		if res.isUnsure && leadEnricher != nil {
+			leads = append(leads, res)
+			return
+		}
+		printResult(res)
+	}
+
+	statsSummary := func() string {
+		summary := stats.String()
+		if report := stats.rulesReport(statsTopRules); report != "" {
+			summary += "\n" + report
+		}
+		return summary
+	}
+
+	// On Ctrl-C, write the buffered results to the output file, and summarize what was done before the interruption
+	interrupted := &interruptedRun{
+		progress:         progress,
+		writer:           writer,
+		seenAssets:       seenAssets,
+		showStats:        showStats,
+		summaryRequests:  make(chan chan string),
+		processedTargets: &processedTargets,
+		inscopeTargets:   &inscopeTargets,
+	}
+	cleanup := func() {
+		interrupted.cleanup(os.Stderr)
+	}
+	interruptCleanup.Store(&cleanup)
+
+	// saveCheckpoint flushes the output file and records how many targets have been completely processed.
+	saveCheckpoint := func(linesProcessed int) {
+		resume.LinesProcessed = linesProcessed
+		if inscopeOutputFile != "" {
+			err := writer.Flush()
+			if err != nil {
+				crash(errWriteOutput, "Unable to write to output file", err)
+			}
+			info, err := f.Stat()
+			if err != nil {
+				crash(errWriteOutput, "Unable to get information about the output file", err)
+			}
+			resume.OutputSize = info.Size()
+		}
+		err := saveResumeState(resumeStatePath, resume)
+		if err != nil {
+			warning(warnFile, "Unable to save the resume state file \""+resumeStatePath+"\": "+err.Error())
+		}
+	}
+
+	if resume != nil {
+		// When resuming, results are handled in the same order as the input, so that everything before the checkpoint is guaranteed to be in the output file.
+		nextIndex := resume.LinesProcessed
+		lastCheckpoint := time.Now()
+		receiveResults(orderResults(outputChan, resume.LinesProcessed, orderedSlots), interrupted.summaryRequests, statsSummary, func(res targetResult) {
+			handleResult(res)
+			nextIndex = res.index + 1
+			if time.Since(lastCheckpoint) > resumeCheckpointInterval {
+				saveCheckpoint(nextIndex)
+				lastCheckpoint = time.Now()
+			}
+		})
+		saveCheckpoint(nextIndex)
+
+		// The run finished successfully, so there's nothing left to resume.
+		err = os.Remove(resumeStatePath)
+		if err != nil {
+			warning(warnFile, "Unable to delete the resume state file \""+resumeStatePath+"\". Please delete it before starting a new run.")
+		}
+	} else if orderedOutput {
+		receiveResults(orderResults(outputChan, 0, orderedSlots), interrupted.summaryRequests, statsSummary, handleResult)
+	} else {
+		receiveResults(outputChan, interrupted.summaryRequests, statsSummary, handleResult)
+	}
+
+	if progress != nil {
+		progress.Finish() // #nosec G104 -- The progress bar is removed when it finishes.
+	}
+	printWarningSummary()
+	if showStats {
+		fmt.Fprintln(os.Stderr, statsSummary())
+	}
+
+	// --any didn't find any in-scope target
+	if anyMode {
+		os.Exit(1)
+	}
+
+	if verdicts != nil {
+		err = verdicts.save(verdictCachePath)
+		if err != nil {
+			warning(warnFile, "Unable to save the verdict cache \""+verdictCachePath+"\": "+err.Error())
+		} else if !chainMode {
+			fmt.Println(verdicts.summary())
+		}
+	}
+
+	// The unsure results with the most signals are the best leads
+	rankLeads(leads)
+	for _, lead := range leads {
+		printResult(lead)
+	}
+	if seenAssets != nil {
+		err = seenAssets.close()
+		if err != nil {
+			warning(warnFile, "Unable to delete the temporary file of --unique: "+err.Error())
+		}
+	}
+
+	if inscopeOutputFile != "" {
+		// Wait for the writer goroutine to write everything to disk
+		err = writer.Close()
+		if err != nil {
+			crash(errWriteOutput, "Unable to write to output file", err)
+		}
+
+		//Close the output file
+		f.Close() // #nosec G104 -- There's no harm done if we're unable to close the output file, since we're already at the end of the program.
+	}
+
+	if ruleTimer != nil {
+		fmt.Fprintln(os.Stderr, ruleTimer.report())
+	}
+
+	StopBenchmark()
+
+	if failOnOutOfScope && stats.outOfScope+stats.invalid > 0 {
+		os.Exit(1)
+	}
+}
+
+// handleInterrupts exits when the user presses Ctrl+C, or when the program receives SIGTERM.
+// If the database was being updated, the temp file of the download is deleted, so the previous state of the database is kept.
+// Like in shells, the exit code is 128 plus the number of the signal: 130 for SIGINT, and 143 for SIGTERM.
+func handleInterrupts(databaseIsUpdating *bool, tmpFile **os.File) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for receivedSignal := range c {
+			if *databaseIsUpdating && *tmpFile != nil {
+				fmt.Fprintln(os.Stderr)
+				path := (*tmpFile).Name()
+				(*tmpFile).Close() // #nosec G104 -- There is no harm in potentially double-closing a temp file.
+				err := os.Remove(path)
 				if err != nil {
-					crash("Error parsing the company "+company, err)
+					warning(warnDatabase, "Error deleting temp file at \""+path+"\". Please ensure the file is deleted.")
 				}
+				infoGood("INFO: ", "Database update has been cancelled. Previous state restored.")
+			}
+			if cleanup := interruptCleanup.Load(); cleanup != nil {
+				(*cleanup)()
+			}
+			unlockDatabase()
+			if receivedSignal == syscall.SIGTERM {
+				os.Exit(143)
 			}
+			os.Exit(130)
+		}
+	}()
+}
 
+// setupFirebountyJSONPath turns the folder given with --database (or the default folder for the OS) into the full path of the firebounty database.
+// The folder is created if it doesn't exist.
+func setupFirebountyJSONPath() {
+	if databaseSnapshotPath != "" {
+		setupDatabaseSnapshot(firebountyJSONPath)
+		return
+	}
+	if firebountyJSONPath == "" {
+		firebountyJSONPath = getFirebountyJSONPath()
+		if firebountyJSONPath == "" {
+			warning(warnDatabase, "This OS isn't officially supported. The firebounty JSON will be downloaded in the current working directory. To override this behavior, use the \"--database\" flag.")
 		} else {
-			//Only 1 company matched the query
-			if !chainMode {
-				fmt.Println("[+] Search for \"" + company + "\" matched the company " + colorGreen + matchingCompanyList[0].companyName + colorReset + "!")
-			}
-			inscopeLines, noscopeLines, err = getCompanyScopes(firebountyJSONPath, &matchingCompanyList[0].companyIndex)
+			// The default folder is created on the first run
+			err := os.MkdirAll(firebountyJSONPath, 0700)
 			if err != nil {
-				crash("Error parsing the company "+company, err)
+				crash(errDatabase, "Unable to create the folder \""+firebountyJSONPath+"\". Use the \"--database\" flag to store the database somewhere else.", err)
 			}
 		}
-
 	} else {
-		//user chose to use their own scope list
-		if _, err := os.Stat(scopesListFilepath); err == nil {
-			// path/to/whatever exists
-
-			// Load the user-supplied inscopes file into memory
-			inscopeLines, err = readFileLines(scopesListFilepath)
+		//If the folder exists...
+		_, err := os.Stat(firebountyJSONPath)
+		if errors.Is(err, os.ErrNotExist) {
+			//Create the folder
+			err := os.Mkdir(firebountyJSONPath, 0700)
 			if err != nil {
-				crash("Error reading the file "+scopesListFilepath, err)
+				crash(errDatabase, "Unable to create the folder \""+firebountyJSONPath+"\"", err)
 			}
+		} else if err != nil {
+			// Schrodinger: file may or may not exist. See err for details.
+			crash(errDatabase, "Could not verify existence of the folder \""+firebountyJSONPath+"\"!", err)
+		}
+	}
 
-			// The outofScopesListFilepath might, or might not have been specified.
-			// If a custom outofScopesListFilepath was specified...
-			if outofScopesListFilepath != "" {
-				// Load the user-supplied noscopes file into memory
-				noscopeLines, err = readFileLines(outofScopesListFilepath)
-				if err != nil {
-					crash("Error reading the file "+outofScopesListFilepath, err)
-				}
-			}
+	firebountyJSONPath = firebountyJSONPath + firebountyJSONFilename
+}
 
-		} else if errors.Is(err, os.ErrNotExist) {
-			//path/to/whatever does not exist
-			err = nil
-			crash(scopesListFilepath+" does not exist.", err)
+// updateFirebountyJSONIfNeeded downloads the firebounty database if it doesn't exist, or if it's older than 24hs.
+// The update is protected by a lock file, so that several hacker-scoper processes running at the same time don't download it at the same time.
+// A --database-snapshot is never updated.
+func updateFirebountyJSONIfNeeded(ctx context.Context, databaseIsUpdating *bool, tmpFile **os.File) {
+	if databaseSnapshotPath != "" {
+		return
+	}
 
-		} else {
-			// Schrodinger: file may or may not exist. See err for details.
-			panic(err)
+	// Whether it was updated or not, the database that is going to be used has to be verified
+	if databaseVerificationEnabled() {
+		defer func() {
+			err := verifyCachedDatabase(firebountyJSONPath)
+			if err != nil {
+				crash(errDatabase, "The firebounty database at \""+firebountyJSONPath+"\" failed verification", err)
+			}
+		}()
+	}
+
+	// --offline uses the local database, however old it is
+	if offlineMode {
+		if _, err := os.Stat(firebountyJSONPath); err != nil {
+			crash(errDatabase, "--offline requires a local firebounty database, but there isn't one at \""+firebountyJSONPath+"\"", err)
 		}
+		return
 	}
 
-	StopBenchmark()
-	StartBenchmark("2")
+	if !firebountyJSONNeedsUpdate(false) {
+		return
+	}
 
-	// Parse all inscopeLines lines
-	inscopeScopes, err := parseAllLines(inscopeLines, true, privateTLDsAreEnabled)
+	err := lockDatabase(ctx, firebountyJSONPath)
 	if err != nil {
-		crash("Unable to parse any inscope entries as scopes", err)
+		crash(errDatabase, "Unable to lock the database for updating", err)
 	}
+	defer unlockDatabase()
 
-	// Parse all noscopeLines lines
-	noscopeScopes, err := parseAllLines(noscopeLines, true, privateTLDsAreEnabled)
-	if err != nil {
-		warning("Unable to parse any noscope entries as scopes")
+	// Another hacker-scoper process may have updated the database while we were waiting for the lock
+	if !firebountyJSONNeedsUpdate(true) {
+		return
 	}
 
-	// Variables for writing the output to a file if necessary.
-	var writer *bufio.Writer
-	var f *os.File
+	_, err = os.Stat(firebountyJSONPath)
+	updateFireBountyJSON(ctx, databaseIsUpdating, tmpFile, err == nil)
+}
 
-	if inscopeOutputFile != "" {
-		f, err := os.OpenFile(inscopeOutputFile, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600) // #nosec G304 -- inscopeOutputFile is a CLI argument specified by the user running the program. It is not unsafe to allow them to open any file in their own system.
-		if err != nil {
-			crash("Unable to read output file", err)
+// firebountyJSONNeedsUpdate reports whether the firebounty database doesn't exist, or is older than its cache TTL (24hs by default).
+// Unless quiet is true, the reason for the update is printed.
+func firebountyJSONNeedsUpdate(quiet bool) bool {
+	// If the db exists...
+	if firebountyJSONFileStats, err := os.Stat(firebountyJSONPath); err == nil {
+		ttl := cacheTTL("firebounty", defaultDatabaseTTL)
+		if !isCacheFresh(firebountyJSONFileStats.ModTime(), ttl) {
+			if !chainMode && !quiet && ttl == defaultDatabaseTTL {
+				fmt.Println("[INFO]: +24hs have passed since the last update to the local firebounty database. Updating...")
+			} else if !chainMode && !quiet {
+				fmt.Println("[INFO]: The local firebounty database is older than its --cache-ttl of " + ttl.String() + ". Updating...")
+			}
+			return true
 		}
-
-		// Use bufio.Writer for efficient disk writes
-		writer = bufio.NewWriter(f)
+		return false
+	} else if errors.Is(err, os.ErrNotExist) {
+		// The database does not exist.
+		// We'll create it.
+		if !chainMode && !quiet {
+			fmt.Println("[INFO]: Downloading scopes file and saving in \"" + firebountyJSONPath + "\"")
+		}
+		return true
+	} else {
+		crash(errDatabase, "Unable to get information about the database file at \""+firebountyJSONPath+"\". Probably a permissions error with the directory the database is saved at. Try using the database argument like '--database /custom/path/to/store/the/firebounty.json'", err)
 	}
+	return false
+}
 
-	// Parse all targetsInput lines concurrently.
-	numWorkers := runtime.NumCPU()
-	outputChan := make(chan targetResult)
+// selectCompanies searches the firebounty database for companies whose (lowercase'd) name contains the company string, and returns the indexes of the companies chosen by the user.
+// If several companies match, the user is asked to choose one of them, or to combine all of them. Exits the program if no companies match.
+// The choice is remembered for --last.
+func selectCompanies(company string) []int {
+	company = strings.ToLower(strings.TrimSpace(company))
 
-	var wg sync.WaitGroup
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for line := range streamedLinesChan {
-				parsedTarget, err := parseLine(line, false, privateTLDsAreEnabled)
-				res := targetResult{
-					parsedTarget: parsedTarget,
-					err:          err,
-					targetStr:    line,
-				}
-				if err == nil {
-					isInsideScope, isUnsure := parseScopes(&inscopeScopes, &noscopeScopes, &parsedTarget, &inscopeExplicitLevel, &noscopeExplicitLevel, includeUnsure)
-					res.isInsideScope = isInsideScope
-					res.isUnsure = isUnsure
-				}
-				outputChan <- res
-			}
-		}()
+	// Get the company names from the JSON file
+	companyNames, err := extractCompanyNames(firebountyJSONPath)
+	if err != nil {
+		crash(errDatabase, "Couldn't parse company names from firebounty JSON.", err)
 	}
 
-	go func() {
-		wg.Wait()
-		close(outputChan)
-	}()
-
-	// Consume results as they arrive
-	var target string
+	var matchingCompanyList []firebountySearchMatch
+	var userChoice string
+	var userPickedInvalidChoice bool = true
+	var userChoiceAsInt int
+
+	//for every company...
+	for i, fcompany := range companyNames {
+		fcompany := strings.ToLower(fcompany)
+		fcompany = strings.TrimSpace(fcompany)
+		if fcompany == company {
+			matchingCompanyList = []firebountySearchMatch{{i, fcompany}}
+			break
+		} else if strings.Contains(fcompany, company) {
+			matchingCompanyList = append(matchingCompanyList, firebountySearchMatch{i, fcompany})
+		}
+	}
+	if len(matchingCompanyList) == 0 {
+		fmt.Fprintln(os.Stderr, colorError+"[-] 0 (lowercase'd) company names contained the string \""+company+"\""+colorReset)
+		fmt.Fprintln(os.Stderr, colorError+"[-] If the company's bug bounty program is private, consider using rescope to download the scopes: https://github.com/root4loot/rescope")
+		fmt.Fprintln(os.Stderr, colorError+"[-] If the company's bug bounty program is public, consider either of these options:")
+		fmt.Fprintln(os.Stderr, colorError+"\t - Doing a manual search at https://firebounty.com")
+		fmt.Fprintln(os.Stderr, colorError+"\t - Loading the scopes manually into '.inscope' and '.noscope' files.")
+		fmt.Fprintln(os.Stderr, colorError+"\t - Loading the scopes manually into custom files, specified with the --inscope-file and --outofscope-file arguments."+colorReset)
+		// Exit code 2 = command line syntax error
+		os.Exit(2)
+	}
 
-	if outputCSVFormat {
-		if !quietMode {
-			fmt.Println("type,asset")
+	// Every choice is a single company, unless --merge-duplicates groups the entries of the same program
+	var choices [][]firebountySearchMatch
+	var identities []programIdentity
+	if mergeDuplicatePrograms || (chainMode && len(matchingCompanyList) > 1) {
+		identities, err = extractProgramIdentities(firebountyJSONPath)
+		if err != nil {
+			crash(errDatabase, "Couldn't parse the program slugs and URLs from firebounty JSON.", err)
 		}
-		if inscopeOutputFile != "" {
-			_, err = writer.WriteString("type,asset\n")
-			if err != nil {
-				crash("Unable to write to output file", err)
-			}
+	}
+	if mergeDuplicatePrograms {
+		choices = duplicateProgramGroups(matchingCompanyList, companyNames, identities)
+	} else {
+		for _, match := range matchingCompanyList {
+			choices = append(choices, []firebountySearchMatch{match})
 		}
 	}
 
-	for res := range outputChan {
-		if res.err != nil {
-			warning("Unable to parse the string '" + res.targetStr + "' as a target.")
-			continue
+	if len(choices) == 1 {
+		//Only 1 company matched the query
+		if !chainMode {
+			fmt.Println("[+] Search for \"" + company + "\" matched the company " + colorGood + groupName(choices[0]) + colorReset + "!")
 		}
-		if res.isInsideScope {
-			if outputDomainsOnly {
-				switch assertedTarget := res.parsedTarget.(type) {
-				case *url.URL:
-					target = removePortFromHost(assertedTarget)
-				case *URLWithIPAddressHost:
-					target = assertedTarget.IPhost.String()
-				default:
-					target = res.targetStr
-				}
-			} else {
-				target = res.targetStr
-			}
-			if !quietMode {
-				if outputCSVFormat {
-					if res.isUnsure {
-						if includeUnsure {
-							fmt.Println("unsure," + target)
-						}
-					} else {
-						fmt.Println("inscope," + target)
-					}
-				} else {
-					if res.isUnsure {
-						if includeUnsure {
-							if !chainMode {
-								infoWarning("UNSURE: ", target)
-							} else {
-								fmt.Println(target)
-							}
-						}
-					} else {
-						if !chainMode {
-							infoGood("IN-SCOPE: ", target)
-						} else {
-							fmt.Println(target)
-						}
-					}
-				}
-			}
-			if inscopeOutputFile != "" {
+		return rememberCompanySelection(company, choices[0])
+	}
 
-				if outputCSVFormat {
-					if res.isUnsure {
-						if includeUnsure {
-							_, err = writer.WriteString("unsure," + target + "\n")
-							if err != nil {
-								crash("Unable to write to output file", err)
-							}
-						}
-					} else {
-						_, err = writer.WriteString("inscope," + target + "\n")
-						if err != nil {
-							crash("Unable to write to output file", err)
-						}
-					}
-				} else {
-					_, err = writer.WriteString(target + "\n")
-					if err != nil {
-						crash("Unable to write to output file", err)
-					}
-				}
+	// Chain mode can't ask, so the wrapper that runs hacker-scoper gets to choose, and runs it again with --select-slug
+	if chainMode {
+		exitWithCompanyCandidates(newCompanyCandidates(company, choices, companyNames, identities))
+	}
 
-			}
+	//apparently "while" doesn't exist in Go. It has been replaced by "for"
+	for userPickedInvalidChoice {
+		//For every choice...
+		for i := range choices {
+			//Print it
+			fmt.Println("    " + strconv.Itoa(i) + " - " + groupName(choices[i]))
 		}
-	}
 
-	if inscopeOutputFile != "" {
-		// Flush any buffered data to disk
-		writer.Flush() // #nosec G104 -- No need to handle any writer errors, since we already crash upon encountering any writer error.
+		//Show user the option to combine all of the previous companies as if they were a single company
+		fmt.Println("    " + strconv.Itoa(len(choices)) + " - COMBINE ALL")
 
-		//Close the output file
-		f.Close() // #nosec G104 -- There's no harm done if we're unable to close the output file, since we're already at the end of the program.
+		//Get userchoice
+		fmt.Print("\n[+] Multiple companies matched \"" + company + "\". Please choose one: ")
+		_, err = fmt.Scanln(&userChoice)
+		if err != nil {
+			crash(errReadInput, "An error occurred while reading user input.", err)
+		}
+
+		//Convert userchoice str -> int
+		userChoiceAsInt, err = strconv.Atoi(userChoice)
+		//If the user picked something invalid...
+		if err != nil || userChoiceAsInt < 0 || userChoiceAsInt > len(choices) {
+			warning(warnInvalidArguments, "Invalid option selected!")
+		} else {
+			userPickedInvalidChoice = false
+		}
 	}
 
-	StopBenchmark()
+	//tip
+	fmt.Println("[-] If you want to remove one of these options, feel free to modify your firebounty database: " + firebountyJSONPath + "\n")
 
+	//If the user chose to "COMBINE ALL"...
+	if userChoiceAsInt == len(choices) {
+		return rememberCompanySelection(company, slices.Concat(choices...))
+	}
+
+	// The user chose a specific company
+	return rememberCompanySelection(company, choices[userChoiceAsInt])
 }
 
-func updateFireBountyJSON(databaseIsUpdating *bool, tmpFile *os.File, dbFileExists bool) {
+// updateFireBountyJSON downloads the firebounty database into a temp file, and renames it into the database once it's complete.
+// The download is abandoned if the context is cancelled, and the previous database is kept.
+// If there is a previous database, the download is conditional: servers that support it can answer that the database hasn't changed, instead of sending it again.
+func updateFireBountyJSON(ctx context.Context, databaseIsUpdating *bool, tmpFile **os.File, dbFileExists bool) {
 	*databaseIsUpdating = true
+	defer func() { *databaseIsUpdating = false }()
 	//get the big JSON from the API
-	req, err := http.NewRequest("GET", firebountyAPIURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, firebountyAPIURL, nil)
+	if err != nil {
+		crash(errDatabase, "Could not download scopes from firebounty at: "+firebountyAPIURL, err)
+	}
+	if dbFileExists {
+		setConditionalHeaders(req, firebountyJSONPath)
+	}
+	jason, err := httpClient.Do(req)
 	if err != nil {
-		crash("Could not download scopes from firebounty at: "+firebountyAPIURL, err)
+		warning(warnDatabase, "Could not download scopes from firebounty at \""+firebountyAPIURL+"\": "+err.Error())
+		return
+	}
+	defer jason.Body.Close()
+
+	if jason.StatusCode == http.StatusNotModified {
+		err = markDatabaseFresh(firebountyJSONPath)
+		if err != nil {
+			warning(warnDatabase, "Unable to update the modification time of the database at \""+firebountyJSONPath+"\": "+err.Error())
+		}
+		if !chainMode {
+			fmt.Println("[INFO]: The firebounty database hasn't changed since the last update.")
+		}
+		return
 	}
-	jason, _ := http.DefaultClient.Do(req)
 
-	//f, _ := os.OpenFile(firebountyJSONPath, os.O_CREATE|os.O_WRONLY, 0600)
-	tmpFile, err = os.CreateTemp("", "hacker-scoper_tmp-db")
+	// The temp file is created in the same folder as the database, so that it can be atomically renamed into the database.
+	// Renaming a file across different filesystems isn't possible.
+	*tmpFile, err = os.CreateTemp(filepath.Dir(firebountyJSONPath), "hacker-scoper_tmp-db")
 	if err != nil {
-		crash("Error creating temporary file.", err)
+		crash(errDatabase, "Error creating temporary file.", err)
 	}
 
 	bar := progressbar.DefaultBytes(
 		jason.ContentLength,
 		"downloading",
 	)
-	_, err = io.Copy(io.MultiWriter(tmpFile, bar), jason.Body)
+	_, err = io.Copy(io.MultiWriter(*tmpFile, bar), jason.Body)
 	if err != nil {
-		warning("Error writing to the temporary file at \"" + tmpFile.Name() + "\". Database update cancelled.")
+		warning(warnDatabase, "Error writing to the temporary file at \""+(*tmpFile).Name()+"\". Database update cancelled.")
+		(*tmpFile).Close()           // #nosec G104 -- The temp file is deleted right after.
+		os.Remove((*tmpFile).Name()) // #nosec G104 -- Best effort cleanup.
 		return
 	}
-	jason.Body.Close() // #nosec G104 -- There is no situation in which closing the body of the request will cause an error.
-	tmpFile.Close()    // #nosec G104 -- There is no situation in which closing the temp file will cause an error.
+	(*tmpFile).Close() // #nosec G104 -- There is no situation in which closing the temp file will cause an error.
 	if jason.StatusCode == 200 {
-		err = os.Rename(tmpFile.Name(), firebountyJSONPath)
+		// A database that fails verification is never used, and the previous one is kept
+		var checksum, signature []byte
+		if databaseVerificationEnabled() {
+			checksum, signature, err = fetchDatabaseVerification(ctx)
+			if err == nil {
+				err = verifyDatabaseFile((*tmpFile).Name(), checksum, signature)
+			}
+			if err != nil {
+				os.Remove((*tmpFile).Name()) // #nosec G104 -- Best effort cleanup.
+				crash(errDatabase, "The downloaded firebounty database failed verification. The previous database has been kept.", err)
+			}
+		}
+
+		// Comparing the programs of both databases is only worth it if someone is going to read the result
+		var previousDigests map[string]programDigest
+		if dbFileExists && !chainMode {
+			previousDigests, err = programDigests(firebountyJSONPath)
+			if err != nil {
+				previousDigests = nil
+			}
+		}
+
+		err = os.Rename((*tmpFile).Name(), firebountyJSONPath)
 		if err != nil {
-			crash("Error renaming temp file to db path", err)
+			crash(errDatabase, "Error renaming temp file to db path", err)
 		}
-	} else {
-		if !chainMode {
-			warning("There was an error downloading the latest update of the firebounty db from URL \"" + firebountyAPIURL + "\". Got status code \"" + strconv.Itoa(jason.StatusCode) + "\" Server may be down temporarily. Try again later.")
+		err = saveDatabaseETag(firebountyJSONPath, jason.Header.Get("ETag"))
+		if err != nil {
+			warning(warnDatabase, "Unable to save the ETag of the database: "+err.Error())
+		}
+		err = saveDatabaseVerification(firebountyJSONPath, checksum, signature)
+		if err != nil {
+			crash(errDatabase, "Unable to save the checksum and signature of the database", err)
+		}
+
+		if previousDigests != nil {
+			currentDigests, err := programDigests(firebountyJSONPath)
+			if err == nil {
+				fmt.Println("[INFO]: The firebounty database was updated: " + diffProgramDigests(previousDigests, currentDigests).String() + ".")
+			}
 		}
-		err = os.Remove(tmpFile.Name())
+	} else {
+		warning(warnDatabase, "There was an error downloading the latest update of the firebounty db from URL \""+firebountyAPIURL+"\". Got status code \""+strconv.Itoa(jason.StatusCode)+"\" Server may be down temporarily. Try again later.")
+		err = os.Remove((*tmpFile).Name())
 		if err != nil {
-			warning("Error deleting temp file at \"" + tmpFile.Name() + "\". Please ensure the file is deleted.")
+			warning(warnDatabase, "Error deleting temp file at \""+(*tmpFile).Name()+"\". Please ensure the file is deleted.")
 		}
 	}
 }
 
-func parseScopes(inscopeScopes *[]interface{}, noscopeScopes *[]interface{}, target *interface{}, inscopeExplicitLevel *int, noscopeExplicitLevel *int, includeUnsure bool) (isInsideScope bool, isUnsure bool) {
+// parseScopes returns whether the target is in scope, and the in-scope entry that matched it. isUnmatched is set when the target matched neither the in-scope nor the out-of-scope entries,
+// even without --include-unsure, where such targets aren't in scope, so that they can still be told apart from the out-of-scope ones.
+func parseScopes(inscopeScopes *[]interface{}, noscopeScopes *[]interface{}, target *interface{}, inscopeExplicitLevel *int, noscopeExplicitLevel *int, includeUnsure bool) (isInsideScope bool, isUnsure bool, isUnmatched bool, matchedScope interface{}) {
 	// This function is where we'll implement the --include-unsure logic
 
-	targetIsOutOfScope := isOutOfScope(noscopeScopes, target, noscopeExplicitLevel)
+	// The same prepared target is compared with the out-of-scope and the in-scope entries
+	prepared := prepareTarget(*target)
+	targetIsOutOfScope := isOutOfScope(noscopeScopes, prepared, noscopeExplicitLevel)
+	// Without any in-scope entries, everything that isn't out of scope is in scope
+	if !targetIsOutOfScope && len(*inscopeScopes) == 0 {
+		return true, false, false, nil
+	}
 	if !targetIsOutOfScope {
 		// We only need to check if the target is inscope if it isn't out of scope.
-		targetIsInscope := isInscope(inscopeScopes, target, inscopeExplicitLevel)
+		matchedScope = findMatchingScope(inscopeScopes, prepared, inscopeExplicitLevel)
+		targetIsInscope := matchedScope != nil
 		if targetIsInscope {
-			return true, false
+			return true, false, false, matchedScope
 		} else if includeUnsure && !targetIsInscope {
-			return true, true
+			return true, true, true, nil
 		} else {
-			return false, false
+			return false, false, true, nil
 		}
 	} else {
-		return false, false
+		return false, false, false, nil
 	}
 }
 
-func crash(message string, err error) {
-	fmt.Fprintln(os.Stderr, colorRed+"[ERROR]: "+message+colorReset)
+// parseScopesThroughCNAMEs follows the CNAME chain of a hostname target, and returns the chain up to the first in-scope hostname, together with the scope that matched it.
+// Nothing is returned if the target is out of scope, or if the chain reaches an out-of-scope hostname before an in-scope one.
+func parseScopesThroughCNAMEs(ctx context.Context, client *dnsClient, maxDepth int, inscopeScopes *[]interface{}, noscopeScopes *[]interface{}, target *interface{}, inscopeExplicitLevel *int, noscopeExplicitLevel *int) (chain []string, matchedScope interface{}) {
+	targetURL, isURL := (*target).(*url.URL)
+	if !isURL || isOutOfScope(noscopeScopes, prepareTarget(targetURL), noscopeExplicitLevel) {
+		return nil, nil
+	}
+
+	fullChain := client.cnameChain(ctx, removePortFromHost(targetURL), maxDepth)
+	for i, hostname := range fullChain {
+		hop := prepareTarget(&url.URL{Host: hostname})
+		if isOutOfScope(noscopeScopes, hop, noscopeExplicitLevel) {
+			return nil, nil
+		}
+		matchedScope = findMatchingScope(inscopeScopes, hop, inscopeExplicitLevel)
+		if matchedScope != nil {
+			return fullChain[:i+1], matchedScope
+		}
+	}
+	return nil, nil
+}
+
+// jsonCrash is the value that crash panics with when the diagnostics are JSON, so that the deferred functions (like the release of the database lock) still run.
+// exitOnJSONCrash turns it into the exit code, without printing a stacktrace.
+type jsonCrash struct{}
+
+// exitOnJSONCrash is deferred by main. It exits with the same exit code as an unrecovered panic if crash was called with --log-format json, and lets any other panic through.
+func exitOnJSONCrash() {
+	if r := recover(); r != nil {
+		if _, isJSONCrash := r.(jsonCrash); isJSONCrash {
+			os.Exit(2)
+		}
+		panic(r)
+	}
+}
+
+// crash prints an error with its code, like "HS-E001", and stops the program.
+// With --log-format json, the error is written as a JSON line instead of a stacktrace.
+func crash(code string, message string, err error) {
+	if jsonDiagnostics {
+		entry := diagnostic{Level: "error", Code: code, Message: message}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		printJSONDiagnostic(entry)
+		panic(jsonCrash{})
+	}
+	fmt.Fprintln(os.Stderr, colorError+"[ERROR "+code+"]: "+message+colorReset)
 	fmt.Fprintln(os.Stderr)
-	fmt.Fprintln(os.Stderr, colorRed+"Error stacktrace: "+colorReset)
+	fmt.Fprintln(os.Stderr, colorError+"Error stacktrace: "+colorReset)
 	panic(err)
 }
 
-func warning(message string) {
-	fmt.Fprintln(os.Stderr, colorYellow+"[WARNING]: "+message+colorReset)
+// warning prints a diagnostic to stderr with its code, like "HS-W001", so that it never gets mixed with the results on stdout, not even in chain mode.
+func warning(code string, message string) {
+	if hideWarnings {
+		return
+	}
+	if jsonDiagnostics {
+		printJSONDiagnostic(diagnostic{Level: "warning", Code: code, Message: message})
+		return
+	}
+	fmt.Fprintln(os.Stderr, colorWarning+"[WARNING "+code+"]: "+message+colorReset)
+}
+
+// misconfigWarning prints a warning about a misconfigured bug bounty program, unless they're hidden with --suppress-misconfig-warnings.
+func misconfigWarning(code string, message string) {
+	if hideMisconfigWarnings {
+		return
+	}
+	warning(code, message)
 }
 
 func infoGood(prefix string, message string) {
-	fmt.Println(colorGreen + "[+] " + prefix + colorReset + message)
+	fmt.Println(colorGood + "[+] " + prefix + colorReset + message)
 }
 
 func infoWarning(prefix string, message string) {
-	fmt.Println(colorYellow + "[-] " + prefix + colorReset + message)
+	fmt.Println(colorWarning + "[-] " + prefix + colorReset + message)
 }
 
+// removePortFromHost returns the host of the URL without its port. IPv6 addresses are returned without their brackets.
 func removePortFromHost(myurl *url.URL) string {
+	// Unbracketed IPv6 addresses (like in "https://2001:db8::1/") don't have a port, even if they end with something like ":1"
+	if net.ParseIP(myurl.Host) != nil {
+		return myurl.Host
+	}
+
+	portless := myurl.Host
 	portLength := len(myurl.Port())
 	if portLength != 0 {
 		hostLength := len(myurl.Host)
 		// The last "-1" removes the ":" character from the host.
-		portless := myurl.Host[:hostLength-portLength-1]
-		return portless
-	} else {
-		return myurl.Host
+		portless = myurl.Host[:hostLength-portLength-1]
+	}
+	if strings.HasPrefix(portless, "[") && strings.HasSuffix(portless, "]") {
+		return portless[1 : len(portless)-1]
+	}
+	return portless
+}
+
+// getTargetComponents splits a target returned by parseLine into its scheme, host, port, path and IP.
+func getTargetComponents(parsedTarget interface{}) targetComponents {
+	switch assertedTarget := parsedTarget.(type) {
+	case *url.URL:
+		return targetComponents{Scheme: assertedTarget.Scheme, Host: removePortFromHost(assertedTarget), Port: assertedTarget.Port(), Path: assertedTarget.Path}
+	case *URLWithIPAddressHost:
+		components := targetComponents{Host: assertedTarget.IPhost.String(), IP: assertedTarget.IPhost.String()}
+		parsedURL, err := url.Parse(assertedTarget.rawURL)
+		if err != nil || parsedURL.Host == "" {
+			parsedURL, err = url.Parse("https://" + assertedTarget.rawURL)
+		}
+		if err == nil {
+			components.Scheme = parsedURL.Scheme
+			components.Path = parsedURL.Path
+			// Unbracketed IPv6 addresses don't have a port
+			if net.ParseIP(parsedURL.Host) == nil {
+				components.Port = parsedURL.Port()
+			}
+		}
+		return components
+	case *net.IP:
+		return targetComponents{Host: assertedTarget.String(), IP: assertedTarget.String()}
+	case *net.IPNet:
+		return targetComponents{Host: assertedTarget.String(), IP: assertedTarget.String()}
+	case *EmailAddress:
+		return targetComponents{Scheme: "mailto", Host: assertedTarget.domain}
+	case *MobileApp:
+		return targetComponents{App: assertedTarget.String(), AppVersion: assertedTarget.version}
+	case *Repository:
+		return targetComponents{Host: assertedTarget.host, Repo: assertedTarget.path}
+	case *ContractAddress:
+		return targetComponents{Chain: assertedTarget.chain, Contract: checksumAddress(assertedTarget.address)}
 	}
+	return targetComponents{}
 }
 
-// out-of-scopes are parsed as --explicit-level==2
-func isOutOfScope(noscopeScopes *[]interface{}, target *interface{}, explicitLevel *int) bool {
+// scopeToString converts a scope returned by parseLine back into text, for showing it to the user.
+func scopeToString(scope interface{}) string {
+	switch assertedScope := scope.(type) {
+	case string:
+		return assertedScope
+	case *WildcardScope:
+		// Undo the wildcard->regex conversion done by parseLine
+		return regexToWildcard.Replace(assertedScope.hostPattern())
+	case *regexp.Regexp:
+		return strings.TrimPrefix(assertedScope.String(), "(?i)")
+	case *net.IPNet:
+		return assertedScope.String()
+	case *net.IP:
+		return assertedScope.String()
+	case *NmapIPRange:
+		return assertedScope.Raw
+	case *MobileApp:
+		return assertedScope.String()
+	case *Repository:
+		return assertedScope.String()
+	case *ContractAddress:
+		return assertedScope.String()
+	case *BinaryScope:
+		return assertedScope.String()
+	}
+	return ""
+}
+
+// out-of-scopes are parsed with the --noscope-explicit-level
+func isOutOfScope(noscopeScopes *[]interface{}, target *preparedTarget, explicitLevel *int) bool {
+	// CIDR targets are out of scope if any of their addresses is
+	if network, isCIDR := target.value.(*net.IPNet); isCIDR {
+		return cidrIntersectsAny(network, noscopeScopes, explicitLevel)
+	}
 	//if we got no matches for any outOfScope
 	return isInscope(noscopeScopes, target, explicitLevel)
 }
@@ -846,95 +2688,209 @@ func searchForFileBackwards(filename string) (string, error) {
 		if newPwd == pwd {
 			break
 		}
-		pwd = newPwd
+		pwd = newPwd
+	}
+
+	return "", errors.New("unable to locate a \".scope\" file")
+}
+
+//======================================================================================
+
+// companyIndex is the numeric index of the company in the firebounty database, where 0 is the first company, 1 is the second company, etc
+// Returns an error if no inscopeLines could be detected.
+// Does not return an error if no noscopeLines could be detected.
+func getCompanyScopes(ctx context.Context, firebountyJSONPath string, companyIndex *int) (programName string, inscopeLines []string, noscopeLines []string, err error) {
+
+	prog, err := loadProgramByIndex(firebountyJSONPath, *companyIndex)
+	if err != nil {
+		crash(errDatabase, "Couldn't load full program data", err)
+	}
+
+	//match found!
+	if !chainMode {
+		fmt.Println("[+] Company: " + hyperlink(prog.Name, prog.Url))
+		printProgramDetails(prog)
+	}
+	if verifyScopeLive {
+		verifyLiveScopes(ctx, prog)
+	}
+	if openProgramPages {
+		openProgramPage(prog)
+	}
+	if !chainMode {
+		fmt.Println("\n[+] Analysis started...")
+	}
+
+	inscopeLines = webApplicationScopeLines(prog.Scopes.In_scopes)
+	noscopeLines = webApplicationScopeLines(prog.Scopes.Out_of_scopes)
+	if mobileScopesEnabled {
+		inscopeLines = append(inscopeLines, mobileScopeLines(prog.Scopes.In_scopes)...)
+		noscopeLines = append(noscopeLines, mobileScopeLines(prog.Scopes.Out_of_scopes)...)
+	}
+	if repoScopesEnabled {
+		inscopeLines = append(inscopeLines, repositoryScopeLines(prog.Scopes.In_scopes)...)
+		noscopeLines = append(noscopeLines, repositoryScopeLines(prog.Scopes.Out_of_scopes)...)
+	}
+	if contractScopesEnabled {
+		inscopeLines = append(inscopeLines, contractScopeLines(prog.Scopes.In_scopes)...)
+		noscopeLines = append(noscopeLines, contractScopeLines(prog.Scopes.Out_of_scopes)...)
+	}
+	if len(inscopeLines) == 0 {
+		return "", nil, nil, errors.New("Unable to parse any inscopes scopes from " + prog.Name)
+	}
+
+	return prog.Name, inscopeLines, noscopeLines, nil
+}
+
+// webApplicationScopeLines returns the non-empty "web_application" scopes of a firebounty scope list. The other scope types (like Android applications) can't be matched against targets.
+func webApplicationScopeLines(scopes []Scope) []string {
+	var lines []string
+	for _, scope := range scopes {
+		if scope.Scope_type == "web_application" && scope.Scope != "" {
+			lines = append(lines, scope.Scope)
+		}
 	}
-
-	return "", errors.New("unable to locate a \".scope\" file")
+	return lines
 }
 
-//======================================================================================
+// stringListFlag is a command-line flag that can be specified multiple times, like "--scope a --scope b".
+type stringListFlag []string
 
-// companyIndex is the numeric index of the company in the firebounty database, where 0 is the first company, 1 is the second company, etc
-// Returns an error if no inscopeLines could be detected.
-// Does not return an error if no noscopeLines could be detected.
-func getCompanyScopes(firebountyJSONPath string, companyIndex *int) (inscopeLines []string, noscopeLines []string, err error) {
+func (list *stringListFlag) String() string {
+	return strings.Join(*list, ",")
+}
 
-	prog, err := loadProgramByIndex(firebountyJSONPath, *companyIndex)
-	if err != nil {
-		crash("Couldn't load full program data", err)
+func (list *stringListFlag) Set(value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return errors.New("empty value")
 	}
+	*list = append(*list, value)
+	return nil
+}
 
-	//match found!
-	if !chainMode {
-
-		// Print the details of the matched company in a readable format
-
-		// Get the last date the cached database was updated
-		info, err := os.Stat(firebountyJSONPath)
-		if err != nil {
-			crash("Error getting file information for the database file at "+firebountyJSONFilename, err)
+// expandOutputFilename replaces the {date} and {company} tokens in the name of the output file.
+// Characters that aren't valid in filenames are removed from the company name.
+func expandOutputFilename(filename string, company string, now time.Time) string {
+	if company == "" {
+		company = "custom"
+	}
+	safeCompany := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' {
+			return r
 		}
-		// info.Atime_ns now contains the last access time
-		// (in nanoseconds since the unix epoch)
-		// Convert the date to the format YYYY-MM-DD HH:MM
-		lastUpdated := time.Unix(info.ModTime().Unix(), 0).Format("2006-01-02 15:04:05")
-		fmt.Println("[+] Last updated: " + lastUpdated)
-
-		// Print the details of the matched company in a readable format
-		fmt.Println("[+] Firebounty URL: " + prog.Firebounty_url)
-		fmt.Println("[+] Program URL: " + prog.Url)
+		return '-'
+	}, strings.ToLower(company))
 
-		// Print the in-scope rules
-		fmt.Println("[+] In-scope rules: ")
-		for _, inscope := range prog.Scopes.In_scopes {
-			fmt.Println("\t[+] " + inscope.Scope_type + ": " + inscope.Scope)
-		}
+	filename = strings.ReplaceAll(filename, "{date}", now.Format("2006-01-02"))
+	return strings.ReplaceAll(filename, "{company}", safeCompany)
+}
 
-		// Print the out-of-scope rules
-		fmt.Println("\n[+] Out-of-scope rules: ")
-		for _, noscope := range prog.Scopes.Out_of_scopes {
-			fmt.Println("\t[+] " + noscope.Scope_type + ": " + noscope.Scope)
-		}
+// isRemotePath reports whether the given path is an http(s) URL instead of a local file.
+func isRemotePath(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
 
-		fmt.Println("\n[+] Analysis started...")
+// newHTTPClient returns an HTTP client that honors the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+// The timeout applies to connecting and waiting for the response headers, but not to the download of the body, since the firebounty database can take a while to download.
+func newHTTPClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.DialContext = (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = timeout
+	transport.ResponseHeaderTimeout = timeout
+	if clientTLSConfig != nil {
+		transport.TLSClientConfig = clientTLSConfig.Clone()
+	}
+	return &http.Client{Transport: transport}
+}
 
+// openInput opens the file at the given path for reading.
+// If the path is an http(s) URL, the file is downloaded instead. Any response other than "200 OK" is returned as an error.
+// gzip-compressed files are decompressed on the fly. A path of "-" reads from stdin.
+func openInput(path string) (io.ReadCloser, error) {
+	if path == stdinPath {
+		// Closing stdin isn't our job
+		return maybeDecompress(io.NopCloser(os.Stdin))
+	}
+	if !isRemotePath(path) {
+		f, err := os.Open(path) // #nosec G304 -- Intended functionality.
+		if err != nil {
+			return nil, err
+		}
+		return maybeDecompress(f)
 	}
 
-	//for every InScope Scope in the program
-	for inscopeCounter := 0; inscopeCounter < len(prog.Scopes.In_scopes); inscopeCounter++ {
-		//if the scope type is "web_application" and it's not empty
-		if prog.Scopes.In_scopes[inscopeCounter].Scope_type == "web_application" && prog.Scopes.In_scopes[inscopeCounter].Scope != "" {
+	resp, err := httpClient.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close() // #nosec G104 -- We're already returning an error.
+		return nil, errors.New("got status code " + strconv.Itoa(resp.StatusCode) + " while downloading " + path)
+	}
+	return maybeDecompress(resp.Body)
+}
 
-			rawInScope := prog.Scopes.In_scopes[inscopeCounter].Scope
-			inscopeLines = append(inscopeLines, rawInScope)
+// maybeDecompress transparently decompresses the input if it's gzip-compressed.
+// The compression is detected through the magic bytes at the start of the input, so the file extension doesn't matter.
+func maybeDecompress(input io.ReadCloser) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(input)
 
-		}
+	// Peek fails for inputs shorter than 2 bytes. Those can't be gzip streams anyway.
+	header, err := buffered.Peek(len(gzipMagic))
+	if err != nil || !bytes.Equal(header, gzipMagic) {
+		return &decompressedReader{Reader: buffered, underlying: input}, nil
 	}
 
-	if len(inscopeLines) == 0 {
-		return nil, nil, errors.New("Unable to parse any inscopes scopes from " + prog.Name)
+	gzipReader, err := gzip.NewReader(buffered)
+	if err != nil {
+		input.Close() // #nosec G104 -- We're already returning an error.
+		return nil, err
 	}
+	return &decompressedReader{Reader: gzipReader, underlying: input}, nil
+}
 
-	//for every NoScope Scope in the program
-	for noscopeCounter := 0; noscopeCounter < len(prog.Scopes.Out_of_scopes); noscopeCounter++ {
-		//if the scope type is "web_application" and it's not empty
-		if prog.Scopes.Out_of_scopes[noscopeCounter].Scope_type == "web_application" && prog.Scopes.Out_of_scopes[noscopeCounter].Scope != "" {
+// printProgramDetails prints the details of a firebounty program in a readable format
+func printProgramDetails(prog *Program) {
+	// Get the last date the cached database was updated
+	info, err := os.Stat(firebountyJSONPath)
+	if err != nil {
+		crash(errDatabase, "Error getting file information for the database file at "+firebountyJSONFilename, err)
+	}
+	// Convert the date to the format YYYY-MM-DD HH:MM
+	lastUpdated := time.Unix(info.ModTime().Unix(), 0).Format("2006-01-02 15:04:05")
+	fmt.Println("[+] Last updated: " + lastUpdated)
 
-			rawNoScope := prog.Scopes.Out_of_scopes[noscopeCounter].Scope
-			noscopeLines = append(noscopeLines, rawNoScope)
+	fmt.Println("[+] Firebounty URL: " + hyperlink(prog.Firebounty_url, prog.Firebounty_url))
+	fmt.Println("[+] Program URL: " + hyperlink(prog.Url, prog.Url))
 
-		}
+	// Print the in-scope rules
+	fmt.Println("[+] In-scope rules: ")
+	for _, inscope := range prog.Scopes.In_scopes {
+		fmt.Println("\t[+] " + inscope.Scope_type + ": " + inscope.Scope)
 	}
 
-	return inscopeLines, noscopeLines, nil
+	// Print the out-of-scope rules
+	fmt.Println("\n[+] Out-of-scope rules: ")
+	for _, noscope := range prog.Scopes.Out_of_scopes {
+		fmt.Println("\t[+] " + noscope.Scope_type + ": " + noscope.Scope)
+	}
 }
 
 // This function receives a filepath as a string, and returns a string with the contents of the file
+// The filepath can also be an http(s) URL
 // All lines are trimmed, and empty lines are removed
 // All lines beginning with '#' or '//' are considered comments and are removed
 func readFileLines(filepath string) ([]string, error) {
+	input, err := openInput(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
 	// Reads the whole file into memory
-	data, err := os.ReadFile(filepath) // #nosec G304 -- Intended functionality.
+	data, err := io.ReadAll(input)
 	if err != nil {
 		return nil, err
 	}
@@ -952,9 +2908,10 @@ func readFileLines(filepath string) ([]string, error) {
 // streamFileLines opens the file at the given path and returns a channel
 // that receives trimmed, non-empty, non-comment lines as they are read.
 // The channel is closed when EOF is reached. An error is returned if the
-// file could not be opened.
+// file could not be opened. The filepath can also be an http(s) URL, or
+// "-" for stdin.
 func streamFileLines(filepath string) (<-chan string, error) {
-	f, err := os.Open(filepath) // #nosec G304 -- intended behavior
+	f, err := openInput(filepath)
 	if err != nil {
 		return nil, err
 	}
@@ -964,77 +2921,185 @@ func streamFileLines(filepath string) (<-chan string, error) {
 	go func() {
 		defer f.Close()
 		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), maxTargetLineLength)
 		for scanner.Scan() {
 			line := strings.TrimSpace(scanner.Text())
-			if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "//") {
+			if isTargetLine(line) {
 				out <- line
 			}
 		}
-		// Ignore scanner.Err() here; if there was an error scanning we'll
-		// simply stop streaming and close the channel. The caller should
-		// detect incomplete processing if necessary.
+		// The targets that were already read are still processed
+		if err := scanner.Err(); err != nil {
+			source := "\"" + filepath + "\""
+			if filepath == stdinPath {
+				source = "stdin"
+			}
+			warning(warnFile, "Stopped reading the targets from "+source+": "+err.Error())
+		}
 		close(out)
 	}()
 
 	return out, nil
 }
 
+// parseSampleRate parses a --sample argument, which can either be a percentage ("1%") or a fraction ("0.01").
+func parseSampleRate(rawRate string) (float64, error) {
+	rawRate = strings.TrimSpace(rawRate)
+	divisor := 1.0
+	if strings.HasSuffix(rawRate, "%") {
+		rawRate = strings.TrimSuffix(rawRate, "%")
+		divisor = 100
+	}
+
+	rate, err := strconv.ParseFloat(rawRate, 64)
+	if err != nil {
+		return 0, err
+	}
+	rate = rate / divisor
+	if rate <= 0 || rate > 1 {
+		return 0, errors.New("the sample rate must be greater than 0% and less than or equal to 100%")
+	}
+	return rate, nil
+}
+
+// parseAge parses an amount of time such as "30d", "2w" or "12h".
+// On top of the units supported by time.ParseDuration, "d" (days) and "w" (weeks) are also accepted.
+func parseAge(rawAge string) (time.Duration, error) {
+	rawAge = strings.TrimSpace(rawAge)
+	multiplier := time.Duration(0)
+	if strings.HasSuffix(rawAge, "d") {
+		multiplier = 24 * time.Hour
+	} else if strings.HasSuffix(rawAge, "w") {
+		multiplier = 7 * 24 * time.Hour
+	}
+	if multiplier == 0 {
+		return time.ParseDuration(rawAge)
+	}
+
+	amount, err := strconv.ParseFloat(rawAge[:len(rawAge)-1], 64)
+	if err != nil {
+		return 0, err
+	}
+	if amount < 0 {
+		return 0, errors.New("negative amount of time")
+	}
+	return time.Duration(amount * float64(multiplier)), nil
+}
+
+// sampleLines forwards a random sample of the lines received from the given channel.
+// Each line has a sampleRate chance of being forwarded. Once maxTargets lines have been forwarded, the rest of the input is ignored. A maxTargets of 0 means no limit.
+func sampleLines(lines <-chan string, maxTargets int, sampleRate float64) <-chan string {
+	out := make(chan string, 128)
+
+	go func() {
+		defer close(out)
+		forwarded := 0
+		for line := range lines {
+			if sampleRate < 1 && rand.Float64() >= sampleRate { // #nosec G404 -- Sampling doesn't need a cryptographically secure random number generator.
+				continue
+			}
+			out <- line
+			forwarded++
+			if maxTargets > 0 && forwarded >= maxTargets {
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
 // If isScope is true, ParseLine attempts to parse a string into either:
 // - *net.IPNet		(CIDR notation)
 // - *net.IP		(single IP address)
 // - *string 		(hostname of a valid URL)
 // - *regexp.Regexp (Regex)
 // - *WildcardScope (Wildcard Scope)
+// - *MobileApp		(mobile app, like "android:com.example.app" or an App Store URL)
+// - *Repository	(source repository, like "https://github.com/example/app", only with --repo-scopes)
+// - *ContractAddress	(smart contract, like "polygon:0x...", only with --contract-scopes)
+// - *BinaryScope	(desktop binary or file hash, which never matches any target)
 //
 // If isScope is false, ParseLine attempts to parse a string into either:
 // - *net.IP				(single IP address)
 // - *url.URL				(valid URL)
 // - *URLWithIPAddressHost	(URL that has an IP host)
+// - *EmailAddress			(email address)
+// - *MobileApp				(mobile app, only with --mobile-scopes)
+// - *Repository			(source repository, only with --repo-scopes)
+// - *ContractAddress		(smart contract, only with --contract-scopes)
 //
 // This function returns the error ErrInvalidFormat if the string didn't match any of the listed formats.
 func parseLine(line string, isScope bool, privateTLDsAreEnabled bool) (interface{}, error) {
-
 	if isScope {
-		if strings.HasPrefix(line, "^") && strings.HasSuffix(line, "$") {
-			// Attempt to parse the scope as a regex
-			scopeRegex, err := regexp.Compile(line)
-			if err != nil {
-				if chainMode {
-					warning("There was an error parsing the scope \"" + line + "\" as a regex.")
-				}
-				return nil, ErrInvalidFormat
-			} else {
-				return scopeRegex, nil
-			}
-		} else if strings.Contains(line, "*") {
-			// If the line is a scope and contains a wildcard...
-			// Attempt to parse the scope as a regex
-			rawRegex := strings.Replace(line, ".", "\\.", -1)
-			rawRegex = strings.Replace(rawRegex, "*", ".*", -1)
+		return parseScope(line, privateTLDsAreEnabled)
+	}
+	return parseTarget(line)
+}
 
-			scopeRegex, err := regexp.Compile(rawRegex)
-			if err != nil {
-				if chainMode {
-					warning("There was an error parsing the scope \"" + line + "\" (converted into \"" + rawRegex + "\") as a regex. This scope was parsed as a regex instead of as a URL because it has 1 or more wildcards.")
-				}
-				return nil, ErrInvalidFormat
-			} else {
-				return &(WildcardScope{scope: *scopeRegex}), nil
-			}
-		} else if isNmapIPRange(line) {
-			// Nmap octet range detection: must look like a.b.c.d with at least one range/comma
-			nmapRange, err := parseNmapIPRange(line)
-			if err != nil {
-				return nil, ErrInvalidFormat
-			}
-			return nmapRange, nil
+// parseScope parses a scope line. See parseLine for the possible results.
+func parseScope(line string, privateTLDsAreEnabled bool) (interface{}, error) {
+	if app := parseMobileAppScope(line); app != nil {
+		return app, nil
+	} else if strings.HasPrefix(line, androidPrefix) || strings.HasPrefix(line, iosPrefix) {
+		return nil, ErrInvalidFormat
+	}
+	if binary := parseBinaryScope(line); binary != nil {
+		return binary, nil
+	}
+	if repoScopesEnabled {
+		if repo := parseRepositoryScope(line); repo != nil {
+			return repo, nil
+		}
+	}
+	if contractScopesEnabled {
+		if contract := parseContractAddress(line); contract != nil {
+			return contract, nil
+		}
+	}
+
+	if strings.HasPrefix(line, "^") && strings.HasSuffix(line, "$") {
+		// Attempt to parse the scope as a regex
+		pattern := line
+		if caseInsensitiveRegexes {
+			pattern = "(?i)" + pattern
+		}
+		scopeRegex, err := compileScopeRegex(pattern)
+		if err != nil {
+			warning(warnInvalidRegex, "There was an error parsing the scope \""+line+"\" as a regex.")
+			return nil, ErrInvalidFormat
 		} else {
-			// Try to parse as CIDR
-			if _, ipnet, err := net.ParseCIDR(line); err == nil {
-				return ipnet, nil
-			}
+			return scopeRegex, nil
+		}
+	} else if strings.Contains(line, "*") || hasSingleCharWildcard(line) {
+		// If the line is a scope and contains a wildcard...
+		// Attempt to parse the scope as a regex. "*" matches any amount of characters, and "?" matches exactly one.
+		// Wildcards only contain literal characters, so lowercasing them (and the target hosts) makes them case-insensitive, like hostnames.
+		rawRegex := wildcardToRegex.Replace(strings.ToLower(line))
+		// The wildcard must match the whole host
+		if !unanchoredWildcards {
+			rawRegex = "^" + rawRegex + "$"
+		}
+
+		scopeRegex, err := compileScopeRegex(rawRegex)
+		if err != nil {
+			warning(warnInvalidRegex, "There was an error parsing the scope \""+line+"\" (converted into \""+rawRegex+"\") as a regex. This scope was parsed as a regex instead of as a URL because it has 1 or more wildcards.")
+			return nil, ErrInvalidFormat
+		} else {
+			return &(WildcardScope{scope: *scopeRegex}), nil
 		}
+	} else if isNmapIPRange(line) {
+		// Nmap octet range detection: must look like a.b.c.d with at least one range/comma
+		nmapRange, err := parseNmapIPRange(line)
+		if err != nil {
+			return nil, ErrInvalidFormat
+		}
+		return nmapRange, nil
+	}
 
+	// Try to parse as CIDR
+	if _, ipnet, err := net.ParseCIDR(line); err == nil {
+		return ipnet, nil
 	}
 
 	// Try plain IP
@@ -1042,82 +3107,120 @@ func parseLine(line string, isScope bool, privateTLDsAreEnabled bool) (interface
 		return &ip, nil
 	}
 
-	// Try URL (with basic validation)
-	parsedURL, err := url.Parse(line)
-	// If parsedURL.Opaque has content, then this is a data URI. Data URI's are not supported by hacker-scoper.
-	parseAsURLFailed := (err != nil || parsedURL.Host == "" || parsedURL.Opaque != "")
+	parsedURL, err := parseURLWithDefaultScheme(line)
+	if err != nil {
+		return nil, err
+	}
 
-	if parseAsURLFailed {
-		// If the line doesn't already start with an "https://" prefix...
-		if !strings.HasPrefix(line, "https://") {
-			// Retry parsing but with a 'https://' prefix
-			parsedURL, err = url.Parse("https://" + line)
-			parseAsURLFailed = (err != nil || parsedURL.Host == "" || parsedURL.Opaque != "")
-			if parseAsURLFailed {
-				return nil, ErrInvalidFormat
-			}
-		} else {
-			return nil, ErrInvalidFormat
-		}
+	// scopes will never be URLs with IP hostnames. It doesn't make sense to check for IP hostnames in URLs for scopes
+	if parsedURL.Path != "" && parsedURL.Path != "/" {
+		warning(warnScopeWithPath, "The text \""+line+"\" was given as a scope, but it contains the path \""+parsedURL.Path+"\". In order to properly match paths in your scope you have to use regex. This scope has been ignored.")
+		return nil, ErrInvalidFormat
 	}
 
-	if !isScope {
-		// scopes will never be URLs with IP hostnames. It doesn't make sense to check for IP hostnames in URLs for scopes
-		// Try plain IP
-		if ip := net.ParseIP(removePortFromHost(parsedURL)); ip != nil {
-			myURLWithIPHostname := URLWithIPAddressHost{rawURL: line, IPhost: ip}
-			return &myURLWithIPHostname, nil
-		} else {
-			return parsedURL, nil
-		}
-	} else {
-		if parsedURL.Path == "" || parsedURL.Path == "/" {
+	// This should help detect any misconfigured bug-bounty programs
+	// Sometimes bug bounty programs set APK package names such as com.my.business.gatewayportal as web_application resources instead of as android_application resources in their program scope, causing trouble for anyone using automatic tools. Hacker-Scoper automatically detects these errors and notifies the user.
+	// The problem with url.Parse is that it rarely returns an error. It often times assumes that invalid domain names (such as "this.is.not.avaliddomain") actually have a "private Top-Level-Domain". This is extremely unlikely in reality
+	// Hostnames aren't case-sensitive. The target hosts are lowercased too.
+	portless := strings.ToLower(removePortFromHost(parsedURL))
+	if !privateTLDsAreEnabled {
 
-			// This should help detect any misconfigured bug-bounty programs
-			// Sometimes bug bounty programs set APK package names such as com.my.business.gatewayportal as web_application resources instead of as android_application resources in their program scope, causing trouble for anyone using automatic tools. Hacker-Scoper automatically detects these errors and notifies the user.
-			// The problem with url.Parse is that it rarely returns an error. It often times assumes that invalid domain names (such as "this.is.not.avaliddomain") actually have a "private Top-Level-Domain". This is extremely unlikely in reality
-			portless := removePortFromHost(parsedURL)
-			if !privateTLDsAreEnabled {
+		eTLD, icann := publicsuffix.PublicSuffix(portless)
 
-				eTLD, icann := publicsuffix.PublicSuffix(portless)
+		if !(icann || strings.IndexByte(eTLD, '.') >= 0) {
+			misconfigWarning(warnPrivateTLD, "The scope \""+line+"\" does not have a public Top Level Domain (TLD). This may be a sign of a misconfigured bug bounty program. Consider editing the \""+firebountyJSONPath+" file and removing the faulty entries. Also, report the failure to the maintainers of the bug bounty program.")
+			return nil, ErrMisconfiguredScope
+		}
 
-				if !(icann || strings.IndexByte(eTLD, '.') >= 0) {
-					if !chainMode {
-						warning("The scope \"" + line + "\" does not have a public Top Level Domain (TLD). This may be a sign of a misconfigured bug bounty program. Consider editing the \"" + firebountyJSONPath + " file and removing the faulty entries. Also, report the failure to the maintainers of the bug bounty program.")
-					}
-					return nil, ErrInvalidFormat
-				}
+		//alert the user about potentially mis-configured bug-bounty program
+		if strings.HasPrefix(line, "com.") || strings.HasPrefix(line, "org.") {
+			misconfigWarning(warnPackageNameScope, "The scope \""+line+"\" starts with \"com.\" or \"org.\" This may be a sign of a misconfigured bug bounty program. Consider editing the \""+firebountyJSONPath+" file and removing the faulty entries. Also, report the failure to the maintainers of the bug bounty program.")
+		}
+	}
 
-				if !chainMode {
-					//alert the user about potentially mis-configured bug-bounty program
-					if line[0:4] == "com." || line[0:4] == "org." {
-						warning("The scope \"" + line + "\" starts with \"com.\" or \"org.\" This may be a sign of a misconfigured bug bounty program. Consider editing the \"" + firebountyJSONPath + " file and removing the faulty entries. Also, report the failure to the maintainers of the bug bounty program.")
-					}
-				}
-			}
+	return portless, nil
+}
 
-			return portless, nil
+// parseTarget parses a target line. See parseLine for the possible results.
+// It runs once per target, so the cheap checks come first: the email regex only runs on lines with an "@", and the URL is parsed only once.
+func parseTarget(line string) (interface{}, error) {
+	if mobileScopesEnabled {
+		if app := parseMobileAppTarget(line); app != nil {
+			return app, nil
+		}
+	}
+	if repoScopesEnabled {
+		if repo := parseRepositoryTarget(line); repo != nil {
+			return repo, nil
+		}
+	}
+	if contractScopesEnabled {
+		if contract := parseContractAddress(line); contract != nil {
+			return contract, nil
+		}
+	}
 
-		} else {
-			if !chainMode {
-				warning("The text \"" + line + "\" was given as a scope, but it contains the path \"" + parsedURL.Path + "\". In order to properly match paths in your scope you have to use regex. This scope has been ignored.")
-			}
-			return nil, ErrInvalidFormat
+	// Try plain IP
+	if ip := net.ParseIP(line); ip != nil {
+		return &ip, nil
+	}
+
+	// Email addresses would otherwise be parsed as URLs with userinfo
+	if strings.IndexByte(line, '@') >= 0 {
+		if match := emailAddressRegex.FindStringSubmatch(line); match != nil {
+			return &EmailAddress{rawAddress: line, domain: match[1]}, nil
 		}
+	}
+
+	parsedURL, err := parseURLWithDefaultScheme(line)
+	if err != nil {
+		return nil, err
+	}
+
+	if ip := net.ParseIP(removePortFromHost(parsedURL)); ip != nil {
+		return &URLWithIPAddressHost{rawURL: line, IPhost: ip}, nil
+	}
+	return parsedURL, nil
+}
 
+// parseURLWithDefaultScheme parses a URL that must have a host. Lines without a scheme, like "example.com:8080/path", are parsed as https:// URLs.
+// Lines without a scheme never have a host on their own, so they're parsed directly with the "https://" prefix instead of parsing them twice. Scheme-relative URLs like "//example.com" are parsed as they are.
+func parseURLWithDefaultScheme(line string) (*url.URL, error) {
+	if !hasURLScheme(line) && !strings.HasPrefix(line, "//") {
+		line = "https://" + line
 	}
+	parsedURL, err := url.Parse(line)
+	// If parsedURL.Opaque has content, then this is a data URI. Data URI's are not supported by hacker-scoper.
+	if err != nil || parsedURL.Host == "" || parsedURL.Opaque != "" {
+		return nil, ErrInvalidFormat
+	}
+	return parsedURL, nil
+}
 
+// hasURLScheme reports whether a line starts with a URL scheme followed by "://", like "https://".
+func hasURLScheme(line string) bool {
+	for i := 0; i < len(line); i++ {
+		character := line[i]
+		switch {
+		case (character >= 'a' && character <= 'z') || (character >= 'A' && character <= 'Z'):
+		case i > 0 && ((character >= '0' && character <= '9') || character == '+' || character == '-' || character == '.'):
+		case i > 0 && character == ':':
+			return strings.HasPrefix(line[i:], "://")
+		default:
+			return false
+		}
+	}
+	return false
 }
 
-// ParseAllLines processes each line individually, returning:
-// - A slice of parsed objects (interface{} holding *net.IPNet, net.IP, or *url.URL)
-// - An error if no lines could be parsed as a scope, otherwise nil.
-// isScopes should be true if the lines to be parsed are scopes.
-func parseAllLines(lines []string, isScopes bool, privateTLDsAreEnabled bool) ([]interface{}, error) {
+// parseAllLines parses every line with parseLine, in parallel across every core, and returns the parsed lines in the same order as the lines, so that the first matching scope doesn't depend on the scheduling.
+// The lines that can't be parsed are skipped with a warning, and an error is only returned if none of them could be parsed. isScopes should be true if the lines are scopes:
+// their trailing comments are then used as their descriptions, and saved into scopeDetails together with their lineDetails, if any.
+func parseAllLines(lines []string, isScopes bool, privateTLDsAreEnabled bool, lineDetails map[string]ruleDetails) ([]interface{}, error) {
 	parsed := []interface{}{}
 
 	numWorkers := runtime.NumCPU()
-	inputChan := make(chan string, numWorkers)
+	inputChan := make(chan int, numWorkers)
 	outputChan := make(chan parseResult, len(lines))
 
 	var wg sync.WaitGroup
@@ -1127,21 +3230,26 @@ func parseAllLines(lines []string, isScopes bool, privateTLDsAreEnabled bool) ([
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for line := range inputChan {
+			for index := range inputChan {
+				line := lines[index]
+				var comment string
+				if isScopes {
+					line, comment = splitScopeComment(line)
+				}
 				result, err := parseLine(line, isScopes, privateTLDsAreEnabled)
 				if err != nil {
-					outputChan <- parseResult{value: result, line: line, err: err}
+					outputChan <- parseResult{index: index, value: result, line: line, err: err}
 				} else {
-					outputChan <- parseResult{value: result, line: "", err: err}
+					outputChan <- parseResult{index: index, value: result, line: line, comment: comment, err: err}
 				}
 			}
 		}()
 	}
 
-	// Feed lines to workers
+	// Feed the indexes of the lines to workers
 	go func() {
-		for _, line := range lines {
-			inputChan <- line
+		for index := range lines {
+			inputChan <- index
 		}
 		close(inputChan)
 	}()
@@ -1152,13 +3260,37 @@ func parseAllLines(lines []string, isScopes bool, privateTLDsAreEnabled bool) ([
 		close(outputChan)
 	}()
 
+	results := make([]parseResult, len(lines))
 	for res := range outputChan {
+		results[res.index] = res
+	}
+
+	for _, res := range results {
 		if res.err != nil {
-			if !chainMode {
-				warning("Unable to parse line: \"" + res.line + "\"")
+			// The scopes of misconfigured programs are expected with --suppress-misconfig-warnings
+			if !hideMisconfigWarnings || !errors.Is(res.err, ErrMisconfiguredScope) {
+				warning(warnUnparsableLine, "Unable to parse line: \""+res.line+"\"")
 			}
 		} else if res.value != nil {
 			parsed = append(parsed, res.value)
+			details, hasDetails := lineDetails[res.line]
+			if res.comment != "" {
+				details.Description = res.comment
+				hasDetails = true
+			}
+			if hasDetails {
+				// Several lines can be the same rule, like "example.com" and "https://example.com/"
+				if previous, exists := scopeDetails[res.value]; exists {
+					sources := slices.Clone(previous.Sources)
+					for _, source := range details.Sources {
+						if !slices.Contains(sources, source) {
+							sources = append(sources, source)
+						}
+					}
+					details.Sources = sources
+				}
+				scopeDetails[res.value] = details
+			}
 		}
 	}
 
@@ -1168,114 +3300,243 @@ func parseAllLines(lines []string, isScopes bool, privateTLDsAreEnabled bool) ([
 	return parsed, nil
 }
 
-func isInscope(inscopeScopes *[]interface{}, target *interface{}, explicitLevel *int) (result bool) {
-
-	// Here we use a switch-case on the type of target. So target is processed differently depending on which variable type it is.
+// Converts a wildcard scope into a regex. The replacements are done in a single pass, so the "." of ".*" isn't escaped.
+var wildcardToRegex = strings.NewReplacer(".", "\\.", "*", ".*", "?", ".")
 
-	switch assertedTarget := (*target).(type) {
-	// If the target is an IP Address...
-	case *net.IP:
-		return isInscopeIP(assertedTarget, inscopeScopes, explicitLevel)
-	case *URLWithIPAddressHost:
-		return isInscopeIP(&assertedTarget.IPhost, inscopeScopes, explicitLevel)
+// Undoes wildcardToRegex. At every position, the first matching pair wins, so ".*" is turned into "*" before a lone "." is turned into "?".
+var regexToWildcard = strings.NewReplacer("\\.", ".", ".*", "*", ".", "?")
 
-	// If the target is a URL...
-	case *url.URL:
-		for i := range *inscopeScopes {
-			// We're only interested in comparing URL targets against URL scopes, and regex.
-			switch assertedScope := (*inscopeScopes)[i].(type) {
-			// If the i scope is a URL...
-			case string:
-				switch *explicitLevel {
-				case 1:
-					//if x is a subdomain of y
-					//ex: wordpress.example.com with a scope of *.example.com will give a match
-					//we DON'T do it by splitting on dots and matching, because that would cause errors with domains that have two top-level-domains (gov.br for example)
-					result = strings.HasSuffix(removePortFromHost(assertedTarget), assertedScope)
-
-				case 2, 3:
-					result = removePortFromHost(assertedTarget) == assertedScope
-				}
+// hasSingleCharWildcard reports whether the host of a scope contains a "?" wildcard, like "db??.example.com". A "?" after the host starts the query string instead.
+func hasSingleCharWildcard(line string) bool {
+	host := line
+	if _, afterScheme, found := strings.Cut(host, "://"); found {
+		host = afterScheme
+	}
+	host, _, _ = strings.Cut(host, "/")
+	return strings.Contains(host, "?")
+}
 
-			case *WildcardScope:
-				if *explicitLevel != 3 {
-					// If the i scope is a Wildcard Scope...
-					//if the current target host matches the regex...
-					result = (assertedScope.scope).MatchString(removePortFromHost(assertedTarget))
-				}
+// Compiled scope regexes, by pattern. Big programs and combined companies often repeat the same wildcards, like "*.example.com", which are only compiled once.
+var scopeRegexCache sync.Map
 
-			case *regexp.Regexp:
-				// If the i scope is a regex...
-				//if the current target matches the regex...
-				result = assertedScope.MatchString(assertedTarget.String())
+// compileScopeRegex compiles the regex of a scope, reusing the regex of an identical pattern if it was already compiled.
+// Regexes are safe for concurrent use, so the same regex can be shared by several scopes.
+func compileScopeRegex(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := scopeRegexCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	scopeRegex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	scopeRegexCache.Store(pattern, scopeRegex)
+	return scopeRegex, nil
+}
 
+// recordScopeSource adds the source to the details of every scope line, so that the rules of combined runs can be traced back to the program or file that contributed them.
+func recordScopeSource(lineDetails map[string]ruleDetails, source string, lineLists ...[]string) {
+	for _, lines := range lineLists {
+		for _, line := range lines {
+			// The details are looked up without the comment of the line
+			scope, _ := splitScopeComment(line)
+			details := lineDetails[scope]
+			if !slices.Contains(details.Sources, source) {
+				details.Sources = append(details.Sources, source)
 			}
-			if result {
-				return result
+			lineDetails[scope] = details
+		}
+	}
+}
+
+// scopeSources returns every source of the scope lines.
+func scopeSources(lineDetails map[string]ruleDetails) []string {
+	var sources []string
+	for _, details := range lineDetails {
+		for _, source := range details.Sources {
+			if !slices.Contains(sources, source) {
+				sources = append(sources, source)
 			}
 		}
 	}
+	return sources
+}
 
-	return false
+// splitScopeComment splits a scope line like "*.example.com # Main website" into the scope and its comment.
+// Only a "#" at the start of the line or after a whitespace starts a comment, so that URL fragments aren't mistaken for comments. "\#" is a literal "#".
+func splitScopeComment(line string) (scope string, comment string) {
+	var builder strings.Builder
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' && i+1 < len(line) && line[i+1] == '#' {
+			builder.WriteByte('#')
+			i++
+			continue
+		}
+		if line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return strings.TrimSpace(builder.String()), strings.TrimSpace(line[i+1:])
+		}
+		builder.WriteByte(line[i])
+	}
+	return strings.TrimSpace(builder.String()), ""
+}
+
+// prepareTarget computes the normalized forms of a parsed target that the scopes are compared with.
+func prepareTarget(target interface{}) *preparedTarget {
+	prepared := &preparedTarget{value: target}
+	switch assertedTarget := target.(type) {
+	case *net.IP:
+		prepared.ip = assertedTarget
+	case *URLWithIPAddressHost:
+		prepared.ip = &assertedTarget.IPhost
+	case *url.URL:
+		// removePortFromHost parses the host as an IP address, which allocates
+		prepared.host = strings.ToLower(removePortFromHost(assertedTarget))
+		prepared.raw = assertedTarget.String()
+	case *EmailAddress:
+		prepared.host = strings.ToLower(removePortFromHost(&url.URL{Host: assertedTarget.domain}))
+		prepared.raw = assertedTarget.rawAddress
+	}
+	return prepared
+}
+
+func isInscope(inscopeScopes *[]interface{}, target *preparedTarget, explicitLevel *int) bool {
+	return findMatchingScope(inscopeScopes, target, explicitLevel) != nil
 }
 
-func isInscopeIP(targetIP *net.IP, inscopeScopes *[]interface{}, explicitLevel *int) (result bool) {
-	if *explicitLevel == 3 {
-		// For each scope in inscopeScopes...
-		for i := range *inscopeScopes {
-			// We're only interested in comparing IP targets against IP addresses.
-			// CIDR scopes are disabled in --explicit-level=3
-			switch assertedScope := (*inscopeScopes)[i].(type) {
+// findMatchingScope returns the first scope that matches the target, or nil if none of them do.
+func findMatchingScope(inscopeScopes *[]interface{}, target *preparedTarget, explicitLevel *int) interface{} {
 
-			// If the i scope is an IP Address...
-			case *net.IP:
-				result = assertedScope.Equal(*targetIP)
+	// Here we use a switch-case on the type of target. So target is processed differently depending on which variable type it is.
+
+	switch assertedTarget := target.value.(type) {
+	// If the target is an IP Address...
+	case *net.IP, *URLWithIPAddressHost:
+		return matchingScopeForIP(target.ip, inscopeScopes, explicitLevel)
+	// CIDR targets are only parsed with --allow-cidr-targets
+	case *net.IPNet:
+		return matchingScopeForCIDR(assertedTarget, inscopeScopes, explicitLevel)
+
+	// If the target is a URL, or an email address, whose domain is compared against the scopes...
+	case *url.URL, *EmailAddress:
+		return matchingScopeForURL(target, inscopeScopes, explicitLevel)
+
+	// App targets are only compared against the app scopes
+	case *MobileApp:
+		return matchingScopeForMobileApp(assertedTarget, inscopeScopes)
+
+	// Repository targets are only compared against the repository scopes
+	case *Repository:
+		return matchingScopeForRepository(assertedTarget, inscopeScopes)
+
+	// Contract targets are only compared against the contract scopes
+	case *ContractAddress:
+		return matchingScopeForContract(assertedTarget, inscopeScopes)
+	}
+
+	return nil
+}
+
+// matchingScopeForURL compares the host of a URL or email address target against the hostname, wildcard and regex scopes, and returns the first one that matches.
+// Regex scopes are matched against the whole target instead of the host.
+func matchingScopeForURL(target *preparedTarget, inscopeScopes *[]interface{}, explicitLevel *int) interface{} {
+	host := target.host
+	var result bool
+	for i := range *inscopeScopes {
+		// --rule-timings measures every match
+		var start time.Time
+		if ruleTimer != nil {
+			start = time.Now()
+		}
+
+		// The scopes of some sources can have their own level
+		level := ExplicitLevel(scopeExplicitLevel((*inscopeScopes)[i], *explicitLevel))
+
+		// We're only interested in comparing URL targets against URL scopes, and regex.
+		switch assertedScope := (*inscopeScopes)[i].(type) {
+		// If the i scope is a URL...
+		case string:
+			switch level {
+			case ExplicitLevelPermissive, ExplicitLevelSubdomains:
+				//if x is a subdomain of y
+				//ex: wordpress.example.com with a scope of *.example.com will give a match
+				//we DON'T do it by splitting on dots and matching, because that would cause errors with domains that have two top-level-domains (gov.br for example)
+				//strings.HasSuffix compares the bytes with the vectorized memequal of the runtime, which is faster than comparing them one by one from the end (see Benchmark_matchingScopeForURL)
+				result = strings.HasSuffix(host, assertedScope)
+
+			case ExplicitLevelWildcards, ExplicitLevelStrict:
+				result = host == assertedScope
 			}
-			if result {
-				return result
+
+		case *WildcardScope:
+			if level != ExplicitLevelStrict {
+				// If the i scope is a Wildcard Scope...
+				//if the current target host matches the regex...
+				result = (assertedScope.scope).MatchString(host)
+				// In --explicit-level=0, "*.example.com" also matches "example.com"
+				if !result && level == ExplicitLevelPermissive {
+					result = host != "" && host == assertedScope.apexDomain()
+				}
 			}
+
+		case *regexp.Regexp:
+			// If the i scope is a regex...
+			//if the current target matches the regex...
+			result = assertedScope.MatchString(target.raw)
+
 		}
-		return false
-	} else {
-		// For each scope in inscopeScopes...
-		for i := range *inscopeScopes {
-			// We're only interested in comparing IP targets against CIDR networks and IP addresses.
-			switch assertedScope := (*inscopeScopes)[i].(type) {
-			// If the i scope is a CIDR network...
-			case *net.IPNet:
-				result = assertedScope.Contains(*targetIP)
-
-			// If the i scope is an IP Address...
-			case *net.IP:
-				result = assertedScope.Equal(*targetIP)
+		if ruleTimer != nil {
+			ruleTimer.record((*inscopeScopes)[i], time.Since(start))
+		}
+		if result {
+			return (*inscopeScopes)[i]
+		}
+	}
+	return nil
+}
 
-			case *NmapIPRange:
-				ip := (*targetIP).To4()
-				if ip == nil {
-					continue
-				}
-				result = true
-				for i := range 4 {
-					found := false
-					for _, v := range assertedScope.Octets[i] {
-						if ip[i] == v {
-							found = true
-							break
-						}
-					}
-					if !found {
-						result = false
+// matchingScopeForIP compares an IP target against the IP, CIDR and nmap range scopes, and returns the first one that matches.
+func matchingScopeForIP(targetIP *net.IP, inscopeScopes *[]interface{}, explicitLevel *int) interface{} {
+	// For each scope in inscopeScopes...
+	for i := range *inscopeScopes {
+		var result bool
+		// CIDR scopes are disabled in --explicit-level=3. The scopes of some sources can have their own level.
+		isStrict := ExplicitLevel(scopeExplicitLevel((*inscopeScopes)[i], *explicitLevel)) == ExplicitLevelStrict
+
+		// We're only interested in comparing IP targets against CIDR networks and IP addresses.
+		switch assertedScope := (*inscopeScopes)[i].(type) {
+		// If the i scope is a CIDR network...
+		case *net.IPNet:
+			result = !isStrict && assertedScope.Contains(*targetIP)
+
+		// If the i scope is an IP Address...
+		case *net.IP:
+			result = assertedScope.Equal(*targetIP)
+
+		case *NmapIPRange:
+			ip := (*targetIP).To4()
+			if isStrict || ip == nil {
+				continue
+			}
+			result = true
+			for i := range 4 {
+				found := false
+				for _, v := range assertedScope.Octets[i] {
+					if ip[i] == v {
+						found = true
 						break
 					}
 				}
-
-			}
-			if result {
-				return result
+				if !found {
+					result = false
+					break
+				}
 			}
+
+		}
+		if result {
+			return (*inscopeScopes)[i]
 		}
-		return false
 	}
+	return nil
 }
 
 func isNmapIPRange(line string) bool {
@@ -1376,10 +3637,45 @@ func extractCompanyNames(jsonPath string) ([]string, error) {
 
 // Efficiently load a single Program by index from the firebounty JSON
 func loadProgramByIndex(jsonPath string, index int) (*Program, error) {
-	file, err := os.Open(jsonPath) // #nosec G304 -- Intended behavior
+	rawProgram, err := loadRawProgramByIndex(jsonPath, index)
+	if err != nil {
+		return nil, err
+	}
+
+	var prog Program
+	if err := json.Unmarshal(rawProgram, &prog); err != nil {
+		return nil, err
+	}
+	return &prog, nil
+}
+
+// Efficiently load the raw JSON of a single Program by index from the firebounty JSON
+// This includes every field of the program, even the ones that aren't part of the Program struct
+func loadRawProgramByIndex(jsonPath string, index int) (json.RawMessage, error) {
+	var found json.RawMessage
+	err := iterateRawPrograms(jsonPath, func(i int, rawProgram json.RawMessage) bool {
+		if i == index {
+			found = rawProgram
+			return false
+		}
+		return true
+	})
 	if err != nil {
 		return nil, err
 	}
+	if found == nil {
+		return nil, errors.New("program index out of range")
+	}
+	return found, nil
+}
+
+// iterateRawPrograms calls fn with the index and raw JSON of every program in the firebounty JSON, without loading the whole database into memory.
+// The iteration stops early if fn returns false.
+func iterateRawPrograms(jsonPath string, fn func(index int, rawProgram json.RawMessage) bool) error {
+	file, err := os.Open(jsonPath) // #nosec G304 -- Intended behavior
+	if err != nil {
+		return err
+	}
 	defer file.Close()
 
 	// Create a decoder and seek to the "pgms" array
@@ -1389,7 +3685,7 @@ func loadProgramByIndex(jsonPath string, index int) (*Program, error) {
 	for {
 		t, err := decoder.Token()
 		if err != nil {
-			return nil, err
+			return err
 		}
 		if t == "pgms" {
 			break
@@ -1398,19 +3694,19 @@ func loadProgramByIndex(jsonPath string, index int) (*Program, error) {
 
 	// Read the start of the array
 	if _, err := decoder.Token(); err != nil { // should be json.Delim('[')
-		return nil, err
+		return err
 	}
 
-	// Iterate through the array until the desired index
+	// Iterate through the array
 	for i := 0; decoder.More(); i++ {
-		var prog Program
-		if err := decoder.Decode(&prog); err != nil {
-			return nil, err
+		var rawProgram json.RawMessage
+		if err := decoder.Decode(&rawProgram); err != nil {
+			return err
 		}
-		if i == index {
-			return &prog, nil
+		if !fn(i, rawProgram) {
+			return nil
 		}
 	}
 
-	return nil, errors.New("program index out of range")
+	return nil
 }
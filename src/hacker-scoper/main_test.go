@@ -1,14 +1,41 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
 	"net/url"
+	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/publicsuffix"
 )
 
 //========================================================================
@@ -33,6 +60,44 @@ func equals(tb testing.TB, exp, act interface{}) {
 	}
 }
 
+// The arguments of main, as a JSON array, when the test binary is run by runMain
+const mainArgsEnvVar = "HACKER_SCOPER_TEST_MAIN_ARGS"
+
+// runMain runs main with the given arguments in a new process, since main calls os.Exit. It runs from dir, with stdin as the input,
+// and with a fresh home directory so that the config file and the firebounty database of the user aren't touched.
+func runMain(tb testing.TB, dir string, stdin string, args ...string) (exitCode int, stdout string) {
+	encodedArgs, err := json.Marshal(args)
+	checkForErrors(tb, err)
+	home := tb.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^Test_main$") // #nosec G204 -- The test binary runs itself.
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), mainArgsEnvVar+"="+string(encodedArgs), "HOME="+home, "XDG_CONFIG_HOME="+filepath.Join(home, ".config"), "XDG_CACHE_HOME="+filepath.Join(home, ".cache"))
+	cmd.Stdin = strings.NewReader(stdin)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), output.String()
+	}
+	checkForErrors(tb, err)
+	return 0, output.String()
+}
+
+// Test_main is the process started by runMain. It does nothing when the tests are run normally.
+func Test_main(t *testing.T) {
+	encodedArgs := os.Getenv(mainArgsEnvVar)
+	if encodedArgs == "" {
+		return
+	}
+	var args []string
+	checkForErrors(t, json.Unmarshal([]byte(encodedArgs), &args))
+	os.Args = append([]string{"hacker-scoper"}, args...)
+	main()
+	// Without this, the test binary would print its own results
+	os.Exit(0)
+}
+
 //========================================================================
 //========================================================================
 //========================================================================
@@ -172,7 +237,7 @@ func Test_parseLine_Scope_URL_IP_Port_NoScheme_WithPath(t *testing.T) {
 // Try parsing wildcards
 func Test_parseLine_Scope_Wildcard_Start(t *testing.T) {
 	scope := "*.amz.example.com"
-	myregex, _ := regexp.Compile(`.*\.amz\.example\.com`)
+	myregex, _ := regexp.Compile(`^.*\.amz\.example\.com$`)
 	scopeParsed := &WildcardScope{scope: *myregex}
 	result, _ := parseLine(scope, true, false)
 	equals(t, scopeParsed, result)
@@ -181,7 +246,7 @@ func Test_parseLine_Scope_Wildcard_Start(t *testing.T) {
 // Try parsing wildcards
 func Test_parseLine_Scope_Wildcard_Middle(t *testing.T) {
 	scope := "database*.internal.example.com"
-	myregex, _ := regexp.Compile(`database.*\.internal\.example\.com`)
+	myregex, _ := regexp.Compile(`^database.*\.internal\.example\.com$`)
 	scopeParsed := &WildcardScope{scope: *myregex}
 	result, _ := parseLine(scope, true, false)
 	equals(t, scopeParsed, result)
@@ -190,10 +255,108 @@ func Test_parseLine_Scope_Wildcard_Middle(t *testing.T) {
 // Try parsing wildcards
 func Test_parseLine_Scope_Wildcard_Complex(t *testing.T) {
 	scope := "database*.internal.*.example.com"
-	myregex, _ := regexp.Compile(`database.*\.internal\..*\.example\.com`)
+	myregex, _ := regexp.Compile(`^database.*\.internal\..*\.example\.com$`)
+	scopeParsed := &WildcardScope{scope: *myregex}
+	result, _ := parseLine(scope, true, false)
+	equals(t, scopeParsed, result)
+}
+
+// Try parsing single-character wildcards
+func Test_parseLine_Scope_Wildcard_SingleCharacter(t *testing.T) {
+	scope := "db??.example.com"
+	myregex, _ := regexp.Compile(`^db..\.example\.com$`)
 	scopeParsed := &WildcardScope{scope: *myregex}
 	result, _ := parseLine(scope, true, false)
 	equals(t, scopeParsed, result)
+	equals(t, scope, scopeToString(result))
+
+	explicitLevel := 1
+	scopes := []interface{}{result}
+	target, _ := parseLine("db01.example.com", false, false)
+	equals(t, true, isInscope(&scopes, prepareTarget(target), &explicitLevel))
+	target, _ = parseLine("db1.example.com", false, false)
+	equals(t, false, isInscope(&scopes, prepareTarget(target), &explicitLevel))
+
+	// A "?" after the host is the start of the query string
+	equals(t, false, hasSingleCharWildcard("https://example.com/search?q=1"))
+	equals(t, true, hasSingleCharWildcard("https://db?.example.com/search"))
+}
+
+// Wildcards must match the whole host, unless --unanchored-wildcards is used
+func Test_isInscope_AnchoredWildcards(t *testing.T) {
+	explicitLevel := 1
+	wildcard, _ := parseLine("*.example.com", true, false)
+	scopes := []interface{}{wildcard}
+	target, _ := parseLine("https://www.example.com/", false, false)
+	equals(t, true, isInscope(&scopes, prepareTarget(target), &explicitLevel))
+	target, _ = parseLine("https://www.example.com.evil.net/", false, false)
+	equals(t, false, isInscope(&scopes, prepareTarget(target), &explicitLevel))
+	equals(t, "*.example.com", scopeToString(wildcard))
+
+	unanchoredWildcards = true
+	defer func() { unanchoredWildcards = false }()
+	wildcard, _ = parseLine("*.example.com", true, false)
+	scopes = []interface{}{wildcard}
+	equals(t, true, isInscope(&scopes, prepareTarget(target), &explicitLevel))
+	equals(t, "*.example.com", scopeToString(wildcard))
+}
+
+func Test_isInscope_PermissiveLevel(t *testing.T) {
+	scopes, err := parseAllLines([]string{"*.example.com", "example.org", "*.dev.*.example.net"}, true, false, nil)
+	checkForErrors(t, err)
+	tests := []struct {
+		target   string
+		level    ExplicitLevel
+		expected bool
+	}{
+		// The wildcards also match their apex domain
+		{"https://example.com/", ExplicitLevelPermissive, true},
+		{"https://example.com/", ExplicitLevelSubdomains, false},
+		{"www.example.com", ExplicitLevelPermissive, true},
+		// The hostnames also match their subdomains, like in level 1
+		{"api.example.org", ExplicitLevelPermissive, true},
+		{"api.example.org", ExplicitLevelWildcards, false},
+		// Wildcards with more wildcards don't have an apex domain
+		{"example.net", ExplicitLevelPermissive, false},
+		{"example.com.evil.net", ExplicitLevelPermissive, false},
+	}
+	for _, test := range tests {
+		target, err := parseTarget(test.target)
+		checkForErrors(t, err)
+		level := int(test.level)
+		equals(t, test.expected, isInscope(&scopes, prepareTarget(target), &level))
+	}
+	equals(t, true, ExplicitLevelPermissive.isValid())
+	equals(t, false, ExplicitLevel(4).isValid())
+}
+
+// Hostnames aren't case-sensitive, but regexes are, unless --case-insensitive is used
+func Test_isInscope_CaseInsensitive(t *testing.T) {
+	explicitLevel := 1
+	hostname, _ := parseLine("Example.com", true, false)
+	wildcard, _ := parseLine("*.Example.org", true, false)
+	regex, _ := parseLine(`^https://admin\.example\.net/$`, true, false)
+	scopes := []interface{}{hostname, wildcard, regex}
+
+	for _, test := range []struct {
+		target   string
+		expected bool
+	}{
+		{"https://API.EXAMPLE.COM/Path", true},
+		{"Www.Example.Org", true},
+		{"https://ADMIN.example.net/", false},
+	} {
+		target, _ := parseLine(test.target, false, false)
+		equals(t, test.expected, isInscope(&scopes, prepareTarget(target), &explicitLevel))
+	}
+
+	caseInsensitiveRegexes = true
+	defer func() { caseInsensitiveRegexes = false }()
+	regex, _ = parseLine(`^https://admin\.example\.net/$`, true, false)
+	scopes = []interface{}{regex}
+	target, _ := parseLine("https://ADMIN.example.net/", false, false)
+	equals(t, true, isInscope(&scopes, prepareTarget(target), &explicitLevel))
+	equals(t, `^https://admin\.example\.net/$`, scopeToString(regex))
 }
 
 // Try parsing regex
@@ -387,13 +550,13 @@ func Test_isInscope_CIDR_IPv4(t *testing.T) {
 	explicitLevel := 1
 
 	iface = &assetIP
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	iface = &assetURLWithIPHost
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 
 	// Test out-of-scope CIDR. --explicit-level=1
@@ -401,13 +564,13 @@ func Test_isInscope_CIDR_IPv4(t *testing.T) {
 	scopes = []interface{}{cidr}
 
 	iface = &assetIP
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPHost
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 
 	// Test inscope CIDR. --explicit-level=2
@@ -418,13 +581,13 @@ func Test_isInscope_CIDR_IPv4(t *testing.T) {
 	explicitLevel = 2
 
 	iface = &assetIP
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	iface = &assetURLWithIPHost
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 
 	// Test out-of-scope CIDR. --explicit-level=2
@@ -432,13 +595,13 @@ func Test_isInscope_CIDR_IPv4(t *testing.T) {
 	scopes = []interface{}{cidr}
 
 	iface = &assetIP
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPHost
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 
 	// Test inscope CIDR. --explicit-level=3
@@ -449,13 +612,13 @@ func Test_isInscope_CIDR_IPv4(t *testing.T) {
 	explicitLevel = 3
 
 	iface = &assetIP
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPHost
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 
 	// Test out-of-scope CIDR. --explicit-level=3
@@ -463,13 +626,13 @@ func Test_isInscope_CIDR_IPv4(t *testing.T) {
 	scopes = []interface{}{cidr}
 
 	iface = &assetIP
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPHost
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 }
 
@@ -488,13 +651,13 @@ func Test_isInscope_CIDR_IPv6(t *testing.T) {
 	explicitLevel := 1
 
 	iface = &assetIP
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	iface = &assetURLWithIPHost
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 
 	// Test out-of-scope CIDR. --explicit-level=1
@@ -502,13 +665,13 @@ func Test_isInscope_CIDR_IPv6(t *testing.T) {
 	scopes = []interface{}{cidr}
 
 	iface = &assetIP
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPHost
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 
 	// Test inscope CIDR. --explicit-level=2
@@ -519,13 +682,13 @@ func Test_isInscope_CIDR_IPv6(t *testing.T) {
 	explicitLevel = 2
 
 	iface = &assetIP
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	iface = &assetURLWithIPHost
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 
 	// Test out-of-scope CIDR. --explicit-level=2
@@ -533,13 +696,13 @@ func Test_isInscope_CIDR_IPv6(t *testing.T) {
 	scopes = []interface{}{cidr}
 
 	iface = &assetIP
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPHost
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 
 	// Test inscope CIDR. --explicit-level=3
@@ -550,13 +713,13 @@ func Test_isInscope_CIDR_IPv6(t *testing.T) {
 	explicitLevel = 3
 
 	iface = &assetIP
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPHost
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 
 	// Test out-of-scope CIDR. --explicit-level=3
@@ -564,13 +727,13 @@ func Test_isInscope_CIDR_IPv6(t *testing.T) {
 	scopes = []interface{}{cidr}
 
 	iface = &assetIP
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPHost
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 }
 
@@ -595,19 +758,19 @@ func Test_isInscope_URL(t *testing.T) {
 	explicitLevel = 1
 
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv4Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetIPv6
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv6Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 
 	pointerToassetURL, _ = url.Parse("https://unrelatedwebsite.com/path/to/stuff")
@@ -615,19 +778,19 @@ func Test_isInscope_URL(t *testing.T) {
 	// explicitLevel still equals 1
 
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv4Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetIPv6
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv6Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 
 	pointerToassetURL, _ = url.Parse("https://somesubdomain.example.com/path/to/stuff")
@@ -635,19 +798,19 @@ func Test_isInscope_URL(t *testing.T) {
 	// explicitLevel still equals 1
 
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv4Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetIPv6
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv6Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 
 	pointerToassetURL, _ = url.Parse("https://example.com/path/to/stuff")
@@ -655,19 +818,19 @@ func Test_isInscope_URL(t *testing.T) {
 	explicitLevel = 2
 
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv4Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetIPv6
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv6Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result) // Since the scope is still just "https://example.com", this should succeed
 
 	pointerToassetURL, _ = url.Parse("https://somesubdomain.example.com/path/to/stuff")
@@ -675,19 +838,19 @@ func Test_isInscope_URL(t *testing.T) {
 	// explicitLevel = 2
 
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv4Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetIPv6
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv6Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result) // Since the scope is still just "https://example.com", this should fail
 
 	myregex := regexp.MustCompile(`.*\.example.com`)
@@ -695,56 +858,56 @@ func Test_isInscope_URL(t *testing.T) {
 	scopes = []interface{}{regexScope}
 
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv4Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetIPv6
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv6Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result) // Since the scope now has a wildcard, this should succeed.
 
 	explicitLevel = 3
 
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv4Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetIPv6
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv6Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result) // The scope has a wildcard, but in explicitlevel=3 wildcards are ignored. This should fail.
 
 	scope = "somesubdomain.example.com"
 	scopes = []interface{}{scope}
 
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv4Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetIPv6
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURLWithIPv6Host
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	iface = &assetURL
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result) // The scope is now explicit. This should succeed.
 
 	scopeRegex := regexp.MustCompile(`^\w+:\/\/db[0-9][0-9][0-9]\.mycompany\.ec2\.amazonaws\.com.*$`)
@@ -753,19 +916,19 @@ func Test_isInscope_URL(t *testing.T) {
 	assetURL = *pointerToassetURL
 	for explicitLevel = 1; explicitLevel < 3; explicitLevel++ {
 		iface = &assetIPv4
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetURLWithIPv4Host
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetIPv6
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetURLWithIPv6Host
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetURL
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, true, result) // The scope is now explicit. But regex scopes aren't disabled by --explicit-level=3. This should succeed.
 
 	}
@@ -774,19 +937,19 @@ func Test_isInscope_URL(t *testing.T) {
 	assetURL = *pointerToassetURL
 	for explicitLevel = 1; explicitLevel < 3; explicitLevel++ {
 		iface = &assetIPv4
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetURLWithIPv4Host
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetIPv6
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetURLWithIPv6Host
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetURL
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result) // The scope is now explicit. This should fail.
 	}
 
@@ -813,76 +976,76 @@ func Test_isInscope_IP(t *testing.T) {
 		scopes = []interface{}{&scope}
 
 		iface = &assetIPv4
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, true, result)
 		iface = &assetURLWithIPv4Host
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, true, result)
 		iface = &assetIPv6
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetURLWithIPv6Host
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetURL
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 
 		scope = net.ParseIP("192.168.0.2")
 		scopes = []interface{}{&scope}
 
 		iface = &assetIPv4
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetURLWithIPv4Host
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetIPv6
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetURLWithIPv6Host
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetURL
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 
 		scope = net.ParseIP("2001:DB8:0000:0000:0000:0000:0000:0001")
 		scopes = []interface{}{&scope}
 
 		iface = &assetIPv4
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetURLWithIPv4Host
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetIPv6
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, true, result)
 		iface = &assetURLWithIPv6Host
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, true, result)
 		iface = &assetURL
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 
 		scope = net.ParseIP("2001:DB9:0000:0000:0000:0000:0000:0001")
 		scopes = []interface{}{&scope}
 
 		iface = &assetIPv4
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetURLWithIPv4Host
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetIPv6
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetURLWithIPv6Host
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 		iface = &assetURL
-		result = isInscope(&scopes, &iface, &explicitLevel)
+		result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 		equals(t, false, result)
 	}
 
@@ -896,19 +1059,19 @@ func Test_isInscope_IP(t *testing.T) {
 	explicitLevel = 1
 
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	assetIPv4 = net.ParseIP("192.168.0.2")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	assetIPv4 = net.ParseIP("192.168.0.3")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	assetIPv4 = net.ParseIP("192.168.0.5")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 
 	// Test nmap-like input (middle octet)
@@ -922,23 +1085,23 @@ func Test_isInscope_IP(t *testing.T) {
 
 	assetIPv4 = net.ParseIP("192.168.0.1")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	assetIPv4 = net.ParseIP("192.168.2.1")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	assetIPv4 = net.ParseIP("192.168.3.1")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	assetIPv4 = net.ParseIP("192.168.1.2")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	assetIPv4 = net.ParseIP("192.168.2.2")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 
 	// Test nmap-like input (middle octet, with commas)
@@ -952,35 +1115,35 @@ func Test_isInscope_IP(t *testing.T) {
 
 	assetIPv4 = net.ParseIP("192.168.0.1")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	assetIPv4 = net.ParseIP("192.168.2.1")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	assetIPv4 = net.ParseIP("192.168.3.1")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	assetIPv4 = net.ParseIP("192.168.1.2")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	assetIPv4 = net.ParseIP("192.168.2.2")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	assetIPv4 = net.ParseIP("192.168.4.1")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 	assetIPv4 = net.ParseIP("192.168.5.1")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, false, result)
 	assetIPv4 = net.ParseIP("192.168.6.1")
 	iface = &assetIPv4
-	result = isInscope(&scopes, &iface, &explicitLevel)
+	result = isInscope(&scopes, prepareTarget(iface), &explicitLevel)
 	equals(t, true, result)
 
 }
@@ -1001,6 +1164,16 @@ func Example_parseOutOfScopes() {
 	// Output: [33m[WARNING]: Couldn't parse out-of-scope "[38;2;0;204;255mhttps://[33mthis is not even close to a URL" as a URL.[0m
 }
 */
+
+func Test_updateCheckIsEnabled(t *testing.T) {
+	// The update check is opt-in
+	equals(t, false, updateCheckIsEnabled(nil))
+	equals(t, false, updateCheckIsEnabled(map[string]interface{}{"theme": "dark"}))
+	equals(t, false, updateCheckIsEnabled(map[string]interface{}{"update-check": "false"}))
+	equals(t, true, updateCheckIsEnabled(map[string]interface{}{"update-check": "true"}))
+	equals(t, true, updateCheckIsEnabled(map[string]interface{}{"update-check": "True"}))
+}
+
 /*
 func Test_updateFireBountyJSON(t *testing.T) {
 	// This test just verifies if the firebountyAPIURL is still available online, and if the JSON it returns still matches the expected structure.
@@ -1037,3 +1210,2973 @@ func Test_removePortFromHost(t *testing.T) {
 	value := removePortFromHost(testURL)
 	equals(t, "example.com", value)
 }
+
+func Test_readFileLines_Remote(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/targets.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "# comment\nexample.com\n\n  192.168.0.1  \n")
+	}))
+	defer server.Close()
+
+	lines, err := readFileLines(server.URL + "/targets.txt")
+	checkForErrors(t, err)
+	equals(t, []string{"example.com", "192.168.0.1"}, lines)
+
+	_, err = readFileLines(server.URL + "/missing.txt")
+	equals(t, true, err != nil)
+}
+
+func Test_readFileLines_Gzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.txt.gz")
+	f, err := os.Create(path)
+	checkForErrors(t, err)
+	gz := gzip.NewWriter(f)
+	_, err = gz.Write([]byte("example.com\n// comment\nsub.example.com\n"))
+	checkForErrors(t, err)
+	checkForErrors(t, gz.Close())
+	checkForErrors(t, f.Close())
+
+	lines, err := readFileLines(path)
+	checkForErrors(t, err)
+	equals(t, []string{"example.com", "sub.example.com"}, lines)
+
+	// Uncompressed files must keep working
+	path = filepath.Join(t.TempDir(), "targets.txt")
+	checkForErrors(t, os.WriteFile(path, []byte("example.com\n"), 0600))
+	lines, err = readFileLines(path)
+	checkForErrors(t, err)
+	equals(t, []string{"example.com"}, lines)
+}
+
+func Test_resumeState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	// A missing state file means starting from scratch
+	state, err := loadResumeState(path)
+	checkForErrors(t, err)
+	equals(t, &resumeState{}, state)
+
+	state = &resumeState{TargetsFile: "targets.txt", OutputFile: "out.txt", LinesProcessed: 42, OutputSize: 1337}
+	checkForErrors(t, saveResumeState(path, state))
+	loaded, err := loadResumeState(path)
+	checkForErrors(t, err)
+	equals(t, state, loaded)
+}
+
+func Test_numberLines(t *testing.T) {
+	lines := make(chan string, 4)
+	lines <- "a.example.com"
+	lines <- "b.example.com"
+	lines <- "c.example.com"
+	lines <- "d.example.com"
+	close(lines)
+
+	var result []numberedLine
+	for line := range numberLines(lines, 2) {
+		result = append(result, line)
+	}
+	equals(t, []numberedLine{{2, "c.example.com"}, {3, "d.example.com"}}, result)
+}
+
+func Test_parseSampleRate(t *testing.T) {
+	rate, err := parseSampleRate("1%")
+	checkForErrors(t, err)
+	equals(t, 0.01, rate)
+
+	rate, err = parseSampleRate("0.5")
+	checkForErrors(t, err)
+	equals(t, 0.5, rate)
+
+	_, err = parseSampleRate("0%")
+	equals(t, true, err != nil)
+	_, err = parseSampleRate("150%")
+	equals(t, true, err != nil)
+	_, err = parseSampleRate("lots")
+	equals(t, true, err != nil)
+}
+
+func Test_sampleLines_MaxTargets(t *testing.T) {
+	lines := make(chan string, 5)
+	for i := 0; i < 5; i++ {
+		lines <- fmt.Sprintf("%d.example.com", i)
+	}
+	close(lines)
+
+	var result []string
+	for line := range sampleLines(lines, 3, 1) {
+		result = append(result, line)
+	}
+	equals(t, []string{"0.example.com", "1.example.com", "2.example.com"}, result)
+}
+
+func Test_extractRawHTTPRequests(t *testing.T) {
+	rawRequests := []string{
+		"GET /api/v1/users?id=1 HTTP/1.1",
+		"Host: api.example.com",
+		"User-Agent: Mozilla/5.0",
+		"POST /login HTTP/2",
+		"host: example.com:80",
+		"Content-Type: application/x-www-form-urlencoded",
+		"user=admin&password=hunter2",
+		"GET http://proxied.example.com/index.html HTTP/1.1",
+		"Host: proxied.example.com",
+	}
+	lines := make(chan string, len(rawRequests))
+	for _, line := range rawRequests {
+		lines <- line
+	}
+	close(lines)
+
+	var result []string
+	for target := range extractRawHTTPRequests(lines) {
+		result = append(result, target)
+	}
+	equals(t, []string{"https://api.example.com/api/v1/users?id=1", "http://example.com:80/login", "http://proxied.example.com/index.html"}, result)
+}
+
+func Test_extractTargetsFromLine(t *testing.T) {
+	line := `fetch("https://api.example.com/v1/users?id=1"); document.location = "//cdn.example.co.uk:8443/app.js"; // 10.0.0.1, 2001:db8::1 and mail.example.com.`
+	result := extractTargetsFromLine(line)
+	equals(t, []string{"https://api.example.com/v1/users?id=1", "10.0.0.1", "cdn.example.co.uk:8443", "mail.example.com", "2001:db8::1"}, result)
+
+	equals(t, []string(nil), extractTargetsFromLine("nothing to see here, window.alert(1)"))
+}
+
+func Test_parseLine_Target_Email(t *testing.T) {
+	result, err := parseLine("john.doe@mail.example.com", false, false)
+	checkForErrors(t, err)
+	equals(t, &EmailAddress{rawAddress: "john.doe@mail.example.com", domain: "mail.example.com"}, result)
+
+	result, err = parseLine("mailto:admin@example.com", false, false)
+	checkForErrors(t, err)
+	equals(t, &EmailAddress{rawAddress: "mailto:admin@example.com", domain: "example.com"}, result)
+
+	// URLs with userinfo are still URLs
+	result, err = parseLine("https://user@example.com/", false, false)
+	checkForErrors(t, err)
+	_, isURL := result.(*url.URL)
+	equals(t, true, isURL)
+}
+
+func Test_isInscope_Email(t *testing.T) {
+	explicitLevel := 2
+	scopes := []interface{}{"example.com", regexp.MustCompile(`^.*@corp\.example\.org$`)}
+
+	var iface interface{} = &EmailAddress{rawAddress: "john@example.com", domain: "example.com"}
+	equals(t, true, isInscope(&scopes, prepareTarget(iface), &explicitLevel))
+
+	iface = &EmailAddress{rawAddress: "john@sub.example.com", domain: "sub.example.com"}
+	equals(t, false, isInscope(&scopes, prepareTarget(iface), &explicitLevel))
+
+	iface = &EmailAddress{rawAddress: "jane@corp.example.org", domain: "corp.example.org"}
+	equals(t, true, isInscope(&scopes, prepareTarget(iface), &explicitLevel))
+}
+
+func Test_parsePastedScopeTable_Markdown(t *testing.T) {
+	text := `## In scope
+| Target | Type | Bounty |
+|--------|:----:|--------|
+| ` + "`*.example.com`" + ` | Wildcard | Eligible |
+| api.example.com | API | Eligible |
+| 10.0.0.0/8 | CIDR | Ineligible |
+| legacy.example.com | Website | Out of scope |
+
+## Out of scope
+| Target | Type |
+|---|---|
+| blog.example.com | Website |
+`
+	inscopeLines, noscopeLines := parsePastedScopeTable(text)
+	equals(t, []string{"*.example.com", "api.example.com", "10.0.0.0/8"}, inscopeLines)
+	equals(t, []string{"legacy.example.com", "blog.example.com"}, noscopeLines)
+}
+
+func Test_parsePastedScopeTable_HTML(t *testing.T) {
+	text := htmlTablesToText(`<h3>In Scope</h3><table><tr><th>Target</th><th>Type</th></tr>
+<tr><td>https://app.example.com</td><td>Website</td></tr></table>
+<h3>Out of Scope</h3><table><tr><td>status.example.com</td><td>Website</td></tr></table>`)
+	inscopeLines, noscopeLines := parsePastedScopeTable(text)
+	equals(t, []string{"https://app.example.com"}, inscopeLines)
+	equals(t, []string{"status.example.com"}, noscopeLines)
+}
+
+func Test_runScopePlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test plugin is a shell script")
+	}
+
+	pluginPath := filepath.Join(t.TempDir(), "plugin.sh")
+	plugin := `#!/bin/sh
+request=$(cat)
+case "$request" in
+	*'"company":"acme"'*) echo '{"in_scope": ["*.acme.com", " "], "out_of_scope": ["admin.acme.com"]}' ;;
+	*) echo '{"error": "unknown company"}' ;;
+esac
+`
+	checkForErrors(t, os.WriteFile(pluginPath, []byte(plugin), 0700))
+
+	inscopeLines, noscopeLines, err := runScopePlugin(context.Background(), pluginPath, "acme")
+	checkForErrors(t, err)
+	equals(t, []string{"*.acme.com"}, inscopeLines)
+	equals(t, []string{"admin.acme.com"}, noscopeLines)
+
+	_, _, err = runScopePlugin(context.Background(), pluginPath, "initech")
+	equals(t, true, err != nil)
+}
+
+func Test_runScopePlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test plugins are shell scripts")
+	}
+
+	directory := t.TempDir()
+	cacheDirectory := filepath.Join(directory, "plugin-cache")
+	workingPlugin := filepath.Join(directory, "working.sh")
+	flakyPlugin := filepath.Join(directory, "flaky.sh")
+	brokenPlugin := filepath.Join(directory, "broken.sh")
+	checkForErrors(t, os.WriteFile(workingPlugin, []byte("#!/bin/sh\ncat > /dev/null\necho '{\"in_scope\": [\"*.acme.com\"]}'\n"), 0700))
+	checkForErrors(t, os.WriteFile(flakyPlugin, []byte("#!/bin/sh\ncat > /dev/null\n[ -e "+filepath.Join(directory, "down")+" ] && exit 1\necho '{\"in_scope\": [\"acme.org\"], \"out_of_scope\": [\"admin.acme.org\"]}'\n"), 0700))
+	checkForErrors(t, os.WriteFile(brokenPlugin, []byte("#!/bin/sh\necho 'unavailable' >&2\nexit 1\n"), 0700))
+
+	results := runScopePlugins(context.Background(), []string{workingPlugin, flakyPlugin, brokenPlugin}, "acme", cacheDirectory, 0)
+	equals(t, 3, len(results))
+	checkForErrors(t, results[0].err)
+	equals(t, []string{"*.acme.com"}, results[0].inscopeLines)
+	checkForErrors(t, results[1].err)
+	equals(t, []string{"admin.acme.org"}, results[1].noscopeLines)
+	equals(t, true, results[2].err != nil)
+	equals(t, false, results[2].cached)
+
+	// A plugin that fails falls back to the scopes of its last successful run
+	checkForErrors(t, os.WriteFile(filepath.Join(directory, "down"), nil, 0600))
+	results = runScopePlugins(context.Background(), []string{workingPlugin, flakyPlugin}, "acme", cacheDirectory, 0)
+	equals(t, true, results[1].err != nil)
+	equals(t, true, results[1].cached)
+	equals(t, []string{"acme.org"}, results[1].inscopeLines)
+	equals(t, []string{"admin.acme.org"}, results[1].noscopeLines)
+
+	// Plugins with fresh cached scopes aren't run
+	results = runScopePlugins(context.Background(), []string{flakyPlugin}, "acme", cacheDirectory, time.Hour)
+	checkForErrors(t, results[0].err)
+	equals(t, true, results[0].cached)
+	equals(t, []string{"acme.org"}, results[0].inscopeLines)
+
+	// The cache is per company
+	results = runScopePlugins(context.Background(), []string{flakyPlugin}, "initech", cacheDirectory, 0)
+	equals(t, false, results[0].cached)
+}
+
+func Test_cacheTTLFlag(t *testing.T) {
+	defer func() { cacheTTLs = cacheTTLFlag{} }()
+	cacheTTLs = cacheTTLFlag{}
+	equals(t, defaultDatabaseTTL, cacheTTL("firebounty", defaultDatabaseTTL))
+
+	checkForErrors(t, cacheTTLs.Set("6h"))
+	checkForErrors(t, cacheTTLs.Set("plugins=never"))
+	equals(t, 6*time.Hour, cacheTTL("firebounty", defaultDatabaseTTL))
+	equals(t, neverExpires, cacheTTL("plugins", 0))
+	checkForErrors(t, cacheTTLs.Set("firebounty=2d"))
+	equals(t, 48*time.Hour, cacheTTL("firebounty", defaultDatabaseTTL))
+	equals(t, "6h0m0s,firebounty=48h0m0s,plugins=never", cacheTTLs.String())
+
+	equals(t, true, cacheTTLs.Set("hackerone=1h") != nil)
+	equals(t, true, cacheTTLs.Set("soon") != nil)
+
+	equals(t, true, isCacheFresh(time.Now().Add(-time.Hour), 2*time.Hour))
+	equals(t, false, isCacheFresh(time.Now().Add(-time.Hour), 0))
+	equals(t, true, isCacheFresh(time.Now().Add(-1000*time.Hour), neverExpires))
+}
+
+func Test_isInscope_MobileApps(t *testing.T) {
+	defer func() { mobileScopesEnabled = false }()
+	mobileScopesEnabled = true
+	explicitLevel := 1
+
+	var inscopeScopes, noscopeScopes []interface{}
+	for _, line := range []string{"android:com.example.app", "android:com.example.games.*", "https://play.google.com/store/apps/details?id=com.other.App&hl=en", "*.example.com"} {
+		scope, err := parseLine(line, true, false)
+		checkForErrors(t, err)
+		inscopeScopes = append(inscopeScopes, scope)
+	}
+	noscope, err := parseLine("android:com.example.games.beta", true, false)
+	checkForErrors(t, err)
+	noscopeScopes = append(noscopeScopes, noscope)
+	equals(t, "android:com.other.app", scopeToString(inscopeScopes[2]))
+
+	targets := map[string]bool{
+		"com.example.app":         true,
+		"com.example.app:1.2.3":   true,
+		"android:COM.Example.App": true,
+		"https://play.google.com/store/apps/details?id=com.other.app": true,
+		"com.example.games.chess":                                     true,
+		"com.example.games.beta":                                      false,
+		"com.example.games":                                           false,
+		"com.example.application":                                     false,
+		"android:www.example.com":                                     false,
+		"www.example.com":                                             true,
+		"https://play.google.com/apps":                                false,
+	}
+	for line, expected := range targets {
+		target, err := parseLine(line, false, false)
+		checkForErrors(t, err)
+		isInsideScope, _, _, _ := parseScopes(&inscopeScopes, &noscopeScopes, &target, &explicitLevel, &explicitLevel, false)
+		if isInsideScope != expected {
+			t.Errorf("%s: expected %t, got %t", line, expected, isInsideScope)
+		}
+	}
+
+	target, err := parseTarget("com.example.app:1.2.3")
+	checkForErrors(t, err)
+	equals(t, targetComponents{App: "com.example.app", AppVersion: "1.2.3"}, getTargetComponents(target))
+	// Hostnames aren't mistaken for package names
+	target, err = parseTarget("example.com:8080")
+	checkForErrors(t, err)
+	_, isApp := target.(*MobileApp)
+	equals(t, false, isApp)
+
+	// Without --mobile-scopes, package names are parsed as hostnames like before
+	mobileScopesEnabled = false
+	target, err = parseTarget("com.example.app")
+	checkForErrors(t, err)
+	_, isApp = target.(*MobileApp)
+	equals(t, false, isApp)
+}
+
+func Test_isInscope_IOSApps(t *testing.T) {
+	lookups := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		switch r.URL.Query().Get("id") {
+		case "111":
+			w.Write([]byte(`{"resultCount":1,"results":[{"trackId":111,"bundleId":"com.Example.iPhone"}]}`))
+		case "222":
+			w.Write([]byte(`{"resultCount":1,"results":[{"trackId":222,"bundleId":"com.other.app"}]}`))
+		default:
+			w.Write([]byte(`{"resultCount":0,"results":[]}`))
+		}
+	}))
+	defer server.Close()
+	originalLookupURL := appStoreLookupURL
+	defer func() {
+		mobileScopesEnabled = false
+		appStoreLookupURL = originalLookupURL
+		bundleIDCache = map[string]*bundleIDLookup{}
+	}()
+	mobileScopesEnabled = true
+	appStoreLookupURL = server.URL
+	explicitLevel := 1
+
+	var inscopeScopes, noscopeScopes []interface{}
+	for _, line := range []string{"https://apps.apple.com/us/app/example/id111", "ios:com.other.app", "android:com.android.only"} {
+		scope, err := parseLine(line, true, false)
+		checkForErrors(t, err)
+		inscopeScopes = append(inscopeScopes, scope)
+	}
+
+	targets := map[string]bool{
+		"ios:com.example.iphone":                         true,
+		"com.example.iphone":                             true,
+		"android:com.example.iphone":                     false,
+		"https://apps.apple.com/gb/app/other-name/id111": true,
+		"apps.apple.com/app/id222":                       true,
+		"https://apps.apple.com/app/id333":               false,
+		"ios:com.android.only":                           false,
+		"com.android.only":                               true,
+	}
+	for line, expected := range targets {
+		target, err := parseLine(line, false, false)
+		checkForErrors(t, err)
+		isInsideScope, _, _, _ := parseScopes(&inscopeScopes, &noscopeScopes, &target, &explicitLevel, &explicitLevel, false)
+		if isInsideScope != expected {
+			t.Errorf("%s: expected %t, got %t", line, expected, isInsideScope)
+		}
+	}
+	// Every App Store ID is only looked up once
+	equals(t, 3, lookups)
+
+	// Programs that list their iOS apps by store link
+	lines := mobileScopeLines([]Scope{{Scope: "apps.apple.com/us/app/example/id111", Scope_type: "ios_application"}, {Scope: "com.example.*", Scope_type: "ios_application"}})
+	equals(t, []string{"https://apps.apple.com/us/app/example/id111", "ios:com.example.*"}, lines)
+
+	// With --offline, App Store URLs are only matched by their App Store ID
+	offlineMode = true
+	defer func() { offlineMode = false }()
+	bundleIDCache = map[string]*bundleIDLookup{}
+	app := parseMobileAppTarget("https://apps.apple.com/app/id222")
+	equals(t, &MobileApp{platform: "ios", storeID: "222"}, app)
+	equals(t, "https://apps.apple.com/app/id222", app.String())
+}
+
+func Test_lookupBundleID_Concurrent(t *testing.T) {
+	var lookups atomic.Int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		if r.URL.Query().Get("id") == "111" {
+			<-release
+		}
+		w.Write([]byte(`{"resultCount":1,"results":[{"bundleId":"com.example.app` + r.URL.Query().Get("id") + `"}]}`))
+	}))
+	defer server.Close()
+	originalLookupURL := appStoreLookupURL
+	defer func() {
+		mobileScopesEnabled = false
+		appStoreLookupURL = originalLookupURL
+		appStoreLookupContext = context.Background()
+		bundleIDCache = map[string]*bundleIDLookup{}
+	}()
+	mobileScopesEnabled = true
+	appStoreLookupURL = server.URL
+
+	// The workers that need the same App Store ID wait for the first lookup
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			equals(t, "com.example.app111", lookupBundleID("111"))
+		}()
+	}
+	// While the other App Store IDs don't wait for it
+	equals(t, "com.example.app222", lookupBundleID("222"))
+	close(release)
+	wg.Wait()
+	equals(t, int64(2), lookups.Load())
+
+	// The lookups stop with the context of the run
+	originalStderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = originalStderr }()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	appStoreLookupContext = ctx
+	equals(t, "", lookupBundleID("333"))
+}
+
+func Test_isInscope_Repositories(t *testing.T) {
+	defer func() { repoScopesEnabled = false }()
+	repoScopesEnabled = true
+	explicitLevel := 1
+
+	var inscopeScopes, noscopeScopes []interface{}
+	for _, line := range []string{"https://github.com/Example/App", "github.com/example-labs", "https://gitlab.com/example/backend/*", "*.example.com"} {
+		scope, err := parseLine(line, true, false)
+		checkForErrors(t, err)
+		inscopeScopes = append(inscopeScopes, scope)
+	}
+	noscope, err := parseLine("https://github.com/example-labs/secret", true, false)
+	checkForErrors(t, err)
+	noscopeScopes = append(noscopeScopes, noscope)
+	equals(t, "https://github.com/example-labs/*", scopeToString(inscopeScopes[1]))
+
+	targets := map[string]bool{
+		"https://github.com/example/app":                            true,
+		"https://www.github.com/example/app/blob/main/README.md":    true,
+		"git@github.com:example/app.git":                            true,
+		"example/app":                                               true,
+		"example/other":                                             false,
+		"https://github.com/example-labs/tool":                      true,
+		"https://github.com/example-labs/secret/issues":             false,
+		"https://gitlab.com/example/backend/api/-/blob/main/go.mod": true,
+		"https://gitlab.com/example/app":                            false,
+		"https://gitlab.com/example/app/-/tree/main":                false,
+		"https://github.com/example":                                false,
+		"https://www.example.com/login":                             true,
+		"www.example.com/login":                                     true,
+	}
+	for line, expected := range targets {
+		target, err := parseLine(line, false, false)
+		checkForErrors(t, err)
+		isInsideScope, _, _, _ := parseScopes(&inscopeScopes, &noscopeScopes, &target, &explicitLevel, &explicitLevel, false)
+		if isInsideScope != expected {
+			t.Errorf("%s: expected %t, got %t", line, expected, isInsideScope)
+		}
+	}
+
+	target, err := parseTarget("https://github.com/Example/App/pulls")
+	checkForErrors(t, err)
+	equals(t, targetComponents{Host: "github.com", Repo: "example/app"}, getTargetComponents(target))
+
+	// Without --repo-scopes, repository URLs are parsed as URLs like before
+	repoScopesEnabled = false
+	target, err = parseTarget("https://github.com/example/app")
+	checkForErrors(t, err)
+	_, isRepo := target.(*Repository)
+	equals(t, false, isRepo)
+}
+
+func Test_isInscope_Contracts(t *testing.T) {
+	defer func() { contractScopesEnabled = false }()
+	contractScopesEnabled = true
+	explicitLevel := 1
+
+	// Test vectors of EIP-55
+	for _, address := range []string{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359", "0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb"} {
+		equals(t, address, checksumAddress(strings.ToLower(address[2:])))
+		equals(t, true, hasValidChecksum(address))
+	}
+	equals(t, false, hasValidChecksum("0x5AAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"))
+
+	var inscopeScopes, noscopeScopes []interface{}
+	for _, line := range []string{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", "https://polygonscan.com/address/0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359", "eip155:42161:0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb", "*.example.com"} {
+		scope, err := parseLine(line, true, false)
+		checkForErrors(t, err)
+		inscopeScopes = append(inscopeScopes, scope)
+	}
+	equals(t, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", scopeToString(inscopeScopes[0]))
+	equals(t, "eip155:137:0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359", scopeToString(inscopeScopes[1]))
+
+	targets := map[string]bool{
+		"0x5AAEB6053F3E94C9B9A09F33669435E7EF1BEAED":                             true,
+		"bsc:0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed":                         true,
+		"polygon:0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359":                     true,
+		"eip155:137:0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359":                  true,
+		"ethereum:0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359":                    false,
+		"0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359":                             true,
+		"https://arbiscan.io/address/0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb": true,
+		"https://etherscan.io/token/0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb":  false,
+		"0x0000000000000000000000000000000000000001":                             false,
+		"www.example.com":       true,
+		"https://etherscan.io/": false,
+	}
+	for line, expected := range targets {
+		target, err := parseLine(line, false, false)
+		checkForErrors(t, err)
+		isInsideScope, _, _, _ := parseScopes(&inscopeScopes, &noscopeScopes, &target, &explicitLevel, &explicitLevel, false)
+		if isInsideScope != expected {
+			t.Errorf("%s: expected %t, got %t", line, expected, isInsideScope)
+		}
+	}
+
+	target, err := parseTarget("matic:0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359")
+	checkForErrors(t, err)
+	equals(t, targetComponents{Chain: "137", Contract: "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359"}, getTargetComponents(target))
+}
+
+func Test_compileFilterExpr(t *testing.T) {
+	env := &filterEnvironment{target: "https://api.example.gov:8443/login", host: "api.example.gov", port: 8443, scheme: "https", path: "/login", verdict: "inscope", rule: "*.example.gov"}
+
+	expressions := map[string]bool{
+		`host endsWith ".gov"`:                           true,
+		`!(host endsWith ".gov")`:                        false,
+		`port == 8443 && scheme == 'https'`:              true,
+		`port < 1000 || path startsWith "/admin"`:        false,
+		`host matches "^api\\."`:                         true,
+		`rule contains "example" && verdict != "unsure"`: true,
+		`unsure == false`:                                true,
+	}
+	for source, expected := range expressions {
+		expr, err := compileFilterExpr(source)
+		checkForErrors(t, err)
+		equals(t, expected, expr.evaluate(env))
+	}
+
+	// Invalid expressions must be rejected when compiling
+	for _, source := range []string{`host`, `port == "80"`, `hostname == "a"`, `(host == "a"`, `host == "a`, `host matches path`} {
+		_, err := compileFilterExpr(source)
+		equals(t, true, err != nil)
+	}
+}
+
+func Test_findMatchingScope(t *testing.T) {
+	explicitLevel := 1
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/8")
+	scopes := []interface{}{"example.com", cidr}
+
+	target, _ := parseLine("https://10.1.2.3/admin", false, false)
+	equals(t, cidr, findMatchingScope(&scopes, prepareTarget(target), &explicitLevel))
+	equals(t, "10.0.0.0/8", scopeToString(findMatchingScope(&scopes, prepareTarget(target), &explicitLevel)))
+
+	target, _ = parseLine("unrelated.org", false, false)
+	equals(t, nil, findMatchingScope(&scopes, prepareTarget(target), &explicitLevel))
+
+	wildcard, _ := parseLine("*.example.com", true, false)
+	equals(t, "*.example.com", scopeToString(wildcard))
+}
+
+func Test_loadRawProgramByIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "firebounty.json")
+	database := `{"pgms": [
+		{"name": "Acme", "slug": "acme", "tag": "hackerone", "scopes": {"in_scopes": [{"scope": "*.acme.com", "scope_type": "web_application"}], "out_of_scopes": []}},
+		{"name": "Initech", "slug": "initech", "tag": "bugcrowd", "updated": "2024-01-01", "scopes": {"in_scopes": [], "out_of_scopes": []}}
+	]}`
+	checkForErrors(t, os.WriteFile(path, []byte(database), 0600))
+
+	rawProgram, err := loadRawProgramByIndex(path, 1)
+	checkForErrors(t, err)
+	equals(t, `{"name": "Initech", "slug": "initech", "tag": "bugcrowd", "updated": "2024-01-01", "scopes": {"in_scopes": [], "out_of_scopes": []}}`, string(rawProgram))
+
+	prog, err := loadProgramByIndex(path, 0)
+	checkForErrors(t, err)
+	equals(t, "acme", prog.Slug)
+	equals(t, []Scope{{Scope: "*.acme.com", Scope_type: "web_application"}}, prog.Scopes.In_scopes)
+
+	_, err = loadRawProgramByIndex(path, 2)
+	equals(t, true, err != nil)
+}
+
+func Test_parseAge(t *testing.T) {
+	age, err := parseAge("30d")
+	checkForErrors(t, err)
+	equals(t, 30*24*time.Hour, age)
+
+	age, err = parseAge("2w")
+	checkForErrors(t, err)
+	equals(t, 14*24*time.Hour, age)
+
+	age, err = parseAge("90m")
+	checkForErrors(t, err)
+	equals(t, 90*time.Minute, age)
+
+	_, err = parseAge("soon")
+	equals(t, true, err != nil)
+}
+
+func Test_summarizeProgram(t *testing.T) {
+	summary, err := summarizeProgram([]byte(`{"name": " Acme ", "slug": "acme", "tag": "hackerone", "updated_at": "2024-05-01T10:00:00Z", "scopes": {"in_scopes": [{"scope": "*.acme.com"}, {"scope": "acme.io"}], "out_of_scopes": [{"scope": "blog.acme.com"}]}}`))
+	checkForErrors(t, err)
+	equals(t, "Acme", summary.Name)
+	equals(t, 2, summary.InScopes)
+	equals(t, 1, summary.OutOfScopes)
+	equals(t, "2024-05-01 10:00:00", summary.LastUpdated)
+
+	summary, err = summarizeProgram([]byte(`{"name": "Initech", "tag": "bugcrowd"}`))
+	checkForErrors(t, err)
+	equals(t, true, summary.lastUpdatedAt.IsZero())
+}
+
+func Test_getDatabaseInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "firebounty.json")
+	database := `{"pgms": [
+		{"name": "Acme", "scopes": {"in_scopes": [{"scope": "*.acme.com"}, {"scope": "acme.io"}], "out_of_scopes": [{"scope": "blog.acme.com"}]}},
+		{"name": "Initech", "scopes": {"in_scopes": [{"scope": "initech.com"}], "out_of_scopes": []}}
+	]}`
+	checkForErrors(t, os.WriteFile(path, []byte(database), 0600))
+
+	info, err := getDatabaseInfo(path)
+	checkForErrors(t, err)
+	equals(t, 2, info.Programs)
+	equals(t, 3, info.InScopes)
+	equals(t, 1, info.OutOfScopes)
+	equals(t, int64(len(database)), info.Size)
+	digest := sha256.Sum256([]byte(database))
+	equals(t, hex.EncodeToString(digest[:]), info.SHA256)
+
+	_, err = getDatabaseInfo(filepath.Join(t.TempDir(), "missing.json"))
+	equals(t, true, os.IsNotExist(err))
+}
+
+func Test_setupDatabaseSnapshot(t *testing.T) {
+	defer func(previousPath string, previousChainMode bool) {
+		firebountyJSONPath, chainMode = previousPath, previousChainMode
+		databaseSnapshotPath, databaseSnapshotDigest = "", ""
+	}(firebountyJSONPath, chainMode)
+	chainMode = true
+
+	databaseSnapshotPath = filepath.Join(t.TempDir(), "snapshot.json")
+	checkForErrors(t, os.WriteFile(databaseSnapshotPath, []byte(`{"pgms": []}`), 0600))
+	firebountyJSONPath = ""
+	setupFirebountyJSONPath()
+	equals(t, databaseSnapshotPath, firebountyJSONPath)
+	equals(t, "sha256:cce588118edfea9c22e735ba98378ceea6ff869d8fc077a4e4fb460b0e3abd9d", databaseSnapshotDigest)
+
+	// The snapshot is recorded in the JSON output
+	var result map[string]interface{}
+	checkForErrors(t, json.Unmarshal([]byte(formatJSONResult(jsonResult{Type: "inscope", Asset: "a.example.com", Database: databaseSnapshotDigest})), &result))
+	equals(t, databaseSnapshotDigest, result["database"])
+}
+
+func Test_lockDatabase(t *testing.T) {
+	jsonPath := filepath.Join(t.TempDir(), "firebounty.json")
+
+	checkForErrors(t, lockDatabase(context.Background(), jsonPath))
+	_, err := os.Stat(jsonPath + ".lock")
+	checkForErrors(t, err)
+
+	unlockDatabase()
+	_, err = os.Stat(jsonPath + ".lock")
+	equals(t, true, os.IsNotExist(err))
+
+	// Stale lock files left behind by crashed processes are ignored
+	checkForErrors(t, os.WriteFile(jsonPath+".lock", []byte("1234"), 0600))
+	old := time.Now().Add(-2 * databaseLockStaleAfter)
+	checkForErrors(t, os.Chtimes(jsonPath+".lock", old, old))
+	checkForErrors(t, lockDatabase(context.Background(), jsonPath))
+	unlockDatabase()
+
+	// Waiting for the lock of another process stops when the context is cancelled
+	checkForErrors(t, os.WriteFile(jsonPath+".lock", []byte("1234"), 0600))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	equals(t, context.DeadlineExceeded, lockDatabase(ctx, jsonPath))
+}
+
+func Test_expandOutputFilename(t *testing.T) {
+	now := time.Date(2024, time.March, 5, 10, 0, 0, 0, time.UTC)
+
+	equals(t, "results/google-2024-03-05.txt", expandOutputFilename("results/{company}-{date}.txt", "Google", now))
+	equals(t, "at-t-inc.txt", expandOutputFilename("{company}.txt", "AT&T Inc", now))
+	equals(t, "custom.txt", expandOutputFilename("{company}.txt", "", now))
+	equals(t, "output.txt", expandOutputFilename("output.txt", "google", now))
+}
+
+func Test_asyncWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer := newAsyncWriter(&buf, 0, 0)
+
+	_, err := writer.WriteString("a.example.com\n")
+	checkForErrors(t, err)
+	checkForErrors(t, writer.Flush())
+	equals(t, "a.example.com\n", buf.String())
+
+	_, err = writer.WriteString("b.example.com\n")
+	checkForErrors(t, err)
+	checkForErrors(t, writer.Close())
+	equals(t, "a.example.com\nb.example.com\n", buf.String())
+}
+
+func Test_stringListFlag(t *testing.T) {
+	var scopes stringListFlag
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.SetOutput(io.Discard)
+	flagSet.Var(&scopes, "scope", "")
+
+	checkForErrors(t, flagSet.Parse([]string{"--scope", "*.example.com", "--scope", " 10.0.0.0/8 "}))
+	equals(t, stringListFlag{"*.example.com", "10.0.0.0/8"}, scopes)
+
+	err := flagSet.Parse([]string{"--scope", ""})
+	equals(t, true, err != nil)
+}
+
+func Test_readFileLines_stdin(t *testing.T) {
+	stdinFile := filepath.Join(t.TempDir(), "stdin.txt")
+	checkForErrors(t, os.WriteFile(stdinFile, []byte("*.example.com\n# comment\n10.0.0.0/8\n"), 0600))
+	fakeStdin, err := os.Open(stdinFile)
+	checkForErrors(t, err)
+	defer fakeStdin.Close()
+
+	realStdin := os.Stdin
+	os.Stdin = fakeStdin
+	defer func() { os.Stdin = realStdin }()
+
+	lines, err := readFileLines(stdinPath)
+	checkForErrors(t, err)
+	equals(t, []string{"*.example.com", "10.0.0.0/8"}, lines)
+}
+
+func Test_splitScopeComment(t *testing.T) {
+	scope, comment := splitScopeComment("*.example.com # Main website")
+	equals(t, "*.example.com", scope)
+	equals(t, "Main website", comment)
+
+	// URL fragments aren't comments
+	scope, comment = splitScopeComment("https://example.com/#/app")
+	equals(t, "https://example.com/#/app", scope)
+	equals(t, "", comment)
+
+	// Escaped hashes are kept as literals
+	scope, comment = splitScopeComment("^example\\.com/\\#anchor$ #Regex")
+	equals(t, "^example\\.com/#anchor$", scope)
+	equals(t, "Regex", comment)
+}
+
+func Test_parseAllLines_comments(t *testing.T) {
+	scopes, err := parseAllLines([]string{"example.com # Main website"}, true, false, nil)
+	checkForErrors(t, err)
+	equals(t, []interface{}{"example.com"}, scopes)
+	equals(t, "Main website", scopeDetails[scopes[0]].Description)
+
+	// The details of the line are kept, and the comment is added to them
+	scopes, err = parseAllLines([]string{"10.0.0.0/8 # VPN"}, true, false, map[string]ruleDetails{"10.0.0.0/8": {Tags: []string{"internal"}}})
+	checkForErrors(t, err)
+	equals(t, ruleDetails{Description: "VPN", Tags: []string{"internal"}}, scopeDetails[scopes[0]])
+}
+
+func Test_formatResults(t *testing.T) {
+	equals(t, `{"type":"inscope","asset":"a.example.com","rule":"*.example.com","description":"Main website"}`, formatJSONResult(jsonResult{Type: "inscope", Asset: "a.example.com", Rule: "*.example.com", Description: "Main website"}))
+	equals(t, `{"type":"unsure","asset":"b.example.org","signals":["cname:cdn.example.com"]}`, formatJSONResult(jsonResult{Type: "unsure", Asset: "b.example.org", Signals: []string{"cname:cdn.example.com"}}))
+	equals(t, `{"type":"inscope","asset":"10.0.0.1","rule":"10.0.0.0/8","ports":[443],"tags":["vpn"],"max_severity":"high"}`, formatJSONResult(jsonResult{Type: "inscope", Asset: "10.0.0.1", Rule: "10.0.0.0/8", Ports: []int{443}, Tags: []string{"vpn"}, MaxSeverity: "high"}))
+
+	target, _ := parseLine("https://a.example.com:8443/login", false, false)
+	components := getTargetComponents(target)
+	equals(t, `{"type":"inscope","asset":"https://a.example.com:8443/login","parsed":{"scheme":"https","host":"a.example.com","port":"8443","path":"/login"}}`, formatJSONResult(jsonResult{Type: "inscope", Asset: "https://a.example.com:8443/login", Parsed: &components}))
+	equals(t, `inscope,a.example.com,*.example.com,"Main website, production"`, formatCSVLine("inscope", "a.example.com", "*.example.com", "Main website, production"))
+	equals(t, "[*.example.com # Main website]", formatRule("*.example.com", "Main website", nil))
+	equals(t, "[*.example.com]", formatRule("*.example.com", "", nil))
+	equals(t, "[*.example.com # Main website, from Example, .inscope]", formatRule("*.example.com", "Main website", []string{"Example", ".inscope"}))
+	equals(t, "[*.example.com # from Example]", formatRule("*.example.com", "", []string{"Example"}))
+}
+
+func Test_parseScopeBundle(t *testing.T) {
+	bundle, err := parseScopeBundle(`# Scope bundle
+program:
+  name: Example
+  platform: hackerone
+  url: https://hackerone.com/example
+notes: |
+  Don't test the payment flow.
+    # Not a comment
+
+  Use the X-Bug-Bounty header.
+in_scope:
+  - "*.example.com"
+  - scope: api.example.com # The public API
+    description: 'Public API: v2'
+    ports: [443, 8443]
+    tags: [api, "production"]
+    max_severity: high
+out_of_scope:
+- scope: internal.example.com
+  description: Staff only
+`)
+	checkForErrors(t, err)
+
+	equals(t, scopeBundleProgram{Name: "Example", Platform: "hackerone", URL: "https://hackerone.com/example"}, bundle.Program)
+	equals(t, "Don't test the payment flow.\n  # Not a comment\n\nUse the X-Bug-Bounty header.\n", bundle.Notes)
+	equals(t, []scopeBundleEntry{
+		{Scope: "*.example.com"},
+		{Scope: "api.example.com", Details: ruleDetails{Description: "Public API: v2", Ports: []int{443, 8443}, Tags: []string{"api", "production"}, MaxSeverity: "high"}},
+	}, bundle.InScope)
+	equals(t, []scopeBundleEntry{{Scope: "internal.example.com", Details: ruleDetails{Description: "Staff only"}}}, bundle.OutOfScope)
+
+	inscopeLines, noscopeLines, lineDetails := bundle.scopeLines()
+	equals(t, []string{"*.example.com", "api.example.com"}, inscopeLines)
+	equals(t, []string{"internal.example.com"}, noscopeLines)
+	equals(t, "Staff only", lineDetails["internal.example.com"].Description)
+
+	// Invalid bundles
+	_, err = parseScopeBundle("in_scope:\n  - scope: example.com\n    ports: [http]\n")
+	equals(t, true, err != nil)
+	_, err = parseScopeBundle("program:\n  name: Example\n")
+	equals(t, true, err != nil)
+	_, err = parseScopeBundle("in_scope:\n  - example.com\n - example.org\n")
+	equals(t, true, err != nil)
+}
+
+func Test_writeScopeBundle(t *testing.T) {
+	prog := &Program{Firebounty_url: "https://firebounty.com/example", Tag: "hackerone", Url: "https://hackerone.com/example", Name: "Example"}
+	prog.Scopes.In_scopes = []Scope{{Scope: "*.example.com", Scope_type: "web_application"}, {Scope: "com.example.app", Scope_type: "android_application"}}
+	prog.Scopes.Out_of_scopes = []Scope{{Scope: "internal.example.com", Scope_type: "web_application"}}
+	bundle := programToScopeBundle(prog)
+	bundle.InScope[0].Details = ruleDetails{Description: "Main \"website\"", Ports: []int{443}, Tags: []string{"web"}, MaxSeverity: "critical"}
+
+	var buf bytes.Buffer
+	checkForErrors(t, writeScopeBundle(&buf, bundle))
+
+	// The exported bundle can be loaded again
+	parsed, err := parseScopeBundle(buf.String())
+	checkForErrors(t, err)
+	equals(t, bundle, parsed)
+}
+
+func Test_applyProfile(t *testing.T) {
+	settings, err := parseProfile(`company: acme
+inscope-explicit-level: 2
+include-unsure: true
+scope: ["*.acme.com", 10.0.0.0/8]
+`)
+	checkForErrors(t, err)
+
+	var company string
+	var explicitLevel int
+	var includeUnsure bool
+	var scopes stringListFlag
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.StringVar(&company, "c", "", "")
+	flagSet.StringVar(&company, "company", "", "")
+	flagSet.IntVar(&explicitLevel, "inscope-explicit-level", 1, "")
+	flagSet.BoolVar(&includeUnsure, "include-unsure", false, "")
+	flagSet.Var(&scopes, "scope", "")
+
+	// Arguments given on the command line take precedence, even when they're given with an alias
+	checkForErrors(t, flagSet.Parse([]string{"-c", "google"}))
+	checkForErrors(t, applyProfile(flagSet, settings))
+	equals(t, "google", company)
+	equals(t, 2, explicitLevel)
+	equals(t, true, includeUnsure)
+	equals(t, stringListFlag{"*.acme.com", "10.0.0.0/8"}, scopes)
+
+	err = applyProfile(flagSet, map[string][]string{"not-an-argument": {"1"}})
+	equals(t, true, err != nil)
+}
+
+func Test_recordCompanySelection(t *testing.T) {
+	historyPath := filepath.Join(t.TempDir(), "history.json")
+
+	history, err := loadCompanyHistory(historyPath)
+	checkForErrors(t, err)
+	equals(t, 0, len(history))
+
+	for i := 0; i < companyHistorySize+5; i++ {
+		checkForErrors(t, recordCompanySelection(historyPath, companySelection{Query: "company" + strconv.Itoa(i), Companies: []string{"company"}}))
+	}
+	// Selecting the same query again moves it to the top instead of duplicating it
+	checkForErrors(t, recordCompanySelection(historyPath, companySelection{Query: "company13", Companies: []string{"company 13", "company 13 vdp"}}))
+
+	history, err = loadCompanyHistory(historyPath)
+	checkForErrors(t, err)
+	equals(t, companyHistorySize, len(history))
+	equals(t, "company13", history[0].Query)
+	equals(t, []string{"company 13", "company 13 vdp"}, history[0].Companies)
+	equals(t, "company14", history[1].Query)
+	equals(t, "company12", history[2].Query)
+}
+
+func Test_parseProjectMarker(t *testing.T) {
+	marker, err := parseProjectMarker("slug: example # Pinned for the Q3 engagement\n", "/engagements/example")
+	checkForErrors(t, err)
+	equals(t, &projectMarker{Slug: "example"}, marker)
+
+	// Relative scope bundle paths are relative to the directory of the marker
+	marker, err = parseProjectMarker("scope-bundle: scopes/program.yaml\n", "/engagements/example")
+	checkForErrors(t, err)
+	equals(t, filepath.Join("/engagements/example", "scopes/program.yaml"), marker.ScopeBundle)
+
+	_, err = parseProjectMarker("slug: example\nscope-bundle: program.yaml\n", "/engagements/example")
+	equals(t, true, err != nil)
+	_, err = parseProjectMarker("company: example\n", "/engagements/example")
+	equals(t, true, err != nil)
+}
+
+func Test_findCompanyBySlug(t *testing.T) {
+	jsonPath := filepath.Join(t.TempDir(), "firebounty.json")
+	checkForErrors(t, os.WriteFile(jsonPath, []byte(`{"pgms":[{"name":"Example","slug":"example"},{"name":"Example VDP","slug":"example-vdp"}]}`), 0600))
+
+	index, err := findCompanyBySlug(jsonPath, "example-vdp")
+	checkForErrors(t, err)
+	equals(t, 1, index)
+
+	_, err = findCompanyBySlug(jsonPath, "missing")
+	equals(t, true, err != nil)
+}
+
+func Test_closestFile(t *testing.T) {
+	equals(t, "/a/b/.inscope", closestFile("/a/.hacker-scoper", "/a/b/.inscope"))
+	equals(t, "/a/b/.hacker-scoper", closestFile("/a/b/.hacker-scoper", "/a/b/.inscope"))
+	equals(t, "/a/.hacker-scoper", closestFile("/a/.hacker-scoper", ""))
+	equals(t, "", closestFile("", ""))
+}
+
+func Test_enricher(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/favicon.ico" {
+			fmt.Fprint(w, "favicon")
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	// The certificate of httptest servers is valid for example.com
+	scopes := []interface{}{"example.com"}
+	explicitLevel := 1
+	leadEnricher, err := newEnricher("tls,favicon", &scopes, &explicitLevel, &dnsClient{}, 10)
+	checkForErrors(t, err)
+	leadEnricher.faviconReferenceURLs = []string{server.URL + "/favicon.ico"}
+
+	target, err := parseLine(server.URL+"/login", false, false)
+	checkForErrors(t, err)
+	serverURL, err := url.Parse(server.URL)
+	checkForErrors(t, err)
+	equals(t, []string{"tls-san:example.com", "favicon:" + serverURL.Host}, leadEnricher.enrich(context.Background(), target))
+
+	_, err = newEnricher("cname,whois", &scopes, &explicitLevel, &dnsClient{}, 10)
+	equals(t, true, err != nil)
+}
+
+func Test_rankLeads(t *testing.T) {
+	leads := []targetResult{
+		{targetStr: "a.example.org"},
+		{targetStr: "b.example.org", signals: []string{"cname:cdn.example.com", "tls-san:example.com"}},
+		{targetStr: "c.example.org", signals: []string{"favicon:example.com"}},
+		{targetStr: "d.example.org"},
+	}
+	rankLeads(leads)
+
+	var ranked []string
+	for _, lead := range leads {
+		ranked = append(ranked, lead.targetStr)
+	}
+	equals(t, []string{"b.example.org", "c.example.org", "a.example.org", "d.example.org"}, ranked)
+}
+
+// answerTestDNSQuery answers a DNS query with the CNAME and A records of the given records, if there are any.
+// The A records can be wildcards, like "*.example.com".
+func answerTestDNSQuery(packedQuery []byte, cnames map[string]string, addresses map[string]string) ([]byte, error) {
+	var query dnsmessage.Message
+	err := query.Unpack(packedQuery)
+	if err != nil {
+		return nil, err
+	}
+	response := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionAvailable: true},
+		Questions: query.Questions,
+	}
+	for _, question := range query.Questions {
+		hostname := strings.TrimSuffix(question.Name.String(), ".")
+		if target, found := cnames[hostname]; found && question.Type == dnsmessage.TypeCNAME {
+			response.Answers = append(response.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(target + ".")},
+			})
+		}
+		if question.Type != dnsmessage.TypeA {
+			continue
+		}
+		address, found := addresses[hostname]
+		if _, parent, hasParent := strings.Cut(hostname, "."); !found && hasParent {
+			address, found = addresses["*."+parent]
+		}
+		if found {
+			response.Answers = append(response.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.AResource{A: [4]byte(net.ParseIP(address).To4())},
+			})
+		}
+	}
+	return response.Pack()
+}
+
+// startTestDNSServer starts a UDP DNS server that answers with the given records like answerTestDNSQuery, and returns its address.
+// The amount of queries received is counted in the given counter.
+func startTestDNSServer(t *testing.T, cnames map[string]string, addresses map[string]string, queries *atomic.Int32) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	checkForErrors(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			queries.Add(1)
+			packed, err := answerTestDNSQuery(buf[:n], cnames, addresses)
+			if err == nil {
+				conn.WriteTo(packed, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func Test_cnameChain(t *testing.T) {
+	server := startTestDNSServer(t, map[string]string{
+		"vanity.example.org": "edge.example.net",
+		"edge.example.net":   "app.example.com",
+		"loop1.example.org":  "loop2.example.org",
+		"loop2.example.org":  "loop1.example.org",
+		"staff.example.org":  "internal.example.com",
+	}, nil, &atomic.Int32{})
+	client := &dnsClient{resolvers: []dnsResolver{{network: "udp", address: server}}, timeout: 2 * time.Second}
+
+	equals(t, []string{"edge.example.net", "app.example.com"}, client.cnameChain(context.Background(), "vanity.example.org", 10))
+	equals(t, []string{"edge.example.net"}, client.cnameChain(context.Background(), "vanity.example.org", 1))
+	equals(t, []string{"loop2.example.org"}, client.cnameChain(context.Background(), "loop1.example.org", 10))
+	equals(t, 0, len(client.cnameChain(context.Background(), "app.example.com", 10)))
+
+	inscopeScopes := []interface{}{"example.com"}
+	noscopeScopes := []interface{}{"internal.example.com"}
+	inscopeLevel, noscopeLevel := 1, 2
+
+	target, err := parseLine("https://vanity.example.org/login", false, false)
+	checkForErrors(t, err)
+	chain, matchedScope := parseScopesThroughCNAMEs(context.Background(), client, 10, &inscopeScopes, &noscopeScopes, &target, &inscopeLevel, &noscopeLevel)
+	equals(t, []string{"edge.example.net", "app.example.com"}, chain)
+	equals(t, "example.com", matchedScope)
+
+	// Out-of-scope hostnames stop the chain
+	target, err = parseLine("staff.example.org", false, false)
+	checkForErrors(t, err)
+	_, matchedScope = parseScopesThroughCNAMEs(context.Background(), client, 10, &inscopeScopes, &noscopeScopes, &target, &inscopeLevel, &noscopeLevel)
+	equals(t, nil, matchedScope)
+}
+
+func Test_dnsClientCache(t *testing.T) {
+	var queries atomic.Int32
+	server := startTestDNSServer(t, map[string]string{"vanity.example.org": "app.example.com"}, nil, &queries)
+	client, err := newDNSClient("", 2*time.Second)
+	checkForErrors(t, err)
+	client.resolvers = []dnsResolver{{network: "udp", address: server}}
+
+	for i := 0; i < 3; i++ {
+		cname, err := client.lookupCNAME(context.Background(), "Vanity.example.org")
+		checkForErrors(t, err)
+		equals(t, "app.example.com", cname)
+	}
+	equals(t, int32(1), queries.Load())
+}
+
+func Test_exchangeDNSOverHTTPS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		response, err := answerTestDNSQuery(query, map[string]string{"vanity.example.org": "app.example.com"}, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(response)
+	}))
+	defer server.Close()
+
+	client := &dnsClient{resolvers: []dnsResolver{{network: "https", address: server.URL}}, timeout: 2 * time.Second, httpClient: server.Client()}
+	cname, err := client.lookupCNAME(context.Background(), "vanity.example.org")
+	checkForErrors(t, err)
+	equals(t, "app.example.com", cname)
+}
+
+func Test_parseResolver(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    dnsResolver
+		wantErr bool
+	}{
+		{line: "8.8.8.8", want: dnsResolver{network: "udp", address: "8.8.8.8:53"}},
+		{line: "8.8.8.8:5353", want: dnsResolver{network: "udp", address: "8.8.8.8:5353"}},
+		{line: "tcp://9.9.9.9", want: dnsResolver{network: "tcp", address: "9.9.9.9:53"}},
+		{line: "udp://dns.example.com:53", want: dnsResolver{network: "udp", address: "dns.example.com:53"}},
+		{line: "2001:4860:4860::8888", want: dnsResolver{network: "udp", address: "[2001:4860:4860::8888]:53"}},
+		{line: "tcp://[2001:4860:4860::8888]:53", want: dnsResolver{network: "tcp", address: "[2001:4860:4860::8888]:53"}},
+		{line: "https://dns.google/dns-query", want: dnsResolver{network: "https", address: "https://dns.google/dns-query"}},
+		{line: "tls://1.1.1.1", wantErr: true},
+		{line: "tcp://", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseResolver(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseResolver(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		equals(t, tt.want, got)
+	}
+
+	path := filepath.Join(t.TempDir(), "resolvers.txt")
+	checkForErrors(t, os.WriteFile(path, []byte("# Public resolvers\n1.1.1.1\n\nhttps://dns.google/dns-query\n"), 0600))
+	resolvers, err := readResolversFile(path)
+	checkForErrors(t, err)
+	equals(t, []dnsResolver{{network: "udp", address: "1.1.1.1:53"}, {network: "https", address: "https://dns.google/dns-query"}}, resolvers)
+
+	checkForErrors(t, os.WriteFile(path, []byte("# Nothing here\n"), 0600))
+	_, err = readResolversFile(path)
+	if err == nil {
+		t.Error("expected an error for a resolvers file without resolvers")
+	}
+}
+
+func Test_isWildcardResolved(t *testing.T) {
+	server := startTestDNSServer(t, nil, map[string]string{
+		"*.example.com":   "192.0.2.1",
+		"api.example.com": "192.0.2.10",
+		"www.example.org": "198.51.100.1",
+		"example.com":     "192.0.2.5",
+	}, &atomic.Int32{})
+	detector := newWildcardDetector(&dnsClient{resolvers: []dnsResolver{{network: "udp", address: server}}, timeout: 2 * time.Second})
+
+	// Only resolves because of *.example.com
+	equals(t, true, detector.isWildcardResolved(context.Background(), "random.example.com"))
+	// Has its own record
+	equals(t, false, detector.isWildcardResolved(context.Background(), "api.example.com"))
+	// Apex domains aren't affected by their own wildcard records
+	equals(t, false, detector.isWildcardResolved(context.Background(), "example.com"))
+	// example.org doesn't have a wildcard record
+	equals(t, false, detector.isWildcardResolved(context.Background(), "www.example.org"))
+	equals(t, false, detector.isWildcardResolved(context.Background(), "missing.example.org"))
+}
+
+func Test_countTargetLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.txt")
+	checkForErrors(t, os.WriteFile(path, []byte("a.example.com\n\n# comment\n// comment\n  b.example.com  \nhttps://c.example.com/\n"), 0600))
+	count, err := countTargetLines(path)
+	checkForErrors(t, err)
+	equals(t, int64(3), count)
+}
+
+func Test_warning(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	checkForErrors(t, err)
+	originalStderr := os.Stderr
+	os.Stderr = writer
+	defer func() {
+		os.Stderr = originalStderr
+		hideWarnings = false
+	}()
+
+	warning(warnUnparsableLine, "shown")
+	jsonDiagnostics = true
+	warning(warnPrivateTLD, "shown as \"json\"")
+	jsonDiagnostics = false
+	hideWarnings = true
+	warning(warnUnparsableLine, "hidden")
+	writer.Close()
+
+	output, err := io.ReadAll(reader)
+	checkForErrors(t, err)
+	equals(t, colorWarning+"[WARNING HS-W001]: shown"+colorReset+"\n"+
+		`{"level":"warning","code":"HS-W002","message":"shown as \"json\""}`+"\n", string(output))
+}
+
+func Test_crash_JSONRunsDeferredFunctions(t *testing.T) {
+	jsonPath := filepath.Join(t.TempDir(), "firebounty.json")
+	checkForErrors(t, lockDatabase(context.Background(), jsonPath))
+
+	originalStderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	jsonDiagnostics = true
+	defer func() {
+		os.Stderr = originalStderr
+		jsonDiagnostics = false
+	}()
+
+	func() {
+		defer func() {
+			_, isJSONCrash := recover().(jsonCrash)
+			equals(t, true, isJSONCrash)
+		}()
+		defer unlockDatabase()
+		crash(errDatabase, "failed", nil)
+	}()
+
+	// The lock was released by the deferred function, so the next runs don't wait for it
+	_, err := os.Stat(jsonPath + ".lock")
+	equals(t, true, os.IsNotExist(err))
+}
+
+func Test_logFormatFlag(t *testing.T) {
+	defer func() { jsonDiagnostics = false }()
+	checkForErrors(t, logFormat.Set("json"))
+	equals(t, "json", logFormat.String())
+	checkForErrors(t, logFormat.Set("text"))
+	equals(t, "text", logFormat.String())
+	equals(t, true, logFormat.Set("xml") != nil)
+}
+
+func Test_verdictCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "verdicts.json")
+	wildcard, err := parseLine("*.example.com", true, false)
+	checkForErrors(t, err)
+	inscopeScopes := []interface{}{wildcard, "example.org"}
+	options := scopeMatchingOptions{inscopeExplicitLevel: 1, noscopeExplicitLevel: 1}
+	scopeHash := hashScopes(inscopeScopes, nil, options)
+
+	cache, err := loadVerdictCache(path, scopeHash, inscopeScopes)
+	checkForErrors(t, err)
+	found, _, _, _, _ := cache.get("a.example.com")
+	equals(t, false, found)
+	cache.set("a.example.com", true, false, false, wildcard)
+	cache.set("b.other.com", false, false, true, nil)
+	checkForErrors(t, cache.save(path))
+
+	cache, err = loadVerdictCache(path, scopeHash, inscopeScopes)
+	checkForErrors(t, err)
+	found, isInsideScope, isUnsure, isUnmatched, matchedScope := cache.get("a.example.com")
+	equals(t, true, found)
+	equals(t, true, isInsideScope)
+	equals(t, false, isUnsure)
+	equals(t, false, isUnmatched)
+	equals(t, wildcard, matchedScope)
+	found, isInsideScope, _, isUnmatched, matchedScope = cache.get("b.other.com")
+	equals(t, true, found)
+	equals(t, false, isInsideScope)
+	equals(t, true, isUnmatched)
+	equals(t, nil, matchedScope)
+
+	// The verdicts of different scopes can't be reused
+	otherOptions := options
+	otherOptions.inscopeExplicitLevel = 2
+	otherHash := hashScopes(inscopeScopes, nil, otherOptions)
+	if otherHash == scopeHash {
+		t.Fatal("the explicit level isn't part of the hash of the scopes")
+	}
+	caseInsensitiveOptions := options
+	caseInsensitiveOptions.caseInsensitiveRegexes = true
+	if hashScopes(inscopeScopes, nil, caseInsensitiveOptions) == scopeHash {
+		t.Fatal("--case-insensitive isn't part of the hash of the scopes")
+	}
+	unanchoredOptions := options
+	unanchoredOptions.unanchoredWildcards = true
+	if hashScopes(inscopeScopes, nil, unanchoredOptions) == scopeHash {
+		t.Fatal("--unanchored-wildcards isn't part of the hash of the scopes")
+	}
+	cache, err = loadVerdictCache(path, otherHash, inscopeScopes)
+	checkForErrors(t, err)
+	found, _, _, _, _ = cache.get("a.example.com")
+	equals(t, false, found)
+}
+
+func Test_previousOutputAsset(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: "a.example.com", want: "a.example.com"},
+		{line: "https://a.example.com/login [*.example.com # Main website] [CNAME: cdn.example.com]", want: "https://a.example.com/login"},
+		{line: `{"type":"inscope","asset":"a.example.com","rule":"*.example.com"}`, want: "a.example.com"},
+		{line: "type,asset,rule,description", want: ""},
+		{line: `inscope,"https://a.example.com/?a=1,2",*.example.com,`, want: "https://a.example.com/?a=1,2"},
+		{line: "unsure-email,admin@example.com", want: "admin@example.com"},
+		{line: "   ", want: ""},
+	}
+	for _, tt := range tests {
+		equals(t, tt.want, previousOutputAsset(tt.line))
+	}
+
+	assets, err := readPreviousAssets(filepath.Join(t.TempDir(), "missing.txt"))
+	checkForErrors(t, err)
+	equals(t, 0, len(assets))
+}
+
+func Test_formatMonitorReport(t *testing.T) {
+	previous := &monitorState{
+		InScope:    []string{"*.example.com", "example.org"},
+		OutOfScope: []string{"internal.example.com"},
+		Assets:     []string{"a.example.com", "b.example.com"},
+	}
+	current := &monitorState{
+		InScope:    []string{"*.example.com", "*.example.net"},
+		OutOfScope: []string{"internal.example.com"},
+		Assets:     []string{"a.example.com", "c.example.com"},
+	}
+	expected := "[hacker-scoper] example: 1 new in-scope assets, 2 scope changes\n" +
+		"New in-scope assets:\n  c.example.com\n" +
+		"Added in-scope rules:\n  *.example.net\n" +
+		"Removed in-scope rules:\n  example.org"
+	equals(t, expected, formatMonitorReport("example", previous, current))
+	equals(t, "", formatMonitorReport("example", current, current))
+}
+
+func Test_filterTargetsDirectory(t *testing.T) {
+	directory := t.TempDir()
+	checkForErrors(t, os.MkdirAll(filepath.Join(directory, "subdomains"), 0700))
+	checkForErrors(t, os.WriteFile(filepath.Join(directory, "urls.txt"), []byte("https://a.example.com/login\nhttps://other.com/\n"), 0600))
+	checkForErrors(t, os.WriteFile(filepath.Join(directory, "subdomains", "example.txt"), []byte("# amass\nb.example.com\ninternal.example.com\nb.example.com\n"), 0600))
+
+	inscopeScopes, err := parseAllLines([]string{"*.example.com"}, true, false, nil)
+	checkForErrors(t, err)
+	noscopeScopes, err := parseAllLines([]string{"internal.example.com"}, true, false, nil)
+	checkForErrors(t, err)
+
+	assets, err := filterTargetsDirectory(directory, inscopeScopes, noscopeScopes)
+	checkForErrors(t, err)
+	equals(t, []string{"b.example.com", "https://a.example.com/login"}, assets)
+}
+
+func Test_notifierWebhook(t *testing.T) {
+	var received map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	reportNotifier := notifier{webhookURL: server.URL}
+	checkForErrors(t, reportNotifier.notify("1 new in-scope asset"))
+	equals(t, map[string]string{"text": "1 new in-scope asset"}, received)
+}
+
+func Test_checkServer(t *testing.T) {
+	inscopeScopes, err := parseAllLines([]string{"*.example.com"}, true, false, nil)
+	checkForErrors(t, err)
+	noscopeScopes, err := parseAllLines([]string{"admin.example.com"}, true, false, nil)
+	checkForErrors(t, err)
+	server := &checkServer{inscopeScopes: inscopeScopes, noscopeScopes: noscopeScopes, inscopeExplicitLevel: 1, noscopeExplicitLevel: 1, token: "secret"}
+
+	tests := []struct {
+		path           string
+		token          string
+		expectedStatus int
+		expected       checkResponse
+	}{
+		{"/check?target=https://api.example.com/v1", "secret", http.StatusOK, checkResponse{Target: "https://api.example.com/v1", Verdict: "inscope", Rule: "*.example.com", Parsed: &targetComponents{Scheme: "https", Host: "api.example.com", Path: "/v1"}}},
+		{"/check?target=admin.example.com", "secret", http.StatusOK, checkResponse{Target: "admin.example.com", Verdict: "outofscope", Parsed: &targetComponents{Scheme: "https", Host: "admin.example.com"}}},
+		{"/check?target=other.com", "secret", http.StatusOK, checkResponse{Target: "other.com", Verdict: "unsure", Parsed: &targetComponents{Scheme: "https", Host: "other.com"}}},
+		{"/check?target=%25zz", "secret", http.StatusOK, checkResponse{Target: "%zz", Verdict: "invalid"}},
+		{"/check?target=api.example.com", "wrong", http.StatusUnauthorized, checkResponse{Error: "invalid token"}},
+		{"/check", "secret", http.StatusBadRequest, checkResponse{Error: "missing the target parameter"}},
+		{"/other", "secret", http.StatusNotFound, checkResponse{Error: "not found. Use GET /check?target=..."}},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, test.path, nil)
+		request.Header.Set("Authorization", "Bearer "+test.token)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+
+		var actual checkResponse
+		checkForErrors(t, json.NewDecoder(recorder.Body).Decode(&actual))
+		equals(t, test.expectedStatus, recorder.Code)
+		equals(t, test.expected, actual)
+	}
+}
+
+func Test_relatedDomains(t *testing.T) {
+	inscopeScopes, err := parseAllLines([]string{"example.com", "*.api.example.co.uk", "10.0.0.0/8", "example.*"}, true, false, nil)
+	checkForErrors(t, err)
+	related := newRelatedDomains(inscopeScopes)
+	equals(t, 2, len(related))
+
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		{"https://dev.example.com:8443/login", "example.com"},
+		{"john.doe@mail.example.com", "example.com"},
+		{"www.example.co.uk", "*.api.example.co.uk"},
+		{"other.org", ""},
+		// co.uk is a public suffix, so other.co.uk isn't related to example.co.uk
+		{"other.co.uk", ""},
+		{"10.1.2.3", ""},
+	}
+	for _, test := range tests {
+		target, err := parseTarget(test.target)
+		checkForErrors(t, err)
+		equals(t, test.expected, scopeToString(related.find(target)))
+	}
+
+	// The check server gives the related verdict too
+	server := &checkServer{inscopeScopes: inscopeScopes, inscopeExplicitLevel: 2, noscopeExplicitLevel: 2, related: related}
+	response := server.check("dev.example.com")
+	equals(t, "related", response.Verdict)
+	equals(t, "example.com", response.Rule)
+	equals(t, "unsure", server.check("other.org").Verdict)
+}
+
+func Test_runStats(t *testing.T) {
+	stats := runStats{started: time.Now()}
+	for _, res := range []targetResult{
+		{isInsideScope: true},
+		{isInsideScope: true},
+		{isInsideScope: true, isUnsure: true},
+		{isInsideScope: true, isUnsure: true, isRelated: true},
+		{},
+		// Without --include-unsure, the unmatched targets are still unsure
+		{isUnmatched: true},
+		{err: ErrInvalidFormat},
+	} {
+		stats.add(res)
+	}
+	equals(t, runStats{started: stats.started, processed: 7, inscope: 2, unsure: 3, related: 1, outOfScope: 1, invalid: 1}, stats)
+	equals(t, true, strings.HasSuffix(stats.String(), ": 2 in scope, 3 unsure (1 related), 1 out of scope, 1 invalid"))
+	// Without any in-scope rules, there are no rules to list
+	equals(t, "", stats.rulesReport(defaultStatsTopRules))
+
+	wildcard, err := parseScope("*.example.com", false)
+	checkForErrors(t, err)
+	hostname, err := parseScope("example.org", false)
+	checkForErrors(t, err)
+	ip, err := parseScope("10.0.0.1", false)
+	checkForErrors(t, err)
+	stats = runStats{}
+	for _, scope := range []interface{}{wildcard, wildcard, wildcard, ip, hostname} {
+		stats.add(targetResult{isInsideScope: true, matchedScope: scope})
+	}
+	equals(t, "[STATS]: Top 2 of 3 rules by in-scope results:\n"+
+		"  3 (60.0%): *.example.com\n"+
+		"  1 (20.0%): 10.0.0.1", stats.rulesReport(2))
+	equals(t, "", stats.rulesReport(0))
+}
+
+func Test_repeatedWarning(t *testing.T) {
+	defer func() { verboseWarnings = false }()
+	// Start from a clean slate, in case other tests printed repeated warnings
+	printWarningSummary()
+	for i := 0; i < 3; i++ {
+		repeatedWarning(warnUnparsableLine, "Unable to parse the string 'foo "+strconv.Itoa(i)+"' as a target.")
+	}
+	repeatedWarning(warnUnknownASN, "The ASN \"AS64500\" isn't in the ASN dataset. It has been ignored.")
+	equals(t, map[string]int{warnUnparsableLine: 3, warnUnknownASN: 1}, repeatedWarnings.counts)
+	equals(t, "Unable to parse the string 'foo 0' as a target.", repeatedWarnings.firstMessages[warnUnparsableLine])
+	equals(t, []string{warnUnparsableLine, warnUnknownASN}, repeatedWarnings.codes)
+
+	printWarningSummary()
+	equals(t, 0, len(repeatedWarnings.counts))
+
+	// --verbose prints every warning without counting them
+	verboseWarnings = true
+	repeatedWarning(warnUnparsableLine, "Unable to parse the string 'foo' as a target.")
+	equals(t, 0, len(repeatedWarnings.counts))
+}
+
+func Test_printDryRun(t *testing.T) {
+	interpretations := interpretScopeLines([]string{"*.example.com # main", "", "10.0.0.0/8", "foo bar"}, false)
+	equals(t, 3, len(interpretations))
+	equals(t, scopeInterpretation{line: "*.example.com # main", kind: "wildcard", normalized: "*.example.com", regex: `^.*\.example\.com$`}, interpretations[0])
+	equals(t, scopeInterpretation{line: "10.0.0.0/8", kind: "cidr", normalized: "10.0.0.0/8"}, interpretations[1])
+	equals(t, true, errors.Is(interpretations[2].err, ErrInvalidFormat))
+
+	targets := make(chan string, 3)
+	targets <- "a.example.com"
+	targets <- ""
+	targets <- "b.example.com"
+	close(targets)
+	var output bytes.Buffer
+	equals(t, 1, printDryRun(&output, []string{"*.example.com", "foo bar"}, []string{"admin.example.com"}, false, targets))
+	equals(t, "[+] In-scope rules (2):\n"+
+		"\t[+] *.example.com -> wildcard *.example.com (regex: ^.*\\.example\\.com$)\n"+
+		"\t[-] foo bar -> invalid: invalid format: not IP, CIDR, or URL\n"+
+		"[+] Out-of-scope rules (1):\n"+
+		"\t[+] admin.example.com -> hostname admin.example.com\n"+
+		"[+] 2 targets would be read.\n", output.String())
+}
+
+func Test_exportScope(t *testing.T) {
+	inscopeScopes, err := parseAllLines([]string{"*.example.com", "example.org", "10.0.0.0/23"}, true, false, nil)
+	checkForErrors(t, err)
+	noscopeScopes, err := parseAllLines([]string{"admin.example.com"}, true, false, nil)
+	checkForErrors(t, err)
+
+	var caido bytes.Buffer
+	checkForErrors(t, exportScope(&caido, "caido", "Example", inscopeScopes, noscopeScopes, 1, 2))
+	var scope caidoScope
+	checkForErrors(t, json.Unmarshal(caido.Bytes(), &scope))
+	equals(t, caidoScope{
+		Name:      "Example",
+		Allowlist: []string{"*.example.com", "example.org", "*.example.org", "10.0.0.*", "10.0.1.*"},
+		Denylist:  []string{"admin.example.com"},
+	}, scope)
+
+	var mitmproxy bytes.Buffer
+	checkForErrors(t, exportScope(&mitmproxy, "mitmproxy", "Example", inscopeScopes, noscopeScopes, 1, 2))
+	allow := `(~d ^.*\.example\.com$ | ~d example\.org$ | ~d "^10\\.0\\.(0|1)\\.\\d+$") & !(~d ^admin\.example\.com$)`
+	equals(t, true, strings.Contains(mitmproxy.String(), "view_filter: '"+allow+"'\n"))
+	equals(t, true, strings.Contains(mitmproxy.String(), "  - '/!("+allow+")/403'\n"))
+}
+
+func Test_parseBinaryScope(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected *BinaryScope
+	}{
+		{"ExampleSetup-1.2.3.exe", &BinaryScope{kind: "executable", raw: "ExampleSetup-1.2.3.exe"}},
+		{"Example Client.AppImage", &BinaryScope{kind: "executable", raw: "Example Client.AppImage"}},
+		{"binary:Example Desktop Client for Windows", &BinaryScope{kind: "executable", raw: "binary:Example Desktop Client for Windows"}},
+		{"SHA256:9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08", &BinaryScope{kind: "hash", raw: "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}},
+		{"d41d8cd98f00b204e9800998ecf8427e", &BinaryScope{kind: "hash", raw: "d41d8cd98f00b204e9800998ecf8427e"}},
+		{"binary:", nil},
+		{"example.app", nil},
+		{"example.com", nil},
+		{"deadbeef", nil},
+		{"https://example.com/download.exe", nil},
+	}
+	for _, test := range tests {
+		equals(t, test.expected, parseBinaryScope(test.line))
+	}
+
+	// The executable extensions must never be TLDs, or they'd hide real domains
+	for _, extension := range []string{"exe", "msi", "msix", "dmg", "pkg", "deb", "rpm", "appimage", "snap", "jar", "dll", "dylib", "apk", "aab", "ipa"} {
+		_, icann := publicsuffix.PublicSuffix("example." + extension)
+		if icann {
+			t.Errorf("the extension %q is a TLD", extension)
+		}
+	}
+
+	// Binary scopes are kept without warnings, but they never match any target
+	inscopeScopes, err := parseAllLines([]string{"*.example.com", "ExampleSetup.exe"}, true, false, nil)
+	checkForErrors(t, err)
+	equals(t, 2, len(inscopeScopes))
+	explicitLevel := 1
+	for _, line := range []string{"ExampleSetup.exe", "https://www.example.com/ExampleSetup.exe"} {
+		target, err := parseLine(line, false, false)
+		if err != nil {
+			continue
+		}
+		_, isBinary := findMatchingScope(&inscopeScopes, prepareTarget(target), &explicitLevel).(*BinaryScope)
+		equals(t, false, isBinary)
+	}
+
+	var mitmproxy bytes.Buffer
+	checkForErrors(t, exportScope(&mitmproxy, "mitmproxy", "Example", inscopeScopes, nil, 1, 2))
+	equals(t, true, strings.Contains(mitmproxy.String(), "# In-scope binaries and file hashes, which can't be filtered by mitmproxy: ExampleSetup.exe\n"))
+
+	kind, _ := auditScopeEntry("ExampleSetup.exe", false)
+	equals(t, "binary", kind)
+}
+
+func Test_ipRangeGlobs(t *testing.T) {
+	tests := []struct {
+		scope    string
+		expected []string
+	}{
+		{"10.0.0.0/8", []string{"10.*.*.*"}},
+		{"192.168.1.0/31", []string{"192.168.1.0", "192.168.1.1"}},
+		{"10.0.0.1-2", []string{"10.0.0.1", "10.0.0.2"}},
+	}
+	for _, test := range tests {
+		scope, err := parseLine(test.scope, true, false)
+		checkForErrors(t, err)
+		globs, err := ipRangeGlobs(scope)
+		checkForErrors(t, err)
+		equals(t, test.expected, globs)
+	}
+
+	// Too many globs
+	scope, err := parseLine("10.1-200.1-200.1", true, false)
+	checkForErrors(t, err)
+	_, err = ipRangeGlobs(scope)
+	equals(t, true, err != nil)
+}
+
+func Test_exportExclusions(t *testing.T) {
+	var noscopeScopes []interface{}
+	for _, line := range []string{"admin.example.com", "*.dev.example.com", "10.0.0.0/24"} {
+		scope, err := parseLine(line, true, false)
+		checkForErrors(t, err)
+		noscopeScopes = append(noscopeScopes, scope)
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"nuclei", "admin.example.com\n10.0.0.0/24\n"},
+		{"katana", `^[a-zA-Z][a-zA-Z0-9+.-]*://admin\.example\.com(:\d+)?(/|\?|#|$)` + "\n" +
+			`^[a-zA-Z][a-zA-Z0-9+.-]*://[^/?#]*\.dev\.example\.com(:\d+)?(/|\?|#|$)` + "\n" +
+			`^[a-zA-Z][a-zA-Z0-9+.-]*://10\.0\.0\.\d+(:\d+)?(/|\?|#|$)` + "\n"},
+	}
+	for _, test := range tests {
+		var exported bytes.Buffer
+		checkForErrors(t, exportExclusions(&exported, test.format, noscopeScopes, 2))
+		equals(t, test.expected, exported.String())
+	}
+
+	regexes := katanaOutOfScopeRegexes(noscopeScopes[:1], 2)
+	excluded := regexp.MustCompile(regexes[0])
+	equals(t, true, excluded.MatchString("https://admin.example.com:8443/login"))
+	equals(t, false, excluded.MatchString("https://admin.example.com.evil.org/"))
+}
+
+func Test_auditProgram(t *testing.T) {
+	prog := &Program{Name: "Example"}
+	prog.Scopes.In_scopes = []Scope{
+		{Scope: "*.example.com", Scope_type: "web_application"},
+		{Scope: "com.example.gatewayportal", Scope_type: "web_application"},
+		{Scope: "example.com/api", Scope_type: "web_application"},
+		{Scope: "intranet.corp", Scope_type: "web_application"},
+		{Scope: "*.Example.com", Scope_type: "web_application"},
+		{Scope: "10.0.0.0/8", Scope_type: "web_application"},
+		{Scope: "com.example.app", Scope_type: "android_application"},
+	}
+	prog.Scopes.Out_of_scopes = []Scope{
+		{Scope: "*.example.com", Scope_type: "web_application"},
+		{Scope: "^https://(unclosed$", Scope_type: "web_application"},
+	}
+
+	audit := auditProgram(prog, false)
+	var kinds []string
+	for _, issue := range audit.Issues {
+		kinds = append(kinds, issue.List+" "+issue.Kind+" "+issue.Scope)
+	}
+	equals(t, []string{
+		"in_scope package-name com.example.gatewayportal",
+		"in_scope path example.com/api",
+		"in_scope invalid-tld intranet.corp",
+		"in_scope duplicate *.Example.com",
+		"out_of_scope in-and-out-of-scope *.example.com",
+		"out_of_scope invalid ^https://(unclosed$",
+	}, kinds)
+
+	// Private TLDs can be allowed, like in the regular runs
+	audit = auditProgram(&Program{Scopes: struct {
+		In_scopes     []Scope
+		Out_of_scopes []Scope
+	}{In_scopes: []Scope{{Scope: "intranet.corp", Scope_type: "web_application"}}}}, true)
+	equals(t, 0, len(audit.Issues))
+}
+
+func Test_reclassifyMobileScopes(t *testing.T) {
+	webLines, mobileLines := reclassifyMobileScopes([]string{"*.example.com", "com.example.app", "io.example.gatewayportal", "io.example.com", "10.0.0.1", "https://example.org"})
+	equals(t, []string{"*.example.com", "io.example.com", "10.0.0.1", "https://example.org"}, webLines)
+	equals(t, []string{"com.example.app", "io.example.gatewayportal"}, mobileLines)
+}
+
+func Test_parseLine_Scope_MisconfiguredProgram(t *testing.T) {
+	hideWarnings = true
+	defer func() { hideWarnings = false }()
+
+	_, err := parseLine("com.my.business.gatewayportal", true, false)
+	equals(t, ErrMisconfiguredScope, err)
+	equals(t, true, errors.Is(err, ErrInvalidFormat))
+}
+
+func Test_parseLine_Target_IPv6URL(t *testing.T) {
+	tests := []struct {
+		target       string
+		expectedIP   string
+		expectedPort string
+	}{
+		{"https://[2001:DB8::0001]:8443/path", "2001:db8::1", "8443"},
+		{"https://[2001:db8::1]/path", "2001:db8::1", ""},
+		{"https://2001:db8::1/path", "2001:db8::1", ""},
+		{"[2001:db8::1]", "2001:db8::1", ""},
+	}
+	for _, test := range tests {
+		result, err := parseLine(test.target, false, false)
+		checkForErrors(t, err)
+		got, isIPURL := result.(*URLWithIPAddressHost)
+		equals(t, true, isIPURL)
+		equals(t, test.expectedIP, got.IPhost.String())
+		equals(t, test.expectedPort, getTargetComponents(result).Port)
+	}
+}
+
+func Test_removePortFromHost_IPv6(t *testing.T) {
+	tests := []struct {
+		rawURL   string
+		expected string
+	}{
+		{"https://[2001:db8::1]:8080/", "2001:db8::1"},
+		{"https://[2001:db8::1]/", "2001:db8::1"},
+		{"https://2001:db8::1/", "2001:db8::1"},
+	}
+	for _, test := range tests {
+		parsedURL, err := url.Parse(test.rawURL)
+		checkForErrors(t, err)
+		equals(t, test.expected, removePortFromHost(parsedURL))
+	}
+}
+
+func Test_isPortAllowed(t *testing.T) {
+	equals(t, true, isPortAllowed(nil, "8080"))
+	equals(t, true, isPortAllowed([]int{443}, ""))
+	equals(t, true, isPortAllowed([]int{443, 8443}, "8443"))
+	equals(t, false, isPortAllowed([]int{443, 8443}, "8080"))
+}
+
+func Test_stripTargetPort(t *testing.T) {
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		{"https://example.com:8080/login?next=/home", "https://example.com/login?next=/home"},
+		{"example.com:8080", "example.com"},
+		{"https://[2001:db8::1]:8443/", "https://[2001:db8::1]/"},
+		{"https://2001:db8::1/", "https://2001:db8::1/"},
+		{"https://example.com/", "https://example.com/"},
+	}
+	for _, test := range tests {
+		equals(t, test.expected, stripTargetPort(test.target))
+	}
+}
+
+func Test_parseScopes_CIDRTargets(t *testing.T) {
+	var inscopeScopes, noscopeScopes []interface{}
+	for _, line := range []string{"10.0.0.0/16", "192.168.1.1", "172.16.0-3.0-255"} {
+		scope, err := parseLine(line, true, false)
+		checkForErrors(t, err)
+		inscopeScopes = append(inscopeScopes, scope)
+	}
+	scope, err := parseLine("10.0.5.0/24", true, false)
+	checkForErrors(t, err)
+	noscopeScopes = append(noscopeScopes, scope)
+
+	tests := []struct {
+		target   string
+		expected bool
+	}{
+		{"10.0.1.0/24", true},
+		{"10.0.0.0/8", false},
+		// Intersects the out-of-scope range
+		{"10.0.4.0/22", false},
+		{"192.168.1.1/32", true},
+		{"192.168.1.0/31", false},
+		{"172.16.2.0/23", true},
+		{"172.16.2.0/22", true},
+		{"172.16.4.0/22", false},
+		{"2001:db8::/32", false},
+	}
+	explicitLevel := 1
+	for _, test := range tests {
+		target, err := parseTargetLine(test.target, true)
+		checkForErrors(t, err)
+		isInsideScope, _, _, _ := parseScopes(&inscopeScopes, &noscopeScopes, &target, &explicitLevel, &explicitLevel, false)
+		if isInsideScope != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.target, test.expected, isInsideScope)
+		}
+	}
+
+	// Without --allow-cidr-targets, CIDR targets are still parsed as URLs
+	target, err := parseTargetLine("10.0.1.0/24", false)
+	checkForErrors(t, err)
+	_, isCIDR := target.(*net.IPNet)
+	equals(t, false, isCIDR)
+}
+
+func Test_rangeToPrefixes(t *testing.T) {
+	tests := []struct {
+		start    string
+		end      string
+		expected []string
+	}{
+		{"10.0.0.0", "10.0.2.255", []string{"10.0.0.0/23", "10.0.2.0/24"}},
+		{"10.0.0.1", "10.0.0.6", []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}},
+		{"0.0.0.0", "255.255.255.255", []string{"0.0.0.0/0"}},
+		{"2001:db8::", "2001:db8::ffff", []string{"2001:db8::/112"}},
+	}
+	for _, test := range tests {
+		var prefixes []string
+		for _, prefix := range rangeToPrefixes(netip.MustParseAddr(test.start), netip.MustParseAddr(test.end)) {
+			prefixes = append(prefixes, prefix.String())
+		}
+		equals(t, test.expected, prefixes)
+	}
+}
+
+func Test_expandASNTargets(t *testing.T) {
+	datasetPath := filepath.Join(t.TempDir(), "ip2asn.tsv")
+	err := os.WriteFile(datasetPath, []byte("10.0.0.0\t10.0.2.255\t64500\tUS\tEXAMPLE-AS Example\n192.0.2.0\t192.0.2.255\t0\tNone\tNot routed\n2001:db8::/48 AS64500\n"), 0600)
+	checkForErrors(t, err)
+	dataset, err := loadASNDataset(datasetPath)
+	checkForErrors(t, err)
+
+	lines := make(chan string, 3)
+	lines <- "AS64500"
+	lines <- "AS0"
+	lines <- "example.com"
+	close(lines)
+
+	hideWarnings = true
+	defer func() { hideWarnings = false }()
+	var expanded []string
+	for line := range expandASNTargets(lines, dataset) {
+		expanded = append(expanded, line)
+	}
+	equals(t, []string{"10.0.0.0/23", "10.0.2.0/24", "2001:db8::/48", "example.com"}, expanded)
+}
+
+func Test_isNewerVersion(t *testing.T) {
+	tests := []struct {
+		latest   string
+		current  string
+		expected bool
+	}{
+		{"v6.3.0", "6.2.0", true},
+		{"v6.10.0", "6.9.1", true},
+		{"v7.0", "6.2.0", true},
+		{"v6.2.0", "6.2.0", false},
+		{"v6.2", "6.2.0", false},
+		{"v6.1.9", "6.2.0", false},
+		{"v6.3.0-beta", "6.2.0", true},
+		{"nightly", "6.2.0", false},
+	}
+	for _, test := range tests {
+		equals(t, test.expected, isNewerVersion(test.latest, test.current))
+	}
+}
+
+func Test_parseAllLines_Order(t *testing.T) {
+	hideWarnings = true
+	defer func() { hideWarnings = false }()
+
+	var lines []string
+	var expected []interface{}
+	for i := range 200 {
+		line := "host" + strconv.Itoa(i) + ".example.com"
+		lines = append(lines, line, "invalid/path/"+strconv.Itoa(i))
+		expected = append(expected, line)
+	}
+	actual, err := parseAllLines(lines, true, false, nil)
+	checkForErrors(t, err)
+	equals(t, expected, actual)
+}
+
+func Test_compileScopeRegex(t *testing.T) {
+	first, err := parseLine("*.example.com", true, false)
+	checkForErrors(t, err)
+	second, err := parseLine("*.example.com", true, false)
+	checkForErrors(t, err)
+
+	// Identical wildcards are compiled only once
+	firstRegex, err := compileScopeRegex(`.*\.example\.com`)
+	checkForErrors(t, err)
+	secondRegex, err := compileScopeRegex(`.*\.example\.com`)
+	checkForErrors(t, err)
+	equals(t, true, firstRegex == secondRegex)
+	equals(t, first.(*WildcardScope).scope.String(), second.(*WildcardScope).scope.String())
+
+	_, err = compileScopeRegex("^(unterminated$")
+	equals(t, true, err != nil)
+}
+
+func Test_parseURLWithDefaultScheme(t *testing.T) {
+	tests := []struct {
+		line         string
+		expectedHost string
+	}{
+		{"example.com", "example.com"},
+		{"example.com:8080/login", "example.com:8080"},
+		{"http://example.com/", "example.com"},
+		{"git+ssh://example.com/repo", "example.com"},
+		{"//example.com/path", "example.com"},
+		// The "://" of the query string isn't a scheme
+		{"example.com/redirect?to=https://example.org", "example.com"},
+		{"data:text/plain,hello", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		parsedURL, err := parseURLWithDefaultScheme(test.line)
+		if test.expectedHost == "" {
+			equals(t, ErrInvalidFormat, err)
+		} else {
+			checkForErrors(t, err)
+			equals(t, test.expectedHost, parsedURL.Host)
+		}
+	}
+}
+
+func Test_ParseScope(t *testing.T) {
+	tests := []struct {
+		line         string
+		expectedKind ScopeKind
+	}{
+		{"example.com", ScopeKindHostname},
+		{"192.0.2.1", ScopeKindIP},
+		{"192.0.2.0/24", ScopeKindCIDR},
+		{"192.0.2-3.1-100", ScopeKindNmapRange},
+		{`^https?://example\.com$`, ScopeKindRegex},
+		{"*.example.com", ScopeKindWildcard},
+	}
+	for _, test := range tests {
+		scope, err := ParseScope(test.line)
+		checkForErrors(t, err)
+		equals(t, test.expectedKind, scope.Kind)
+	}
+
+	scope, err := ParseScope("https://example.com:8443/")
+	checkForErrors(t, err)
+	equals(t, "example.com", scope.Hostname)
+
+	hideWarnings = true
+	defer func() { hideWarnings = false }()
+	_, err = ParseScope("example.com/path")
+	equals(t, ErrInvalidFormat, err)
+}
+
+func Test_ParseTarget(t *testing.T) {
+	target, err := ParseTarget("sub.example.com:8080/login")
+	checkForErrors(t, err)
+	equals(t, TargetKindURL, target.Kind)
+	equals(t, "sub.example.com:8080", target.URL.Host)
+
+	target, err = ParseTarget("192.0.2.1")
+	checkForErrors(t, err)
+	equals(t, TargetKindIP, target.Kind)
+	equals(t, "192.0.2.1", target.IP.String())
+
+	target, err = ParseTarget("http://192.0.2.1:8080/admin")
+	checkForErrors(t, err)
+	equals(t, TargetKindURLWithIP, target.Kind)
+	equals(t, "192.0.2.1", target.IP.String())
+	equals(t, "/admin", target.URL.Path)
+
+	target, err = ParseTarget("security@example.com")
+	checkForErrors(t, err)
+	equals(t, TargetKindEmail, target.Kind)
+	equals(t, "example.com", target.EmailDomain)
+
+	_, err = ParseTarget("%zz")
+	equals(t, ErrInvalidFormat, err)
+}
+
+func Test_Matcher_Concurrent(t *testing.T) {
+	inscope, err := ParseScope("*.example.com")
+	checkForErrors(t, err)
+	noscope, err := ParseScope("admin.example.com")
+	checkForErrors(t, err)
+	matcher := NewMatcher([]ParsedScope{inscope}, []ParsedScope{noscope}, ExplicitLevelSubdomains)
+
+	tests := []struct {
+		target   string
+		expected bool
+	}{
+		{"https://www.example.com/", true},
+		{"admin.example.com", false},
+		{"example.org", false},
+	}
+
+	// Run with -race to check that Match doesn't modify the matcher
+	var wg sync.WaitGroup
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, test := range tests {
+				target, err := ParseTarget(test.target)
+				if err != nil || matcher.Match(target) != test.expected {
+					t.Errorf("unexpected result for %q", test.target)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func Test_Matcher_MatchesCommandLine(t *testing.T) {
+	inscopeLines := []string{"*.example.com", "192.168.1.0/24"}
+	noscopeLines := []string{"admin.example.com", "192.168.1.10"}
+
+	var inscopes, noscopes []ParsedScope
+	var inscopeScopes, noscopeScopes []interface{}
+	for _, line := range inscopeLines {
+		scope, err := ParseScope(line)
+		checkForErrors(t, err)
+		inscopes = append(inscopes, scope)
+		inscopeScopes = append(inscopeScopes, scope.value)
+	}
+	for _, line := range noscopeLines {
+		scope, err := ParseScope(line)
+		checkForErrors(t, err)
+		noscopes = append(noscopes, scope)
+		noscopeScopes = append(noscopeScopes, scope.value)
+	}
+	matcher := NewMatcher(inscopes, noscopes, ExplicitLevelSubdomains)
+
+	// The default levels of the command-line tool
+	inscopeExplicitLevel, noscopeExplicitLevel := int(ExplicitLevelSubdomains), int(ExplicitLevelSubdomains)
+	for _, line := range []string{"www.example.com", "admin.example.com", "api.admin.example.com", "https://api.admin.example.com/login", "example.org", "192.168.1.5", "192.168.1.10"} {
+		target, err := ParseTarget(line)
+		checkForErrors(t, err)
+		isInsideScope, _, _, _ := parseScopes(&inscopeScopes, &noscopeScopes, &target.value, &inscopeExplicitLevel, &noscopeExplicitLevel, false)
+		if matcher.Match(target) != isInsideScope {
+			t.Errorf("the matcher and the command-line tool disagree on %q", line)
+		}
+	}
+
+	target, err := ParseTarget("api.admin.example.com")
+	checkForErrors(t, err)
+	equals(t, false, matcher.Match(target))
+}
+
+func Test_Matcher_MatchAll(t *testing.T) {
+	inscope, err := ParseScope("*.example.com")
+	checkForErrors(t, err)
+	matcher := NewMatcher([]ParsedScope{inscope}, nil, ExplicitLevelSubdomains)
+	var targets []ParsedTarget
+	for _, line := range []string{"www.example.com", "example.org"} {
+		target, err := ParseTarget(line)
+		checkForErrors(t, err)
+		targets = append(targets, target)
+	}
+
+	results, err := matcher.MatchAll(context.Background(), targets)
+	checkForErrors(t, err)
+	equals(t, []bool{true, false}, results)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = matcher.MatchAll(ctx, targets)
+	equals(t, context.Canceled, err)
+}
+
+func Benchmark_Matcher_Parallel(b *testing.B) {
+	var inscopes []ParsedScope
+	for _, line := range []string{"*.example.com", "example.org", "10.0.0.0/8", `^https://api\.example\.net/.*$`} {
+		scope, err := ParseScope(line)
+		checkForErrors(b, err)
+		inscopes = append(inscopes, scope)
+	}
+	matcher := NewMatcher(inscopes, nil, ExplicitLevelSubdomains)
+	target, err := ParseTarget("https://www.example.com/login")
+	checkForErrors(b, err)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			matcher.Match(target)
+		}
+	})
+}
+
+func Test_ParsedScope_Matches(t *testing.T) {
+	scope, err := ParseScope("*.example.com")
+	checkForErrors(t, err)
+	network, err := ParseScope("192.0.2.0/24")
+	checkForErrors(t, err)
+
+	tests := []struct {
+		scope    ParsedScope
+		target   string
+		expected bool
+	}{
+		{scope, "https://sub.example.com/login", true},
+		{scope, "https://example.org/", false},
+		{network, "192.0.2.10", true},
+		{network, "http://192.0.2.10:8080/", true},
+		{network, "192.0.3.10", false},
+	}
+	for _, test := range tests {
+		target, err := ParseTarget(test.target)
+		checkForErrors(t, err)
+		equals(t, test.expected, test.scope.Matches(target, ExplicitLevelSubdomains))
+	}
+}
+
+// chanWriter sends every write to a channel, so that tests can wait for the writes of an asyncWriter.
+type chanWriter chan string
+
+func (writer chanWriter) Write(p []byte) (int, error) {
+	writer <- string(p)
+	return len(p), nil
+}
+
+func Test_asyncWriter_FlushEvery(t *testing.T) {
+	writes := make(chanWriter, 10)
+	writer := newAsyncWriter(writes, 2, 0)
+
+	writer.WriteString("a.example.com\n")
+	writer.WriteString("b.example.com\n")
+	equals(t, "a.example.com\nb.example.com\n", <-writes)
+
+	writer.WriteString("c.example.com\n")
+	checkForErrors(t, writer.Close())
+	equals(t, "c.example.com\n", <-writes)
+}
+
+func Test_asyncWriter_FlushInterval(t *testing.T) {
+	writes := make(chanWriter, 10)
+	writer := newAsyncWriter(writes, 0, 10*time.Millisecond)
+	defer writer.Close()
+
+	writer.WriteString("a.example.com\n")
+	select {
+	case written := <-writes:
+		equals(t, "a.example.com\n", written)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the buffered write wasn't flushed")
+	}
+}
+
+func Test_streamFileLines_LongLine(t *testing.T) {
+	hideWarnings = true
+	defer func() { hideWarnings = false }()
+
+	path := filepath.Join(t.TempDir(), "targets.txt")
+	content := "a.example.com\n" + strings.Repeat("x", maxTargetLineLength+1) + "\nb.example.com\n"
+	checkForErrors(t, os.WriteFile(path, []byte(content), 0600))
+
+	lines, err := streamFileLines(path)
+	checkForErrors(t, err)
+	var actual []string
+	for line := range lines {
+		actual = append(actual, line)
+	}
+	// The targets before the line that is too long are still processed
+	equals(t, []string{"a.example.com"}, actual)
+}
+
+func Test_duplicateProgramGroups(t *testing.T) {
+	companyNames := []string{"Example", "Example (Bugcrowd)", "Other", "Example Security", "Unrelated", "Examples"}
+	identities := []programIdentity{
+		{Slug: "example", URL: "https://example.com/security"},
+		{Slug: "example-bugcrowd", URL: "https://bugcrowd.com/example"},
+		{Slug: "other", URL: "https://other.com"},
+		{Slug: "examplesec", URL: "https://www.Example.com/security/"},
+		{Slug: "unrelated", URL: ""},
+		{Slug: "examples", URL: ""},
+	}
+	matches := []firebountySearchMatch{{0, "example"}, {5, "examples"}}
+
+	groups := duplicateProgramGroups(matches, companyNames, identities)
+	equals(t, [][]firebountySearchMatch{
+		// Same slug prefix, and same program URL
+		{{0, "example"}, {1, "example (bugcrowd)"}, {3, "example security"}},
+		{{5, "examples"}},
+	}, groups)
+	equals(t, "example (merged: example, example (bugcrowd), example security)", groupName(groups[0]))
+	equals(t, "examples", groupName(groups[1]))
+}
+
+func Test_recordScopeSource(t *testing.T) {
+	lineDetails := map[string]ruleDetails{"*.example.com": {Description: "Main website"}}
+	recordScopeSource(lineDetails, "Example", []string{"*.example.com # Main website", "example.org"}, []string{"admin.example.com"})
+	recordScopeSource(lineDetails, "Example (Bugcrowd)", []string{"*.example.com", "https://example.org/"})
+	recordScopeSource(lineDetails, "Example (Bugcrowd)", []string{"*.example.com"})
+
+	equals(t, ruleDetails{Description: "Main website", Sources: []string{"Example", "Example (Bugcrowd)"}}, lineDetails["*.example.com"])
+	equals(t, []string{"Example"}, lineDetails["admin.example.com"].Sources)
+	equals(t, 2, len(scopeSources(lineDetails)))
+
+	// Both lines are the same rule, so the rule has both sources
+	scopeDetails = map[interface{}]ruleDetails{}
+	defer func() { scopeDetails = map[interface{}]ruleDetails{} }()
+	scopes, err := parseAllLines([]string{"example.org", "https://example.org/"}, true, false, lineDetails)
+	checkForErrors(t, err)
+	equals(t, []string{"Example", "Example (Bugcrowd)"}, scopeDetails[scopes[0]].Sources)
+}
+
+func Test_parseScopes_OutOfScopeOnly(t *testing.T) {
+	inscopeScopes := []interface{}{}
+	noscopeScopes, err := parseAllLines([]string{"admin.example.com", "10.0.0.0/8"}, true, false, nil)
+	checkForErrors(t, err)
+	explicitLevel := 1
+
+	tests := []struct {
+		target   string
+		expected bool
+	}{
+		{"https://www.example.com/", true},
+		{"https://admin.example.com/", false},
+		{"192.0.2.1", true},
+		{"10.1.2.3", false},
+	}
+	for _, test := range tests {
+		target, err := parseTarget(test.target)
+		checkForErrors(t, err)
+		isInsideScope, isUnsure, _, _ := parseScopes(&inscopeScopes, &noscopeScopes, &target, &explicitLevel, &explicitLevel, false)
+		equals(t, test.expected, isInsideScope)
+		equals(t, false, isUnsure)
+	}
+}
+
+func Test_parseScopes_Unmatched(t *testing.T) {
+	inscopeScopes, err := parseAllLines([]string{"*.example.com"}, true, false, nil)
+	checkForErrors(t, err)
+	noscopeScopes, err := parseAllLines([]string{"admin.example.com"}, true, false, nil)
+	checkForErrors(t, err)
+	explicitLevel := 1
+
+	tests := []struct {
+		target        string
+		includeUnsure bool
+		isInsideScope bool
+		isUnmatched   bool
+	}{
+		{"www.example.com", false, true, false},
+		{"admin.example.com", false, false, false},
+		{"www.other.com", false, false, true},
+		{"admin.example.com", true, false, false},
+		{"www.other.com", true, true, true},
+	}
+	for _, test := range tests {
+		target, err := parseTarget(test.target)
+		checkForErrors(t, err)
+		isInsideScope, _, isUnmatched, _ := parseScopes(&inscopeScopes, &noscopeScopes, &target, &explicitLevel, &explicitLevel, test.includeUnsure)
+		equals(t, test.isInsideScope, isInsideScope)
+		equals(t, test.isUnmatched, isUnmatched)
+	}
+}
+
+func Test_ruleTimings(t *testing.T) {
+	ruleTimer = &ruleTimings{}
+	defer func() { ruleTimer = nil }()
+
+	explicitLevel := 1
+	slow, _ := parseLine(`^https://(a+)+\.example\.com/$`, true, false)
+	fast, _ := parseLine("example.org", true, false)
+	scopes := []interface{}{slow, fast}
+	for _, line := range []string{"https://aaaaaaaaaaaaaaaaaaaaaaaa.example.org/", "www.example.org"} {
+		target, _ := parseLine(line, false, false)
+		equals(t, fast, findMatchingScope(&scopes, prepareTarget(target), &explicitLevel))
+	}
+
+	slowest := ruleTimer.slowest(1)
+	equals(t, 1, len(slowest))
+	equals(t, int64(2), slowest[0].matches.Load())
+	equals(t, 3, len(strings.Split(ruleTimer.report(), "\n")))
+}
+
+func Test_orderResults(t *testing.T) {
+	slots := make(chan struct{}, 2)
+	lines := make(chan numberedLine)
+	go func() {
+		for i := range 10 {
+			lines <- numberedLine{index: i, line: strconv.Itoa(i)}
+		}
+		close(lines)
+	}()
+
+	// Every pair of results arrives in reverse order
+	results := make(chan targetResult)
+	go func() {
+		var held *numberedLine
+		for line := range throttleLines(lines, slots) {
+			if held == nil {
+				held = &line
+				continue
+			}
+			results <- targetResult{index: line.index, targetStr: line.line}
+			results <- targetResult{index: held.index, targetStr: held.line}
+			held = nil
+		}
+		close(results)
+	}()
+
+	var order []int
+	for res := range orderResults(results, 0, slots) {
+		order = append(order, res.index)
+	}
+	equals(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, order)
+}
+
+func Test_matchPrograms(t *testing.T) {
+	programs := []multiProgram{
+		{name: "Example", inscopeScopes: []interface{}{"example.com"}, noscopeScopes: []interface{}{"admin.example.com"}},
+		{name: "Example (Bugcrowd)", inscopeScopes: []interface{}{"api.example.com"}},
+	}
+
+	target, _ := parseLine("https://api.example.com/v1", false, false)
+	equals(t, []programMatch{{Program: "Example", Rule: "example.com", index: 0}, {Program: "Example (Bugcrowd)", Rule: "api.example.com", index: 1}}, matchPrograms(programs, target, 1))
+	target, _ = parseLine("admin.example.com", false, false)
+	equals(t, []programMatch(nil), matchPrograms(programs, target, 1))
+	// The subdomains of the out-of-scope hostnames are out of scope too, like in the regular runs
+	target, _ = parseLine("api.admin.example.com", false, false)
+	equals(t, []programMatch(nil), matchPrograms(programs, target, 1))
+
+	companyNames := []string{"Example ", "Other"}
+	identities := []programIdentity{{Slug: "example"}, {Slug: "other-bugcrowd"}}
+	equals(t, 0, findCompanyByNameOrSlug("example", companyNames, identities))
+	equals(t, 1, findCompanyByNameOrSlug("Other-Bugcrowd", companyNames, identities))
+	equals(t, -1, findCompanyByNameOrSlug("missing", companyNames, identities))
+}
+
+func Test_findOwners(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "firebounty.json")
+	database := `{"pgms": [
+		{"name": "Acme", "slug": "acme", "scopes": {"in_scopes": [{"scope": "*.acme.com", "scope_type": "web_application"}], "out_of_scopes": [{"scope": "admin.acme.com", "scope_type": "web_application"}]}},
+		{"name": "Acme VDP", "slug": "acme-vdp", "scopes": {"in_scopes": [{"scope": "api.acme.com", "scope_type": "web_application"}, {"scope": "com.acme.app", "scope_type": "android_application"}], "out_of_scopes": []}},
+		{"name": "Initech", "slug": "initech", "scopes": {"in_scopes": [{"scope": "10.0.0.0/8", "scope_type": "web_application"}], "out_of_scopes": []}}
+	]}`
+	checkForErrors(t, os.WriteFile(path, []byte(database), 0600))
+
+	target, _ := parseTarget("https://api.acme.com/v1")
+	owners, err := findOwners(path, target, 1, false)
+	checkForErrors(t, err)
+	equals(t, []programMatch{{Program: "Acme", Slug: "acme", Rule: "*.acme.com"}, {Program: "Acme VDP", Slug: "acme-vdp", Rule: "api.acme.com"}}, owners)
+
+	target, _ = parseTarget("admin.acme.com")
+	owners, err = findOwners(path, target, 1, false)
+	checkForErrors(t, err)
+	equals(t, []programMatch(nil), owners)
+
+	target, _ = parseTarget("10.1.2.3")
+	owners, err = findOwners(path, target, 1, false)
+	checkForErrors(t, err)
+	equals(t, []programMatch{{Program: "Initech", Slug: "initech", Rule: "10.0.0.0/8"}}, owners)
+}
+
+func Test_collectTagScopes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "firebounty.json")
+	database := `{"pgms": [
+		{"name": "Acme", "slug": "acme", "tag": "hackerone", "scopes": {"in_scopes": [{"scope": "*.acme.com", "scope_type": "web_application"}, {"scope": "10.0.0.0/8", "scope_type": "web_application"}], "out_of_scopes": []}},
+		{"name": "Acme VDP", "slug": "acme-vdp", "tag": "HackerOne", "scopes": {"in_scopes": [{"scope": "https://api.acme.com", "scope_type": "web_application"}, {"scope": "*.ACME.com", "scope_type": "web_application"}, {"scope": "com.acme.app", "scope_type": "android_application"}], "out_of_scopes": []}},
+		{"name": "Initech", "slug": "initech", "tag": "bugcrowd", "scopes": {"in_scopes": [{"scope": "initech.com", "scope_type": "web_application"}], "out_of_scopes": []}}
+	]}`
+	checkForErrors(t, os.WriteFile(path, []byte(database), 0600))
+
+	scopes, programCount, err := collectTagScopes(path, "hackerone", false)
+	checkForErrors(t, err)
+	equals(t, 2, programCount)
+	equals(t, []string{"*.acme.com", "api.acme.com"}, scopes)
+
+	_, programCount, err = collectTagScopes(path, "intigriti", false)
+	checkForErrors(t, err)
+	equals(t, 0, programCount)
+}
+
+func Test_chaosList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chaos-bugbounty-list.json")
+	chaos := `{"programs": [
+		{"name": "Acme", "url": "https://hackerone.com/acme", "bounty": true, "swag": false, "domains": ["acme.com", " ACME.com", "acme.io"]},
+		{"name": "Acme Labs", "url": "https://acmelabs.com/security", "bounty": false, "swag": true, "domains": ["acmelabs.com"]},
+		{"name": "Initech", "url": "https://www.bugcrowd.com/initech", "bounty": true, "swag": false, "domains": ["initech.com"]}
+	]}`
+	checkForErrors(t, os.WriteFile(path, []byte(chaos), 0600))
+	list, err := readChaosList(path)
+	checkForErrors(t, err)
+
+	// The exact name wins over the partial matches
+	prog, err := list.find("acme")
+	checkForErrors(t, err)
+	equals(t, "Acme", prog.Name)
+	prog, err = list.find("init")
+	checkForErrors(t, err)
+	equals(t, "Initech", prog.Name)
+	_, err = list.find("ac")
+	if err == nil {
+		t.Error("An ambiguous company name was accepted")
+	}
+	_, err = list.find("hooli")
+	if err == nil {
+		t.Error("An unknown company name was accepted")
+	}
+
+	prog, _ = list.find("acme")
+	bundle := prog.toScopeBundle(path)
+	equals(t, scopeBundleProgram{Name: "Acme", Platform: "hackerone", URL: "https://hackerone.com/acme"}, bundle.Program)
+	equals(t, []scopeBundleEntry{{Scope: "acme.com"}, {Scope: "*.acme.com"}, {Scope: "acme.io"}, {Scope: "*.acme.io"}}, bundle.InScope)
+	equals(t, "bugcrowd", chaosPlatform("https://www.bugcrowd.com/initech"))
+	equals(t, "", chaosPlatform("https://acmelabs.com/security"))
+
+	// The bundle can be read back with --scope-bundle
+	var buffer bytes.Buffer
+	checkForErrors(t, writeScopeBundle(&buffer, bundle))
+	parsed, err := parseScopeBundle(buffer.String())
+	checkForErrors(t, err)
+	equals(t, bundle.InScope, parsed.InScope)
+}
+
+func Test_compareLiveScopes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><script src="https://cdn.example.com/app.js"></script></head><body>
+			<h2>In scope</h2><ul><li>*.example.com</li><li>https://API.example.org/v2</li><li>new.example.org</li></ul>
+			<p>Report to security&#64;example.com. Powered by <a href="https://hackerone.com">HackerOne</a>.</p>
+		</body></html>`)
+	}))
+	defer server.Close()
+	page, err := fetchProgramPage(context.Background(), server.URL)
+	checkForErrors(t, err)
+	// The download stops with the context of the run
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = fetchProgramPage(ctx, server.URL)
+	equals(t, true, errors.Is(err, context.Canceled))
+
+	// The hosts of the scripts and links aren't part of the text of the page, and the hosts under the wildcards are covered by them
+	comparison := compareLiveScopes([]string{"*.example.com", "api.example.org:443", "10.0.0.0/8"}, page)
+	equals(t, liveScopeComparison{cached: 2, unknown: []string{"new.example.org"}}, comparison)
+	equals(t, true, comparison.diverges())
+
+	comparison = compareLiveScopes([]string{"*.example.com", "api.example.org", "new.example.org", "old.example.org", "legacy.example.org"}, page)
+	equals(t, []string{"old.example.org", "legacy.example.org"}, comparison.missing)
+	equals(t, false, comparison.diverges())
+	comparison = compareLiveScopes([]string{"old.example.net", "legacy.example.net"}, page)
+	equals(t, true, comparison.diverges())
+
+	equals(t, "a, b, c, d, e and 2 more", listLiveScopes([]string{"a", "b", "c", "d", "e", "f", "g"}))
+}
+
+func Test_databaseDelta(t *testing.T) {
+	directory := t.TempDir()
+	previousPath := filepath.Join(directory, "previous.json")
+	currentPath := filepath.Join(directory, "current.json")
+	checkForErrors(t, os.WriteFile(previousPath, []byte(`{"pgms": [{"name": "Acme", "slug": "acme", "scopes": {"in_scopes": []}}, {"name": "Initech", "slug": "initech"}, {"name": "Umbrella", "slug": ""}]}`), 0600))
+	checkForErrors(t, os.WriteFile(currentPath, []byte(`{"pgms": [{"name": "Acme", "slug": "acme", "scopes": {"in_scopes": [{"scope": "*.acme.com"}]}}, {"name": "Umbrella", "slug": ""}, {"name": "Hooli", "slug": "hooli"}, {"name": "Hooli", "slug": "hooli"}]}`), 0600))
+
+	previous, err := programDigests(previousPath)
+	checkForErrors(t, err)
+	current, err := programDigests(currentPath)
+	checkForErrors(t, err)
+	equals(t, databaseDelta{Added: 2, Changed: 1, Removed: 1}, diffProgramDigests(previous, current))
+	equals(t, "2 programs added, 1 changed, 1 removed", diffProgramDigests(previous, current).String())
+
+	// The ETag is sent back on the next update
+	checkForErrors(t, saveDatabaseETag(currentPath, `"abc"`))
+	req, err := http.NewRequest(http.MethodGet, "https://firebounty.com", nil)
+	checkForErrors(t, err)
+	setConditionalHeaders(req, currentPath)
+	equals(t, `"abc"`, req.Header.Get("If-None-Match"))
+	if req.Header.Get("If-Modified-Since") == "" {
+		t.Error("The If-Modified-Since header wasn't set")
+	}
+	checkForErrors(t, saveDatabaseETag(currentPath, ""))
+	checkForErrors(t, saveDatabaseETag(currentPath, ""))
+	req.Header = http.Header{}
+	setConditionalHeaders(req, currentPath)
+	equals(t, "", req.Header.Get("If-None-Match"))
+}
+
+func Test_verifyDatabaseFile(t *testing.T) {
+	defer func(previousPath string) {
+		firebountyJSONPath, databaseChecksumURL, databaseSignatureURL, databasePublicKeyPath = previousPath, "", "", ""
+	}(firebountyJSONPath)
+	directory := t.TempDir()
+	firebountyJSONPath = filepath.Join(directory, "firebounty.json")
+	database := []byte(`{"pgms": []}`)
+	checkForErrors(t, os.WriteFile(firebountyJSONPath, database, 0600))
+
+	digest := sha256.Sum256(database)
+	checksum := hex.EncodeToString(digest[:])
+	checkForErrors(t, verifyDatabaseFile(firebountyJSONPath, []byte(checksum+"\n"), nil))
+	checkForErrors(t, verifyDatabaseFile(firebountyJSONPath, []byte(strings.Repeat("0", 64)+"  other.json\n"+checksum+" *firebounty.json\n"), nil))
+	if verifyDatabaseFile(firebountyJSONPath, []byte(strings.Repeat("0", 64)), nil) == nil {
+		t.Error("A wrong checksum was accepted")
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	checkForErrors(t, err)
+	databasePublicKeyPath = filepath.Join(directory, "key.pub")
+	checkForErrors(t, os.WriteFile(databasePublicKeyPath, []byte(base64.StdEncoding.EncodeToString(publicKey)), 0600))
+	signature := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, database)))
+	checkForErrors(t, verifyDatabaseFile(firebountyJSONPath, nil, signature))
+	if verifyDatabaseFile(firebountyJSONPath, nil, []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte("tampered"))))) == nil {
+		t.Error("A wrong signature was accepted")
+	}
+
+	// The cached database is verified with the saved signature
+	databaseSignatureURL = "https://example.com/firebounty.json.sig"
+	err = verifyCachedDatabase(firebountyJSONPath)
+	if err == nil {
+		t.Error("A database without a saved signature was accepted")
+	}
+	checkForErrors(t, saveDatabaseVerification(firebountyJSONPath, nil, signature))
+	checkForErrors(t, verifyCachedDatabase(firebountyJSONPath))
+	checkForErrors(t, os.WriteFile(firebountyJSONPath, []byte(`{"pgms": [{"name": "Evil"}]}`), 0600))
+	if verifyCachedDatabase(firebountyJSONPath) == nil {
+		t.Error("A database that was modified on disk was accepted")
+	}
+}
+
+func Test_loadClientTLSConfig(t *testing.T) {
+	defer func() { clientTLSConfig = nil }()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strconv.Itoa(len(r.TLS.PeerCertificates))))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	// The test server's own certificate is both the CA and the client certificate
+	certificate := server.TLS.Certificates[0]
+	privateKey, err := x509.MarshalPKCS8PrivateKey(certificate.PrivateKey)
+	checkForErrors(t, err)
+	directory := t.TempDir()
+	certPath := filepath.Join(directory, "client.pem")
+	caPath := filepath.Join(directory, "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKey})
+	checkForErrors(t, os.WriteFile(certPath, append(certPEM, keyPEM...), 0600))
+	checkForErrors(t, os.WriteFile(caPath, certPEM, 0600))
+
+	clientTLSConfig, err = loadClientTLSConfig(certPath, "", caPath)
+	checkForErrors(t, err)
+	resp, err := newHTTPClient(5 * time.Second).Get(server.URL)
+	checkForErrors(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	checkForErrors(t, err)
+	equals(t, "1", string(body))
+
+	// Without the CA bundle, the server isn't trusted
+	clientTLSConfig = nil
+	_, err = newHTTPClient(5 * time.Second).Get(server.URL)
+	if err == nil {
+		t.Error("A server with an untrusted certificate was accepted")
+	}
+
+	config, err := loadClientTLSConfig("", "", "")
+	checkForErrors(t, err)
+	equals(t, (*tls.Config)(nil), config)
+	_, err = loadClientTLSConfig("", certPath, "")
+	if err == nil {
+		t.Error("A client key without a certificate was accepted")
+	}
+	_, err = loadClientTLSConfig("", "", certPath+".missing")
+	if err == nil {
+		t.Error("A missing CA bundle was accepted")
+	}
+}
+
+func Test_createBuckets(t *testing.T) {
+	directory := filepath.Join(t.TempDir(), "buckets")
+	programs := []multiProgram{{name: "Example", slug: "example"}, {name: "Example (Bugcrowd)"}}
+	buckets, closeBuckets, err := createBuckets(directory, programs)
+	checkForErrors(t, err)
+	buckets[0].WriteString("a.example.com\n")
+	checkForErrors(t, closeBuckets())
+
+	data, err := os.ReadFile(filepath.Join(directory, "example.txt"))
+	checkForErrors(t, err)
+	equals(t, "a.example.com\n", string(data))
+	// Programs without a slug are named after the program
+	data, err = os.ReadFile(filepath.Join(directory, "example--bugcrowd-.txt"))
+	checkForErrors(t, err)
+	equals(t, "", string(data))
+}
+
+func Test_githubAnnotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.txt")
+	checkForErrors(t, os.WriteFile(path, []byte("a.example.com\n\n# comment\n  admin.example.com\nfoo bar\nadmin.example.com\n"), 0600))
+	lineNumbers, err := targetLineNumbers(path)
+	checkForErrors(t, err)
+	equals(t, map[string]int{"a.example.com": 1, "admin.example.com": 4, "foo bar": 5}, lineNumbers)
+
+	equals(t, `::error file=scans/targets.txt,line=4,title=Out-of-scope target::"admin.example.com" is out of scope.`,
+		targetAnnotation(targetResult{targetStr: "admin.example.com", inputLine: "admin.example.com"}, "scans/targets.txt", lineNumbers).String())
+	equals(t, `::warning title=Unsure target::"b.other.com" isn't matched by any in-scope or out-of-scope rule, so it might not be in scope.`,
+		targetAnnotation(targetResult{targetStr: "b.other.com", isInsideScope: true, isUnsure: true}, "", nil).String())
+	// Without --include-unsure, the unmatched targets are unsure too
+	equals(t, `::warning title=Unsure target::"b.other.com" isn't matched by any in-scope or out-of-scope rule, so it might not be in scope.`,
+		targetAnnotation(targetResult{targetStr: "b.other.com", isUnmatched: true}, "", nil).String())
+	equals(t, "::warning file=C%3A/targets%2C1.txt::100%25%0Adone",
+		githubAnnotation{level: "warning", file: "C:/targets,1.txt", message: "100%\ndone"}.String())
+}
+
+func Test_hyperlink(t *testing.T) {
+	equals(t, "example.com", hyperlink("example.com", "https://example.com"))
+
+	hyperlinksEnabled = true
+	defer func() { hyperlinksEnabled = false }()
+	equals(t, "\033]8;;https://example.com\033\\example.com\033]8;;\033\\", hyperlink("example.com", "https://example.com"))
+	// URLs with control characters could inject their own escape sequences
+	equals(t, "Example", hyperlink("Example", "https://example.com/\033]8;;evil\033\\"))
+	equals(t, "Example", hyperlink("Example", ""))
+
+	target, err := parseTarget("https://a.example.com:8443/login")
+	checkForErrors(t, err)
+	equals(t, "https://a.example.com:8443", hostURL(target))
+	ip := net.ParseIP("2001:db8::1")
+	equals(t, "https://[2001:db8::1]", hostURL(&ip))
+	equals(t, "", hostURL(&MobileApp{}))
+}
+
+func Test_applyColorTheme(t *testing.T) {
+	defer applyColorTheme(nil)
+
+	config, err := parseYAML("color-theme: 16-color\ncolors:\n  warning: bright-yellow\n  info: \"#00CCFF\"\n  error: nonsense\n")
+	checkForErrors(t, err)
+	hideWarnings = true
+	defer func() { hideWarnings = false }()
+	applyColorTheme(config.(map[string]interface{}))
+	equals(t, "\033[32m", colorGood)
+	equals(t, "\033[93m", colorWarning)
+	// Invalid colors are ignored
+	equals(t, "\033[31m", colorError)
+	equals(t, "\033[38;2;0;204;255m", colorInfo)
+	equals(t, "\033[0m", colorReset)
+
+	applyColorTheme(map[string]interface{}{"color-theme": "none"})
+	equals(t, "", colorGood+colorWarning+colorError+colorInfo+colorReset)
+
+	applyColorTheme(nil)
+	equals(t, "\033[38;2;37;255;36m", colorGood)
+}
+
+func Test_sourceExplicitLevels(t *testing.T) {
+	config, err := parseYAML("explicit-levels:\n  firebounty: 3\n  files: 0\n")
+	checkForErrors(t, err)
+	firebountyLevel, fileLevel := configSourceExplicitLevels(config.(map[string]interface{}))
+	equals(t, 3, firebountyLevel)
+	equals(t, 0, fileLevel)
+	hideWarnings = true
+	defer func() { hideWarnings = false }()
+	firebountyLevel, fileLevel = configSourceExplicitLevels(map[string]interface{}{"explicit-levels": map[string]interface{}{"firebounty": "7"}})
+	equals(t, noSourceExplicitLevel, firebountyLevel)
+	equals(t, noSourceExplicitLevel, fileLevel)
+
+	defer func() { scopeDetails = map[interface{}]ruleDetails{}; explicitLevelOverrides = nil }()
+	lineDetails := map[string]ruleDetails{}
+	recordScopeSource(lineDetails, "Example", []string{"*.example.com", "example.org", "shared.example.io"})
+	recordScopeSource(lineDetails, ".inscope", []string{"example.net", "shared.example.io"})
+	inscopeScopes, err := parseAllLines([]string{"*.example.com", "example.org", "shared.example.io", "example.net"}, true, false, lineDetails)
+	checkForErrors(t, err)
+	explicitLevelOverrides = newExplicitLevelOverrides(inscopeScopes, nil, map[string]bool{"Example": true}, int(ExplicitLevelStrict), int(ExplicitLevelSubdomains))
+
+	tests := []struct {
+		target   string
+		expected bool
+	}{
+		// The firebounty wildcards are disabled by their strict level
+		{"www.example.com", false},
+		{"example.org", true},
+		// The subdomains of the files' hostnames are matched by their level
+		{"api.example.net", true},
+		// The entries of both kinds of sources keep the --inscope-explicit-level
+		{"api.shared.example.io", false},
+	}
+	explicitLevel := int(ExplicitLevelWildcards)
+	for _, test := range tests {
+		target, err := parseTarget(test.target)
+		checkForErrors(t, err)
+		equals(t, test.expected, isInscope(&inscopeScopes, prepareTarget(target), &explicitLevel))
+	}
+
+	equals(t, map[interface{}]int(nil), newExplicitLevelOverrides(inscopeScopes, nil, nil, noSourceExplicitLevel, noSourceExplicitLevel))
+	equals(t, nil, validateSourceExplicitLevel(noSourceExplicitLevel))
+	equals(t, true, validateSourceExplicitLevel(4) != nil)
+}
+
+func Test_outputHeader(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	var company, token string
+	var chain, unsure bool
+	flags.StringVar(&company, "company", "", "")
+	flags.StringVar(&token, "serve-token", "", "")
+	flags.BoolVar(&chain, "ch", false, "")
+	flags.BoolVar(&unsure, "include-unsure", false, "")
+	checkForErrors(t, flags.Parse([]string{"--company", "Example Corp", "-ch", "--serve-token", "secret"}))
+	equals(t, []string{"-ch", "--company=Example Corp", "--serve-token=REDACTED"}, usedArguments(flags))
+
+	lineDetails := map[string]ruleDetails{}
+	recordScopeSource(lineDetails, "Example", []string{"*.example.com"})
+	recordScopeSource(lineDetails, "--scope", []string{"a.example.org"})
+	header := newOutputHeader(flags, lineDetails, "abc")
+	equals(t, []string{"--scope", "Example"}, header.ScopeSources)
+	header.Generated = "2026-01-02T03:04:05Z"
+	equals(t, "# hacker-scoper v"+currentVersion+"\n"+
+		"# Generated: 2026-01-02T03:04:05Z\n"+
+		"# Scope sources: --scope, Example\n"+
+		"# Scope hash: sha256:abc\n"+
+		"# Arguments: -ch \"--company=Example Corp\" --serve-token=REDACTED\n", header.format(false))
+	equals(t, true, strings.HasPrefix(header.format(true), `{"type":"header","version":"`+currentVersion+`"`))
+
+	// The header isn't an asset of the previous output
+	equals(t, "", previousOutputAsset("# Scope sources: --scope, Example"))
+}
+
+func Test_columnLayout(t *testing.T) {
+	split, err := columnLayout{column: 1}.split("https://a.example.com\t200  Example title")
+	checkForErrors(t, err)
+	// Without a delimiter, the title after the target isn't split into words
+	equals(t, splitLine{target: "https://a.example.com", after: "\t200  Example title", others: []string{"200  Example title"}}, split)
+
+	split, err = columnLayout{column: 2}.split("web  https://a.example.com 200 Example title  ")
+	checkForErrors(t, err)
+	equals(t, splitLine{target: "https://a.example.com", before: "web  ", after: " 200 Example title  ", others: []string{"web", "200 Example title"}}, split)
+
+	split, err = columnLayout{column: 1}.split("a.example.com")
+	checkForErrors(t, err)
+	equals(t, splitLine{target: "a.example.com"}, split)
+
+	split, err = columnLayout{delimiter: ",", column: 2}.split(`web,"https://a.example.com",Example, Inc`)
+	checkForErrors(t, err)
+	equals(t, splitLine{target: "https://a.example.com", before: "web,", after: ",Example, Inc", others: []string{"web", "Example", "Inc"}}, split)
+
+	_, err = columnLayout{delimiter: ",", column: 3}.split("web,a.example.com")
+	equals(t, true, err != nil)
+
+	delimiter, err := parseColumnDelimiter("tab")
+	checkForErrors(t, err)
+	equals(t, "\t", delimiter)
+}
+
+func Test_benchRegression(t *testing.T) {
+	for rawThreshold, expected := range map[string]float64{"10%": 10, "2.5": 2.5, " 0% ": 0} {
+		threshold, err := parseBenchThreshold(rawThreshold)
+		checkForErrors(t, err)
+		equals(t, expected, threshold)
+	}
+	for _, rawThreshold := range []string{"-5%", "ten", "%"} {
+		_, err := parseBenchThreshold(rawThreshold)
+		equals(t, true, err != nil)
+	}
+
+	throughput := benchMetric{current: 85, baseline: 100, higherIsBetter: true}
+	equals(t, -15.0, throughput.change())
+	equals(t, true, throughput.regressed(10))
+	equals(t, false, throughput.regressed(20))
+	// Faster runs are never regressions
+	equals(t, false, benchMetric{current: 200, baseline: 100, higherIsBetter: true}.regressed(0))
+	allocs := benchMetric{current: 105, baseline: 100}
+	equals(t, false, allocs.regressed(10))
+	equals(t, true, allocs.regressed(4))
+	equals(t, true, benchMetric{current: 1, baseline: 0}.regressed(10))
+
+	result, err := runBench(50, 1)
+	checkForErrors(t, err)
+	equals(t, 50, result.Targets)
+	equals(t, benchWorkloadVersion, result.Workload)
+	equals(t, true, result.TargetsPerSecond > 0)
+}
+
+func Test_startPprofServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	address, err := startPprofServer(ctx, 0)
+	checkForErrors(t, err)
+	equals(t, true, strings.HasPrefix(address, "127.0.0.1:"))
+
+	resp, err := http.Get("http://" + address + "/debug/pprof/cmdline")
+	checkForErrors(t, err)
+	resp.Body.Close()
+	equals(t, http.StatusOK, resp.StatusCode)
+
+	equals(t, nil, validatePprofPort(6060))
+	equals(t, true, validatePprofPort(70000) != nil)
+}
+
+func Test_seenSet(t *testing.T) {
+	for rawSize, expected := range map[string]int64{"512": 512, "1KB": 1024, "2m": 2 << 20, "1.5G": 3 << 29, "1 GiB": 1 << 30} {
+		size, err := parseMemorySize(rawSize)
+		checkForErrors(t, err)
+		equals(t, expected, size)
+	}
+	for _, rawSize := range []string{"", "0", "-1MB", "10XB", "MB"} {
+		_, err := parseMemorySize(rawSize)
+		equals(t, true, err != nil)
+	}
+
+	// A budget of two assets, so that the rest are spilled to disk
+	set := newSeenSet(newMemoryBudget(int64(2 * (len("a0.example.com") + mapEntryOverhead))))
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 5000; i++ {
+			isNew, err := set.add("a" + strconv.Itoa(i) + ".example.com")
+			checkForErrors(t, err)
+			equals(t, round == 0, isNew)
+		}
+	}
+	equals(t, true, set.spilled())
+	path := set.disk.file.Name()
+	checkForErrors(t, set.close())
+	_, err := os.Stat(path)
+	equals(t, true, errors.Is(err, os.ErrNotExist))
+
+	unlimited := newSeenSet(nil)
+	isNew, err := unlimited.add("example.com")
+	checkForErrors(t, err)
+	equals(t, true, isNew)
+	equals(t, false, unlimited.spilled())
+}
+
+func Benchmark_matchingScopeForURL(b *testing.B) {
+	var inscopeScopes []interface{}
+	for i := 0; i < 100; i++ {
+		inscopeScopes = append(inscopeScopes, "company"+strconv.Itoa(i)+".com")
+	}
+	wildcard, err := parseScope("*.example.net", false)
+	checkForErrors(b, err)
+	inscopeScopes = append(inscopeScopes, wildcard)
+	target, err := url.Parse("https://www.unrelated.org:8443/login")
+	checkForErrors(b, err)
+	prepared := prepareTarget(target)
+	explicitLevel := int(ExplicitLevelSubdomains)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		matchingScopeForURL(prepared, &inscopeScopes, &explicitLevel)
+	}
+}
+
+func Test_newCompanyCandidates(t *testing.T) {
+	companyNames := []string{"Example ", "Example Bugcrowd", "Other"}
+	identities := []programIdentity{{Slug: "example", URL: "https://example.com/security"}, {Slug: "example-bugcrowd"}, {Slug: "other"}}
+	choices := [][]firebountySearchMatch{
+		{{0, "example"}},
+		{{0, "example"}, {1, "example bugcrowd"}},
+	}
+
+	candidates := newCompanyCandidates("exam", choices, companyNames, identities)
+	encoded, err := json.Marshal(candidates)
+	checkForErrors(t, err)
+	equals(t, `{"query":"exam","candidates":[`+
+		`{"name":"Example","programs":[{"name":"Example","slug":"example","url":"https://example.com/security"}]},`+
+		`{"name":"Example (merged: Example, Example Bugcrowd)","programs":[{"name":"Example","slug":"example","url":"https://example.com/security"},{"name":"Example Bugcrowd","slug":"example-bugcrowd"}]}]}`, string(encoded))
+}
+
+func Test_programPageURLs(t *testing.T) {
+	prog := &Program{Url: " https://hackerone.com/example ", Firebounty_url: "https://firebounty.com/example"}
+	equals(t, []string{"https://hackerone.com/example", "https://firebounty.com/example"}, programPageURLs(prog))
+
+	// Only the http(s) URLs are handed to the system opener
+	prog = &Program{Url: "file:///etc/passwd", Firebounty_url: "https://firebounty.com/example"}
+	equals(t, []string{"https://firebounty.com/example"}, programPageURLs(prog))
+	prog = &Program{Url: "javascript:alert(1)", Firebounty_url: ""}
+	equals(t, 0, len(programPageURLs(prog)))
+}
+
+func Test_interruptedRun_cleanup(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "output.txt")
+	f, err := os.Create(outputPath)
+	checkForErrors(t, err)
+	defer f.Close()
+	writer := newAsyncWriter(f, 0, 0)
+	defer writer.Close()
+	writer.WriteString("a.example.com\n")
+
+	// A budget of a single asset, so that the seen assets are spilled to disk
+	seenAssets := newSeenSet(newMemoryBudget(int64(len("a.example.com") + mapEntryOverhead)))
+	for _, asset := range []string{"a.example.com", "b.example.com"} {
+		_, err = seenAssets.add(asset)
+		checkForErrors(t, err)
+	}
+	equals(t, true, seenAssets.spilled())
+	spillPath := seenAssets.disk.file.Name()
+
+	var processedTargets, inscopeTargets atomic.Int64
+	processedTargets.Store(2)
+	inscopeTargets.Store(1)
+	run := &interruptedRun{
+		writer:           writer,
+		seenAssets:       seenAssets,
+		showStats:        true,
+		summaryRequests:  make(chan chan string),
+		processedTargets: &processedTargets,
+		inscopeTargets:   &inscopeTargets,
+	}
+
+	// The summary is asked to the goroutine that handles the results
+	results := make(chan targetResult)
+	go receiveResults(results, run.summaryRequests, func() string { return "[STATS]: summary" }, func(targetResult) {})
+	var stderr strings.Builder
+	run.cleanup(&stderr)
+	close(results)
+
+	equals(t, "[STATS]: summary\n", stderr.String())
+	output, err := os.ReadFile(outputPath)
+	checkForErrors(t, err)
+	equals(t, "a.example.com\n", string(output))
+	_, err = os.Stat(spillPath)
+	equals(t, true, errors.Is(err, os.ErrNotExist))
+
+	// Without --stats, the processed targets are counted instead
+	run.showStats, run.seenAssets = false, nil
+	stderr.Reset()
+	run.cleanup(&stderr)
+	equals(t, "[INFO]: Interrupted after processing 2 targets, 1 of which were in scope.\n", stderr.String())
+}
+
+func Test_anyMode(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		args     []string
+		targets  string
+		exitCode int
+	}{
+		// Since a finished run exits with code 1, the run must stop at the first in-scope target
+		{"in-scope target", []string{"--scope", "*.example.com"}, "www.other.com\nwww.example.com\nadmin.example.com\n", 0},
+		{"no in-scope targets", []string{"--scope", "*.example.com", "--exclude", "admin.example.com"}, "www.other.com\nadmin.example.com\n", 1},
+		{"no targets", []string{"--scope", "*.example.com"}, "", 1},
+		{"unsure targets don't count", []string{"--scope", "*.example.com", "--include-unsure"}, "www.other.com\n", 1},
+		{"in-scope target after the unsure ones", []string{"--scope", "*.example.com", "--include-unsure"}, "www.other.com\nwww.example.com\n", 0},
+		{"with --output", []string{"--scope", "*.example.com", "--output", filepath.Join(dir, "out.txt")}, "www.example.com\n", 2},
+		{"with --resume", []string{"--scope", "*.example.com", "--resume", filepath.Join(dir, "resume.json")}, "www.example.com\n", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exitCode, stdout := runMain(t, dir, test.targets, append(test.args, "--any")...)
+			equals(t, test.exitCode, exitCode)
+			// --any only reports through the exit code
+			equals(t, "", stdout)
+		})
+	}
+}
+
+func Test_assumeInscope(t *testing.T) {
+	// The .inscope and .noscope files of the current directory are ignored
+	dir := t.TempDir()
+	checkForErrors(t, os.WriteFile(filepath.Join(dir, ".inscope"), []byte("*.other.com\n"), 0600))
+	checkForErrors(t, os.WriteFile(filepath.Join(dir, ".noscope"), []byte("www.example.com\n"), 0600))
+	targets := "www.example.com\nadmin.example.com\nexample.com\nwww.other.com\n"
+
+	exitCode, stdout := runMain(t, dir, targets, "--assume-inscope", "*.example.com", "-ch")
+	equals(t, 0, exitCode)
+	equals(t, "www.example.com\nadmin.example.com\n", stdout)
+
+	// Together with --exclude
+	exitCode, stdout = runMain(t, dir, targets, "--assume-inscope", "*.example.com", "--exclude", "admin.example.com", "-ch")
+	equals(t, 0, exitCode)
+	equals(t, "www.example.com\n", stdout)
+
+	scopesFile := filepath.Join(dir, "scopes.txt")
+	checkForErrors(t, os.WriteFile(scopesFile, []byte("*.example.com\n"), 0600))
+	conflicts := map[string][]string{
+		"company":       {"--company", "example"},
+		"scopes file":   {"--inscope-file", scopesFile},
+		"scope bundle":  {"--scope-bundle", scopesFile},
+		"pasted scopes": {"--paste-scope", scopesFile},
+		"scope plugin":  {"--scope-plugin", "scopes-plugin"},
+		"last company":  {"--last"},
+	}
+	for name, args := range conflicts {
+		t.Run(name, func(t *testing.T) {
+			exitCode, stdout := runMain(t, dir, targets, append(args, "--assume-inscope", "*.example.com", "-ch")...)
+			equals(t, 2, exitCode)
+			equals(t, "", stdout)
+		})
+	}
+}
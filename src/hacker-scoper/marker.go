@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// A file with this name pins a project directory, and every directory under it, to a program.
+const projectMarkerFilename = ".hacker-scoper"
+
+// projectMarker is the content of a .hacker-scoper file. Exactly one of the fields is set, like:
+//
+//	slug: example
+//
+// or:
+//
+//	scope-bundle: scopes/program.yaml
+type projectMarker struct {
+	// The slug of the program in the firebounty database
+	Slug string
+	// The path of a scope bundle. Relative paths are relative to the directory of the .hacker-scoper file.
+	ScopeBundle string
+}
+
+// readProjectMarker reads the .hacker-scoper file at the given path.
+func readProjectMarker(path string) (*projectMarker, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- The path is found by searchForFileBackwards.
+	if err != nil {
+		return nil, err
+	}
+	return parseProjectMarker(string(data), filepath.Dir(path))
+}
+
+// parseProjectMarker parses the content of a .hacker-scoper file found in the given directory.
+func parseProjectMarker(data string, directory string) (*projectMarker, error) {
+	root, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	rootMap, ok := root.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("expected either \"slug: program-slug\" or \"scope-bundle: /path/to/program.yaml\"")
+	}
+
+	marker := &projectMarker{}
+	for key, value := range rootMap {
+		str, ok := value.(string)
+		if !ok {
+			return nil, errors.New("the value of \"" + key + "\" must be a string")
+		}
+		switch key {
+		case "slug":
+			marker.Slug = str
+		case "scope-bundle":
+			marker.ScopeBundle = expandHomeDirectory(str)
+			if marker.ScopeBundle != "" && !isRemotePath(marker.ScopeBundle) && !filepath.IsAbs(marker.ScopeBundle) {
+				marker.ScopeBundle = filepath.Join(directory, marker.ScopeBundle)
+			}
+		default:
+			return nil, errors.New("unknown key \"" + key + "\"")
+		}
+	}
+
+	if (marker.Slug == "") == (marker.ScopeBundle == "") {
+		return nil, errors.New("expected either \"slug: program-slug\" or \"scope-bundle: /path/to/program.yaml\"")
+	}
+	return marker, nil
+}
+
+// findCompanyBySlug returns the index of the program with the given slug in the firebounty database.
+func findCompanyBySlug(jsonPath string, slug string) (int, error) {
+	companyIndex := -1
+	var decodeErr error
+	err := iterateRawPrograms(jsonPath, func(index int, rawProgram json.RawMessage) bool {
+		var program struct {
+			Slug string `json:"slug"`
+		}
+		decodeErr = json.Unmarshal(rawProgram, &program)
+		if decodeErr != nil {
+			return false
+		}
+		if program.Slug == slug {
+			companyIndex = index
+			return false
+		}
+		return true
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	if err != nil {
+		return -1, err
+	}
+	if companyIndex == -1 {
+		return -1, errors.New("no program with the slug \"" + slug + "\" was found in the firebounty database")
+	}
+	return companyIndex, nil
+}
+
+// closestFile returns whichever of the paths found by searchForFileBackwards is in the deepest directory, or an empty string if none were found.
+func closestFile(paths ...string) string {
+	closest := ""
+	for _, path := range paths {
+		if path != "" && len(filepath.Dir(path)) > len(filepath.Dir(closest)) {
+			closest = path
+		}
+	}
+	return closest
+}
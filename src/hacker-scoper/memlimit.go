@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// The estimated memory used by every entry of a map of strings, on top of the bytes of the string itself
+const mapEntryOverhead = 48
+
+// memoryBudget is the memory that the seen-set of --unique and the verdicts of --cache-verdicts can use together, set with "--max-memory".
+// It's an estimate of the size of their entries, not of the whole heap. A nil budget is unlimited.
+type memoryBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+// newMemoryBudget returns a budget of the given amount of bytes, or nil if the limit is 0.
+func newMemoryBudget(limit int64) *memoryBudget {
+	if limit == 0 {
+		return nil
+	}
+	return &memoryBudget{limit: limit}
+}
+
+// reserve takes the given amount of bytes from the budget. It returns false, without taking anything, if there isn't enough left.
+func (budget *memoryBudget) reserve(size int64) bool {
+	if budget == nil {
+		return true
+	}
+	if budget.used.Add(size) > budget.limit {
+		budget.used.Add(-size)
+		return false
+	}
+	return true
+}
+
+// use takes the given amount of bytes from the budget, even if there isn't enough left, for the memory that is already in use.
+func (budget *memoryBudget) use(size int64) {
+	if budget != nil {
+		budget.used.Add(size)
+	}
+}
+
+// release gives back the given amount of bytes to the budget.
+func (budget *memoryBudget) release(size int64) {
+	if budget != nil {
+		budget.used.Add(-size)
+	}
+}
+
+// parseMemorySize parses an amount of memory such as "512MB", "2G" or "1048576". The units are powers of 1024.
+func parseMemorySize(rawSize string) (int64, error) {
+	rawSize = strings.ToLower(strings.TrimSpace(rawSize))
+	unitStart := strings.IndexFunc(rawSize, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	unit := ""
+	if unitStart != -1 {
+		rawSize, unit = rawSize[:unitStart], strings.TrimSpace(rawSize[unitStart:])
+	}
+
+	var multiplier float64
+	switch strings.TrimSuffix(strings.TrimSuffix(unit, "b"), "i") {
+	case "":
+		multiplier = 1
+	case "k":
+		multiplier = 1 << 10
+	case "m":
+		multiplier = 1 << 20
+	case "g":
+		multiplier = 1 << 30
+	case "t":
+		multiplier = 1 << 40
+	default:
+		return 0, errors.New("unknown unit \"" + unit + "\"")
+	}
+
+	amount, err := strconv.ParseFloat(rawSize, 64)
+	if err != nil {
+		return 0, err
+	}
+	size := int64(amount * multiplier)
+	if size <= 0 {
+		return 0, errors.New("the amount of memory must be greater than 0")
+	}
+	return size, nil
+}
+
+// seenSet remembers the assets that were already printed by --unique. The assets are kept in memory until the memory budget runs out,
+// and are then moved to a temporary file on disk, which is slower but only limited by the disk space.
+// It's only used by the goroutine that prints the results, so it isn't safe for concurrent use.
+type seenSet struct {
+	budget      *memoryBudget
+	memory      map[string]struct{}
+	memoryBytes int64
+	// Set once the assets don't fit in the budget anymore
+	disk *diskSeenSet
+}
+
+func newSeenSet(budget *memoryBudget) *seenSet {
+	return &seenSet{budget: budget, memory: map[string]struct{}{}}
+}
+
+// add adds an asset to the set, and reports whether it wasn't in it yet.
+func (set *seenSet) add(asset string) (bool, error) {
+	if set.disk != nil {
+		return set.disk.add(seenHash(asset))
+	}
+	if _, isSeen := set.memory[asset]; isSeen {
+		return false, nil
+	}
+
+	size := int64(len(asset) + mapEntryOverhead)
+	if set.budget.reserve(size) {
+		set.memory[asset] = struct{}{}
+		set.memoryBytes += size
+		return true, nil
+	}
+	err := set.spill()
+	if err != nil {
+		return false, err
+	}
+	return set.disk.add(seenHash(asset))
+}
+
+// spill moves the assets of the set to a temporary file, and gives their memory back to the budget.
+func (set *seenSet) spill() error {
+	disk, err := newDiskSeenSet(initialDiskSeenSlots)
+	if err != nil {
+		return err
+	}
+	for asset := range set.memory {
+		_, err = disk.add(seenHash(asset))
+		if err != nil {
+			disk.close() // #nosec G104 -- The error of the spill is more relevant.
+			return err
+		}
+	}
+	set.disk = disk
+	set.memory = nil
+	set.budget.release(set.memoryBytes)
+	set.memoryBytes = 0
+	return nil
+}
+
+// spilled reports whether the set was moved to disk.
+func (set *seenSet) spilled() bool {
+	return set.disk != nil
+}
+
+// close deletes the temporary file of the set, if any.
+func (set *seenSet) close() error {
+	if set.disk == nil {
+		return nil
+	}
+	return set.disk.close()
+}
+
+// The size of the slots of the temporary file of a seenSet, which are 128-bit hashes of the assets
+const seenSlotSize = 16
+
+// The amount of slots of a new temporary file (1 MiB)
+const initialDiskSeenSlots = 1 << 16
+
+// diskSeenSet is a hash set of 128-bit hashes stored in a temporary file, with open addressing. Empty slots are all zeros.
+// Only the hashes of the assets are written to disk, so the assets themselves never are.
+type diskSeenSet struct {
+	file *os.File
+	// A power of 2
+	slots uint64
+	used  uint64
+}
+
+func newDiskSeenSet(slots uint64) (*diskSeenSet, error) {
+	file, err := os.CreateTemp("", "hacker-scoper-seen-*")
+	if err != nil {
+		return nil, err
+	}
+	// The file is filled with zeros (empty slots) without writing them, as a sparse file where supported
+	err = file.Truncate(int64(slots * seenSlotSize))
+	if err != nil {
+		file.Close()           // #nosec G104 -- The error of the truncation is more relevant.
+		os.Remove(file.Name()) // #nosec G104
+		return nil, err
+	}
+	return &diskSeenSet{file: file, slots: slots}, nil
+}
+
+// seenHash returns the 128-bit hash of an asset. It's never all zeros, since that's an empty slot.
+func seenHash(asset string) [seenSlotSize]byte {
+	sum := sha256.Sum256([]byte(asset))
+	var hash [seenSlotSize]byte
+	copy(hash[:], sum[:seenSlotSize])
+	if hash == ([seenSlotSize]byte{}) {
+		hash[0] = 1
+	}
+	return hash
+}
+
+// add adds a hash to the set, and reports whether it wasn't in it yet. The file is doubled when it's half full, so that the lookups stay short.
+func (set *diskSeenSet) add(hash [seenSlotSize]byte) (bool, error) {
+	if (set.used+1)*2 > set.slots {
+		err := set.grow()
+		if err != nil {
+			return false, err
+		}
+	}
+	isNew, err := set.insert(hash)
+	if isNew {
+		set.used++
+	}
+	return isNew, err
+}
+
+// insert writes a hash in its slot, or in the next empty one, unless it's already there.
+func (set *diskSeenSet) insert(hash [seenSlotSize]byte) (bool, error) {
+	var slot [seenSlotSize]byte
+	index := binary.LittleEndian.Uint64(hash[:8]) & (set.slots - 1)
+	for {
+		offset := int64(index * seenSlotSize)
+		_, err := set.file.ReadAt(slot[:], offset)
+		if err != nil {
+			return false, err
+		}
+		if slot == hash {
+			return false, nil
+		}
+		if slot == ([seenSlotSize]byte{}) {
+			_, err = set.file.WriteAt(hash[:], offset)
+			return err == nil, err
+		}
+		index = (index + 1) & (set.slots - 1)
+	}
+}
+
+// grow moves the hashes to a new file with twice as many slots.
+func (set *diskSeenSet) grow() error {
+	bigger, err := newDiskSeenSet(set.slots * 2)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReaderSize(io.NewSectionReader(set.file, 0, int64(set.slots*seenSlotSize)), 1<<20)
+	var slot [seenSlotSize]byte
+	for i := uint64(0); i < set.slots; i++ {
+		_, err = io.ReadFull(reader, slot[:])
+		if err == nil && slot != ([seenSlotSize]byte{}) {
+			_, err = bigger.insert(slot)
+		}
+		if err != nil {
+			bigger.close() // #nosec G104 -- The error of the copy is more relevant.
+			return err
+		}
+	}
+	bigger.used = set.used
+
+	err = set.close()
+	*set = *bigger
+	return err
+}
+
+// close deletes the temporary file.
+func (set *diskSeenSet) close() error {
+	set.file.Close() // #nosec G104 -- The file is deleted anyway.
+	return os.Remove(set.file.Name())
+}
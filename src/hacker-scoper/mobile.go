@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Set with "--mobile-scopes". The mobile app scopes of the programs are matched against the targets that are app IDs, like Android package names and iOS bundle IDs.
+var mobileScopesEnabled bool
+
+// The prefix of the Android app scopes and targets, like "android:com.example.app"
+const androidPrefix = "android:"
+
+// The prefix of the iOS app scopes and targets, like "ios:com.example.app"
+const iosPrefix = "ios:"
+
+// The iTunes Search API endpoint that maps App Store IDs to bundle IDs. It's a variable so that the tests can replace it.
+var appStoreLookupURL = "https://itunes.apple.com/lookup"
+
+// The context of the App Store lookups. The App Store URLs are looked up while they're parsed, which is too deep to pass a context to, so main sets it to the context of the run.
+var appStoreLookupContext = context.Background()
+
+// Android package names are made of Java identifiers separated by dots, like "com.example.app"
+var androidPackageRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*(\.[A-Za-z][A-Za-z0-9_]*)+$`)
+
+// iOS bundle IDs are reverse-DNS strings, which may also have hyphens, like "com.example.my-app"
+var iosBundleIDRegex = regexp.MustCompile(`^[A-Za-z0-9-]+(\.[A-Za-z0-9_-]+)+$`)
+
+// The App Store ID in the path of an App Store URL, like the "id123456789" of "https://apps.apple.com/us/app/example/id123456789"
+var appStoreIDRegex = regexp.MustCompile(`/id([0-9]+)/?$`)
+
+// MobileApp is the ID of a mobile app, like the Android package name "com.example.app".
+// As a scope, a trailing ".*" matches every app whose ID starts with the rest of it, like "com.example.*". As a target, it may have a version, like "com.example.app:1.2.3".
+type MobileApp struct {
+	// "android", "ios", or empty for the targets that are bare app IDs, which could belong to either platform
+	platform string
+	// Lowercased, since app IDs that only differ in case are almost certainly the same app. Empty for the App Store URLs whose bundle ID couldn't be looked up.
+	id string
+	// The numeric App Store ID of iOS apps listed by store link, like "123456789"
+	storeID string
+	// Set for scopes like "com.example.*"
+	isPrefix bool
+	version  string
+}
+
+// String returns the app as a scope line, like "android:com.example.app".
+func (app *MobileApp) String() string {
+	prefix := ""
+	if app.platform != "" {
+		prefix = app.platform + ":"
+	}
+	if app.isPrefix {
+		return prefix + app.id + ".*"
+	}
+	if app.id == "" {
+		return "https://apps.apple.com/app/id" + app.storeID
+	}
+	return prefix + app.id
+}
+
+// matches reports whether the app of a target is matched by an app scope.
+func (scope *MobileApp) matches(target *MobileApp) bool {
+	if target.platform != "" && scope.platform != target.platform {
+		return false
+	}
+	if scope.storeID != "" && scope.storeID == target.storeID {
+		return true
+	}
+	if target.id == "" {
+		return false
+	}
+	if scope.isPrefix {
+		return strings.HasPrefix(target.id, scope.id+".")
+	}
+	return scope.id == target.id
+}
+
+// parseAndroidApp parses an Android app ID, either as a package name with an optional version, like "com.example.app:1.2.3", or as a Google Play URL, like "https://play.google.com/store/apps/details?id=com.example.app".
+// Prefix scopes like "com.example.*" are only accepted if allowPrefix is true.
+func parseAndroidApp(line string, allowPrefix bool) *MobileApp {
+	if strings.HasPrefix(line, "https://play.google.com/") || strings.HasPrefix(line, "play.google.com/") {
+		playURL, err := parseURLWithDefaultScheme(line)
+		if err != nil || playURL.Path != "/store/apps/details" {
+			return nil
+		}
+		line = playURL.Query().Get("id")
+	}
+
+	packageName, version, _ := strings.Cut(line, ":")
+	app := &MobileApp{platform: "android", version: version}
+	if allowPrefix && strings.HasSuffix(packageName, ".*") {
+		packageName = strings.TrimSuffix(packageName, ".*")
+		app.isPrefix = true
+	}
+	if !androidPackageRegex.MatchString(packageName) {
+		return nil
+	}
+	app.id = strings.ToLower(packageName)
+	return app
+}
+
+// isAppStoreURL reports whether the line is an App Store URL, like "https://apps.apple.com/us/app/example/id123456789".
+func isAppStoreURL(line string) bool {
+	for _, host := range []string{"apps.apple.com/", "itunes.apple.com/"} {
+		if strings.HasPrefix(line, "https://"+host) || strings.HasPrefix(line, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIOSApp parses an iOS app ID, either as a bundle ID with an optional version, like "com.example.app:1.2.3", or as an App Store URL, like "https://apps.apple.com/us/app/example/id123456789".
+// The bundle IDs of App Store URLs are looked up with lookupBundleID, so that they match the bundle IDs of the same app. Prefix scopes like "com.example.*" are only accepted if allowPrefix is true.
+func parseIOSApp(line string, allowPrefix bool) *MobileApp {
+	if isAppStoreURL(line) {
+		storeURL, err := parseURLWithDefaultScheme(line)
+		if err != nil {
+			return nil
+		}
+		match := appStoreIDRegex.FindStringSubmatch(storeURL.Path)
+		if match == nil {
+			return nil
+		}
+		return &MobileApp{platform: "ios", id: lookupBundleID(match[1]), storeID: match[1]}
+	}
+
+	bundleID, version, _ := strings.Cut(line, ":")
+	app := &MobileApp{platform: "ios", version: version}
+	if allowPrefix && strings.HasSuffix(bundleID, ".*") {
+		bundleID = strings.TrimSuffix(bundleID, ".*")
+		app.isPrefix = true
+	}
+	if !iosBundleIDRegex.MatchString(bundleID) {
+		return nil
+	}
+	app.id = strings.ToLower(bundleID)
+	return app
+}
+
+// parseMobileAppScope parses the mobile app scopes, like "android:com.example.app", "ios:com.example.*", Google Play URLs and App Store URLs. It returns nil for every other scope.
+func parseMobileAppScope(line string) *MobileApp {
+	var app *MobileApp
+	switch {
+	case strings.HasPrefix(line, androidPrefix):
+		app = parseAndroidApp(strings.TrimPrefix(line, androidPrefix), true)
+	case strings.HasPrefix(line, iosPrefix):
+		app = parseIOSApp(strings.TrimPrefix(line, iosPrefix), true)
+	case strings.HasPrefix(line, "https://play.google.com/"):
+		return parseAndroidApp(line, false)
+	case isAppStoreURL(line) && strings.HasPrefix(line, "https://"):
+		return parseIOSApp(line, false)
+	}
+	if app != nil && app.version != "" {
+		return nil
+	}
+	return app
+}
+
+// parseMobileAppTarget parses the targets that are mobile app IDs, for --mobile-scopes. It returns nil for every other target.
+// App IDs look like hostnames, so bare IDs like "com.example.app" are only recognized when they would be suspicious as hostnames, and they're matched against the app scopes of both platforms. The "android:" and "ios:" prefixes, Google Play URLs and App Store URLs are always recognized.
+func parseMobileAppTarget(line string) *MobileApp {
+	switch {
+	case strings.HasPrefix(line, androidPrefix):
+		return parseAndroidApp(strings.TrimPrefix(line, androidPrefix), false)
+	case strings.HasPrefix(line, iosPrefix):
+		return parseIOSApp(strings.TrimPrefix(line, iosPrefix), false)
+	case strings.HasPrefix(line, "https://play.google.com/") || strings.HasPrefix(line, "play.google.com/"):
+		return parseAndroidApp(line, false)
+	case isAppStoreURL(line):
+		return parseIOSApp(line, false)
+	}
+	packageName, _, _ := strings.Cut(line, ":")
+	if !isAndroidPackageName(packageName) {
+		return nil
+	}
+	app := parseAndroidApp(line, false)
+	if app != nil {
+		app.platform = ""
+	}
+	return app
+}
+
+// bundleIDLookup is the lookup of the bundle ID of an App Store ID. The workers that need the same App Store ID wait for the first lookup, instead of looking it up again.
+type bundleIDLookup struct {
+	// Closed once bundleID is set
+	done     chan struct{}
+	bundleID string
+}
+
+var (
+	bundleIDCache      = map[string]*bundleIDLookup{}
+	bundleIDCacheMutex sync.Mutex
+)
+
+// lookupBundleID returns the lowercased bundle ID of the iOS app with the given App Store ID, using the iTunes Search API.
+// It returns an empty string with --offline, without --mobile-scopes, or if the lookup fails, in which case the app is only matched by its App Store ID. Every App Store ID is only looked up once.
+// The cache is only locked to find or add the lookup, so the lookups of different App Store IDs don't wait for each other.
+func lookupBundleID(storeID string) string {
+	if offlineMode || !mobileScopesEnabled {
+		return ""
+	}
+	bundleIDCacheMutex.Lock()
+	lookup, isCached := bundleIDCache[storeID]
+	if isCached {
+		bundleIDCacheMutex.Unlock()
+		<-lookup.done
+		return lookup.bundleID
+	}
+	lookup = &bundleIDLookup{done: make(chan struct{})}
+	bundleIDCache[storeID] = lookup
+	bundleIDCacheMutex.Unlock()
+
+	bundleID, err := fetchBundleID(appStoreLookupContext, storeID)
+	if err != nil {
+		warning(warnAppStoreLookup, "Unable to look up the bundle ID of the App Store app "+storeID+". It will only be matched by its App Store ID: "+err.Error())
+	}
+	lookup.bundleID = bundleID
+	close(lookup.done)
+	return bundleID
+}
+
+// fetchBundleID asks the iTunes Search API for the bundle ID of the iOS app with the given App Store ID.
+func fetchBundleID(ctx context.Context, storeID string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, appStoreLookupURL+"?id="+url.QueryEscape(storeID), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("the server replied with \"" + resp.Status + "\"")
+	}
+
+	var lookup struct {
+		Results []struct {
+			BundleID string `json:"bundleId"`
+		} `json:"results"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&lookup)
+	if err != nil {
+		return "", err
+	}
+	if len(lookup.Results) == 0 || lookup.Results[0].BundleID == "" {
+		return "", errors.New("the app isn't in the App Store")
+	}
+	return strings.ToLower(lookup.Results[0].BundleID), nil
+}
+
+// matchingScopeForMobileApp returns the first app scope that matches the app target.
+func matchingScopeForMobileApp(target *MobileApp, inscopeScopes *[]interface{}) interface{} {
+	for i := range *inscopeScopes {
+		if scope, isApp := (*inscopeScopes)[i].(*MobileApp); isApp && scope.matches(target) {
+			return scope
+		}
+	}
+	return nil
+}
+
+// mobileScopeLines returns the "android_application" and "ios_application" scopes of a firebounty scope list as app scopes, like "android:com.example.app", for --mobile-scopes.
+// Store links are kept as they are, since they're app scopes on their own.
+func mobileScopeLines(scopes []Scope) []string {
+	var lines []string
+	for _, scope := range scopes {
+		rawScope := strings.TrimSpace(scope.Scope)
+		if rawScope == "" {
+			continue
+		}
+		switch scope.Scope_type {
+		case "android_application":
+			if app := parseAndroidApp(rawScope, true); app != nil {
+				lines = append(lines, app.String())
+			}
+		case "ios_application":
+			if isAppStoreURL(rawScope) {
+				if !strings.HasPrefix(rawScope, "https://") {
+					rawScope = "https://" + rawScope
+				}
+				lines = append(lines, rawScope)
+			} else if app := parseIOSApp(rawScope, true); app != nil {
+				lines = append(lines, app.String())
+			}
+		}
+	}
+	return lines
+}
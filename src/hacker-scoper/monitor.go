@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// monitorState is what the monitor subcommand remembers between cycles, and between runs.
+type monitorState struct {
+	InScope    []string  `json:"in_scope"`
+	OutOfScope []string  `json:"out_of_scope"`
+	Assets     []string  `json:"assets"`
+	LastRun    time.Time `json:"last_run"`
+}
+
+// monitorCommand periodically refreshes the scopes of a company, re-filters a directory of targets, and reports the new in-scope assets and the scope changes.
+func monitorCommand(ctx context.Context, args []string) {
+	var company string
+	var targetsDirectory string
+	var intervalStr string
+	var statePath string
+	var runOnce bool
+	var privateTLDsAreEnabled bool
+	var reportNotifier notifier
+	var databaseIsUpdating bool
+	var tmpFile *os.File
+
+	flags := newSubcommandFlagSet("monitor")
+	flags.StringVar(&company, "c", "", "Specify the company name to lookup.")
+	flags.StringVar(&company, "company", "", "Specify the company name to lookup.")
+	flags.StringVar(&targetsDirectory, "targets-dir", "", "Directory with the files of targets to re-filter on every cycle.")
+	flags.StringVar(&intervalStr, "interval", "6h", "Time between cycles, like \"6h\" or \"1d\".")
+	flags.StringVar(&statePath, "state", "", "Where the scopes and assets of the last cycle are saved.")
+	flags.BoolVar(&runOnce, "once", false, "Run a single cycle and exit, for cron jobs.")
+	flags.BoolVar(&privateTLDsAreEnabled, "enable-private-tlds", false, "Enable the use of company scope domains with private TLDs.")
+	flags.StringVar(&reportNotifier.command, "notify-command", "", "Executable that receives the reports on stdin.")
+	flags.StringVar(&reportNotifier.webhookURL, "notify-webhook", "", "URL that receives the reports as JSON POST requests.")
+	flags.IntVar(&pprofPort, "pprof-port", 0, "Serve the net/http/pprof endpoints on this port of 127.0.0.1 while the monitor runs.")
+	flags.Parse(args) // #nosec G104 -- The FlagSet exits on errors.
+	setupClientTLS()
+
+	if company == "" || targetsDirectory == "" {
+		fmt.Fprintln(os.Stderr, "Usage: hacker-scoper monitor -c company --targets-dir /path/to/targets [--interval 6h] [--state /path/to/state.json] [--once] [--notify-command COMMAND] [--notify-webhook URL] [--pprof-port INT]")
+		// Exit code 2 = command line syntax error
+		os.Exit(2)
+	}
+	interval, err := parseAge(intervalStr)
+	if err != nil || interval <= 0 {
+		crash(errInvalidArguments, "Invalid --interval selected", err)
+	}
+	if info, err := os.Stat(targetsDirectory); err != nil || !info.IsDir() {
+		crash(errReadInput, "The targets directory \""+targetsDirectory+"\" doesn't exist", err)
+	}
+	if err := validatePprofPort(pprofPort); err != nil {
+		crash(errInvalidArguments, "Invalid --pprof-port selected", err)
+	}
+
+	handleInterrupts(&databaseIsUpdating, &tmpFile)
+	setupFirebountyJSONPath()
+	updateFirebountyJSONIfNeeded(ctx, &databaseIsUpdating, &tmpFile)
+
+	// The companies are remembered by name, since their indexes change when the database is updated
+	var companyNames []string
+	allCompanyNames, err := extractCompanyNames(firebountyJSONPath)
+	if err != nil {
+		crash(errDatabase, "Couldn't parse company names from firebounty JSON.", err)
+	}
+	for _, index := range selectCompanies(company) {
+		companyNames = append(companyNames, strings.ToLower(strings.TrimSpace(allCompanyNames[index])))
+	}
+
+	if statePath == "" {
+		statePath = filepath.Join(filepath.Dir(firebountyJSONPath), expandOutputFilename("monitor-{company}.json", company, time.Now()))
+	}
+
+	if pprofPort != 0 {
+		pprofAddress, err := startPprofServer(ctx, pprofPort)
+		if err != nil {
+			crash(errProfiling, "Unable to start the profiling endpoints", err)
+		}
+		if !chainMode {
+			fmt.Println("[+] Profiling endpoints at http://" + pprofAddress + "/debug/pprof/")
+		}
+	}
+
+	// Every cycle is unattended, so the details of the programs aren't printed again
+	verbose := !chainMode
+	chainMode = true
+
+	for {
+		report, err := runMonitorCycle(ctx, company, companyNames, targetsDirectory, statePath, privateTLDsAreEnabled, &databaseIsUpdating, &tmpFile)
+		if err != nil {
+			warning(warnMonitor, "The monitor cycle failed: "+err.Error())
+		} else if report != "" {
+			err = reportNotifier.notify(report)
+			if err != nil {
+				warning(warnMonitor, "Unable to send the monitor report: "+err.Error())
+			}
+		} else if verbose {
+			fmt.Println("[+] " + time.Now().Format("2006-01-02 15:04:05") + " - No new in-scope assets or scope changes.")
+		}
+
+		if runOnce {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// runMonitorCycle refreshes the scopes, re-filters the targets directory, and compares the results with the previous cycle.
+// The report is empty if nothing changed, or if there was no previous cycle to compare with.
+func runMonitorCycle(ctx context.Context, company string, companyNames []string, targetsDirectory string, statePath string, privateTLDsAreEnabled bool, databaseIsUpdating *bool, tmpFile **os.File) (string, error) {
+	updateFirebountyJSONIfNeeded(ctx, databaseIsUpdating, tmpFile)
+
+	companyIndexes, missing, err := companyIndexesByName(companyNames)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range missing {
+		warning(warnProgramSkipped, "The company \""+name+"\" isn't in the database anymore.")
+	}
+
+	current := &monitorState{LastRun: time.Now()}
+	for _, companyIndex := range companyIndexes {
+		_, inscopeLines, noscopeLines, err := getCompanyScopes(ctx, firebountyJSONPath, &companyIndex)
+		if err != nil {
+			return "", err
+		}
+		current.InScope = append(current.InScope, inscopeLines...)
+		current.OutOfScope = append(current.OutOfScope, noscopeLines...)
+	}
+	current.InScope = sortedUnique(current.InScope)
+	current.OutOfScope = sortedUnique(current.OutOfScope)
+
+	inscopeScopes, err := parseAllLines(current.InScope, true, privateTLDsAreEnabled, nil)
+	if err != nil {
+		return "", errors.New("unable to parse any inscope entries as scopes")
+	}
+	// Not having any out-of-scope entries is fine
+	noscopeScopes, _ := parseAllLines(current.OutOfScope, true, privateTLDsAreEnabled, nil)
+	current.Assets, err = filterTargetsDirectory(targetsDirectory, inscopeScopes, noscopeScopes)
+	if err != nil {
+		return "", err
+	}
+
+	previous, err := loadMonitorState(statePath)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	err = writeFileAtomically(statePath, data)
+	if err != nil {
+		return "", err
+	}
+
+	// The first cycle is the baseline
+	if previous == nil {
+		return "", nil
+	}
+	return formatMonitorReport(company, previous, current), nil
+}
+
+// loadMonitorState reads the state saved by the previous cycle, or returns nil if there wasn't one.
+func loadMonitorState(path string) (*monitorState, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- Intended functionality.
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var state monitorState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, errors.New("the monitor state " + path + " is corrupted: " + err.Error())
+	}
+	return &state, nil
+}
+
+// filterTargetsDirectory returns the sorted in-scope targets of every file in the directory and its subdirectories.
+func filterTargetsDirectory(directory string, inscopeScopes []interface{}, noscopeScopes []interface{}) ([]string, error) {
+	explicitLevel := int(ExplicitLevelSubdomains)
+	var assets []string
+	err := filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		input, err := openInput(path)
+		if err != nil {
+			return err
+		}
+		defer input.Close()
+
+		scanner := bufio.NewScanner(input)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if !isTargetLine(line) {
+				continue
+			}
+			target, err := parseTarget(line)
+			if err != nil {
+				continue
+			}
+			if isInsideScope, _, _, _ := parseScopes(&inscopeScopes, &noscopeScopes, &target, &explicitLevel, &explicitLevel, false); isInsideScope {
+				assets = append(assets, line)
+			}
+		}
+		return scanner.Err()
+	})
+	return sortedUnique(assets), err
+}
+
+// formatMonitorReport describes the new in-scope assets and the scope changes between two cycles, or returns an empty string if nothing changed.
+func formatMonitorReport(company string, previous *monitorState, current *monitorState) string {
+	newAssets, _ := diffSortedStrings(previous.Assets, current.Assets)
+	addedInScope, removedInScope := diffSortedStrings(previous.InScope, current.InScope)
+	addedOutOfScope, removedOutOfScope := diffSortedStrings(previous.OutOfScope, current.OutOfScope)
+	scopeChanges := len(addedInScope) + len(removedInScope) + len(addedOutOfScope) + len(removedOutOfScope)
+	if len(newAssets) == 0 && scopeChanges == 0 {
+		return ""
+	}
+
+	var builder strings.Builder
+	builder.WriteString("[hacker-scoper] " + company + ": " + strconv.Itoa(len(newAssets)) + " new in-scope assets, " + strconv.Itoa(scopeChanges) + " scope changes\n")
+	writeSection := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		builder.WriteString(title + ":\n")
+		for _, line := range lines {
+			builder.WriteString("  " + line + "\n")
+		}
+	}
+	writeSection("New in-scope assets", newAssets)
+	writeSection("Added in-scope rules", addedInScope)
+	writeSection("Removed in-scope rules", removedInScope)
+	writeSection("Added out-of-scope rules", addedOutOfScope)
+	writeSection("Removed out-of-scope rules", removedOutOfScope)
+	return strings.TrimSuffix(builder.String(), "\n")
+}
+
+// sortedUnique sorts the strings and removes the duplicates.
+func sortedUnique(strs []string) []string {
+	sort.Strings(strs)
+	unique := strs[:0]
+	for _, str := range strs {
+		if len(unique) == 0 || str != unique[len(unique)-1] {
+			unique = append(unique, str)
+		}
+	}
+	return unique
+}
+
+// diffSortedStrings returns the strings that were added to and removed from a sorted list.
+func diffSortedStrings(previous []string, current []string) (added []string, removed []string) {
+	i, j := 0, 0
+	for i < len(previous) || j < len(current) {
+		switch {
+		case i == len(previous) || (j < len(current) && current[j] < previous[i]):
+			added = append(added, current[j])
+			j++
+		case j == len(current) || previous[i] < current[j]:
+			removed = append(removed, previous[i])
+			i++
+		default:
+			i++
+			j++
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// multiProgram is one of the programs of the multi subcommand, with its parsed scopes.
+type multiProgram struct {
+	name          string
+	slug          string
+	inscopeScopes []interface{}
+	noscopeScopes []interface{}
+}
+
+// programMatch is a program that covers a target, together with the rule that matched it.
+type programMatch struct {
+	Program string `json:"program"`
+	Slug    string `json:"slug,omitempty"`
+	Rule    string `json:"rule"`
+	// The index of the program in the list of programs
+	index int
+}
+
+// multiResult is a line of the "--format jsonl" output of the multi subcommand.
+type multiResult struct {
+	Asset    string         `json:"asset"`
+	Programs []programMatch `json:"programs"`
+}
+
+// multiCommand checks every target against every program of a list, and reports the programs that every target belongs to.
+func multiCommand(ctx context.Context, args []string) {
+	var companiesFilepath string
+	var targetsFilepath string
+	var format string
+	var explicitLevel int
+	var privateTLDsAreEnabled bool
+	var outputDirectory string
+	var databaseIsUpdating bool
+	var tmpFile *os.File
+
+	flags := newSubcommandFlagSet("multi")
+	flags.StringVar(&companiesFilepath, "companies-file", "", "File with the names or slugs of the programs, one per line.")
+	flags.StringVar(&targetsFilepath, "f", stdinPath, "Path to the file containing the targets. Defaults to stdin.")
+	flags.StringVar(&targetsFilepath, "file", stdinPath, "Path to the file containing the targets. Defaults to stdin.")
+	flags.StringVar(&format, "format", "text", "Output format. Either \"text\" or \"jsonl\".")
+	flags.IntVar(&explicitLevel, "ie", int(ExplicitLevelSubdomains), "Level of explicitness expected. (0/[1]/2/3)")
+	flags.IntVar(&explicitLevel, "inscope-explicit-level", int(ExplicitLevelSubdomains), "Level of explicitness expected. (0/[1]/2/3)")
+	flags.BoolVar(&privateTLDsAreEnabled, "enable-private-tlds", false, "Enable the use of company scope domains with private TLDs.")
+	flags.StringVar(&outputDirectory, "out-dir", "", "Write the in-scope targets of every program into its own file in this directory.")
+	flags.Parse(args) // #nosec G104 -- The FlagSet exits on errors.
+	setupClientTLS()
+
+	if companiesFilepath == "" {
+		fmt.Fprintln(os.Stderr, "Usage: hacker-scoper multi --companies-file /path/to/companies.txt [-f /path/to/targets] [--format text|jsonl] [--out-dir /path/to/buckets] [--inscope-explicit-level INT] [--enable-private-tlds]")
+		// Exit code 2 = command line syntax error
+		os.Exit(2)
+	}
+	if format != "text" && format != "jsonl" {
+		crash(errInvalidArguments, "Invalid --format selected. Valid formats are \"text\" and \"jsonl\"", errors.New("invalid format "+format))
+	}
+	if !ExplicitLevel(explicitLevel).isValid() {
+		crash(errInvalidArguments, "Invalid --inscope-explicit-level selected", errors.New("invalid explicit level"))
+	}
+
+	companies, err := readFileLines(companiesFilepath)
+	if err != nil {
+		crash(errReadInput, "Unable to read the companies file \""+companiesFilepath+"\"", err)
+	}
+
+	handleInterrupts(&databaseIsUpdating, &tmpFile)
+	setupFirebountyJSONPath()
+	updateFirebountyJSONIfNeeded(ctx, &databaseIsUpdating, &tmpFile)
+
+	// The details of every program would drown the results
+	chainMode = true
+	programs, err := loadMultiPrograms(ctx, companies, privateTLDsAreEnabled)
+	if err != nil {
+		crash(errNoScopes, "Unable to load the programs of \""+companiesFilepath+"\"", err)
+	}
+
+	var buckets []*bufio.Writer
+	if outputDirectory != "" {
+		var closeBuckets func() error
+		buckets, closeBuckets, err = createBuckets(outputDirectory, programs)
+		if err != nil {
+			crash(errWriteOutput, "Unable to create the output files in \""+outputDirectory+"\"", err)
+		}
+		defer func() {
+			if err := closeBuckets(); err != nil {
+				crash(errWriteOutput, "Unable to write to the output files in \""+outputDirectory+"\"", err)
+			}
+		}()
+	}
+
+	targets, err := streamFileLines(targetsFilepath)
+	if err != nil {
+		crash(errReadInput, "Unable to read the targets file \""+targetsFilepath+"\"", err)
+	}
+	for line := range targets {
+		target, err := parseTarget(line)
+		if err != nil {
+			repeatedWarning(warnUnparsableLine, "Unable to parse the string '"+line+"' as a target.")
+			continue
+		}
+		matches := matchPrograms(programs, target, explicitLevel)
+		if len(matches) == 0 {
+			continue
+		}
+		if buckets != nil {
+			for _, match := range matches {
+				buckets[match.index].WriteString(line + "\n") // #nosec G104 -- Write errors are reported when the buckets are closed.
+			}
+		}
+
+		if format == "jsonl" {
+			encoded, err := json.Marshal(multiResult{Asset: line, Programs: matches})
+			if err != nil {
+				crash(errWriteOutput, "Unable to encode the result as JSON", err)
+			}
+			fmt.Println(string(encoded))
+		} else {
+			var names []string
+			for _, match := range matches {
+				names = append(names, match.Program)
+			}
+			fmt.Println(line + " [" + strings.Join(names, ", ") + "]")
+		}
+	}
+	printWarningSummary()
+}
+
+// loadMultiPrograms finds every company of the list in the firebounty database, by name or by slug, and parses its scopes.
+// Companies that can't be found, or that don't have any usable in-scope entries, are skipped with a warning.
+func loadMultiPrograms(ctx context.Context, companies []string, privateTLDsAreEnabled bool) ([]multiProgram, error) {
+	companyNames, err := extractCompanyNames(firebountyJSONPath)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := extractProgramIdentities(firebountyJSONPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var programs []multiProgram
+	for _, company := range companies {
+		companyIndex := findCompanyByNameOrSlug(company, companyNames, identities)
+		if companyIndex == -1 {
+			warning(warnProgramSkipped, "The company \""+company+"\" isn't in the database. It has been skipped.")
+			continue
+		}
+
+		programName, inscopeLines, noscopeLines, err := getCompanyScopes(ctx, firebountyJSONPath, &companyIndex)
+		if err != nil {
+			warning(warnProgramSkipped, "The company \""+company+"\" doesn't have any in-scope entries. It has been skipped.")
+			continue
+		}
+		inscopeScopes, err := parseAllLines(inscopeLines, true, privateTLDsAreEnabled, nil)
+		if err != nil {
+			warning(warnProgramSkipped, "Unable to parse any in-scope entries of \""+company+"\". It has been skipped.")
+			continue
+		}
+		// Not having any out-of-scope entries is fine
+		noscopeScopes, _ := parseAllLines(noscopeLines, true, privateTLDsAreEnabled, nil)
+		programs = append(programs, multiProgram{name: strings.TrimSpace(programName), slug: identities[companyIndex].Slug, inscopeScopes: inscopeScopes, noscopeScopes: noscopeScopes})
+	}
+
+	if len(programs) == 0 {
+		return nil, errors.New("none of the companies could be loaded")
+	}
+	return programs, nil
+}
+
+// findCompanyByNameOrSlug returns the index of the company with the given name (case-insensitive) or slug, or -1 if there isn't one. Names take precedence over slugs.
+func findCompanyByNameOrSlug(company string, companyNames []string, identities []programIdentity) int {
+	company = strings.ToLower(strings.TrimSpace(company))
+	for i, name := range companyNames {
+		if strings.ToLower(strings.TrimSpace(name)) == company {
+			return i
+		}
+	}
+	for i, identity := range identities {
+		if strings.ToLower(identity.Slug) == company {
+			return i
+		}
+	}
+	return -1
+}
+
+// matchPrograms returns every program whose scope covers the target, in the same order as the programs.
+// Like in the regular runs, the out-of-scope entries are matched with the default --noscope-explicit-level, so the subdomains of the out-of-scope hostnames are out of scope too.
+func matchPrograms(programs []multiProgram, target interface{}, explicitLevel int) []programMatch {
+	noscopeExplicitLevel := int(ExplicitLevelSubdomains)
+	var matches []programMatch
+	for i := range programs {
+		isInsideScope, _, _, matchedScope := parseScopes(&programs[i].inscopeScopes, &programs[i].noscopeScopes, &target, &explicitLevel, &noscopeExplicitLevel, false)
+		if isInsideScope {
+			matches = append(matches, programMatch{Program: programs[i].name, Slug: programs[i].slug, Rule: scopeToString(matchedScope), index: i})
+		}
+	}
+	return matches
+}
+
+// createBuckets creates an output file for every program in the directory, named after the slug of the program, like "example-bugcrowd.txt".
+// Existing files are overwritten, so that every bucket only has the targets of the latest run. The returned function flushes and closes every file.
+func createBuckets(directory string, programs []multiProgram) ([]*bufio.Writer, func() error, error) {
+	err := os.MkdirAll(directory, 0700)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files []*os.File
+	var buckets []*bufio.Writer
+	closeBuckets := func() error {
+		var errs []error
+		for i, file := range files {
+			errs = append(errs, buckets[i].Flush(), file.Close())
+		}
+		return errors.Join(errs...)
+	}
+
+	now := time.Now()
+	for _, program := range programs {
+		name := program.slug
+		if name == "" {
+			name = program.name
+		}
+		path := filepath.Join(directory, expandOutputFilename("{company}.txt", name, now))
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600) // #nosec G304 -- The directory is a CLI argument specified by the user running the program.
+		if err != nil {
+			closeBuckets() // #nosec G104 -- We're already returning an error.
+			return nil, nil, err
+		}
+		files = append(files, file)
+		buckets = append(buckets, bufio.NewWriter(file))
+	}
+	return buckets, closeBuckets, nil
+}
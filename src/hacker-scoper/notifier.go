@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// notifier delivers the reports of the monitor subcommand.
+// If neither a command nor a webhook is configured, the reports are printed to stdout.
+type notifier struct {
+	// Executable that receives the report on stdin, like "notify -silent"
+	command string
+	// URL that receives the report as a JSON POST request with a "text" field, which is understood by Slack and Mattermost incoming webhooks
+	webhookURL string
+}
+
+// notify sends the report to every configured destination.
+func (n *notifier) notify(report string) error {
+	if n.command == "" && n.webhookURL == "" {
+		fmt.Println(report)
+		return nil
+	}
+
+	var errs []error
+	if n.command != "" {
+		errs = append(errs, n.runCommand(report))
+	}
+	if n.webhookURL != "" {
+		errs = append(errs, n.postWebhook(report))
+	}
+	return errors.Join(errs...)
+}
+
+// runCommand runs the notifier command with the report on stdin.
+func (n *notifier) runCommand(report string) error {
+	args := strings.Fields(n.command)
+	if len(args) == 0 {
+		return errors.New("empty notifier command")
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...) // #nosec G204 -- The notifier is a CLI argument specified by the user running the program.
+	cmd.Stdin = strings.NewReader(report)
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil && stderr.Len() > 0 {
+		return errors.New(err.Error() + ": " + strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
+
+// postWebhook sends the report to the webhook. Like every other request, it honors the proxy environment variables.
+func (n *notifier) postWebhook(report string) error {
+	body, err := json.Marshal(map[string]string{"text": report})
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Post(n.webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("the webhook replied with \"" + resp.Status + "\"")
+	}
+	return nil
+}
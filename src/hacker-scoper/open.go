@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Set with "--open". The program URL and the firebounty page of the selected programs are opened in the default browser.
+var openProgramPages bool
+
+// The pages that were already opened by --open, so that the programs selected together don't open the same page twice
+var openedPages = map[string]bool{}
+
+// openProgramPage opens the program URL and the firebounty page of a program in the default browser. Failures are only warnings, since the scopes are still usable.
+func openProgramPage(prog *Program) {
+	for _, pageURL := range programPageURLs(prog) {
+		if openedPages[pageURL] {
+			continue
+		}
+		openedPages[pageURL] = true
+
+		cmd := browserCommand(pageURL)
+		err := cmd.Start()
+		if err != nil {
+			warning(warnOpenBrowser, "Unable to open "+pageURL+" in the browser: "+err.Error())
+			continue
+		}
+		// The browser keeps running on its own. The opener is only waited for so that it doesn't become a zombie.
+		go cmd.Wait() // #nosec G104 -- The page was already handed to the browser.
+	}
+}
+
+// programPageURLs returns the pages of a program that --open opens: its program URL (the policy) and its firebounty page.
+// Only http(s) URLs are returned, since the URLs of the database are handed to the system opener, which would also run local files.
+func programPageURLs(prog *Program) []string {
+	var pageURLs []string
+	for _, rawURL := range []string{prog.Url, prog.Firebounty_url} {
+		rawURL = strings.TrimSpace(rawURL)
+		parsed, err := url.Parse(rawURL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			continue
+		}
+		pageURLs = append(pageURLs, rawURL)
+	}
+	return pageURLs
+}
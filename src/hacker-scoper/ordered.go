@@ -0,0 +1,47 @@
+package main
+
+// Amount of targets that can be processed ahead of the oldest unfinished target when the results are ordered.
+// Without a limit, a single slow target (like one waiting for a DNS timeout) would make the reorder buffer grow with the whole input.
+const orderedWindowSize = 4096
+
+// throttleLines forwards the lines to the workers while less than cap(slots) of them are waiting to be handed over by orderResults.
+func throttleLines(lines <-chan numberedLine, slots chan struct{}) <-chan numberedLine {
+	out := make(chan numberedLine)
+
+	go func() {
+		for line := range lines {
+			slots <- struct{}{}
+			out <- line
+		}
+		close(out)
+	}()
+
+	return out
+}
+
+// orderResults hands over the results in the same order as the input lines, starting at the line with the index firstIndex.
+// The results that arrive early are held back until every result before them has arrived. A slot is released for every result that is handed over.
+func orderResults(results <-chan targetResult, firstIndex int, slots chan struct{}) <-chan targetResult {
+	out := make(chan targetResult)
+
+	go func() {
+		pendingResults := make(map[int]targetResult)
+		nextIndex := firstIndex
+		for res := range results {
+			pendingResults[res.index] = res
+			for {
+				nextResult, ok := pendingResults[nextIndex]
+				if !ok {
+					break
+				}
+				delete(pendingResults, nextIndex)
+				<-slots
+				out <- nextResult
+				nextIndex++
+			}
+		}
+		close(out)
+	}()
+
+	return out
+}
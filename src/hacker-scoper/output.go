@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// jsonResult is a single result of the --json output format
+type jsonResult struct {
+	Type        string   `json:"type"`
+	Asset       string   `json:"asset"`
+	Rule        string   `json:"rule,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Ports       []int    `json:"ports,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	MaxSeverity string   `json:"max_severity,omitempty"`
+	Sources     []string `json:"sources,omitempty"`
+	Signals     []string `json:"signals,omitempty"`
+	CNAMEChain  []string `json:"cname_chain,omitempty"`
+	WildcardDNS bool     `json:"wildcard_dns,omitempty"`
+	// The pieces of the asset, like its host and port
+	Parsed *targetComponents `json:"parsed,omitempty"`
+	// The digest of the --database-snapshot, like "sha256:..."
+	Database string `json:"database,omitempty"`
+	// The rest of the columns of the input line, like ["200 Example title"]. Without --delimiter, the rest of the line after the target is a single column.
+	Columns []string `json:"columns,omitempty"`
+}
+
+// formatJSONResult returns a result as a single line of JSON
+func formatJSONResult(result jsonResult) string {
+	line, err := json.Marshal(result)
+	if err != nil {
+		// Marshaling a struct of strings can't fail
+		crash(errWriteOutput, "Unable to encode the result as JSON", err)
+	}
+	return string(line)
+}
+
+// formatCSVLine joins the fields with commas, quoting the ones that contain commas, quotes or newlines.
+func formatCSVLine(fields ...string) string {
+	quoted := make([]string, len(fields))
+	for i, field := range fields {
+		if strings.ContainsAny(field, ",\"\r\n") {
+			field = "\"" + strings.ReplaceAll(field, "\"", "\"\"") + "\""
+		}
+		quoted[i] = field
+	}
+	return strings.Join(quoted, ",")
+}
+
+// formatRule returns the rule as it's shown by --show-rule, like "[*.example.com # Main website]", or "[*.example.com # Main website, from Example]" with the sources of the rule.
+func formatRule(rule string, description string, sources []string) string {
+	formatted := rule
+	if description != "" {
+		formatted += " # " + description
+	}
+	if len(sources) > 0 {
+		if description == "" {
+			formatted += " #"
+		} else {
+			formatted += ","
+		}
+		formatted += " from " + strings.Join(sources, ", ")
+	}
+	return "[" + formatted + "]"
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"regexp"
+)
+
+// ScopeKind is the format of a parsed scope.
+type ScopeKind int
+
+const (
+	// A hostname, like "example.com"
+	ScopeKindHostname ScopeKind = iota + 1
+	// A single IP address, like "192.0.2.1"
+	ScopeKindIP
+	// A CIDR range, like "192.0.2.0/24"
+	ScopeKindCIDR
+	// An nmap octet range, like "192.0.2-3.1-100"
+	ScopeKindNmapRange
+	// A regex, like "^https?://example\.com$"
+	ScopeKindRegex
+	// A wildcard, like "*.example.com"
+	ScopeKindWildcard
+	// A mobile app, like "android:com.example.app"
+	ScopeKindMobileApp
+	// A source repository, like "https://github.com/example/app". Only parsed with --repo-scopes.
+	ScopeKindRepository
+	// A smart contract address, like "eip155:137:0x5FbDB2315678afecb367f032d93F642f64180aa3". Only parsed with --contract-scopes.
+	ScopeKindContract
+	// A desktop binary or a file hash, like "ExampleSetup.exe" or "sha256:9f86d08...". It never matches any target.
+	ScopeKindBinary
+)
+
+// ExplicitLevel is how explicit the scopes are expected to be, like with --inscope-explicit-level.
+type ExplicitLevel int
+
+const (
+	// Every scope is treated like a wildcard: the hostnames match their subdomains, and the wildcards also match their apex domain, like "example.com" for "*.example.com". Meant for recon triage.
+	ExplicitLevelPermissive ExplicitLevel = iota
+	// The hostnames match their subdomains, even without a wildcard. This is the default.
+	ExplicitLevelSubdomains
+	// The hostnames only match themselves. Subdomains are only matched by wildcards.
+	ExplicitLevelWildcards
+	// Only the hostnames and IP addresses that are explicitly listed are matched. CIDR ranges and wildcards are disabled.
+	ExplicitLevelStrict
+)
+
+// isValid reports whether the level is one of the known levels.
+func (level ExplicitLevel) isValid() bool {
+	return level >= ExplicitLevelPermissive && level <= ExplicitLevelStrict
+}
+
+// ParsedScope is a scope parsed by ParseScope. Only the fields of its Kind are set.
+type ParsedScope struct {
+	Kind ScopeKind
+	Raw  string
+	// Set for hostnames
+	Hostname string
+	// Set for IP addresses
+	IP net.IP
+	// Set for CIDR ranges
+	Network *net.IPNet
+	// Set for nmap ranges. Each octet is the list of its allowed values.
+	Octets [4][]uint8
+	// Set for regexes and wildcards. Wildcards are converted into an equivalent regex.
+	Regex *regexp.Regexp
+	// Set for mobile apps, like "android:com.example.app"
+	App string
+	// Set for repositories, like "https://github.com/example/app"
+	Repo string
+	// Set for smart contracts, like "eip155:137:0x5FbDB2315678afecb367f032d93F642f64180aa3"
+	Contract string
+	// Set for binaries and file hashes, like "ExampleSetup.exe"
+	Binary string
+
+	// The representation used by findMatchingScope
+	value interface{}
+}
+
+// TargetKind is the format of a parsed target.
+type TargetKind int
+
+const (
+	// A URL or hostname with a domain, like "https://example.com/path" or "example.com"
+	TargetKindURL TargetKind = iota + 1
+	// A single IP address, like "192.0.2.1"
+	TargetKindIP
+	// A URL with an IP address host, like "https://192.0.2.1:8080/path"
+	TargetKindURLWithIP
+	// An email address, like "user@example.com"
+	TargetKindEmail
+	// A mobile app, like "com.example.app:1.2.3". Only parsed with --mobile-scopes.
+	TargetKindMobileApp
+	// A source repository, like "https://github.com/example/app" or "example/app". Only parsed with --repo-scopes.
+	TargetKindRepository
+	// A smart contract address, like "polygon:0x5FbDB2315678afecb367f032d93F642f64180aa3". Only parsed with --contract-scopes.
+	TargetKindContract
+)
+
+// ParsedTarget is a target parsed by ParseTarget. Only the fields of its Kind are set.
+type ParsedTarget struct {
+	Kind TargetKind
+	Raw  string
+	// Set for URLs, including the URLs with an IP address host
+	URL *url.URL
+	// Set for IP addresses, and for the URLs with an IP address host
+	IP net.IP
+	// Set for email addresses. Only the domain is matched against the scopes.
+	EmailDomain string
+	// Set for mobile apps, like "android:com.example.app"
+	App string
+	// Set for repositories, like "https://github.com/example/app"
+	Repo string
+	// Set for smart contracts, like "eip155:137:0x5FbDB2315678afecb367f032d93F642f64180aa3"
+	Contract string
+
+	// The representation used by findMatchingScope
+	value interface{}
+}
+
+// ParseScope parses a scope line with the default settings, where the scopes without a public TLD are rejected.
+// It's the typed counterpart of parseScope.
+func ParseScope(line string) (ParsedScope, error) {
+	value, err := parseScope(line, false)
+	if err != nil {
+		return ParsedScope{}, err
+	}
+
+	scope := ParsedScope{Raw: line, value: value}
+	switch assertedScope := value.(type) {
+	case string:
+		scope.Kind = ScopeKindHostname
+		scope.Hostname = assertedScope
+	case *net.IP:
+		scope.Kind = ScopeKindIP
+		scope.IP = *assertedScope
+	case *net.IPNet:
+		scope.Kind = ScopeKindCIDR
+		scope.Network = assertedScope
+	case *NmapIPRange:
+		scope.Kind = ScopeKindNmapRange
+		scope.Octets = assertedScope.Octets
+	case *regexp.Regexp:
+		scope.Kind = ScopeKindRegex
+		scope.Regex = assertedScope
+	case *WildcardScope:
+		scope.Kind = ScopeKindWildcard
+		scope.Regex = &assertedScope.scope
+	case *MobileApp:
+		scope.Kind = ScopeKindMobileApp
+		scope.App = assertedScope.String()
+	case *Repository:
+		scope.Kind = ScopeKindRepository
+		scope.Repo = assertedScope.String()
+	case *ContractAddress:
+		scope.Kind = ScopeKindContract
+		scope.Contract = assertedScope.String()
+	case *BinaryScope:
+		scope.Kind = ScopeKindBinary
+		scope.Binary = assertedScope.String()
+	default:
+		return ParsedScope{}, errors.New("unexpected scope type")
+	}
+	return scope, nil
+}
+
+// ParseTarget parses a target line. It's the typed counterpart of parseTarget.
+func ParseTarget(line string) (ParsedTarget, error) {
+	value, err := parseTarget(line)
+	if err != nil {
+		return ParsedTarget{}, err
+	}
+
+	target := ParsedTarget{Raw: line, value: value}
+	switch assertedTarget := value.(type) {
+	case *url.URL:
+		target.Kind = TargetKindURL
+		target.URL = assertedTarget
+	case *net.IP:
+		target.Kind = TargetKindIP
+		target.IP = *assertedTarget
+	case *URLWithIPAddressHost:
+		target.Kind = TargetKindURLWithIP
+		target.IP = assertedTarget.IPhost
+		target.URL, err = parseURLWithDefaultScheme(line)
+		if err != nil {
+			return ParsedTarget{}, err
+		}
+	case *EmailAddress:
+		target.Kind = TargetKindEmail
+		target.EmailDomain = assertedTarget.domain
+	case *MobileApp:
+		target.Kind = TargetKindMobileApp
+		target.App = assertedTarget.String()
+	case *Repository:
+		target.Kind = TargetKindRepository
+		target.Repo = assertedTarget.String()
+	case *ContractAddress:
+		target.Kind = TargetKindContract
+		target.Contract = assertedTarget.String()
+	default:
+		return ParsedTarget{}, errors.New("unexpected target type")
+	}
+	return target, nil
+}
+
+// Matches reports whether the target is matched by the scope, with the given --inscope-explicit-level.
+func (scope ParsedScope) Matches(target ParsedTarget, explicitLevel ExplicitLevel) bool {
+	scopes := []interface{}{scope.value}
+	level := int(explicitLevel)
+	return isInscope(&scopes, prepareTarget(target.value), &level)
+}
+
+// Matcher decides whether targets are in scope, like the command-line tool does. It's never modified after NewMatcher returns,
+// so Match can be called from any number of goroutines at the same time, without any locking.
+type Matcher struct {
+	inscopeScopes        []interface{}
+	noscopeScopes        []interface{}
+	inscopeExplicitLevel int
+	noscopeExplicitLevel int
+}
+
+// NewMatcher creates a Matcher from parsed in-scope and out-of-scope entries. The out-of-scope entries are matched with ExplicitLevelSubdomains, the default --noscope-explicit-level of the command-line tool,
+// so that the subdomains of the out-of-scope hostnames are out of scope too.
+// Without any in-scope entries, every target that isn't out of scope is in scope. The slices are copied, so they can be reused by the caller.
+func NewMatcher(inscopes []ParsedScope, noscopes []ParsedScope, explicitLevel ExplicitLevel) *Matcher {
+	matcher := &Matcher{inscopeExplicitLevel: int(explicitLevel), noscopeExplicitLevel: int(ExplicitLevelSubdomains)}
+	for _, scope := range inscopes {
+		matcher.inscopeScopes = append(matcher.inscopeScopes, scope.value)
+	}
+	for _, scope := range noscopes {
+		matcher.noscopeScopes = append(matcher.noscopeScopes, scope.value)
+	}
+	return matcher
+}
+
+// Match reports whether the target is in scope. It's safe for concurrent use.
+func (matcher *Matcher) Match(target ParsedTarget) bool {
+	// parseScopes only reads through its pointers, so the matcher is shared without copying it
+	isInsideScope, _, _, _ := parseScopes(&matcher.inscopeScopes, &matcher.noscopeScopes, &target.value, &matcher.inscopeExplicitLevel, &matcher.noscopeExplicitLevel, false)
+	return isInsideScope
+}
+
+// MatchAll reports whether every target is in scope. It stops early and returns the error of the context if the context is cancelled,
+// so that a deadline can be enforced on big lists of targets.
+func (matcher *Matcher) MatchAll(ctx context.Context, targets []ParsedTarget) ([]bool, error) {
+	results := make([]bool, len(targets))
+	for i, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		results[i] = matcher.Match(target)
+	}
+	return results, nil
+}
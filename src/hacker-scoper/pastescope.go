@@ -0,0 +1,177 @@
+package main
+
+import (
+	"io"
+	"net"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Matches identifiers such as "example.com", "*.example.com", "api.example.com:8443" and "example.com/path"
+var pastedScopeIdentifierRegex = regexp.MustCompile(`^[a-zA-Z0-9*_-]+(\.[a-zA-Z0-9*_-]+)*\.[a-zA-Z*][a-zA-Z0-9*-]*(:\d{1,5})?(/\S*)?$`)
+
+// Matches the separator row of markdown tables, like "|---|:---:|"
+var markdownTableSeparatorRegex = regexp.MustCompile(`^\|?(\s*:?-+:?\s*\|)+\s*:?-*:?\s*$`)
+
+// readPastedScopeFile reads a file containing scope tables copied from the policy page of a bug bounty program, and returns the in-scope and out-of-scope identifiers found in it.
+func readPastedScopeFile(path string) (inscopeLines []string, noscopeLines []string, err error) {
+	input, err := openInput(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer input.Close()
+
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	text := string(data)
+	if strings.Contains(strings.ToLower(text), "<tr") {
+		text = htmlTablesToText(text)
+	}
+
+	inscopeLines, noscopeLines = parsePastedScopeTable(text)
+	return inscopeLines, noscopeLines, nil
+}
+
+// parsePastedScopeTable extracts the scope identifiers from text copied from the scope tables of a program's policy page.
+// Rows can be markdown table rows, tab-separated rows (which is what browsers produce when copying an HTML table), or lines with a single identifier.
+// Rows are in scope by default. Headings mentioning "out of scope" switch the following rows to out-of-scope until another heading mentions "in scope". Rows that have their own "In scope"/"Out of scope" cell override the current section.
+func parsePastedScopeTable(text string) (inscopeLines []string, noscopeLines []string) {
+	sectionIsInscope := true
+	seen := make(map[string]bool)
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || markdownTableSeparatorRegex.MatchString(line) {
+			continue
+		}
+
+		var cells []string
+		if strings.HasPrefix(line, "|") {
+			cells = strings.Split(strings.Trim(line, "|"), "|")
+		} else {
+			cells = strings.Split(line, "\t")
+		}
+
+		rowIsInscope := sectionIsInscope
+		identifier := ""
+		for _, cell := range cells {
+			cell = strings.Trim(strings.TrimSpace(cell), "`")
+			if identifier == "" && isPastedScopeIdentifier(cell) {
+				identifier = cell
+				continue
+			}
+			switch pastedScopeStatus(cell) {
+			case "in":
+				rowIsInscope = true
+			case "out":
+				rowIsInscope = false
+			}
+		}
+
+		if identifier == "" {
+			// Lines without identifiers may be the headings of the scope sections
+			if len(cells) == 1 {
+				switch pastedScopeStatus(line) {
+				case "in":
+					sectionIsInscope = true
+				case "out":
+					sectionIsInscope = false
+				}
+			}
+			continue
+		}
+
+		if seen[identifier] {
+			continue
+		}
+		seen[identifier] = true
+		if rowIsInscope {
+			inscopeLines = append(inscopeLines, identifier)
+		} else {
+			noscopeLines = append(noscopeLines, identifier)
+		}
+	}
+
+	return inscopeLines, noscopeLines
+}
+
+// pastedScopeStatus returns "in" or "out" if the text says that something is in scope or out of scope, and an empty string otherwise.
+func pastedScopeStatus(text string) string {
+	text = strings.ToLower(text)
+	if strings.Contains(text, "out of scope") || strings.Contains(text, "out-of-scope") || strings.Contains(text, "not in scope") {
+		return "out"
+	} else if strings.Contains(text, "in scope") || strings.Contains(text, "in-scope") {
+		return "in"
+	}
+	return ""
+}
+
+// isPastedScopeIdentifier reports whether a table cell looks like a scope identifier (hostname, wildcard, URL, IP or CIDR range) instead of a description.
+func isPastedScopeIdentifier(cell string) bool {
+	if cell == "" || strings.ContainsAny(cell, " \t") {
+		return false
+	}
+	if net.ParseIP(cell) != nil || strings.Contains(cell, "://") {
+		return true
+	}
+	if _, _, err := net.ParseCIDR(cell); err == nil {
+		return true
+	}
+	return pastedScopeIdentifierRegex.MatchString(cell)
+}
+
+// htmlTablesToText converts the rows of every HTML table into tab-separated lines, and the rest of the text into plain lines, so that they can be read by parsePastedScopeTable.
+func htmlTablesToText(rawHTML string) string {
+	var output strings.Builder
+	var cell strings.Builder
+	var row []string
+	insideCell := false
+
+	tokenizer := html.NewTokenizer(strings.NewReader(rawHTML))
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			// io.EOF, or malformed HTML. Either way we return whatever we could read.
+			if len(row) > 0 {
+				output.WriteString(strings.Join(row, "\t") + "\n")
+			}
+			return output.String()
+
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			tagName, _ := tokenizer.TagName()
+			switch string(tagName) {
+			case "td", "th":
+				if tokenType == html.StartTagToken {
+					insideCell = true
+					cell.Reset()
+				} else if insideCell {
+					insideCell = false
+					row = append(row, strings.Join(strings.Fields(cell.String()), " "))
+				}
+			case "tr":
+				if len(row) > 0 {
+					output.WriteString(strings.Join(row, "\t") + "\n")
+					row = nil
+				}
+			case "br", "p", "div", "h1", "h2", "h3", "h4", "h5", "h6", "li":
+				if !insideCell {
+					output.WriteString("\n")
+				}
+			}
+
+		case html.TextToken:
+			text := string(tokenizer.Text())
+			if insideCell {
+				cell.WriteString(text + " ")
+			} else {
+				output.WriteString(strings.TrimSpace(text))
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The version of the JSON protocol spoken with scope plugins. It's sent with every request, so that plugins can reject versions they don't understand.
+const scopePluginProtocolVersion = 1
+
+// scopePluginRequest is written as JSON to the stdin of a scope plugin
+type scopePluginRequest struct {
+	Version int    `json:"version"`
+	Company string `json:"company"`
+}
+
+// scopePluginResponse is read as JSON from the stdout of a scope plugin
+type scopePluginResponse struct {
+	InScope    []string `json:"in_scope"`
+	OutOfScope []string `json:"out_of_scope"`
+	Error      string   `json:"error"`
+}
+
+// scopePluginResult holds the scopes returned by one of the scope plugins, or the reason why it failed.
+type scopePluginResult struct {
+	command      string
+	inscopeLines []string
+	noscopeLines []string
+	// Set when the scopes are the ones the plugin returned on its last successful run, either because they're within the cache TTL or because the plugin failed
+	cached bool
+	err    error
+}
+
+// runScopePlugins runs every scope plugin at the same time, so that a slow plugin doesn't delay the others. The results are in the same order as the commands.
+// A plugin that fails doesn't affect the others: its result falls back to the scopes it returned the last time it succeeded, which are cached in cacheDirectory.
+// Plugins whose cached scopes are younger than the TTL aren't run at all. A TTL of 0 runs every plugin.
+func runScopePlugins(ctx context.Context, pluginCommands []string, company string, cacheDirectory string, ttl time.Duration) []scopePluginResult {
+	results := make([]scopePluginResult, len(pluginCommands))
+	var wg sync.WaitGroup
+	for i, pluginCommand := range pluginCommands {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := scopePluginResult{command: pluginCommand}
+			cachePath := scopePluginCachePath(cacheDirectory, pluginCommand, company)
+			if info, err := os.Stat(cachePath); ttl > 0 && err == nil && isCacheFresh(info.ModTime(), ttl) {
+				if inscopeLines, noscopeLines, err := loadScopePluginCache(cachePath); err == nil {
+					results[i] = scopePluginResult{command: pluginCommand, inscopeLines: inscopeLines, noscopeLines: noscopeLines, cached: true}
+					return
+				}
+			}
+			result.inscopeLines, result.noscopeLines, result.err = runScopePlugin(ctx, pluginCommand, company)
+			if result.err == nil {
+				// Failing to cache the scopes only matters if the plugin fails next time
+				saveScopePluginCache(cachePath, result.inscopeLines, result.noscopeLines) // #nosec G104 -- Best effort.
+			} else if inscopeLines, noscopeLines, err := loadScopePluginCache(cachePath); err == nil {
+				result.inscopeLines, result.noscopeLines, result.cached = inscopeLines, noscopeLines, true
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// scopePluginCachePath returns the path of the cached scopes of a plugin for a company.
+func scopePluginCachePath(cacheDirectory string, pluginCommand string, company string) string {
+	key := sha256.Sum256([]byte(pluginCommand + "\x00" + company))
+	return filepath.Join(cacheDirectory, hex.EncodeToString(key[:])+".json")
+}
+
+// saveScopePluginCache remembers the scopes that a plugin returned, in the same format as the plugin responses.
+func saveScopePluginCache(path string, inscopeLines []string, noscopeLines []string) error {
+	data, err := json.Marshal(scopePluginResponse{InScope: inscopeLines, OutOfScope: noscopeLines})
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path, data)
+}
+
+// loadScopePluginCache reads the scopes that a plugin returned on its last successful run.
+func loadScopePluginCache(path string) (inscopeLines []string, noscopeLines []string, err error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- The path is derived from the database path.
+	if err != nil {
+		return nil, nil, err
+	}
+	var cached scopePluginResponse
+	err = json.Unmarshal(data, &cached)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cached.InScope, cached.OutOfScope, nil
+}
+
+// runScopePlugin executes the given scope plugin and returns the scopes it provides for the company.
+// pluginCommand is the path to the executable, optionally followed by space-separated arguments.
+// The plugin receives a scopePluginRequest on its stdin, and must print a scopePluginResponse on its stdout. Anything the plugin prints on stderr is included in the error message if it fails.
+// The plugin is killed if the context is cancelled.
+func runScopePlugin(ctx context.Context, pluginCommand string, company string) (inscopeLines []string, noscopeLines []string, err error) {
+	args := strings.Fields(pluginCommand)
+	if len(args) == 0 {
+		return nil, nil, errors.New("empty scope plugin command")
+	}
+
+	request, err := json.Marshal(scopePluginRequest{Version: scopePluginProtocolVersion, Company: company})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) // #nosec G204 -- The plugin is a CLI argument specified by the user running the program.
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		if stderr.Len() > 0 {
+			return nil, nil, errors.New(err.Error() + ": " + strings.TrimSpace(stderr.String()))
+		}
+		return nil, nil, err
+	}
+
+	var response scopePluginResponse
+	err = json.Unmarshal(stdout.Bytes(), &response)
+	if err != nil {
+		return nil, nil, errors.New("the scope plugin returned invalid JSON: " + err.Error())
+	}
+	if response.Error != "" {
+		return nil, nil, errors.New("the scope plugin returned an error: " + response.Error)
+	}
+
+	return cleanScopePluginLines(response.InScope), cleanScopePluginLines(response.OutOfScope), nil
+}
+
+// cleanScopePluginLines trims the scopes returned by a plugin, and removes the empty ones.
+func cleanScopePluginLines(rawLines []string) []string {
+	var lines []string
+	for _, line := range rawLines {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
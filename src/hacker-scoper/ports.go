@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// isPortAllowed reports whether the port of a target is one of the ports of its matching rule. Rules without ports allow every port.
+func isPortAllowed(allowedPorts []int, port string) bool {
+	if len(allowedPorts) == 0 || port == "" {
+		return true
+	}
+	portNumber, err := strconv.Atoi(port)
+	return err == nil && slices.Contains(allowedPorts, portNumber)
+}
+
+// stripTargetPort removes the port from a target like "https://example.com:8080/path" or "example.com:8080", for --strip-port-and-keep.
+// The rest of the target is kept exactly as it was given.
+func stripTargetPort(target string) string {
+	parsedURL, err := url.Parse(target)
+	if err != nil || parsedURL.Host == "" {
+		parsedURL, err = url.Parse("https://" + target)
+		if err != nil {
+			return target
+		}
+	}
+	port := parsedURL.Port()
+	// Unbracketed IPv6 addresses don't have a port
+	if port == "" || removePortFromHost(parsedURL) == parsedURL.Host {
+		return target
+	}
+	portlessHost := strings.TrimSuffix(parsedURL.Host, ":"+port)
+	return strings.Replace(target, parsedURL.Host, portlessHost, 1)
+}
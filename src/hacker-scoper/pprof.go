@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof" // #nosec G108 -- The endpoints are registered on their own ServeMux, which is only served on the loopback interface.
+	"strconv"
+	"time"
+)
+
+// Set with "--pprof-port". While --serve or the monitor subcommand runs, the profiling endpoints of net/http/pprof are served on this port of 127.0.0.1, so that a live instance can be profiled without rebuilding it with the benchmark tag.
+// 0 when it's disabled.
+var pprofPort int
+
+// validatePprofPort returns an error if --pprof-port isn't a valid port.
+func validatePprofPort(port int) error {
+	if port < 0 || port > 65535 {
+		return errors.New("invalid port " + strconv.Itoa(port))
+	}
+	return nil
+}
+
+// startPprofServer serves the net/http/pprof endpoints at http://127.0.0.1:PORT/debug/pprof/ until the context is cancelled, and returns the address that it listens on.
+// It only listens on the loopback interface, since the profiles expose the memory of the process, including the scopes.
+func startPprofServer(ctx context.Context, port int) (string, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return "", err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	httpServer := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		httpServer.Close() // #nosec G104 -- The process is stopping anyway.
+	}()
+	go func() {
+		// The profiler is only a diagnostic aid, so the instance keeps running if it stops serving
+		httpServer.Serve(listener) // #nosec G104
+	}()
+	return listener.Addr().String(), nil
+}
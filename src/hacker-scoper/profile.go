@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// profilesDirectory returns the folder where the named profiles are stored:
+// $XDG_CONFIG_HOME/hacker-scoper/profiles/ on Linux, ~/Library/Application Support/hacker-scoper/profiles/ on MacOS, and %APPDATA%\hacker-scoper\profiles\ on Windows.
+func profilesDirectory() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "hacker-scoper", "profiles"), nil
+}
+
+// loadProfile reads the settings of a named profile. A profile is a YAML mapping of argument names to their values, like:
+//
+//	company: acme
+//	inscope-explicit-level: 2
+//	scope: ["*.acme.com", 10.0.0.0/8]
+//	output: ~/engagements/acme/{date}.txt
+func loadProfile(name string) (map[string][]string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, errors.New("invalid profile name \"" + name + "\"")
+	}
+	directory, err := profilesDirectory()
+	if err != nil {
+		return nil, err
+	}
+
+	profilePath := filepath.Join(directory, name+".yaml")
+	data, err := os.ReadFile(profilePath) // #nosec G304 -- The profile name can't contain path separators.
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errors.New("the profile doesn't exist. Profiles are stored at \"" + directory + "\"")
+		}
+		return nil, err
+	}
+	return parseProfile(string(data))
+}
+
+// parseProfile parses the settings of a profile. Every value is returned as a list, so that repeatable arguments like --scope can be set several times.
+func parseProfile(data string) (map[string][]string, error) {
+	root, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	if root == "" {
+		return map[string][]string{}, nil
+	}
+	rootMap, ok := root.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("a profile must be a mapping of argument names to their values")
+	}
+
+	settings := map[string][]string{}
+	for key, value := range rootMap {
+		values, err := yamlStringList(value)
+		if err != nil {
+			return nil, errors.New("invalid value for \"" + key + "\"")
+		}
+		for i := range values {
+			values[i] = expandHomeDirectory(values[i])
+		}
+		settings[key] = values
+	}
+	return settings, nil
+}
+
+// expandHomeDirectory replaces a leading "~/" with the home folder of the user.
+func expandHomeDirectory(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+// applyProfile sets the arguments of a profile. Arguments that were given on the command line take precedence over the profile.
+func applyProfile(flags *flag.FlagSet, settings map[string][]string) error {
+	// Aliases like -c and --company share the same variable, so the variables are compared instead of the names
+	setOnCommandLine := map[uintptr]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		setOnCommandLine[reflect.ValueOf(f.Value).Pointer()] = true
+	})
+
+	for name, values := range settings {
+		f := flags.Lookup(name)
+		if f == nil || name == "profile" {
+			return errors.New("unknown argument \"" + name + "\"")
+		}
+		if setOnCommandLine[reflect.ValueOf(f.Value).Pointer()] {
+			continue
+		}
+		for _, value := range values {
+			err := flags.Set(name, value)
+			if err != nil {
+				return errors.New("invalid value for \"" + name + "\": " + err.Error())
+			}
+		}
+	}
+	return nil
+}
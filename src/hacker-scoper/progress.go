@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// The progress bar is redrawn at most this often
+const progressRefreshInterval = 200 * time.Millisecond
+
+// newTargetsProgressBar returns a progress bar on stderr that counts the processed targets, together with their rate and the ETA.
+// If the total is -1, a spinner is shown instead of the ETA until the total is set with ChangeMax64.
+func newTargetsProgressBar(total int64) *progressbar.ProgressBar {
+	return progressbar.NewOptions64(total,
+		progressbar.OptionSetWriter(os.Stderr),
+		progressbar.OptionSetDescription("processing"),
+		progressbar.OptionShowCount(),
+		progressbar.OptionShowIts(),
+		progressbar.OptionSetItsString("targets"),
+		progressbar.OptionThrottle(progressRefreshInterval),
+		// The spinner is redrawn from its own goroutine otherwise, which would break the lines of the results printed in between
+		progressbar.OptionSetSpinnerChangeInterval(0),
+		progressbar.OptionClearOnFinish(),
+	)
+}
+
+// stderrIsTerminal reports whether stderr is shown to the user, instead of being redirected to a file or another program.
+func stderrIsTerminal() bool {
+	stat, err := os.Stderr.Stat()
+	return err == nil && (stat.Mode()&os.ModeCharDevice) != 0
+}
+
+// isTargetLine reports whether a line of the targets input is a target, instead of an empty line or a comment.
+func isTargetLine(line string) bool {
+	return line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "//")
+}
+
+// countTargetLines counts the targets of a targets file, skipping the same lines as streamFileLines.
+func countTargetLines(path string) (int64, error) {
+	input, err := openInput(path)
+	if err != nil {
+		return 0, err
+	}
+	defer input.Close()
+
+	var count int64
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		if isTargetLine(strings.TrimSpace(scanner.Text())) {
+			count++
+		}
+	}
+	return count, scanner.Err()
+}
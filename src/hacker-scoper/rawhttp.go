@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Matches the request line of a raw HTTP request, like "GET /path?query=1 HTTP/1.1"
+var rawHTTPRequestLineRegex = regexp.MustCompile(`^[A-Z]+ (\S+) HTTP/\d(\.\d)?$`)
+
+// extractRawHTTPRequests converts a stream of lines from raw HTTP requests (like the ones saved by Burp's "copy to file") into a stream of URLs.
+// Each URL is built from the Host header and the path of the request line. Several requests may be concatenated in the same input.
+// Since the raw requests don't contain the scheme, "https://" is assumed unless the Host header specifies port 80.
+func extractRawHTTPRequests(lines <-chan string) <-chan string {
+	out := make(chan string, 128)
+
+	go func() {
+		defer close(out)
+		var requestTarget string
+		waitingForHost := false
+		for line := range lines {
+			if match := rawHTTPRequestLineRegex.FindStringSubmatch(line); match != nil {
+				if waitingForHost {
+					repeatedWarning(warnRequestWithoutHost, "Found an HTTP request without a Host header for \""+requestTarget+"\". The request has been ignored.")
+				}
+				requestTarget = match[1]
+
+				// Requests sent to a proxy already contain the full URL
+				if strings.Contains(requestTarget, "://") {
+					out <- requestTarget
+					waitingForHost = false
+				} else {
+					waitingForHost = true
+				}
+				continue
+			}
+
+			if waitingForHost {
+				name, value, found := strings.Cut(line, ":")
+				if found && strings.EqualFold(strings.TrimSpace(name), "host") {
+					out <- rawHTTPRequestToURL(strings.TrimSpace(value), requestTarget)
+					waitingForHost = false
+				}
+			}
+		}
+		if waitingForHost {
+			repeatedWarning(warnRequestWithoutHost, "Found an HTTP request without a Host header for \""+requestTarget+"\". The request has been ignored.")
+		}
+	}()
+
+	return out
+}
+
+// rawHTTPRequestToURL builds a URL out of the Host header and the request target of a raw HTTP request.
+func rawHTTPRequestToURL(host string, requestTarget string) string {
+	scheme := "https://"
+	if _, port, err := net.SplitHostPort(host); err == nil && port == "80" {
+		scheme = "http://"
+	}
+
+	// "OPTIONS * HTTP/1.1" and "CONNECT host:port HTTP/1.1" don't have a path
+	if !strings.HasPrefix(requestTarget, "/") {
+		requestTarget = "/"
+	}
+	return scheme + host + requestTarget
+}
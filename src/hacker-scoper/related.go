@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Set with "--mark-related". The unsure targets that share the registrable domain of an in-scope hostname or wildcard get the "related" verdict.
+var markRelated bool
+
+// relatedDomains maps the registrable domains (eTLD+1) of the in-scope hostname and wildcard scopes to the first scope with that domain, like "example.co.uk" to "*.api.example.co.uk".
+type relatedDomains map[string]interface{}
+
+// newRelatedDomains collects the registrable domains of the in-scope scopes. The scopes that aren't hostnames or wildcards, like IP ranges and regexes, don't have one.
+func newRelatedDomains(inscopeScopes []interface{}) relatedDomains {
+	domains := relatedDomains{}
+	for _, scope := range inscopeScopes {
+		var host string
+		switch scope.(type) {
+		case string, *WildcardScope:
+			// Wildcards like "*.example.com" and "*example.com" are reduced to their fixed part
+			host = strings.TrimLeft(scopeToString(scope), "*.")
+		default:
+			continue
+		}
+		if strings.Contains(host, "*") {
+			// Wildcards in the middle of the domain, like "example.*", don't have a fixed registrable domain
+			continue
+		}
+		domain, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(host))
+		if err != nil {
+			continue
+		}
+		if _, isKnown := domains[domain]; !isKnown {
+			domains[domain] = scope
+		}
+	}
+	return domains
+}
+
+// find returns the in-scope scope that shares the registrable domain of a hostname or email address target, like "example.com" for "dev.example.com" with an explicit-level of 2. It returns nil for the other targets, and for the unrelated ones.
+func (domains relatedDomains) find(target interface{}) interface{} {
+	var host string
+	switch assertedTarget := target.(type) {
+	case *url.URL:
+		host = removePortFromHost(assertedTarget)
+	case *EmailAddress:
+		host = assertedTarget.domain
+	default:
+		return nil
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(strings.TrimSuffix(host, ".")))
+	if err != nil {
+		return nil
+	}
+	return domains[domain]
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Set with "--repo-scopes". The source repositories listed in the scopes of the programs are matched against the targets that are repository URLs, or "org/repo" shorthands.
+var repoScopesEnabled bool
+
+// The code hosting sites whose repository URLs are recognized
+var repositoryHosts = []string{"github.com", "gitlab.com"}
+
+// The "org/repo" shorthand of repository targets. The owner can't have dots, so that "example.com/login" is still parsed as a URL.
+var repositoryShorthandRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+/[A-Za-z0-9_.-]+$`)
+
+// Repository is a source repository, like "github.com/example/app".
+// As a scope, it can also be every repository of an owner, like "https://github.com/example" or "https://github.com/example/*". GitLab repositories may be inside nested groups, like "gitlab.com/example/backend/api".
+type Repository struct {
+	// Empty for the targets that are "org/repo" shorthands, which are matched against the repositories of every host
+	host string
+	// Lowercased, since GitHub and GitLab paths are case-insensitive
+	path string
+	// Set for the scopes that match every repository of an owner or group
+	isPrefix bool
+}
+
+// String returns the repository as a scope line, like "https://github.com/example/app".
+func (repo *Repository) String() string {
+	result := repo.path
+	if repo.host != "" {
+		result = "https://" + repo.host + "/" + repo.path
+	}
+	if repo.isPrefix {
+		return result + "/*"
+	}
+	return result
+}
+
+// matches reports whether the repository of a target is matched by a repository scope.
+func (scope *Repository) matches(target *Repository) bool {
+	if target.host != "" && scope.host != target.host {
+		return false
+	}
+	if scope.isPrefix {
+		return strings.HasPrefix(target.path, scope.path+"/")
+	}
+	return scope.path == target.path
+}
+
+// parseRepositoryURL parses the URL of a repository on GitHub or GitLab, like "https://github.com/example/app/tree/main" or "git@github.com:example/app.git". It returns nil for every other line.
+// The pages inside of the repository are ignored. URLs of owners, like "https://github.com/example", are only accepted if allowPrefix is true, as every repository of the owner.
+func parseRepositoryURL(line string, allowPrefix bool) *Repository {
+	var host, path string
+	if rest, isSSH := strings.CutPrefix(line, "git@"); isSSH {
+		host, path, _ = strings.Cut(rest, ":")
+	} else {
+		repoURL, err := parseURLWithDefaultScheme(line)
+		if err != nil || (repoURL.Scheme != "https" && repoURL.Scheme != "http") {
+			return nil
+		}
+		host, path = repoURL.Hostname(), repoURL.Path
+	}
+
+	host = strings.TrimPrefix(strings.ToLower(host), "www.")
+	isPrefix := false
+	if allowPrefix && strings.HasSuffix(path, "/*") {
+		path = strings.TrimSuffix(path, "/*")
+		isPrefix = true
+	}
+	segments := strings.FieldsFunc(strings.ToLower(path), func(r rune) bool { return r == '/' })
+
+	switch host {
+	case "github.com":
+		// Like "/example/app/blob/main/README.md"
+		if len(segments) > 2 {
+			segments = segments[:2]
+		}
+	case "gitlab.com":
+		// Like "/example/backend/api/-/blob/main/README.md"
+		if separator := slices.Index(segments, "-"); separator != -1 {
+			segments = segments[:separator]
+		}
+	default:
+		return nil
+	}
+	if len(segments) == 0 || (isPrefix && host == "github.com" && len(segments) > 1) {
+		return nil
+	}
+	if len(segments) == 1 {
+		if !allowPrefix {
+			return nil
+		}
+		isPrefix = true
+	}
+	segments[len(segments)-1] = strings.TrimSuffix(segments[len(segments)-1], ".git")
+	return &Repository{host: host, path: strings.Join(segments, "/"), isPrefix: isPrefix}
+}
+
+// isRepositoryURL reports whether the line points to one of the code hosting sites, like "https://github.com/example/app".
+func isRepositoryURL(line string) bool {
+	line = strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(line, "https://"), "http://"), "www.")
+	line = strings.TrimPrefix(line, "git@")
+	for _, host := range repositoryHosts {
+		if strings.HasPrefix(line, host+"/") || strings.HasPrefix(line, host+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRepositoryScope parses the repository scopes, for --repo-scopes. It returns nil for every other scope.
+func parseRepositoryScope(line string) *Repository {
+	if !isRepositoryURL(line) {
+		return nil
+	}
+	return parseRepositoryURL(line, true)
+}
+
+// parseRepositoryTarget parses the targets that are repositories, for --repo-scopes: repository URLs, and "org/repo" shorthands. It returns nil for every other target.
+func parseRepositoryTarget(line string) *Repository {
+	if isRepositoryURL(line) {
+		return parseRepositoryURL(line, false)
+	}
+	if repositoryShorthandRegex.MatchString(line) {
+		return &Repository{path: strings.TrimSuffix(strings.ToLower(line), ".git")}
+	}
+	return nil
+}
+
+// matchingScopeForRepository returns the first repository scope that matches the repository target.
+func matchingScopeForRepository(target *Repository, inscopeScopes *[]interface{}) interface{} {
+	for i := range *inscopeScopes {
+		if scope, isRepo := (*inscopeScopes)[i].(*Repository); isRepo && scope.matches(target) {
+			return scope
+		}
+	}
+	return nil
+}
+
+// repositoryScopeLines returns the "source_code" scopes of a firebounty scope list, for --repo-scopes. The repositories listed as web_application scopes are already loaded with the rest of them.
+func repositoryScopeLines(scopes []Scope) []string {
+	var lines []string
+	for _, scope := range scopes {
+		rawScope := strings.TrimSpace(scope.Scope)
+		if scope.Scope_type == "source_code" && isRepositoryURL(rawScope) {
+			lines = append(lines, rawScope)
+		}
+	}
+	return lines
+}
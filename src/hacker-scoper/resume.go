@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// How often the --resume checkpoint file gets updated
+const resumeCheckpointInterval = 5 * time.Second
+
+// resumeState is the checkpoint saved by --resume.
+// LinesProcessed counts targets (comments and empty lines are not counted), and OutputSize is the size of the output file right after the last of those targets was written.
+type resumeState struct {
+	TargetsFile    string `json:"targets_file"`
+	OutputFile     string `json:"output_file"`
+	LinesProcessed int    `json:"lines_processed"`
+	OutputSize     int64  `json:"output_size"`
+}
+
+type numberedLine struct {
+	index int
+	line  string
+}
+
+// loadResumeState reads the checkpoint at the given path.
+// If the file doesn't exist, an empty state is returned, so that the run starts from the beginning.
+func loadResumeState(path string) (*resumeState, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- Intended functionality.
+	if errors.Is(err, os.ErrNotExist) {
+		return &resumeState{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var state resumeState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, err
+	}
+	if state.LinesProcessed < 0 || state.OutputSize < 0 {
+		return nil, errors.New("the resume state file contains negative offsets")
+	}
+	return &state, nil
+}
+
+// saveResumeState writes the checkpoint to a temp file, and then renames it to the given path.
+// This way an interruption in the middle of the write can never leave a corrupted checkpoint behind.
+func saveResumeState(path string, state *resumeState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path, data)
+}
+
+// writeFileAtomically replaces the file at the given path with the data.
+// The data is written into a temp file that is then renamed, so that the file can't be left half-written if the program gets interrupted.
+func writeFileAtomically(path string, data []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name()) // #nosec G104 -- We're already returning an error.
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+// numberLines numbers every line received from the given channel, starting at 0.
+// The first skipLines lines are discarded, since they were already processed by a previous run.
+func numberLines(lines <-chan string, skipLines int) <-chan numberedLine {
+	out := make(chan numberedLine, 128)
+
+	go func() {
+		index := 0
+		for line := range lines {
+			if index >= skipLines {
+				out <- numberedLine{index: index, line: line}
+			}
+			index++
+		}
+		close(out)
+	}()
+
+	return out
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Amount of rules listed by the --rule-timings report
+const ruleTimingsReportSize = 10
+
+// Set with "--rule-timings". It's nil otherwise, so that the matching loop only pays for a nil check.
+var ruleTimer *ruleTimings
+
+// ruleTimings measures how long every scope rule takes to be matched against the targets, so that slow rules (usually pathological regexes) can be found in huge rule sets.
+// Only the matches against URLs, hostnames and email addresses are measured, since matching IP addresses takes constant time.
+type ruleTimings struct {
+	// The *ruleTiming of every scope
+	rules sync.Map
+}
+
+type ruleTiming struct {
+	scope       interface{}
+	nanoseconds atomic.Int64
+	matches     atomic.Int64
+}
+
+// record adds the time that a single match of the scope took. It's safe for concurrent use.
+func (timings *ruleTimings) record(scope interface{}, elapsed time.Duration) {
+	value, found := timings.rules.Load(scope)
+	if !found {
+		value, _ = timings.rules.LoadOrStore(scope, &ruleTiming{scope: scope})
+	}
+	timing := value.(*ruleTiming)
+	timing.nanoseconds.Add(int64(elapsed))
+	timing.matches.Add(1)
+}
+
+// slowest returns the rules that took the most time in total, up to the given amount.
+func (timings *ruleTimings) slowest(amount int) []*ruleTiming {
+	var rules []*ruleTiming
+	timings.rules.Range(func(_, value any) bool {
+		rules = append(rules, value.(*ruleTiming))
+		return true
+	})
+	slices.SortFunc(rules, func(a, b *ruleTiming) int {
+		return int(b.nanoseconds.Load() - a.nanoseconds.Load())
+	})
+	return rules[:min(amount, len(rules))]
+}
+
+// report lists the slowest rules, like "  12ms total, 1.2µs per match, 10000 matches: ^(a+)+\.example\.com$".
+func (timings *ruleTimings) report() string {
+	var builder strings.Builder
+	builder.WriteString("[INFO]: Slowest scope rules:")
+	for _, timing := range timings.slowest(ruleTimingsReportSize) {
+		total := time.Duration(timing.nanoseconds.Load())
+		matches := timing.matches.Load()
+		builder.WriteString("\n  " + total.Round(time.Microsecond).String() + " total, " + (total / time.Duration(matches)).String() + " per match, " + strconv.FormatInt(matches, 10) + " matches: " + scopeToString(timing.scope))
+	}
+	return builder.String()
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// scopeBundle is a scopes file that also holds the metadata of the program, so that no context is lost when it's shared with a team.
+//
+// Example:
+//
+//	program:
+//	  name: Example
+//	  platform: hackerone
+//	  url: https://hackerone.com/example
+//	notes: |
+//	  Don't test the payment flow.
+//	in_scope:
+//	  - "*.example.com"
+//	  - scope: api.example.com
+//	    description: Public API
+//	    ports: [443, 8443]
+//	    tags: [api, production]
+//	    max_severity: high
+//	out_of_scope:
+//	  - scope: internal.example.com
+//	    description: Staff only
+type scopeBundle struct {
+	Program    scopeBundleProgram
+	Notes      string
+	InScope    []scopeBundleEntry
+	OutOfScope []scopeBundleEntry
+}
+
+type scopeBundleProgram struct {
+	Name     string
+	Platform string
+	URL      string
+}
+
+type scopeBundleEntry struct {
+	Scope   string
+	Details ruleDetails
+}
+
+// readScopeBundle reads and parses the YAML scope bundle at the given path. The path can also be an http(s) URL.
+func readScopeBundle(path string) (*scopeBundle, error) {
+	input, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return parseScopeBundle(string(data))
+}
+
+// loadScopeBundle reads the scope bundle at the given path, and returns its scopes like scopeBundle.scopeLines does. The program details are printed unless chain mode is enabled.
+func loadScopeBundle(path string) (inscopeLines []string, noscopeLines []string, lineDetails map[string]ruleDetails) {
+	bundle, err := readScopeBundle(path)
+	if err != nil {
+		crash(errReadInput, "Error reading the scope bundle "+path, err)
+	}
+	if !chainMode {
+		printScopeBundleDetails(bundle)
+	}
+	return bundle.scopeLines()
+}
+
+// parseScopeBundle parses a YAML scope bundle.
+func parseScopeBundle(data string) (*scopeBundle, error) {
+	root, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	rootMap, ok := root.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("a scope bundle must be a mapping with the \"program\", \"notes\", \"in_scope\" and \"out_of_scope\" keys")
+	}
+
+	bundle := &scopeBundle{}
+	for key, value := range rootMap {
+		switch key {
+		case "program":
+			program, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("\"program\" must be a mapping")
+			}
+			bundle.Program.Name, _ = program["name"].(string)
+			bundle.Program.Platform, _ = program["platform"].(string)
+			bundle.Program.URL, _ = program["url"].(string)
+		case "notes":
+			bundle.Notes, ok = value.(string)
+			if !ok {
+				return nil, errors.New("\"notes\" must be a string")
+			}
+		case "in_scope":
+			bundle.InScope, err = parseScopeBundleEntries(key, value)
+		case "out_of_scope":
+			bundle.OutOfScope, err = parseScopeBundleEntries(key, value)
+		default:
+			return nil, errors.New("unknown key \"" + key + "\"")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(bundle.InScope) == 0 {
+		return nil, errors.New("the scope bundle doesn't have any in_scope entries")
+	}
+	return bundle, nil
+}
+
+// parseScopeBundleEntries parses the list of entries of the in_scope or out_of_scope keys.
+// Every entry is either a scope, or a mapping with the scope and its attributes.
+func parseScopeBundleEntries(key string, value interface{}) ([]scopeBundleEntry, error) {
+	if value == "" {
+		return nil, nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.New("\"" + key + "\" must be a list")
+	}
+
+	var entries []scopeBundleEntry
+	for _, item := range items {
+		switch assertedItem := item.(type) {
+		case string:
+			entries = append(entries, scopeBundleEntry{Scope: assertedItem})
+		case map[string]interface{}:
+			var entry scopeBundleEntry
+			for attribute, attributeValue := range assertedItem {
+				var err error
+				switch attribute {
+				case "scope":
+					entry.Scope, _ = attributeValue.(string)
+				case "description":
+					entry.Details.Description, _ = attributeValue.(string)
+				case "max_severity":
+					entry.Details.MaxSeverity, _ = attributeValue.(string)
+				case "tags":
+					entry.Details.Tags, err = yamlStringList(attributeValue)
+				case "ports":
+					entry.Details.Ports, err = yamlPortList(attributeValue)
+				default:
+					err = errors.New("unknown attribute \"" + attribute + "\"")
+				}
+				if err != nil {
+					return nil, errors.New("invalid entry in \"" + key + "\": " + err.Error())
+				}
+			}
+			if entry.Scope == "" {
+				return nil, errors.New("an entry in \"" + key + "\" doesn't have a scope")
+			}
+			entries = append(entries, entry)
+		default:
+			return nil, errors.New("invalid entry in \"" + key + "\"")
+		}
+	}
+	return entries, nil
+}
+
+// parseYAML parses a single YAML document, for the scope bundles, the profiles, the .hacker-scoper files and the config file.
+// Mappings are returned as map[string]interface{}, sequences as []interface{}, and every scalar as a string, with null as an empty string.
+func parseYAML(data string) (interface{}, error) {
+	var document yaml.Node
+	err := yaml.Unmarshal([]byte(data), &document)
+	if err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		return "", nil
+	}
+	return yamlNodeValue(document.Content[0]), nil
+}
+
+func yamlNodeValue(node *yaml.Node) interface{} {
+	switch node.Kind {
+	case yaml.MappingNode:
+		mapping := make(map[string]interface{}, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			mapping[node.Content[i].Value] = yamlNodeValue(node.Content[i+1])
+		}
+		return mapping
+	case yaml.SequenceNode:
+		sequence := make([]interface{}, 0, len(node.Content))
+		for _, item := range node.Content {
+			sequence = append(sequence, yamlNodeValue(item))
+		}
+		return sequence
+	case yaml.AliasNode:
+		return yamlNodeValue(node.Alias)
+	}
+	if node.Tag == "!!null" {
+		return ""
+	}
+	return node.Value
+}
+
+// yamlStringList accepts either a list of strings, or a single string.
+func yamlStringList(value interface{}) ([]string, error) {
+	switch assertedValue := value.(type) {
+	case string:
+		return []string{assertedValue}, nil
+	case []interface{}:
+		list := make([]string, 0, len(assertedValue))
+		for _, item := range assertedValue {
+			str, ok := item.(string)
+			if !ok {
+				return nil, errors.New("expected a list of strings")
+			}
+			list = append(list, str)
+		}
+		return list, nil
+	}
+	return nil, errors.New("expected a list of strings")
+}
+
+// yamlPortList accepts either a list of ports, or a single port.
+func yamlPortList(value interface{}) ([]int, error) {
+	strs, err := yamlStringList(value)
+	if err != nil {
+		return nil, errors.New("expected a list of ports")
+	}
+	ports := make([]int, 0, len(strs))
+	for _, str := range strs {
+		port, err := strconv.Atoi(str)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, errors.New("invalid port \"" + str + "\"")
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// scopeLines returns the scopes of the bundle in the same format as the lines of the .inscope and .noscope files, together with the details of every line.
+func (bundle *scopeBundle) scopeLines() (inscopeLines []string, noscopeLines []string, lineDetails map[string]ruleDetails) {
+	lineDetails = map[string]ruleDetails{}
+	toLines := func(entries []scopeBundleEntry) []string {
+		var lines []string
+		for _, entry := range entries {
+			// Hashes in the scope aren't comments
+			lines = append(lines, strings.ReplaceAll(entry.Scope, "#", "\\#"))
+			lineDetails[entry.Scope] = entry.Details
+		}
+		return lines
+	}
+	return toLines(bundle.InScope), toLines(bundle.OutOfScope), lineDetails
+}
+
+// printScopeBundleDetails prints the metadata of a scope bundle in a readable format
+func printScopeBundleDetails(bundle *scopeBundle) {
+	if bundle.Program.Name != "" {
+		fmt.Println("[+] Program: " + bundle.Program.Name)
+	}
+	if bundle.Program.Platform != "" {
+		fmt.Println("[+] Platform: " + bundle.Program.Platform)
+	}
+	if bundle.Program.URL != "" {
+		fmt.Println("[+] URL: " + bundle.Program.URL)
+	}
+	if bundle.Notes != "" {
+		fmt.Println("[+] Notes:")
+		for _, line := range strings.Split(strings.TrimRight(bundle.Notes, "\n"), "\n") {
+			fmt.Println("    " + line)
+		}
+	}
+	fmt.Println("[+] Found " + strconv.Itoa(len(bundle.InScope)) + " in-scope and " + strconv.Itoa(len(bundle.OutOfScope)) + " out-of-scope entries in the scope bundle")
+}
+
+// writeScopeBundle writes the bundle in YAML.
+func writeScopeBundle(w io.Writer, bundle *scopeBundle) error {
+	var builder strings.Builder
+	builder.WriteString("program:\n")
+	builder.WriteString("  name: " + strconv.Quote(bundle.Program.Name) + "\n")
+	builder.WriteString("  platform: " + strconv.Quote(bundle.Program.Platform) + "\n")
+	builder.WriteString("  url: " + strconv.Quote(bundle.Program.URL) + "\n")
+	if bundle.Notes != "" {
+		builder.WriteString("notes: |\n")
+		for _, line := range strings.Split(strings.TrimRight(bundle.Notes, "\n"), "\n") {
+			builder.WriteString("  " + line + "\n")
+		}
+	}
+
+	writeEntries := func(key string, entries []scopeBundleEntry) {
+		if len(entries) == 0 {
+			builder.WriteString(key + ": []\n")
+			return
+		}
+		builder.WriteString(key + ":\n")
+		for _, entry := range entries {
+			builder.WriteString("  - scope: " + strconv.Quote(entry.Scope) + "\n")
+			if entry.Details.Description != "" {
+				builder.WriteString("    description: " + strconv.Quote(entry.Details.Description) + "\n")
+			}
+			if len(entry.Details.Ports) > 0 {
+				ports := make([]string, len(entry.Details.Ports))
+				for i, port := range entry.Details.Ports {
+					ports[i] = strconv.Itoa(port)
+				}
+				builder.WriteString("    ports: [" + strings.Join(ports, ", ") + "]\n")
+			}
+			if len(entry.Details.Tags) > 0 {
+				tags := make([]string, len(entry.Details.Tags))
+				for i, tag := range entry.Details.Tags {
+					tags[i] = strconv.Quote(tag)
+				}
+				builder.WriteString("    tags: [" + strings.Join(tags, ", ") + "]\n")
+			}
+			if entry.Details.MaxSeverity != "" {
+				builder.WriteString("    max_severity: " + strconv.Quote(entry.Details.MaxSeverity) + "\n")
+			}
+		}
+	}
+	writeEntries("in_scope", bundle.InScope)
+	writeEntries("out_of_scope", bundle.OutOfScope)
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// programToScopeBundle converts a firebounty program into a scope bundle.
+// Like in the company lookups, only the "web_application" scopes are included.
+func programToScopeBundle(prog *Program) *scopeBundle {
+	bundle := &scopeBundle{
+		Program: scopeBundleProgram{Name: prog.Name, Platform: prog.Tag, URL: prog.Url},
+	}
+	if prog.Firebounty_url != "" {
+		bundle.Notes = "Exported from " + prog.Firebounty_url + "\n"
+	}
+	for _, scope := range prog.Scopes.In_scopes {
+		if scope.Scope_type == "web_application" && scope.Scope != "" {
+			bundle.InScope = append(bundle.InScope, scopeBundleEntry{Scope: scope.Scope})
+		}
+	}
+	for _, scope := range prog.Scopes.Out_of_scopes {
+		if scope.Scope_type == "web_application" && scope.Scope != "" {
+			bundle.OutOfScope = append(bundle.OutOfScope, scopeBundleEntry{Scope: scope.Scope})
+		}
+	}
+	return bundle
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// checkResponse is the response of the GET /check endpoint of --serve.
+type checkResponse struct {
+	Target string `json:"target"`
+	// "inscope", "outofscope", "unsure", "related" or "invalid"
+	Verdict     string   `json:"verdict"`
+	Rule        string   `json:"rule,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Ports       []int    `json:"ports,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	MaxSeverity string   `json:"max_severity,omitempty"`
+	Sources     []string `json:"sources,omitempty"`
+	// The pieces of the target, like its host and port. Invalid targets don't have them.
+	Parsed *targetComponents `json:"parsed,omitempty"`
+	// The digest of the --database-snapshot, like "sha256:..."
+	Database string `json:"database,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// checkServer answers scope checks over HTTP, so that proxy extensions (Burp, Caido, etc) can color the requests by their verdict in real time.
+type checkServer struct {
+	inscopeScopes        []interface{}
+	noscopeScopes        []interface{}
+	inscopeExplicitLevel int
+	noscopeExplicitLevel int
+	// Set with --mark-related
+	related relatedDomains
+	// If set, requests must have an "Authorization: Bearer <token>" header
+	token string
+}
+
+// check returns the verdict of a single target.
+func (server *checkServer) check(rawTarget string) checkResponse {
+	response := checkResponse{Target: rawTarget, Database: databaseSnapshotDigest}
+	target, err := parseTarget(strings.TrimSpace(rawTarget))
+	if err != nil {
+		response.Verdict = "invalid"
+		return response
+	}
+	components := getTargetComponents(target)
+	response.Parsed = &components
+
+	prepared := prepareTarget(target)
+	if isOutOfScope(&server.noscopeScopes, prepared, &server.noscopeExplicitLevel) {
+		response.Verdict = "outofscope"
+		return response
+	}
+	matchedScope := findMatchingScope(&server.inscopeScopes, prepared, &server.inscopeExplicitLevel)
+	response.Verdict = "inscope"
+	if matchedScope == nil && server.related != nil {
+		matchedScope = server.related.find(target)
+		response.Verdict = "related"
+	}
+	if matchedScope == nil {
+		response.Verdict = "unsure"
+		return response
+	}
+
+	details := scopeDetails[matchedScope]
+	response.Rule = scopeToString(matchedScope)
+	response.Description = details.Description
+	response.Ports = details.Ports
+	response.Tags = details.Tags
+	response.MaxSeverity = details.MaxSeverity
+	response.Sources = details.Sources
+	return response
+}
+
+// ServeHTTP handles the GET /check?target=... endpoint. Every response is a JSON object.
+func (server *checkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+
+	if r.URL.Path != "/check" {
+		w.WriteHeader(http.StatusNotFound)
+		encoder.Encode(checkResponse{Error: "not found. Use GET /check?target=..."}) // #nosec G104 -- The client is gone if the response can't be written.
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		encoder.Encode(checkResponse{Error: "method not allowed"}) // #nosec G104 -- The client is gone if the response can't be written.
+		return
+	}
+	if server.token != "" {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(server.token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			encoder.Encode(checkResponse{Error: "invalid token"}) // #nosec G104 -- The client is gone if the response can't be written.
+			return
+		}
+	}
+
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(checkResponse{Error: "missing the target parameter"}) // #nosec G104 -- The client is gone if the response can't be written.
+		return
+	}
+	encoder.Encode(server.check(target)) // #nosec G104 -- The client is gone if the response can't be written.
+}
+
+// serveChecks listens on the given address until the context is cancelled. The requests that are being answered are given a few seconds to finish, and their contexts are cancelled too.
+func serveChecks(ctx context.Context, address string, server *checkServer) error {
+	httpServer := &http.Server{
+		Addr:              address,
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	stopped := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stopped <- httpServer.Shutdown(shutdownCtx)
+	}()
+
+	err := httpServer.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return <-stopped
+	}
+	return err
+}
+
+// isLoopbackAddress reports whether the listen address is only reachable from this machine.
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
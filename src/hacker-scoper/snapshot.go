@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Set with "--database-snapshot". Path to a pinned copy of the firebounty database, which is used as it is and never refreshed.
+var databaseSnapshotPath string
+
+// databaseSnapshotDigest is the "sha256:<hex>" of the pinned database, recorded in the output so that the scope decisions can be reproduced later. Empty without --database-snapshot.
+var databaseSnapshotDigest string
+
+// fileSHA256 returns the hex SHA-256 of a file.
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path) // #nosec G304 -- The path is the database path.
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// setupDatabaseSnapshot makes the pinned database the database of this run, and computes its digest.
+// --database-snapshot replaces --database, so they can't be used together.
+func setupDatabaseSnapshot(databaseFolder string) {
+	if databaseFolder != "" {
+		crash(errInvalidArguments, "--database-snapshot and --database can't be used together", errors.New("conflicting database arguments"))
+	}
+	digest, err := fileSHA256(databaseSnapshotPath)
+	if err != nil {
+		crash(errDatabase, "Unable to read the database snapshot \""+databaseSnapshotPath+"\"", err)
+	}
+	firebountyJSONPath = databaseSnapshotPath
+	databaseSnapshotDigest = "sha256:" + digest
+	if !chainMode {
+		fmt.Println("[INFO]: Using the database snapshot \"" + databaseSnapshotPath + "\" (" + databaseSnapshotDigest + "). It will never be updated.")
+	}
+}
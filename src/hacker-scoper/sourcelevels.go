@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Set with "--firebounty-explicit-level" and "--file-explicit-level", or with the "explicit-levels" setting of the config file.
+// The in-scope entries of the firebounty programs, and of every other source (the scopes files, --scope, scope bundles, plugins, etc), are matched with these levels instead of --inscope-explicit-level.
+// noSourceExplicitLevel when they aren't set.
+var firebountyExplicitLevel, fileExplicitLevel int
+
+// The value of the per-source levels that aren't set
+const noSourceExplicitLevel = -1
+
+// explicitLevelOverrides holds the explicit level of the in-scope scopes whose source has its own level, keyed by the parsed scope. It's nil when no source has its own level.
+// Like scopeDetails, it's filled before any target is processed, and only read afterwards.
+var explicitLevelOverrides map[interface{}]int
+
+// scopeExplicitLevel returns the explicit level that a scope is matched with: the level of its source, if it has one, or the given level otherwise.
+func scopeExplicitLevel(scope interface{}, explicitLevel int) int {
+	if explicitLevelOverrides == nil {
+		return explicitLevel
+	}
+	if level, isOverridden := explicitLevelOverrides[scope]; isOverridden {
+		return level
+	}
+	return explicitLevel
+}
+
+// configSourceExplicitLevels reads the per-source levels of the config file, like:
+//
+//	explicit-levels:
+//	  firebounty: 3
+//	  files: 0
+//
+// The levels that aren't set are returned as noSourceExplicitLevel. Invalid levels are ignored with a warning.
+func configSourceExplicitLevels(config map[string]interface{}) (firebountyLevel int, fileLevel int) {
+	firebountyLevel, fileLevel = noSourceExplicitLevel, noSourceExplicitLevel
+	levels, _ := config["explicit-levels"].(map[string]interface{})
+	for _, source := range []struct {
+		name  string
+		level *int
+	}{{"firebounty", &firebountyLevel}, {"files", &fileLevel}} {
+		rawLevel, isSet := levels[source.name].(string)
+		if !isSet {
+			continue
+		}
+		level, err := strconv.Atoi(strings.TrimSpace(rawLevel))
+		if err != nil || !ExplicitLevel(level).isValid() {
+			warning(warnInvalidConfig, "Invalid \""+source.name+"\" explicit level \""+rawLevel+"\" in the config file. Valid levels are 0, 1, 2 and 3.")
+			continue
+		}
+		*source.level = level
+	}
+	return firebountyLevel, fileLevel
+}
+
+// newExplicitLevelOverrides returns the explicit levels of the in-scope scopes whose source has its own level. The firebounty sources are the names of the programs whose scopes were loaded.
+// The scopes that were contributed by both kinds of sources, and the hostnames that are also out of scope, keep the --inscope-explicit-level, so that the out-of-scope entries are never matched with another level.
+// It returns nil if no source has its own level.
+func newExplicitLevelOverrides(inscopeScopes []interface{}, noscopeScopes []interface{}, firebountySources map[string]bool, firebountyLevel int, fileLevel int) map[interface{}]int {
+	if firebountyLevel == noSourceExplicitLevel && fileLevel == noSourceExplicitLevel {
+		return nil
+	}
+	noscopeHostnames := map[string]bool{}
+	for _, scope := range noscopeScopes {
+		if hostname, isHostname := scope.(string); isHostname {
+			noscopeHostnames[hostname] = true
+		}
+	}
+
+	overrides := map[interface{}]int{}
+	for _, scope := range inscopeScopes {
+		if hostname, isHostname := scope.(string); isHostname && noscopeHostnames[hostname] {
+			continue
+		}
+		sources := scopeDetails[scope].Sources
+		if len(sources) == 0 {
+			continue
+		}
+		isFromFirebounty, isFromFiles := false, false
+		for _, source := range sources {
+			if firebountySources[source] {
+				isFromFirebounty = true
+			} else {
+				isFromFiles = true
+			}
+		}
+		switch {
+		case isFromFirebounty && !isFromFiles && firebountyLevel != noSourceExplicitLevel:
+			overrides[scope] = firebountyLevel
+		case isFromFiles && !isFromFirebounty && fileLevel != noSourceExplicitLevel:
+			overrides[scope] = fileLevel
+		}
+	}
+	return overrides
+}
+
+// validateSourceExplicitLevel returns an error if a per-source level is set to an unknown level.
+func validateSourceExplicitLevel(level int) error {
+	if level != noSourceExplicitLevel && !ExplicitLevel(level).isValid() {
+		return errors.New("unknown explicit level " + strconv.Itoa(level))
+	}
+	return nil
+}
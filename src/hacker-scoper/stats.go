@@ -0,0 +1,102 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Amount of rules listed by --stats, unless --stats-top says otherwise
+const defaultStatsTopRules = 10
+
+// runStats counts the results of a run, for --stats and --fail-on-out-of-scope.
+type runStats struct {
+	started   time.Time
+	processed int64
+	inscope   int64
+	unsure    int64
+	// The unsure results that are related to an in-scope rule, with --mark-related
+	related    int64
+	outOfScope int64
+	invalid    int64
+	// The amount of in-scope results of every rule
+	ruleHits map[interface{}]int64
+}
+
+// ruleHit is the amount of in-scope results of a rule.
+type ruleHit struct {
+	scope interface{}
+	hits  int64
+}
+
+// add counts the result of a target.
+func (stats *runStats) add(res targetResult) {
+	stats.processed++
+	switch {
+	case res.err != nil:
+		stats.invalid++
+	case res.isInsideScope && res.isUnsure:
+		stats.unsure++
+		if res.isRelated {
+			stats.related++
+		}
+	case res.isInsideScope:
+		stats.inscope++
+		// Without any in-scope rules, the results don't have a rule
+		if res.matchedScope != nil {
+			if stats.ruleHits == nil {
+				stats.ruleHits = map[interface{}]int64{}
+			}
+			stats.ruleHits[res.matchedScope]++
+		}
+	case res.isUnmatched:
+		stats.unsure++
+	default:
+		stats.outOfScope++
+	}
+}
+
+// String returns the summary of the run, like "[STATS]: 1000 targets in 1.5s: 800 in scope, 10 unsure, 150 out of scope, 40 invalid".
+// The related results are counted among the unsure ones, like "10 unsure (3 related)".
+func (stats *runStats) String() string {
+	unsure := strconv.FormatInt(stats.unsure, 10) + " unsure"
+	if stats.related > 0 {
+		unsure += " (" + strconv.FormatInt(stats.related, 10) + " related)"
+	}
+	return "[STATS]: " + strconv.FormatInt(stats.processed, 10) + " targets in " + time.Since(stats.started).Round(time.Millisecond).String() + ": " +
+		strconv.FormatInt(stats.inscope, 10) + " in scope, " +
+		unsure + ", " +
+		strconv.FormatInt(stats.outOfScope, 10) + " out of scope, " +
+		strconv.FormatInt(stats.invalid, 10) + " invalid"
+}
+
+// topRules returns the rules with the most in-scope results, up to the given amount. Rules with the same amount of results are sorted by their scope line, so that the report is stable.
+func (stats *runStats) topRules(amount int) []ruleHit {
+	var rules []ruleHit
+	for scope, hits := range stats.ruleHits {
+		rules = append(rules, ruleHit{scope: scope, hits: hits})
+	}
+	slices.SortFunc(rules, func(a, b ruleHit) int {
+		if a.hits != b.hits {
+			return int(b.hits - a.hits)
+		}
+		return strings.Compare(scopeToString(a.scope), scopeToString(b.scope))
+	})
+	return rules[:min(amount, len(rules))]
+}
+
+// rulesReport lists the rules with the most in-scope results, like "  800 (80.0%): *.example.com". It returns "" if no rule matched any target.
+func (stats *runStats) rulesReport(amount int) string {
+	rules := stats.topRules(amount)
+	if len(rules) == 0 {
+		return ""
+	}
+	var builder strings.Builder
+	builder.WriteString("[STATS]: Top " + strconv.Itoa(len(rules)) + " of " + strconv.Itoa(len(stats.ruleHits)) + " rules by in-scope results:")
+	for _, rule := range rules {
+		percentage := strconv.FormatFloat(float64(rule.hits)*100/float64(stats.inscope), 'f', 1, 64)
+		builder.WriteString("\n  " + strconv.FormatInt(rule.hits, 10) + " (" + percentage + "%): " + scopeToString(rule.scope))
+	}
+	return builder.String()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The colors of the decorated output. They can be changed with the "color-theme" and "colors" settings of the config file.
+var (
+	colorReset = "\033[0m"
+	// The in-scope results, and the other good news
+	colorGood = "\033[38;2;37;255;36m"
+	// The warnings and the unsure results
+	colorWarning = "\033[33m"
+	// The errors
+	colorError = "\033[38;2;255;0;0m"
+	// The headings of the usage
+	colorInfo = "\033[38;2;0;204;255m"
+)
+
+// colorTheme is a set of colors for the decorated output, as ANSI escape sequences.
+type colorTheme struct {
+	good    string
+	warning string
+	error   string
+	info    string
+}
+
+// The themes that can be selected with "color-theme" in the config file
+var colorThemes = map[string]colorTheme{
+	"default": {good: colorGood, warning: colorWarning, error: colorError, info: colorInfo},
+	// The Okabe-Ito palette, which can be told apart with every kind of color blindness: blue, orange, vermillion and sky blue
+	"colorblind": {good: "\033[38;2;0;114;178m", warning: "\033[38;2;230;159;0m", error: "\033[38;2;213;94;0m", info: "\033[38;2;86;180;233m"},
+	// For the terminals without truecolor support
+	"16-color": {good: "\033[32m", warning: "\033[33m", error: "\033[31m", info: "\033[36m"},
+	"none":     {},
+}
+
+// The 16 colors that every terminal supports, with their ANSI foreground codes
+var ansiColorCodes = map[string]int{
+	"black": 30, "red": 31, "green": 32, "yellow": 33, "blue": 34, "magenta": 35, "cyan": 36, "white": 37,
+	"bright-black": 90, "bright-red": 91, "bright-green": 92, "bright-yellow": 93, "bright-blue": 94, "bright-magenta": 95, "bright-cyan": 96, "bright-white": 97,
+}
+
+var hexColorRegex = regexp.MustCompile(`^#([0-9a-fA-F]{2})([0-9a-fA-F]{2})([0-9a-fA-F]{2})$`)
+
+// parseColor returns the ANSI escape sequence of a color of the config file, which can be one of the 16 ANSI colors (like "green" or "bright-red"), a truecolor hex code (like "#25ff24"), or "none".
+func parseColor(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "none" {
+		return "", nil
+	}
+	if code, isANSI := ansiColorCodes[value]; isANSI {
+		return "\033[" + strconv.Itoa(code) + "m", nil
+	}
+	if match := hexColorRegex.FindStringSubmatch(value); match != nil {
+		var channels []string
+		for _, hexChannel := range match[1:] {
+			channel, _ := strconv.ParseUint(hexChannel, 16, 8) // #nosec G104 -- The regex only matches hex digits.
+			channels = append(channels, strconv.FormatUint(channel, 10))
+		}
+		return "\033[38;2;" + strings.Join(channels, ";") + "m", nil
+	}
+	return "", errors.New("unknown color \"" + value + "\". Use an ANSI color name (like \"green\" or \"bright-red\"), a hex code (like \"#25ff24\"), or \"none\"")
+}
+
+// applyColorTheme sets the colors of the decorated output from the "color-theme" and "colors" settings of the config file, like:
+//
+//	color-theme: colorblind
+//	colors:
+//	  warning: bright-yellow
+//
+// Invalid settings are ignored with a warning.
+func applyColorTheme(config map[string]interface{}) {
+	theme := colorThemes["default"]
+	if name, isSet := config["color-theme"].(string); isSet {
+		if selected, isKnown := colorThemes[name]; isKnown {
+			theme = selected
+		} else {
+			var names []string
+			for known := range colorThemes {
+				names = append(names, known)
+			}
+			sort.Strings(names)
+			warning(warnInvalidConfig, "Unknown color-theme \""+name+"\" in the config file. Valid themes are \""+strings.Join(names, "\", \"")+"\".")
+		}
+	}
+
+	overrides, _ := config["colors"].(map[string]interface{})
+	for _, color := range []struct {
+		name  string
+		value *string
+	}{{"good", &theme.good}, {"warning", &theme.warning}, {"error", &theme.error}, {"info", &theme.info}} {
+		rawColor, isSet := overrides[color.name].(string)
+		if !isSet {
+			continue
+		}
+		parsed, err := parseColor(rawColor)
+		if err != nil {
+			warning(warnInvalidConfig, "Invalid \""+color.name+"\" color in the config file: "+err.Error())
+			continue
+		}
+		*color.value = parsed
+	}
+
+	colorGood, colorWarning, colorError, colorInfo = theme.good, theme.warning, theme.error, theme.info
+	// Without any colors, nothing has to be reset either
+	colorReset = "\033[0m"
+	if theme == (colorTheme{}) {
+		colorReset = ""
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The installed version of hacker-scoper
+const currentVersion = "6.2.0"
+
+// The GitHub API endpoint of the latest release
+const latestReleaseURL = "https://api.github.com/repos/ItsIgnacioPortal/hacker-scoper/releases/latest"
+
+// updateCheck is the result of the last update check. It's saved next to the database, so that GitHub is asked at most once a day.
+type updateCheck struct {
+	Time          time.Time `json:"time"`
+	LatestVersion string    `json:"latest_version"`
+}
+
+// updateCheckPath returns the path of the file where the last update check is remembered.
+func updateCheckPath() string {
+	return filepath.Join(filepath.Dir(firebountyJSONPath), "update-check.json")
+}
+
+// configPath returns the path of the config file, next to the profiles folder:
+// $XDG_CONFIG_HOME/hacker-scoper/config.yaml on Linux, ~/Library/Application Support/hacker-scoper/config.yaml on MacOS, and %APPDATA%\hacker-scoper\config.yaml on Windows.
+func configPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "hacker-scoper", "config.yaml"), nil
+}
+
+// readConfig returns the settings of the config file. It returns nil if there's no config file, or if it can't be parsed.
+func readConfig() map[string]interface{} {
+	path, err := configPath()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- The path is derived from the config directory of the user.
+	if err != nil {
+		return nil
+	}
+	root, err := parseYAML(string(data))
+	if err != nil {
+		warning(warnFile, "Unable to parse the config file at \""+path+"\": "+err.Error())
+		return nil
+	}
+	config, _ := root.(map[string]interface{})
+	return config
+}
+
+// updateCheckIsEnabled reports whether the user opted in to the update check. It's disabled unless the config file contains "update-check: true",
+// so that hacker-scoper never contacts GitHub without being asked to.
+func updateCheckIsEnabled(config map[string]interface{}) bool {
+	value, _ := config["update-check"].(string)
+	return strings.EqualFold(strings.TrimSpace(value), "true")
+}
+
+// notifyIfOutdated prints a one-line notice if a newer version of hacker-scoper has been released.
+// GitHub is asked at most once a day. Any error is ignored, since the update check must never get in the way.
+func notifyIfOutdated(ctx context.Context) {
+	path := updateCheckPath()
+	var check updateCheck
+	data, err := os.ReadFile(path) // #nosec G304 -- The path is derived from the database path.
+	if err != nil || json.Unmarshal(data, &check) != nil || time.Since(check.Time) > 24*time.Hour {
+		// Failed checks are remembered too, so that an offline machine isn't delayed on every run
+		latestVersion, err := fetchLatestVersion(ctx)
+		if err != nil {
+			latestVersion = check.LatestVersion
+		}
+		check = updateCheck{Time: time.Now(), LatestVersion: latestVersion}
+		if data, err := json.Marshal(check); err == nil {
+			writeFileAtomically(path, data) // #nosec G104 -- The check is simply repeated on the next run.
+		}
+	}
+
+	if isNewerVersion(check.LatestVersion, currentVersion) {
+		fmt.Println("[INFO]: hacker-scoper " + check.LatestVersion + " is available (installed: v" + currentVersion + "). Download it from https://github.com/ItsIgnacioPortal/hacker-scoper/releases")
+	}
+}
+
+// fetchLatestVersion returns the tag of the latest hacker-scoper release on GitHub.
+func fetchLatestVersion(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	// A short timeout, so that a slow network doesn't delay the startup
+	resp, err := newHTTPClient(3 * time.Second).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("unexpected status " + resp.Status)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&release)
+	if err != nil {
+		return "", err
+	}
+	if release.TagName == "" {
+		return "", errors.New("the latest release doesn't have a tag")
+	}
+	return release.TagName, nil
+}
+
+// isNewerVersion reports whether the version "latest" (like "v6.3.0") is newer than "current" (like "6.2.0").
+// Pre-release suffixes like "-beta" are ignored.
+func isNewerVersion(latest string, current string) bool {
+	latestParts := versionNumbers(latest)
+	currentParts := versionNumbers(current)
+	if latestParts == nil || currentParts == nil {
+		return false
+	}
+	for i := range max(len(latestParts), len(currentParts)) {
+		var latestPart, currentPart int
+		if i < len(latestParts) {
+			latestPart = latestParts[i]
+		}
+		if i < len(currentParts) {
+			currentPart = currentParts[i]
+		}
+		if latestPart != currentPart {
+			return latestPart > currentPart
+		}
+	}
+	return false
+}
+
+// versionNumbers splits a version like "v6.2.0-beta" into its numbers, or returns nil if it isn't a valid version.
+func versionNumbers(version string) []int {
+	version, _, _ = strings.Cut(strings.TrimPrefix(strings.TrimSpace(version), "v"), "-")
+	var numbers []int
+	for _, part := range strings.Split(version, ".") {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return nil
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers
+}
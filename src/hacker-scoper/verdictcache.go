@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// verdictCache remembers the verdicts of the targets across runs, so that re-runs over mostly-unchanged targets only evaluate the new ones.
+// The verdicts are only valid for the exact same scopes and options, so they're discarded when the hash of the scopes changes.
+type verdictCache struct {
+	ScopeHash string                   `json:"scope_hash"`
+	Verdicts  map[string]cachedVerdict `json:"verdicts"`
+
+	mutex sync.Mutex
+	// The in-scope scopes by their text, to turn the cached rules back into scopes
+	scopesByRule map[string]interface{}
+	hits         int
+	// Set with --max-memory. Once it runs out, the new verdicts aren't cached anymore.
+	budget *memoryBudget
+	isFull bool
+}
+
+// cachedVerdict is the result of parseScopes for a single target.
+type cachedVerdict struct {
+	InScope   bool   `json:"inscope,omitempty"`
+	Unsure    bool   `json:"unsure,omitempty"`
+	Unmatched bool   `json:"unmatched,omitempty"`
+	Rule      string `json:"rule,omitempty"`
+}
+
+// scopeMatchingOptions are the arguments that change the verdicts of parseScopes, besides the scopes themselves.
+type scopeMatchingOptions struct {
+	inscopeExplicitLevel   int
+	noscopeExplicitLevel   int
+	includeUnsure          bool
+	allowCIDRTargets       bool
+	caseInsensitiveRegexes bool
+	unanchoredWildcards    bool
+}
+
+// hashScopes returns a hash of everything that affects the verdicts of parseScopes.
+func hashScopes(inscopeScopes []interface{}, noscopeScopes []interface{}, options scopeMatchingOptions) string {
+	hash := sha256.New()
+	fmt.Fprintln(hash, "levels", options.inscopeExplicitLevel, options.noscopeExplicitLevel, options.includeUnsure)
+	// The older caches don't tell the unmatched targets apart from the out-of-scope ones, so they're discarded
+	fmt.Fprintln(hash, "unmatched")
+	// Only hashed when enabled, so that the caches of older versions stay valid
+	if options.allowCIDRTargets {
+		fmt.Fprintln(hash, "cidr-targets")
+	}
+	// The (?i) of the case-insensitive regexes isn't part of scopeToString, so it's hashed on its own
+	if options.caseInsensitiveRegexes {
+		fmt.Fprintln(hash, "case-insensitive")
+	}
+	// Neither are the anchors of the wildcards, which --unanchored-wildcards drops
+	if options.unanchoredWildcards {
+		fmt.Fprintln(hash, "unanchored-wildcards")
+	}
+	for _, scope := range inscopeScopes {
+		fmt.Fprintf(hash, "inscope %T %q\n", scope, scopeToString(scope))
+		// The levels of the sources are only hashed when they're set, like the CIDR targets
+		if level := scopeExplicitLevel(scope, options.inscopeExplicitLevel); level != options.inscopeExplicitLevel {
+			fmt.Fprintln(hash, "level", level)
+		}
+	}
+	for _, scope := range noscopeScopes {
+		fmt.Fprintf(hash, "noscope %T %q\n", scope, scopeToString(scope))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// loadVerdictCache reads the verdict cache at the given path. If it doesn't exist, or if it was made for different scopes, an empty cache is returned.
+func loadVerdictCache(path string, scopeHash string, inscopeScopes []interface{}) (*verdictCache, error) {
+	cache := &verdictCache{ScopeHash: scopeHash, Verdicts: map[string]cachedVerdict{}, scopesByRule: map[string]interface{}{}}
+	for _, scope := range inscopeScopes {
+		cache.scopesByRule[scopeToString(scope)] = scope
+	}
+
+	data, err := os.ReadFile(path) // #nosec G304 -- Intended functionality.
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var saved verdictCache
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return nil, errors.New("the verdict cache " + path + " is corrupted: " + err.Error())
+	}
+	if saved.ScopeHash == scopeHash && saved.Verdicts != nil {
+		cache.Verdicts = saved.Verdicts
+	}
+	return cache, nil
+}
+
+// get returns the cached verdict of the target, in the same format as parseScopes.
+func (cache *verdictCache) get(target string) (found bool, isInsideScope bool, isUnsure bool, isUnmatched bool, matchedScope interface{}) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	verdict, found := cache.Verdicts[target]
+	if !found {
+		return false, false, false, false, nil
+	}
+	if verdict.Rule != "" {
+		matchedScope, found = cache.scopesByRule[verdict.Rule]
+		if !found {
+			// Can't happen unless the cache was edited by hand, since the rules are part of the hash
+			return false, false, false, false, nil
+		}
+	}
+	cache.hits++
+	return true, verdict.InScope, verdict.Unsure, verdict.Unmatched, matchedScope
+}
+
+// set caches the verdict of parseScopes for the target, unless the memory budget ran out.
+func (cache *verdictCache) set(target string, isInsideScope bool, isUnsure bool, isUnmatched bool, matchedScope interface{}) {
+	verdict := cachedVerdict{InScope: isInsideScope, Unsure: isUnsure, Unmatched: isUnmatched}
+	if matchedScope != nil {
+		verdict.Rule = scopeToString(matchedScope)
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if _, isCached := cache.Verdicts[target]; !isCached && !cache.budget.reserve(verdictSize(target, verdict)) {
+		if !cache.isFull {
+			cache.isFull = true
+			warning(warnMemoryLimit, "The verdict cache reached the --max-memory limit. The verdicts of the rest of the targets won't be cached.")
+		}
+		return
+	}
+	cache.Verdicts[target] = verdict
+}
+
+// limitMemory makes the cache stop growing when the budget runs out. The verdicts that were already loaded are taken from the budget.
+func (cache *verdictCache) limitMemory(budget *memoryBudget) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.budget = budget
+	for target, verdict := range cache.Verdicts {
+		budget.use(verdictSize(target, verdict))
+	}
+}
+
+// verdictSize estimates the memory used by a cached verdict.
+func verdictSize(target string, verdict cachedVerdict) int64 {
+	return int64(len(target) + len(verdict.Rule) + mapEntryOverhead)
+}
+
+// save writes the cache to the given path.
+func (cache *verdictCache) save(path string) error {
+	cache.mutex.Lock()
+	data, err := json.Marshal(cache)
+	cache.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path, data)
+}
+
+// summary describes how many verdicts were reused.
+func (cache *verdictCache) summary() string {
+	return "[+] Reused " + strconv.Itoa(cache.hits) + " cached verdicts. " + strconv.Itoa(len(cache.Verdicts)) + " verdicts are saved in the verdict cache."
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+)
+
+// Set with "--verbose". Every repeated warning is printed, instead of only the first one of each code.
+var verboseWarnings bool
+
+// repeatedWarnings counts the repeated warnings of every code, like the targets that can't be parsed, so that only the first one of each code is printed.
+var repeatedWarnings = struct {
+	sync.Mutex
+	counts map[string]int
+	// The first message of every code
+	firstMessages map[string]string
+	// The codes, in the order of their first warning
+	codes []string
+}{counts: map[string]int{}, firstMessages: map[string]string{}}
+
+// repeatedWarning prints a warning that can be repeated for thousands of input lines, like the warnings about malformed targets.
+// Unless --verbose is set, only the first warning of every code is printed. The rest are counted, and summarized by printWarningSummary at the end of the run.
+func repeatedWarning(code string, message string) {
+	if hideWarnings {
+		return
+	}
+	if verboseWarnings {
+		warning(code, message)
+		return
+	}
+
+	repeatedWarnings.Lock()
+	defer repeatedWarnings.Unlock()
+	repeatedWarnings.counts[code]++
+	if repeatedWarnings.counts[code] == 1 {
+		repeatedWarnings.firstMessages[code] = message
+		repeatedWarnings.codes = append(repeatedWarnings.codes, code)
+		warning(code, message+" Similar warnings will be counted and summarized at the end (use --verbose to show all of them).")
+	}
+}
+
+// printWarningSummary prints how many warnings of every code were hidden by repeatedWarning, and resets the counters.
+func printWarningSummary() {
+	repeatedWarnings.Lock()
+	defer repeatedWarnings.Unlock()
+	for _, code := range repeatedWarnings.codes {
+		if hidden := repeatedWarnings.counts[code] - 1; hidden > 0 {
+			warning(code, strconv.Itoa(hidden)+" more warnings like \""+repeatedWarnings.firstMessages[code]+"\" were hidden. Use --verbose to show all of them.")
+		}
+	}
+	repeatedWarnings.counts = map[string]int{}
+	repeatedWarnings.firstMessages = map[string]string{}
+	repeatedWarnings.codes = nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// whoOwnsCommand searches the whole firebounty database for the programs whose scope covers an asset, to decide where a stray finding should be reported.
+func whoOwnsCommand(ctx context.Context, args []string) {
+	var format string
+	var explicitLevel int
+	var privateTLDsAreEnabled bool
+	var databaseIsUpdating bool
+	var tmpFile *os.File
+
+	flags := newSubcommandFlagSet("who-owns")
+	flags.StringVar(&format, "format", "text", "Output format. Either \"text\" or \"json\".")
+	flags.IntVar(&explicitLevel, "ie", int(ExplicitLevelSubdomains), "Level of explicitness expected. (0/[1]/2/3)")
+	flags.IntVar(&explicitLevel, "inscope-explicit-level", int(ExplicitLevelSubdomains), "Level of explicitness expected. (0/[1]/2/3)")
+	flags.BoolVar(&privateTLDsAreEnabled, "enable-private-tlds", false, "Enable the use of company scope domains with private TLDs.")
+	flags.Parse(args) // #nosec G104 -- The FlagSet exits on errors.
+
+	// The asset can also be given before the flags, like "who-owns example.com --format json"
+	asset := flags.Arg(0)
+	extraArguments := false
+	if flags.NArg() > 1 {
+		flags.Parse(flags.Args()[1:]) // #nosec G104 -- The FlagSet exits on errors.
+		extraArguments = flags.NArg() > 0
+	}
+	setupClientTLS()
+	if asset == "" || extraArguments {
+		fmt.Fprintln(os.Stderr, "Usage: hacker-scoper who-owns ASSET [--format text|json] [--inscope-explicit-level INT] [--enable-private-tlds]")
+		// Exit code 2 = command line syntax error
+		os.Exit(2)
+	}
+	if format != "text" && format != "json" {
+		crash(errInvalidArguments, "Invalid --format selected. Valid formats are \"text\" and \"json\"", errors.New("invalid format "+format))
+	}
+	if !ExplicitLevel(explicitLevel).isValid() {
+		crash(errInvalidArguments, "Invalid --inscope-explicit-level selected", errors.New("invalid explicit level"))
+	}
+	if format == "json" {
+		chainMode = true
+	}
+
+	target, err := parseTarget(strings.TrimSpace(asset))
+	if err != nil {
+		crash(errInvalidArguments, "Unable to parse \""+asset+"\" as a target", err)
+	}
+
+	handleInterrupts(&databaseIsUpdating, &tmpFile)
+	setupFirebountyJSONPath()
+	updateFirebountyJSONIfNeeded(ctx, &databaseIsUpdating, &tmpFile)
+
+	owners, err := findOwners(firebountyJSONPath, target, explicitLevel, privateTLDsAreEnabled)
+	if err != nil {
+		crash(errDatabase, "Unable to search the firebounty database", err)
+	}
+	if len(owners) == 0 {
+		if !chainMode {
+			fmt.Fprintln(os.Stderr, "[-] None of the programs of the database cover \""+asset+"\".")
+		}
+		os.Exit(1)
+	}
+
+	for _, owner := range owners {
+		if format == "json" {
+			encoded, err := json.Marshal(owner)
+			if err != nil {
+				crash(errWriteOutput, "Unable to encode the result as JSON", err)
+			}
+			fmt.Println(string(encoded))
+		} else {
+			fmt.Println(owner.Program + " (" + owner.Slug + ") [" + owner.Rule + "]")
+		}
+	}
+}
+
+// findOwners returns every program of the firebounty database whose scope covers the target, with the rule that matched it.
+// Programs that exclude the target with an out-of-scope entry don't cover it.
+func findOwners(jsonPath string, target interface{}, explicitLevel int, privateTLDsAreEnabled bool) ([]programMatch, error) {
+	// Thousands of programs are parsed, and the warnings about their scopes aren't relevant to the search
+	previousHideWarnings, previousHideMisconfigWarnings := hideWarnings, hideMisconfigWarnings
+	hideWarnings, hideMisconfigWarnings = true, true
+	defer func() { hideWarnings, hideMisconfigWarnings = previousHideWarnings, previousHideMisconfigWarnings }()
+
+	var owners []programMatch
+	var decodeErr error
+	err := iterateRawPrograms(jsonPath, func(index int, rawProgram json.RawMessage) bool {
+		var prog Program
+		decodeErr = json.Unmarshal(rawProgram, &prog)
+		if decodeErr != nil {
+			return false
+		}
+
+		inscopeScopes, err := parseAllLines(webApplicationScopeLines(prog.Scopes.In_scopes), true, privateTLDsAreEnabled, nil)
+		if err != nil {
+			return true
+		}
+		noscopeScopes, _ := parseAllLines(webApplicationScopeLines(prog.Scopes.Out_of_scopes), true, privateTLDsAreEnabled, nil)
+		program := []multiProgram{{name: strings.TrimSpace(prog.Name), slug: prog.Slug, inscopeScopes: inscopeScopes, noscopeScopes: noscopeScopes}}
+		owners = append(owners, matchPrograms(program, target, explicitLevel)...)
+		return true
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	return owners, err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// wildcardDetector finds the in-scope subdomains that only resolve because their apex domain has a wildcard DNS record, like "*.example.com".
+// Those subdomains don't necessarily exist, so they're usually noise.
+type wildcardDetector struct {
+	resolver *dnsClient
+
+	mutex sync.Mutex
+	// The addresses that the wildcard record of every apex domain resolves to. Apex domains without a wildcard record have an empty set.
+	apexes map[string]*wildcardApex
+}
+
+type wildcardApex struct {
+	once      sync.Once
+	addresses map[string]bool
+}
+
+func newWildcardDetector(resolver *dnsClient) *wildcardDetector {
+	return &wildcardDetector{resolver: resolver, apexes: map[string]*wildcardApex{}}
+}
+
+// isWildcardResolved reports whether the hostname is a subdomain that resolves to the same addresses as the wildcard record of its apex domain.
+func (d *wildcardDetector) isWildcardResolved(ctx context.Context, hostname string) bool {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	apexDomain, err := publicsuffix.EffectiveTLDPlusOne(hostname)
+	if err != nil || apexDomain == hostname {
+		return false
+	}
+
+	wildcardAddresses := d.wildcardAddresses(ctx, apexDomain)
+	if len(wildcardAddresses) == 0 {
+		return false
+	}
+	addresses, err := d.resolver.lookupHost(ctx, hostname)
+	if err != nil || len(addresses) == 0 {
+		return false
+	}
+	// Subdomains with their own records resolve to something else
+	for _, address := range addresses {
+		if !wildcardAddresses[address] {
+			return false
+		}
+	}
+	return true
+}
+
+// wildcardAddresses resolves a random subdomain of the apex domain, which only exists if the apex domain has a wildcard record. Every apex domain is only checked once.
+func (d *wildcardDetector) wildcardAddresses(ctx context.Context, apexDomain string) map[string]bool {
+	d.mutex.Lock()
+	apex, found := d.apexes[apexDomain]
+	if !found {
+		apex = &wildcardApex{}
+		d.apexes[apexDomain] = apex
+	}
+	d.mutex.Unlock()
+
+	apex.once.Do(func() {
+		apex.addresses = map[string]bool{}
+		addresses, err := d.resolver.lookupHost(ctx, randomDNSLabel()+"."+apexDomain)
+		if err != nil {
+			return
+		}
+		for _, address := range addresses {
+			apex.addresses[address] = true
+		}
+	})
+	return apex.addresses
+}
+
+// randomDNSLabel returns a subdomain label that is extremely unlikely to exist.
+func randomDNSLabel() string {
+	random := make([]byte, 8)
+	rand.Read(random) // #nosec G104 -- crypto/rand.Read never returns an error.
+	return "hacker-scoper-" + hex.EncodeToString(random)
+}